@@ -9,9 +9,11 @@ import (
 	"log/slog"
 	"maps"
 	mathrand "math/rand/v2"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"runtime"
 	"slices"
 	"sort"
@@ -58,6 +60,12 @@ func _build(tx *bstore.Tx, repoName string, id int32) (Repo, Build) {
 	return r, b
 }
 
+func _schedule(tx *bstore.Tx, repoName string, id int32) Schedule {
+	s, err := bstore.QueryTx[Schedule](tx).FilterNonzero(Schedule{ID: id, RepoName: repoName}).Get()
+	_checkf(err, "get schedule")
+	return s
+}
+
 func _checkPassword(password string) {
 	if password != config.Password {
 		panic(&sherpa.Error{Code: "user:badAuth", Message: "bad password"})
@@ -71,14 +79,25 @@ func _checkPassword(password string) {
 //
 // Low priority builds are executed after regular builds. And only one low
 // priority build is running over all repo's.
-func (Ding) BuildCreate(ctx context.Context, password, repoName, branch, commit string, lowPrio bool) Build {
+//
+// BuildParams sets values for parameters of the repository, other parameters get
+// their default value.
+//
+// A branch of the form "tags/<name>" builds the tag.
+func (Ding) BuildCreate(ctx context.Context, password, repoName, branch, commit string, lowPrio bool, buildParams []Param) Build {
+	return Ding{}.BuildCreateJob(ctx, password, repoName, "", branch, commit, lowPrio, buildParams)
+}
+
+// BuildCreateJob is like BuildCreate, but builds a job of the repository, see
+// Repo.Jobs. An empty job builds the build script of the repository.
+func (Ding) BuildCreateJob(ctx context.Context, password, repoName, job, branch, commit string, lowPrio bool, buildParams []Param) Build {
 	_checkPassword(password)
 
 	if branch == "" {
 		_userError("Branch cannot be empty")
 	}
 
-	repo, build, buildDir, gotoolchains := _prepareBuild(ctx, repoName, branch, commit, lowPrio)
+	repo, build, buildDir, gotoolchains := _prepareBuild(ctx, repoName, branch, commit, lowPrio, buildParams, buildOpts{job: job})
 	go func() {
 		defer func() {
 			if x := recover(); x != nil {
@@ -92,7 +111,7 @@ func (Ding) BuildCreate(ctx context.Context, password, repoName, branch, commit
 
 // CreateBuild exists for compatibility with older "ding kick" behaviour.
 func (Ding) CreateBuild(ctx context.Context, password, repoName, branch, commit string) Build {
-	return Ding{}.BuildCreate(ctx, password, repoName, branch, commit, false)
+	return Ding{}.BuildCreate(ctx, password, repoName, branch, commit, false, nil)
 }
 
 // BuildsCreateLowPrio creates low priority builds for each repository, for the default branch.
@@ -148,7 +167,7 @@ func scheduleLowPrioBuilds(ctx context.Context, newGoToolchain bool) error {
 			}
 		}
 
-		_, build, buildDir, gotoolchains, err := prepareBuild(ctx, repo.Name, repo.DefaultBranch, commit, lowPrio)
+		_, build, buildDir, gotoolchains, err := prepareBuild(ctx, repo.Name, repo.DefaultBranch, commit, lowPrio, nil, buildOpts{})
 		if err != nil {
 			return fmt.Errorf("preparing build: %v", err)
 		}
@@ -177,8 +196,9 @@ func scheduleLowPrioBuilds(ctx context.Context, newGoToolchain bool) error {
 func (Ding) BuildCancel(ctx context.Context, password, repoName string, buildID int32) {
 	_checkPassword(password)
 
+	var b Build
 	_dbwrite(ctx, func(tx *bstore.Tx) {
-		_, b := _build(tx, repoName, buildID)
+		_, b = _build(tx, repoName, buildID)
 		if b.Finish != nil {
 			_userError("Build has already finished")
 		}
@@ -191,17 +211,136 @@ func (Ding) BuildCancel(ctx context.Context, password, repoName string, buildID
 		_checkf(err, "marking build as cancelled in database")
 	})
 
-	// Cancel any commands in the http-serve process, like cloning.
-	buildIDCommandCancel(buildID)
+	// Remove from queue if the build has not started yet.
+	var removed []job
+	jobQueueDo(func(q *jobQueue) {
+		removed = q.remove(func(j job) bool { return j.buildID == buildID })
+	})
+	if len(removed) > 0 {
+		// The build will not be finished by the build goroutine, so we send the event.
+		events <- EventBuild{b}
+	}
 
-	// And cancel the actual build command controlled by the serve process.
-	cancelMsg := msg{CancelCommand: &msgCancelCommand{buildID}}
-	go func() {
-		err := requestPrivileged(cancelMsg)
-		if err != nil {
-			slog.Error("requesting build cancel", "err", err)
+	buildCancelCommands(buildID)
+}
+
+// QueueJob is a build that is waiting to start or running, as managed by the
+// build queue.
+type QueueJob struct {
+	BuildID  int32
+	RepoName string
+	Branch   string
+	LowPrio  bool
+	Active   bool // Whether the build is running. If not, it is waiting in the queue.
+	Position int  // For waiting builds, the position in the queue, starting at 1. Zero for running builds.
+}
+
+// Queue returns the running builds and the builds waiting in the queue. Builds
+// are typically started in order of queue position, but limits on concurrent
+// builds and low-prio builds may cause later builds to start earlier.
+func (Ding) Queue(ctx context.Context, password string) (jobs []QueueJob) {
+	_checkPassword(password)
+
+	jobQueueDo(func(q *jobQueue) {
+		jobs = q.queueJobs()
+	})
+	return jobs
+}
+
+// QueueMoveFront moves a build waiting in the queue to the front. It will be
+// started before other waiting builds, as soon as limits on concurrent builds
+// allow.
+func (Ding) QueueMoveFront(ctx context.Context, password, repoName string, buildID int32) {
+	_checkPassword(password)
+
+	_dbread(ctx, func(tx *bstore.Tx) {
+		_build(tx, repoName, buildID)
+	})
+
+	var found bool
+	jobQueueDo(func(q *jobQueue) {
+		for i, j := range q.pending {
+			if j.buildID == buildID {
+				j.front = true
+				q.pending = append([]job{j}, append(q.pending[:i:i], q.pending[i+1:]...)...)
+				found = true
+				break
+			}
 		}
-	}()
+	})
+	if !found {
+		_userError("Build not in queue")
+	}
+}
+
+// QueueCancelRepo cancels all builds for the repository that are waiting in the
+// queue. Running builds are not affected.
+func (Ding) QueueCancelRepo(ctx context.Context, password, repoName string) {
+	_checkPassword(password)
+
+	_dbread(ctx, func(tx *bstore.Tx) {
+		_repo(tx, repoName)
+	})
+
+	var removed []job
+	jobQueueDo(func(q *jobQueue) {
+		removed = q.remove(func(j job) bool { return j.repoName == repoName })
+	})
+
+	var builds []Build
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		for _, j := range removed {
+			b := Build{ID: j.buildID}
+			err := tx.Get(&b)
+			_checkf(err, "get build")
+			if b.Finish != nil {
+				continue
+			}
+			now := time.Now()
+			b.Finish = &now
+			b.Status = StatusCancelled
+			b.Steps = _buildSteps(b)
+			err = tx.Update(&b)
+			_checkf(err, "marking build as cancelled in database")
+			builds = append(builds, b)
+		}
+	})
+	for _, b := range builds {
+		events <- EventBuild{b}
+	}
+}
+
+// QueuePromoteLowPrio turns a low-prio build waiting in the queue into a regular
+// build, so it is no longer held back by other builds.
+func (Ding) QueuePromoteLowPrio(ctx context.Context, password, repoName string, buildID int32) {
+	_checkPassword(password)
+
+	_dbread(ctx, func(tx *bstore.Tx) {
+		_build(tx, repoName, buildID)
+	})
+
+	var found bool
+	jobQueueDo(func(q *jobQueue) {
+		for i, j := range q.pending {
+			if j.buildID == buildID {
+				q.pending[i].lowPrio = false
+				found = true
+				break
+			}
+		}
+	})
+	if !found {
+		_userError("Build not in queue")
+	}
+
+	var b Build
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		_, b = _build(tx, repoName, buildID)
+		b.LowPrio = false
+		err := tx.Update(&b)
+		_checkf(err, "updating build in database")
+	})
+	events <- EventBuild{b}
 }
 
 // BuildSettings describes the environment a build script is run in.
@@ -214,6 +353,7 @@ type BuildSettings struct {
 func (Ding) ReleaseCreate(ctx context.Context, password, repoName string, buildID int32) (release Build) {
 	_checkPassword(password)
 
+	var repo Repo
 	_dbwrite(ctx, func(tx *bstore.Tx) {
 		r, b := _build(tx, repoName, buildID)
 		if b.Finish == nil {
@@ -226,22 +366,28 @@ func (Ding) ReleaseCreate(ctx context.Context, password, repoName string, buildI
 			_userError("Build already released")
 		}
 
-		now := time.Now()
-		b.Released = &now
-		err := tx.Update(&b)
-		_checkf(err, "marking build as released")
-
-		checkoutDir := fmt.Sprintf("%s/build/%s/%d/checkout/%s", dingDataDir, r.Name, b.ID, r.CheckoutPath)
-		for _, res := range b.Results {
-			_fileCopy(checkoutDir+"/"+res.Filename, fmt.Sprintf("%s/release/%s/%d/%s.gz", dingDataDir, r.Name, b.ID, path.Base(res.Filename)))
-		}
-
+		_release(tx, r, &b)
 		release = b
+		repo = r
 	})
 	events <- EventBuild{release}
+	triggerDownstreams(ctx, repo, release, true)
 	return
 }
 
+// _release marks a successful build as released, and copies its result files to
+// the release directory.
+func _release(tx *bstore.Tx, r Repo, b *Build) {
+	now := time.Now()
+	b.Released = &now
+	err := tx.Update(b)
+	_checkf(err, "marking build as released")
+
+	for _, res := range b.Results {
+		_fileCopy(resultPath(r.Name, b.ID, r.CheckoutPath, res), fmt.Sprintf("%s/release/%s/%d/%s.gz", dingDataDir, r.Name, b.ID, path.Base(res.Filename)))
+	}
+}
+
 func _fileCopy(src, dst string) {
 	err := os.MkdirAll(path.Dir(dst), 0777)
 	_checkf(err, "making directory for copying result file")
@@ -269,16 +415,21 @@ func _fileCopy(src, dst string) {
 	_checkf(err, "copying result file to destination")
 }
 
-// RepoBuilds is a repository and its recent builds, per branch.
+// RepoBuilds is a repository and its recent builds, per branch and per pull
+// request.
 type RepoBuilds struct {
-	Repo   Repo
-	Builds []Build // Field Steps is cleared to reduce data transferred.
+	Repo              Repo
+	Builds            []Build // Field Steps is cleared to reduce data transferred.
+	PullRequestBuilds []Build // Like Builds, but for pull requests.
 }
 
 // RepoBuilds returns all repositories and recent build info for "active" branches.
 // A branch is active if its name is "master" or "main" (for git), "default" (for hg), or
 // "develop", or if the last build was less than 4 weeks ago. The most recent
-// build is returned.
+// build that was not skipped, and not of an earlier commit of a push or for a
+// bisect, is returned, for each job of the repository.
+// Builds for pull requests are returned separately, for pull requests with a build
+// in the past week.
 func (Ding) RepoBuilds(ctx context.Context, password string) (rb []RepoBuilds) {
 	_checkPassword(password)
 
@@ -286,21 +437,39 @@ func (Ding) RepoBuilds(ctx context.Context, password string) (rb []RepoBuilds) {
 		repos, err := bstore.QueryTx[Repo](tx).List()
 		_checkf(err, "list repositories")
 
-		// repo name -> branch name -> build
-		repoBuilds := map[string]map[string]Build{}
+		type branchJob struct {
+			branch, job string
+		}
+		// repo name -> branch name and job -> build
+		repoBuilds := map[string]map[branchJob]Build{}
+		// repo name -> pull request branch and job -> build
+		repoPRBuilds := map[string]map[branchJob]Build{}
 		start := time.Now().Add(-4 * 7 * 24 * time.Hour)
+		prStart := time.Now().Add(-7 * 24 * time.Hour)
 		err = bstore.QueryTx[Build](tx).SortDesc("ID").ForEach(func(b Build) error {
-			if _, ok := repoBuilds[b.RepoName][b.Branch]; ok {
+			key := branchJob{b.Branch, b.Job}
+			if b.PullRequest != 0 {
+				if _, ok := repoPRBuilds[b.RepoName][key]; ok || b.Created.Before(prStart) {
+					return nil
+				}
+				if _, ok := repoPRBuilds[b.RepoName]; !ok {
+					repoPRBuilds[b.RepoName] = map[branchJob]Build{}
+				}
+				b.Steps = nil
+				repoPRBuilds[b.RepoName][key] = b
+				return nil
+			}
+			if _, ok := repoBuilds[b.RepoName][key]; ok || b.Status == StatusSkipped || extraBuild(b) {
 				return nil
 			}
 			if b.Start != nil && b.Start.Before(start) && !slices.Contains([]string{"main", "master", "default", "develop"}, b.Branch) {
 				return nil
 			}
 			if _, ok := repoBuilds[b.RepoName]; !ok {
-				repoBuilds[b.RepoName] = map[string]Build{}
+				repoBuilds[b.RepoName] = map[branchJob]Build{}
 			}
 			b.Steps = nil
-			repoBuilds[b.RepoName][b.Branch] = b
+			repoBuilds[b.RepoName][key] = b
 			return nil
 		})
 		_checkf(err, "gathering repository builds")
@@ -309,11 +478,13 @@ func (Ding) RepoBuilds(ctx context.Context, password string) (rb []RepoBuilds) {
 		for i, r := range repos {
 			rb[i].Repo = r
 			rb[i].Builds = slices.Collect(maps.Values(repoBuilds[r.Name]))
-			builds := rb[i].Builds
-			sort.Slice(builds, func(i, j int) bool {
-				a, b := builds[i], builds[j]
-				return a.Created.After(b.Created)
-			})
+			rb[i].PullRequestBuilds = slices.Collect(maps.Values(repoPRBuilds[r.Name]))
+			for _, builds := range [][]Build{rb[i].Builds, rb[i].PullRequestBuilds} {
+				sort.Slice(builds, func(i, j int) bool {
+					a, b := builds[i], builds[j]
+					return a.Created.After(b.Created)
+				})
+			}
 		}
 		sort.Slice(rb, func(i, j int) bool {
 			a, b := rb[i], rb[j]
@@ -359,6 +530,16 @@ func (Ding) Builds(ctx context.Context, password, repoName string) (builds []Bui
 	return
 }
 
+var paramNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Values of matrix axes are used in names of build steps and checkout directories.
+var matrixValueRegexp = regexp.MustCompile(`^[a-zA-Z0-9._+=,-]+$`)
+
+const maxMatrixCells = 64
+
+// Job names are shown with builds and used in commit status contexts.
+var jobNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
 func _checkRepo(repo Repo) {
 	if repo.VCS != VCSCommand && repo.DefaultBranch == "" {
 		_userError("DefaultBranch path cannot be empty")
@@ -369,6 +550,163 @@ func _checkRepo(repo Repo) {
 	if strings.HasPrefix(repo.CheckoutPath, "/") || strings.HasSuffix(repo.CheckoutPath, "/") {
 		_userError("Checkout path cannot start or end with a slash")
 	}
+	if repo.MaxBuilds < 0 {
+		_userError("Max builds cannot be negative")
+	}
+	if repo.MaxDuration < 0 || repo.InactivityTimeout < 0 {
+		_userError("Timeouts cannot be negative")
+	}
+	if repo.MaxMemoryMB < 0 || repo.MaxProcesses < 0 || repo.MaxCPUSeconds < 0 || repo.MaxOpenFiles < 0 || repo.MaxFileSizeMB < 0 {
+		_userError("Resource limits cannot be negative")
+	}
+	names := map[string]bool{}
+	for _, p := range repo.Params {
+		if !paramNameRegexp.MatchString(p.Name) {
+			_userError(fmt.Sprintf("Parameter name %q must consist of letters, digits and underscore", p.Name))
+		}
+		if names[p.Name] {
+			_userError(fmt.Sprintf("Duplicate parameter %q", p.Name))
+		}
+		names[p.Name] = true
+		if strings.ContainsRune(p.Value, 0) {
+			_userError(fmt.Sprintf("Default value for parameter %q cannot contain NUL byte", p.Name))
+		}
+	}
+	cells := 1
+	axes := map[string]bool{}
+	for _, axis := range repo.Matrix {
+		if !secretNameRegexp.MatchString(axis.Name) || strings.HasPrefix(strings.ToUpper(axis.Name), "DING_") {
+			_userError(fmt.Sprintf("Matrix axis %q must be an environment variable name, with letters, digits and underscore, not starting with DING_", axis.Name))
+		}
+		if axes[axis.Name] {
+			_userError(fmt.Sprintf("Duplicate matrix axis %q", axis.Name))
+		}
+		axes[axis.Name] = true
+		if len(axis.Values) == 0 {
+			_userError(fmt.Sprintf("Matrix axis %q needs at least one value", axis.Name))
+		}
+		values := map[string]bool{}
+		for _, v := range axis.Values {
+			if !matrixValueRegexp.MatchString(v) {
+				_userError(fmt.Sprintf("Value %q for matrix axis %q must consist of letters, digits and any of ._+=,-", v, axis.Name))
+			}
+			if values[v] {
+				_userError(fmt.Sprintf("Duplicate value %q for matrix axis %q", v, axis.Name))
+			}
+			values[v] = true
+		}
+		cells *= len(axis.Values)
+		if cells > maxMatrixCells {
+			_userError(fmt.Sprintf("Build matrix cannot have more than %d combinations", maxMatrixCells))
+		}
+	}
+	checkEnv := func(env []string) {
+		for _, kv := range env {
+			if k, _, ok := strings.Cut(kv, "="); !ok || k == "" || strings.ContainsRune(kv, 0) {
+				_userError(fmt.Sprintf("Environment variable %q must be of the form key=value", kv))
+			}
+		}
+	}
+	checkEnv(repo.Environment)
+	for _, be := range repo.BranchEnvs {
+		if be.Pattern == "" {
+			_userError("Branch pattern cannot be empty")
+		}
+		if _, err := path.Match(be.Pattern, ""); err != nil {
+			_userError(fmt.Sprintf("Bad branch pattern %q: %v", be.Pattern, err))
+		}
+		checkEnv(be.Environment)
+	}
+	checkRefPatterns := func(pats ...[]string) {
+		for _, pat := range slices.Concat(pats...) {
+			if _, err := path.Match(pat, ""); err != nil || pat == "" {
+				_userError(fmt.Sprintf("Bad branch or tag pattern %q", pat))
+			}
+		}
+	}
+	checkPathPatterns := func(pats ...[]string) {
+		for _, pat := range slices.Concat(pats...) {
+			if _, err := path.Match(pat, ""); err != nil || strings.Trim(pat, "/") == "" {
+				_userError(fmt.Sprintf("Bad path pattern %q", pat))
+			}
+		}
+	}
+	checkScriptPath := func(p string) {
+		if p != "" && (path.IsAbs(p) || path.Clean(p) != p || p == "." || p == ".." || strings.HasPrefix(p, "../")) {
+			_userError(fmt.Sprintf("Build script path %q must be a clean path relative to the checkout", p))
+		}
+	}
+	checkScriptPath(repo.BuildScriptPath)
+	checkRefPatterns(repo.IncludeBranches, repo.ExcludeBranches, repo.IncludeTags, repo.ExcludeTags)
+	checkPathPatterns(repo.IncludePaths, repo.ExcludePaths)
+	jobs := map[string]bool{}
+	for _, j := range repo.Jobs {
+		if !jobNameRegexp.MatchString(j.Name) {
+			_userError(fmt.Sprintf("Job name %q must consist of letters, digits and any of ._-", j.Name))
+		}
+		if jobs[j.Name] {
+			_userError(fmt.Sprintf("Duplicate job %q", j.Name))
+		}
+		jobs[j.Name] = true
+		if strings.TrimSpace(j.BuildScript) == "" {
+			_userError(fmt.Sprintf("Build script for job %q cannot be empty", j.Name))
+		}
+		checkScriptPath(j.BuildScriptPath)
+		checkRefPatterns(j.IncludeBranches, j.ExcludeBranches, j.IncludeTags, j.ExcludeTags)
+		checkPathPatterns(j.IncludePaths, j.ExcludePaths)
+	}
+	if repo.PollInterval < 0 || repo.PollInterval > 0 && repo.PollInterval < 60 {
+		_userError("Poll interval must be zero to disable polling, or at least 60 seconds")
+	}
+	if repo.PollInterval > 0 && repo.VCS == VCSCommand && repo.PollCommand == "" {
+		_userError("Polling a repository with VCS command requires a poll command")
+	}
+	for _, b := range repo.PollBranches {
+		if b == "" || strings.ContainsAny(b, " \t\n") {
+			_userError(fmt.Sprintf("Bad branch %q to poll", b))
+		}
+	}
+	if repo.PushCommitBuilds < 0 || repo.PushCommitBuilds > 20 {
+		_userError("Number of earlier commits of a push to build must be between 0 and 20")
+	}
+	if repo.Bisect && repo.VCS != VCSGit {
+		_userError("Bisecting failed builds is only supported for git repositories")
+	}
+	for _, d := range repo.Downstreams {
+		if d.Repo == "" || d.Repo == repo.Name {
+			_userError(fmt.Sprintf("Bad downstream repository %q", d.Repo))
+		}
+		if _, err := path.Match(d.UpstreamBranch, ""); err != nil {
+			_userError(fmt.Sprintf("Bad upstream branch pattern %q for downstream repository %s", d.UpstreamBranch, d.Repo))
+		}
+		if strings.ContainsAny(d.Branch, " \t\n") {
+			_userError(fmt.Sprintf("Bad branch %q for downstream repository %s", d.Branch, d.Repo))
+		}
+		if d.Condition != DownstreamSuccess && d.Condition != DownstreamRelease {
+			_userError(fmt.Sprintf("Bad condition %q for downstream repository %s", d.Condition, d.Repo))
+		}
+	}
+	cs := repo.CommitStatus
+	switch cs.Forge {
+	case ForgeNone:
+	case ForgeGithub, ForgeGitea, ForgeBitbucket:
+		if owner, name, ok := strings.Cut(cs.Repository, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			_userError("Commit status repository must be of the form owner/name")
+		}
+		if !secretNameRegexp.MatchString(cs.TokenSecret) {
+			_userError("Commit status token must be the name of a secret")
+		}
+		if cs.Forge == ForgeGitea && cs.URL == "" {
+			_userError("Commit status for gitea requires the URL of its API")
+		}
+		if cs.URL != "" {
+			if u, err := url.Parse(cs.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				_userError("Commit status URL must be an http or https URL")
+			}
+		}
+	default:
+		_userError(fmt.Sprintf("Unknown forge %q for commit status", cs.Forge))
+	}
 }
 
 func _assignRepoUID(tx *bstore.Tx) (uid uint32) {
@@ -420,6 +758,7 @@ func (Ding) RepoCreate(ctx context.Context, password string, repo Repo) (r Repo)
 		repo.UID = uid
 		repo.HomeDiskUsage = 0
 		repo.WebhookSecret = genSecret()
+		_checkDownstreams(tx, repo)
 		err := tx.Insert(&repo)
 		_checkf(err, "inserting repository in database")
 		r = repo
@@ -429,6 +768,17 @@ func (Ding) RepoCreate(ctx context.Context, password string, repo Repo) (r Repo)
 	return
 }
 
+// _checkDownstreams checks that the downstream repositories of repo exist.
+func _checkDownstreams(tx *bstore.Tx, repo Repo) {
+	for _, d := range repo.Downstreams {
+		err := tx.Get(&Repo{Name: d.Repo})
+		if err == bstore.ErrAbsent {
+			_userError(fmt.Sprintf("Downstream repository %q does not exist", d.Repo))
+		}
+		_checkf(err, "get downstream repository")
+	}
+}
+
 // RepoSave changes a repository.
 func (Ding) RepoSave(ctx context.Context, password string, repo Repo) (r Repo) {
 	_checkPassword(password)
@@ -452,6 +802,7 @@ func (Ding) RepoSave(ctx context.Context, password string, repo Repo) (r Repo) {
 		r.CheckoutPath = repo.CheckoutPath
 		r.UID = uid
 		r.BuildScript = repo.BuildScript
+		r.BuildScriptPath = repo.BuildScriptPath
 		r.NotifyEmailAddrs = repo.NotifyEmailAddrs
 		r.Bubblewrap = repo.Bubblewrap
 		r.BubblewrapNoNet = repo.BubblewrapNoNet
@@ -460,8 +811,41 @@ func (Ding) RepoSave(ctx context.Context, password string, repo Repo) (r Repo) {
 		r.GoCur = repo.GoCur
 		r.GoPrev = repo.GoPrev
 		r.GoNext = repo.GoNext
+		r.GoParallel = repo.GoParallel
+		r.MaxBuilds = repo.MaxBuilds
+		r.SupersedeBuilds = repo.SupersedeBuilds
+		r.SupersedeRunning = repo.SupersedeRunning
+		r.MaxDuration = repo.MaxDuration
+		r.InactivityTimeout = repo.InactivityTimeout
+		r.MaxMemoryMB = repo.MaxMemoryMB
+		r.MaxProcesses = repo.MaxProcesses
+		r.MaxCPUSeconds = repo.MaxCPUSeconds
+		r.MaxOpenFiles = repo.MaxOpenFiles
+		r.MaxFileSizeMB = repo.MaxFileSizeMB
 		r.WebhookSecret = repo.WebhookSecret
 		r.AllowGlobalWebhookSecrets = repo.AllowGlobalWebhookSecrets
+		r.Params = repo.Params
+		r.Matrix = repo.Matrix
+		r.Environment = repo.Environment
+		r.RunPrefix = repo.RunPrefix
+		r.ReplaceRunPrefix = repo.ReplaceRunPrefix
+		r.BranchEnvs = repo.BranchEnvs
+		r.CommitStatus = repo.CommitStatus
+		r.IncludeBranches = repo.IncludeBranches
+		r.ExcludeBranches = repo.ExcludeBranches
+		r.IncludeTags = repo.IncludeTags
+		r.ExcludeTags = repo.ExcludeTags
+		r.IncludePaths = repo.IncludePaths
+		r.ExcludePaths = repo.ExcludePaths
+		r.ReleaseTags = repo.ReleaseTags
+		r.PollInterval = repo.PollInterval
+		r.PollBranches = repo.PollBranches
+		r.PollCommand = repo.PollCommand
+		r.PushCommitBuilds = repo.PushCommitBuilds
+		r.Bisect = repo.Bisect
+		r.Downstreams = repo.Downstreams
+		_checkDownstreams(tx, r)
+		r.Jobs = repo.Jobs
 		err := tx.Update(&r)
 		_checkf(err, "updating repo in database")
 		r = _repo(tx, repo.Name)
@@ -534,6 +918,12 @@ func (Ding) RepoRemove(ctx context.Context, password, repoName string) {
 		_, err := bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: repo.Name}).Delete()
 		_checkf(err, "deleting builds from database")
 
+		_, err = bstore.QueryTx[Schedule](tx).FilterNonzero(Schedule{RepoName: repo.Name}).Delete()
+		_checkf(err, "deleting schedules from database")
+
+		_, err = bstore.QueryTx[Secret](tx).FilterNonzero(Secret{RepoName: repo.Name}).Delete()
+		_checkf(err, "deleting secrets from database")
+
 		err = tx.Delete(repo)
 		_checkf(err, "removing repo from database")
 	})
@@ -546,6 +936,157 @@ func (Ding) RepoRemove(ctx context.Context, password, repoName string) {
 	_checkf(err, "removing release directory")
 }
 
+// Schedules returns the schedules of a repository.
+func (Ding) Schedules(ctx context.Context, password, repoName string) (schedules []Schedule) {
+	_checkPassword(password)
+
+	_dbread(ctx, func(tx *bstore.Tx) {
+		repo := _repo(tx, repoName)
+		var err error
+		schedules, err = bstore.QueryTx[Schedule](tx).FilterNonzero(Schedule{RepoName: repo.Name}).List()
+		_checkf(err, "listing schedules")
+	})
+	return
+}
+
+// _checkSchedule checks the schedule and returns the next time it creates a build.
+func _checkSchedule(repo Repo, schedule Schedule) time.Time {
+	if schedule.Branch == "" && repo.DefaultBranch == "" {
+		_userError("Branch required, repository has no default branch")
+	}
+	cs, err := parseCron(schedule.Cron)
+	_checkUserf(err, "parsing schedule")
+	return cs.next(time.Now())
+}
+
+// ScheduleCreate adds a schedule to a repository, and sets the time of its first
+// build.
+func (Ding) ScheduleCreate(ctx context.Context, password string, schedule Schedule) (s Schedule) {
+	_checkPassword(password)
+
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		repo := _repo(tx, schedule.RepoName)
+		s = Schedule{
+			RepoName: repo.Name,
+			Branch:   schedule.Branch,
+			Cron:     strings.TrimSpace(schedule.Cron),
+			LowPrio:  schedule.LowPrio,
+			Next:     _checkSchedule(repo, schedule),
+		}
+		err := tx.Insert(&s)
+		_checkf(err, "inserting schedule in database")
+	})
+	events <- EventSchedule{s}
+	return
+}
+
+// ScheduleSave changes the branch, time specification and priority of a schedule,
+// and sets the time of its next build.
+func (Ding) ScheduleSave(ctx context.Context, password string, schedule Schedule) (s Schedule) {
+	_checkPassword(password)
+
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		repo := _repo(tx, schedule.RepoName)
+		s = _schedule(tx, repo.Name, schedule.ID)
+		s.Branch = schedule.Branch
+		s.Cron = strings.TrimSpace(schedule.Cron)
+		s.LowPrio = schedule.LowPrio
+		s.Next = _checkSchedule(repo, s)
+		err := tx.Update(&s)
+		_checkf(err, "updating schedule in database")
+	})
+	events <- EventSchedule{s}
+	return
+}
+
+// ScheduleRemove removes a schedule from a repository. Builds created by the
+// schedule are not affected.
+func (Ding) ScheduleRemove(ctx context.Context, password, repoName string, scheduleID int32) {
+	_checkPassword(password)
+
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		s := _schedule(tx, repoName, scheduleID)
+		err := tx.Delete(&s)
+		_checkf(err, "removing schedule from database")
+	})
+	events <- EventRemoveSchedule{repoName, scheduleID}
+}
+
+var secretNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Secrets returns the secrets of a repository, without their values.
+func (Ding) Secrets(ctx context.Context, password, repoName string) (secrets []Secret) {
+	_checkPassword(password)
+
+	_dbread(ctx, func(tx *bstore.Tx) {
+		repo := _repo(tx, repoName)
+		var err error
+		secrets, err = bstore.QueryTx[Secret](tx).FilterNonzero(Secret{RepoName: repo.Name}).SortAsc("Name").List()
+		_checkf(err, "listing secrets")
+	})
+	return
+}
+
+// SecretSave adds a secret to a repository, or replaces the secret with the same
+// name. The value is stored encrypted and cannot be retrieved through the API.
+func (Ding) SecretSave(ctx context.Context, password, repoName, name, value string, file bool) (s Secret) {
+	_checkPassword(password)
+
+	if !secretNameRegexp.MatchString(name) {
+		_userError("Secret name must be a valid environment variable name, with letters, digits and underscores")
+	}
+	if strings.HasPrefix(strings.ToUpper(name), "DING_") {
+		_userError("Secret names starting with DING_ are reserved")
+	}
+	if slices.Contains(secretReservedNames, strings.ToUpper(name)) || strings.HasPrefix(strings.ToUpper(name), "LD_") {
+		_userError(fmt.Sprintf("Secret name %s is reserved, it would override the environment of the build", name))
+	}
+	if value == "" {
+		_userError("Secret value cannot be empty")
+	}
+	if len(strings.TrimSpace(value)) < secretMaskMinLength {
+		_userError(fmt.Sprintf("Secret value must be at least %d characters, shorter values cannot be masked in build output", secretMaskMinLength))
+	}
+	if strings.Contains(value, "\x00") {
+		_userError("Secret value cannot contain NUL bytes")
+	}
+
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		repo := _repo(tx, repoName)
+		encrypted, err := encryptSecret(repo.Name, name, value)
+		_checkf(err, "encrypting secret")
+
+		s, err = bstore.QueryTx[Secret](tx).FilterNonzero(Secret{RepoName: repo.Name, Name: name}).Get()
+		if err == bstore.ErrAbsent {
+			s = Secret{RepoName: repo.Name, Name: name}
+		} else {
+			_checkf(err, "get secret")
+		}
+		s.File = file
+		s.Updated = time.Now()
+		s.Encrypted = encrypted
+		if s.ID == 0 {
+			err = tx.Insert(&s)
+		} else {
+			err = tx.Update(&s)
+		}
+		_checkf(err, "saving secret in database")
+	})
+	return
+}
+
+// SecretRemove removes a secret from a repository.
+func (Ding) SecretRemove(ctx context.Context, password, repoName, name string) {
+	_checkPassword(password)
+
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		s, err := bstore.QueryTx[Secret](tx).FilterNonzero(Secret{RepoName: repoName, Name: name}).Get()
+		_checkf(err, "get secret")
+		err = tx.Delete(&s)
+		_checkf(err, "removing secret from database")
+	})
+}
+
 // Build returns the build, including steps output.
 func (Ding) Build(ctx context.Context, password, repoName string, buildID int32) (b Build) {
 	_checkPassword(password)
@@ -561,6 +1102,29 @@ func (Ding) Build(ctx context.Context, password, repoName string, buildID int32)
 	return
 }
 
+// PushBuilds returns the builds for the commits of the push of a build, ordered
+// from the first to the last commit of the push. Steps are not included. If the
+// build is not part of a push with builds for earlier commits, no builds are
+// returned.
+func (Ding) PushBuilds(ctx context.Context, password, repoName string, buildID int32) (builds []Build) {
+	_checkPassword(password)
+
+	_dbread(ctx, func(tx *bstore.Tx) {
+		_, b := _build(tx, repoName, buildID)
+		if b.PushBuildID == 0 {
+			builds = []Build{}
+			return
+		}
+		var err error
+		builds, err = bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: repoName, PushBuildID: b.PushBuildID}).SortAsc("PushPosition").List()
+		_checkf(err, "fetching builds of push")
+		for i := range builds {
+			builds[i].Steps = nil
+		}
+	})
+	return
+}
+
 // BuildRemove removes a build completely. Both from database and all local files.
 func (Ding) BuildRemove(ctx context.Context, password string, buildID int32) {
 	_checkPassword(password)
@@ -833,8 +1397,12 @@ func (Ding) Settings(ctx context.Context, password string) (isolationEnabled, ma
 // SettingsSave saves the runtime settings.
 func (Ding) SettingsSave(ctx context.Context, password string, settings Settings) {
 	_checkPassword(password)
+	if settings.MaxBuilds < 0 {
+		_userError("Max builds cannot be negative")
+	}
 	err := database.Update(ctx, &settings)
 	_checkf(err, "update settings")
+	jobsMaxBuilds <- settings.MaxBuilds
 }
 
 // Version returns the ding version this instance is running.
@@ -2,6 +2,13 @@
 
 namespace api {
 
+// Param is a named parameter for a build. Its value is available during clone and
+// build as environment variable DING_PARAM_<name>.
+export interface Param {
+	Name: string  // Letters, digits and underscore.
+	Value: string  // Default value for a parameter of a repository, the value used for a build.
+}
+
 // Build is an attempt at building a repository.
 export interface Build {
 	ID: number
@@ -19,14 +26,50 @@ export interface Build {
 	CoverageReportFile: string  // Relative to URL /dl/<reponame>/<buildid>.
 	Version: string  // Version if this build, typically contains a semver version, with optional commit count/hash, perhaps a branch.
 	BuildScript: string
+	BuildScriptFile: string  // If set, BuildScript was read from this file in the checkout, see Repo.BuildScriptPath. Otherwise it is the build script of the repository or its job at the time the build was created.
+	Job: string  // Name of the job of the repository this build is for, see Repo.Jobs. Empty for builds of the build script of the repository. Builds of a job only supersede, and are compared with, earlier builds of the same job.
 	LowPrio: boolean  // Low-prio builds run after regular builds for a repo have finished. And we only run one low-prio build in ding at a time. Useful after a toolchain update.
+	PullRequest: number  // For builds of a pull request (GitHub) or merge request (Gitea), started through a webhook: the number of the pull request, and its source branch (possibly in another repository) and target branch. Branch is "pull/<number>" for these builds. Zero for other builds.
+	PullRequestSource: string
+	PullRequestTarget: string
+	RefType: RefType  // Kind of ref the build is for. Empty for builds created before the ref type was recorded, which are for branches.
+	Tag: string  // For builds of a tag, the name of the tag. Branch is "tags/<name>" for these builds.
+	PushBuildID: number  // For builds of a push with multiple commits, if the repository builds each commit of a push: the ID of the build of the head commit of the push, and the position of the commit among the built commits of the push, starting at 1. The head build has its own ID and the highest position, the builds of earlier commits are low-priority. Zero for other builds.
+	PushPosition: number
+	Bisect: Bisect  // For a build that failed after a successful build of its branch, with Repo.Bisect: the search for the first failing commit. Zero value for other builds.
+	BisectBuildID: number  // For builds started by a bisect, the ID of the failed build being bisected. Zero for other builds.
+	UpstreamRepoName: string  // For builds triggered by a build of an upstream repository, see Repo.Downstreams: the name of the upstream repository, and the ID and version of its build. Available to the build as $DING_UPSTREAM_REPONAME, $DING_UPSTREAM_BUILDID and $DING_UPSTREAM_VERSION. Empty for other builds.
+	UpstreamBuildID: number
+	UpstreamVersion: string
+	UpstreamRepos?: string[] | null  // Repositories in the chain of triggers that led to this build, starting with the first. Builds are not triggered for repositories already in the chain, to prevent cycles.
 	LastLine: string  // Last line of output, when build has completed.
 	DiskUsage: number  // Disk usage for build.
 	HomeDiskUsageDelta: number  // Change in disk usage of shared home directory, if enabled for this repository. Disk usage can shrink, e.g. after a cleanup.
+	SupersededBy: number  // If set, this build was cancelled because of a newer build for the same branch, with this ID. The status is "superseded".
+	PeakMemory: number  // Peak memory usage in bytes of the build script. If ding is configured with a cgroup directory, this is for all processes of the build together, otherwise for the largest process. Zero if unknown.
+	CPUNsec: number  // User and system CPU time used by the build script, for all build steps.
+	Params?: Param[] | null  // Values for all parameters of the repository at the time the build was created. Available during clone and build as environment variables.
+	Environment?: string[] | null  // Additional environment variables and run prefix the build was created with, from the global settings, the repository and matching branch patterns. The DING_ variables are not included.
+	RunPrefix?: string[] | null
 	Results?: Result[] | null  // Only set for success builds.
+	TestsPassed: number  // Number of tests over all build steps, see Step.Tests. Set for finished builds.
+	TestsFailed: number
+	TestsSkipped: number
 	Steps?: Step[] | null  // Only set for finished builds.
 }
 
+// Bisect is the state of an automatic bisect, a binary search for the first failing
+// commit between the last successful build of a branch and a failed build.
+export interface Bisect {
+	Good: string  // Commit of the last successful build of the branch.
+	Commits?: string[] | null  // Commits after Good, up to and including the commit of the failed build, oldest first. Empty if no bisect was done.
+	GoodIndex: number  // Indices in Commits of the last commit known to succeed (-1 for Good), and the first commit known to fail.
+	BadIndex: number
+	BuildID: number  // Build of the commit currently being tested. Zero when the bisect is done.
+	FirstBad: string  // First failing commit, once found.
+	Error: string  // If set, the bisect was aborted, e.g. because a build was cancelled.
+}
+
 // Result is a file created during a build, as the result of a build.
 export interface Result {
 	Command: string  // Short name of command, without version, as you would want to run it from a command-line.
@@ -35,19 +78,58 @@ export interface Result {
 	Toolchain: string  // String describing the tools used during build, eg SDK version.
 	Filename: string  // Path relative to the checkout directory where build.sh is run. For builds, the file is started at <dataDir>/build/<repoName>/<buildID>/checkout/<checkoutPath>/<filename>. For releases, the file is stored gzipped at <dataDir>/release/<repoName>/<buildID>/<basename of filename>.gz.
 	Filesize: number  // Size of filename.
+	Checkout: string  // Directory in the build directory with the checkout that has the file. Empty means "checkout". Set to e.g. "checkout-goprev" or "checkout-goprev-linux" for build steps of Go toolchains and build matrices that ran concurrently.
 }
 
 // Step is one phase of a build and stores the output generated in that step.
 export interface Step {
-	Name: string  // Mostly same values as build.status.
+	Name: string  // Mostly same values as build.status. Builds for Go toolchains and build matrices have a build step per combination, e.g. "build:go" and "build:goprev:linux:amd64".
 	Output: string  // Combined output of stdout and stderr.
 	Nsec: number  // Time it took this step to finish, initially 0.
+	ErrorMessage: string  // Set if the step failed, e.g. the exit status of build.sh. This field and the fields below are only set for build steps of finished builds.
+	Version: string  // From "version:" line in output.
+	Coverage?: number | null  // Test coverage in percentage, from 0 to 100.
+	CoverageReportFile: string  // Relative to URL /dl/<reponame>/<buildid>.
+	Results?: Result[] | null
+	Tests?: TestPackage[] | null  // Results of tests per package, from "go test -json" output of the build script, or from a file referenced by a "go-test-json:" or "junit:" line. Also set for failed build steps.
+	Matrix?: Param[] | null  // For build steps of a combination of Go toolchain and build matrix, the environment variable of each axis with its value. The Go toolchain is the DING_GOTOOLCHAIN axis. Only set for finished builds.
+}
+
+// TestPackage holds the results of the tests of a Go package or of a test suite
+// in a JUnit XML report.
+export interface TestPackage {
+	Package: string  // Import path, or name of the test suite.
+	Status: TestStatus  // Failed if no final status was seen, e.g. when the test binary crashed.
+	Elapsed: number  // In seconds.
+	Output: string  // Output of the package outside its tests, e.g. a build error. Only kept for failed packages, possibly truncated.
+	Tests?: Test[] | null
+}
+
+// Test is the result of a single test.
+export interface Test {
+	Name: string  // Go subtests include the name of their parent, e.g. "TestX/sub". JUnit tests can be prefixed with their class name.
+	Status: TestStatus
+	Elapsed: number  // In seconds.
+	Output: string  // Only kept for failed tests, possibly truncated.
+}
+
+// QueueJob is a build that is waiting to start or running, as managed by the
+// build queue.
+export interface QueueJob {
+	BuildID: number
+	RepoName: string
+	Branch: string
+	LowPrio: boolean
+	Active: boolean  // Whether the build is running. If not, it is waiting in the queue.
+	Position: number  // For waiting builds, the position in the queue, starting at 1. Zero for running builds.
 }
 
-// RepoBuilds is a repository and its recent builds, per branch.
+// RepoBuilds is a repository and its recent builds, per branch and per pull
+// request.
 export interface RepoBuilds {
 	Repo: Repo
 	Builds?: Build[] | null  // Field Steps is cleared to reduce data transferred.
+	PullRequestBuilds?: Build[] | null  // Like Builds, but for pull requests.
 }
 
 // Repo is a repository as stored in the database.
@@ -62,14 +144,123 @@ export interface Repo {
 	HomeDiskUsage: number  // Disk usage of shared home directory after last finished build. Only if UID is set.
 	WebhookSecret: string  // If non-empty, a per-repo secret for incoming webhook calls.
 	AllowGlobalWebhookSecrets: boolean  // If set, global webhook secrets are allowed to start builds. Set initially during migrations. Will be ineffective when global webhooks have been unconfigured.
+	BuildScriptPath: string  // If set, path of a file in the checkout, relative to the checkout path, e.g. ".ding/build.sh", with the build script. It is read after the clone, so the script of the built commit is used. If the file does not exist, BuildScript is used.
+	IncludeBranches?: string[] | null  // Patterns for names of branches and tags, as for path.Match, for selecting the pushes that start a build through a webhook or "ding kick". If an include list is not empty, only matching names are built. Names matching an exclude pattern are not built. For pull requests, the source branch is matched. Builds created through the web interface are not filtered.
+	ExcludeBranches?: string[] | null
+	IncludeTags?: string[] | null
+	ExcludeTags?: string[] | null
+	IncludePaths?: string[] | null  // Patterns for paths of files, for skipping builds when no relevant files changed since the previous build of the branch. Patterns are as for path.Match. A pattern without slash matches any element of a path, e.g. "*.md" or "docs", other patterns match a path or its leading directories, e.g. "cmd/*". If IncludePaths is not empty, only changes to matching files are relevant. Changes to files matching ExcludePaths are not relevant. Low-priority builds and builds of pull requests and tags are not skipped.
+	ExcludePaths?: string[] | null
+	ReleaseTags: boolean  // If set, successful builds of tags are released automatically, as with ReleaseCreate.
+	PushCommitBuilds: number  // If non-zero, for pushes of multiple commits through a webhook, low-priority builds are created for up to this many commits before the head commit, in addition to the build of the head commit. The most recent commits are built. At most 20.
+	Bisect: boolean  // If set, when a build of a branch fails after a successful build of the branch, the commits in between are bisected: low-priority builds are created one at a time, in a binary search for the first failing commit. The failure notification is sent when the first failing commit is found, and mentions it. Only for git repositories, for up to 1000 commits.
+	Downstreams?: Downstream[] | null  // Repositories to build after builds of this repository, e.g. services that depend on a library. Triggered builds get details about the upstream build in environment variables $DING_UPSTREAM_*. Only builds of the build script of the repository trigger builds, not builds of Jobs.
+	Jobs?: RepoJob[] | null  // Additional named jobs, each with its own build script, triggers and Go toolchains, e.g. for linting, releases, or subprojects of a monorepo. A push through a webhook, "ding kick" or a poll creates a build of the build script of the repository, and a build for each job whose patterns match. Builds of jobs have their own history per branch.
+	PollInterval: number  // If non-zero, the origin is checked for new commits every PollInterval seconds, for repositories without webhooks. A build is created for each polled branch whose head differs from the commit of its latest build.
+	PollBranches?: string[] | null  // Branches to poll. If empty, the default branch is polled.
+	PollCommand: string  // For VCS "command", required for polling: shell command that prints the head commit of branch $DING_BRANCH, as last line of the form "commit:<hash>", like the clone command.
+	PollLast?: Date | null  // Time of last poll, nil if never polled.
+	PollError: string  // Error of last poll, empty if it was successful.
 	GoAuto: boolean  // Build with go toolchains. If set, PATH includes the go toolchain and GOTOOLCHAIN is set.; Build for each of the available go toolchains: go (current), goprev, gonext.
 	GoCur: boolean
 	GoPrev: boolean
 	GoNext: boolean  // If Go toolchain gonext doesn't exist, it is skipped.
+	GoParallel: boolean  // Run the build steps for the go toolchains and the build matrix concurrently, each in its own copy of the checkout, instead of sequentially. All steps run to completion, instead of stopping at the first failure.
+	Matrix?: MatrixAxis[] | null  // Axes of the build matrix, in addition to the Go toolchains. The build script is run for each combination of values, each in its own build step, with an environment variable per axis.
+	MaxBuilds: number  // Maximum number of builds to run concurrently for this repo, for different branches. Builds for the same branch are never run concurrently. Zero means 1.
+	SupersedeBuilds: boolean  // If set, a new build for a branch cancels builds for that branch that are waiting to start, marking them as superseded. Not for low-prio builds. Builds of earlier commits of a push and for bisects are not superseded.
+	SupersedeRunning: boolean  // If set, along with SupersedeBuilds, a running build for the branch is cancelled too.
+	MaxDuration: number  // Maximum duration in seconds for the clone and build steps together. If the build takes longer, it is cancelled. Zero means no limit.
+	InactivityTimeout: number  // If the clone or build commands don't write output for this many seconds, the build is assumed to be stuck and is cancelled. Zero means no limit.
+	MaxMemoryMB: number  // Maximum memory in megabytes for the build script. If ding is configured with a cgroup directory, the limit is for all processes of the build together, otherwise it limits the address space of each process. Zero means no limit.
+	MaxProcesses: number  // Maximum number of processes for the build script. If ding is configured with a cgroup directory, the limit is for the processes of the build, otherwise for all processes of the UID of the build. Zero means no limit.
+	MaxCPUSeconds: number  // Maximum CPU time in seconds for each process of the build script. Zero means no limit.
+	MaxOpenFiles: number  // Maximum number of open files for each process of the build script. Zero means no limit.
+	MaxFileSizeMB: number  // Maximum size in megabytes of files written by the build script. Zero means no limit.
 	Bubblewrap: boolean  // If true, build is run with bubblewrap (bwrap) to isolate the environment further. Only the system, the build directory, home directory and toolchain directory is available.
 	BubblewrapNoNet: boolean  // If true, along with Bubblewrap, then no network access is possible during the build (though it is during clone).
 	NotifyEmailAddrs?: string[] | null  // If not empty, each address gets notified about build breakage/fixage, overriding the default address configured in the configuration file.
 	BuildOnUpdatedToolchain: boolean  // If set, automatically installed Go toolchains will trigger a low priority build for this repository.
+	Params?: Param[] | null  // Parameters that can be set when creating a build, with their default values.
+	Environment?: string[] | null  // Additional environment variables of the form key=value, and commands prefixed to the clone and build commands. Combined with the global settings: variables replace global variables with the same name, and the run prefix is appended to the global run prefix.
+	RunPrefix?: string[] | null
+	ReplaceRunPrefix: boolean  // If set, RunPrefix replaces the global run prefix instead of being appended to it. With an empty RunPrefix, commands are run without prefix.
+	BranchEnvs?: BranchEnv[] | null  // Environment variables and run prefixes for branches matching a pattern. Applied after those of the repository, in order.
+	CommitStatus: CommitStatus  // For reporting the status of builds to the commit status API of a forge.
+}
+
+// Downstream is a repository to build after a build of an upstream repository.
+export interface Downstream {
+	Repo: string  // Name of the downstream repository.
+	UpstreamBranch: string  // Pattern for branches of the upstream repository whose builds trigger a build, as for path.Match, e.g. "release/*". If empty, the default branch of the upstream repository.
+	Branch: string  // Branch of the downstream repository to build. If empty, its default branch.
+	Condition: DownstreamCondition  // When a build of the upstream repository triggers a build.
+}
+
+// RepoJob is a named job of a repository, with its own build script. The branch,
+// tag and path patterns are as for the repository, and are applied in addition to
+// those of the repository.
+export interface RepoJob {
+	Name: string  // Name of the job, e.g. "lint", available to builds as $DING_JOB.
+	BuildScript: string
+	BuildScriptPath: string  // As for the repository.
+	IncludeBranches?: string[] | null
+	ExcludeBranches?: string[] | null
+	IncludeTags?: string[] | null
+	ExcludeTags?: string[] | null
+	IncludePaths?: string[] | null
+	ExcludePaths?: string[] | null
+	GoAuto: boolean  // Go toolchains to build with, as for the repository.
+	GoCur: boolean
+	GoPrev: boolean
+	GoNext: boolean
+}
+
+// MatrixAxis is a dimension of the build matrix of a repository.
+export interface MatrixAxis {
+	Name: string  // Name of the environment variable, e.g. GOOS.
+	Values?: string[] | null  // Values of the environment variable, e.g. linux and openbsd.
+}
+
+// BranchEnv holds environment variables and a run prefix for builds of branches
+// matching a pattern.
+export interface BranchEnv {
+	Pattern: string  // Pattern for branch names, as for path.Match, e.g. "release/*".
+	Environment?: string[] | null  // Of the form key=value.
+	RunPrefix?: string[] | null
+	ReplaceRunPrefix: boolean  // If set, RunPrefix replaces the run prefix so far instead of being appended to it.
+}
+
+// CommitStatus configures reporting build statuses for the commit of the build to
+// a forge: pending when the build starts, and success, failure or cancelled when
+// it finishes. Failed requests are retried.
+export interface CommitStatus {
+	Forge: Forge  // If empty, no statuses are reported.
+	URL: string  // Base URL of the API, e.g. https://gitea.example.com/api/v1. Required for gitea. Defaults to https://api.github.com for github, and https://api.bitbucket.org/2.0 for bitbucket.
+	Repository: string  // Repository at the forge, of the form owner/name, or workspace/name for bitbucket.
+	TokenSecret: string  // Name of a secret of the repository holding the access token, sent as bearer token. The secret is also available to builds.
+}
+
+// Schedule periodically creates a build for a branch of a repository, like cron.
+export interface Schedule {
+	ID: number
+	RepoName: string
+	Branch: string  // If empty, the default branch of the repository.
+	Cron: string  // When to create builds, in crontab format with 5 fields: minute, hour, day of month, month, day of week. Fields can be "*", a number or name, a range, a list, and have a "/step". Shorthands @hourly, @daily, @weekly, @monthly and @yearly are also accepted. Times are in the local time zone of the ding server.
+	LowPrio: boolean  // Whether created builds are low-prio.
+	Next: Date  // Time at which the next build is created. If ding wasn't running at that time, the build is created at startup.
+	LastBuildID: number  // ID of last build created by this schedule, 0 if none yet.
+}
+
+// Secret is a value for builds of a repository that is stored encrypted, with a
+// key in the data directory. Values are never returned through the API, and
+// are masked in the output of build steps.
+export interface Secret {
+	ID: number
+	RepoName: string
+	Name: string  // Name of the environment variable in the build script, e.g. DEPLOY_TOKEN. Names starting with DING_ are reserved.
+	File: boolean  // If set, the value is written to a file in the build directory, readable only by the build, and the environment variable holds the path to the file. The file is removed after the build. Useful for SSH keys and other credentials that tools read from files.
+	Updated: Date
 }
 
 // GoToolchains lists the active current, previous and next versions of the Go
@@ -90,6 +281,7 @@ export interface Settings {
 	GoToolchainWebhookSecret: string  // Required in Authorization header value to webhook /gotoolchain.
 	RunPrefix?: string[] | null  // Commands prefixed to the clone and build commands. E.g. /usr/bin/nice.
 	Environment?: string[] | null  // Additional environment variables to set during clone and build.
+	MaxBuilds: number  // Maximum number of builds to run concurrently, including low-prio builds. Zero means no limit.
 	AutomaticGoToolchains: boolean  // If set, new "go", "goprev" and "gonext" (if present, for release candidates) are automatically downloaded and installed (symlinked as active).
 }
 
@@ -100,6 +292,24 @@ export enum BuildStatus {
 	StatusBuild = "build",  // Building application.
 	StatusSuccess = "success",  // Build was successful.
 	StatusCancelled = "cancelled",  // Build was cancelled before finishing.
+	StatusTimeout = "timeout",  // Build was cancelled because it took too long, or didn't write output for too long.
+	StatusSuperseded = "superseded",  // Build was cancelled because a newer build for the same branch was started, see Build.SupersededBy.
+	StatusSkipped = "skipped",  // Build was not needed because no files matching the path patterns of the repository changed.
+}
+
+// RefType is the kind of ref a build is for.
+export enum RefType {
+	RefBranch = "branch",
+	RefTag = "tag",
+	RefPullRequest = "pullrequest",
+}
+
+// TestStatus is the status of a test or package. JUnit tests with an error are
+// failed.
+export enum TestStatus {
+	TestPass = "pass",
+	TestFail = "fail",
+	TestSkip = "skip",
 }
 
 // VCS indicates the mechanism to fetch the source code.
@@ -111,6 +321,21 @@ export enum VCS {
 	VCSCommand = "command",
 }
 
+// DownstreamCondition is the condition for triggering a build of a downstream
+// repository.
+export enum DownstreamCondition {
+	DownstreamSuccess = "success",  // After a successful build.
+	DownstreamRelease = "release",  // After a build is released, e.g. a tag.
+}
+
+// Forge is a code hosting service with a commit status API.
+export enum Forge {
+	ForgeNone = "",
+	ForgeGithub = "github",
+	ForgeGitea = "gitea",
+	ForgeBitbucket = "bitbucket",
+}
+
 // LogLevel indicates the severity of a log message.
 export enum LogLevel {
 	LogDebug = "debug",
@@ -150,43 +375,99 @@ export interface EventOutput {
 	Text: string  // Lines of text written.
 }
 
-export const structTypes: {[typename: string]: boolean} = {"Build":true,"EventBuild":true,"EventOutput":true,"EventRemoveBuild":true,"EventRemoveRepo":true,"EventRepo":true,"GoToolchains":true,"Repo":true,"RepoBuilds":true,"Result":true,"Settings":true,"Step":true}
-export const stringsTypes: {[typename: string]: boolean} = {"BuildStatus":true,"LogLevel":true,"VCS":true}
+// EventQueue represents a change to the build queue, e.g. a build that was
+// added, started, finished or moved. Jobs holds all running and waiting builds.
+export interface EventQueue {
+	Jobs?: QueueJob[] | null
+}
+
+// EventSchedule represents the creation or update of a schedule, e.g. after it
+// created a build and its next time changed.
+export interface EventSchedule {
+	Schedule: Schedule
+}
+
+// EventRemoveSchedule represents the removal of a schedule.
+export interface EventRemoveSchedule {
+	RepoName: string
+	ScheduleID: number
+}
+
+export const structTypes: {[typename: string]: boolean} = {"Bisect":true,"BranchEnv":true,"Build":true,"CommitStatus":true,"Downstream":true,"EventBuild":true,"EventOutput":true,"EventQueue":true,"EventRemoveBuild":true,"EventRemoveRepo":true,"EventRemoveSchedule":true,"EventRepo":true,"EventSchedule":true,"GoToolchains":true,"MatrixAxis":true,"Param":true,"QueueJob":true,"Repo":true,"RepoBuilds":true,"RepoJob":true,"Result":true,"Schedule":true,"Secret":true,"Settings":true,"Step":true,"Test":true,"TestPackage":true}
+export const stringsTypes: {[typename: string]: boolean} = {"BuildStatus":true,"DownstreamCondition":true,"Forge":true,"LogLevel":true,"RefType":true,"TestStatus":true,"VCS":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
-	"Build": {"Name":"Build","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int32"]},{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"Branch","Docs":"","Typewords":["string"]},{"Name":"CommitHash","Docs":"","Typewords":["string"]},{"Name":"Status","Docs":"","Typewords":["BuildStatus"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Start","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Finish","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"ErrorMessage","Docs":"","Typewords":["string"]},{"Name":"Released","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"BuilddirRemoved","Docs":"","Typewords":["bool"]},{"Name":"Coverage","Docs":"","Typewords":["nullable","float32"]},{"Name":"CoverageReportFile","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"BuildScript","Docs":"","Typewords":["string"]},{"Name":"LowPrio","Docs":"","Typewords":["bool"]},{"Name":"LastLine","Docs":"","Typewords":["string"]},{"Name":"DiskUsage","Docs":"","Typewords":["int64"]},{"Name":"HomeDiskUsageDelta","Docs":"","Typewords":["int64"]},{"Name":"Results","Docs":"","Typewords":["[]","Result"]},{"Name":"Steps","Docs":"","Typewords":["[]","Step"]}]},
-	"Result": {"Name":"Result","Docs":"","Fields":[{"Name":"Command","Docs":"","Typewords":["string"]},{"Name":"Os","Docs":"","Typewords":["string"]},{"Name":"Arch","Docs":"","Typewords":["string"]},{"Name":"Toolchain","Docs":"","Typewords":["string"]},{"Name":"Filename","Docs":"","Typewords":["string"]},{"Name":"Filesize","Docs":"","Typewords":["int64"]}]},
-	"Step": {"Name":"Step","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Output","Docs":"","Typewords":["string"]},{"Name":"Nsec","Docs":"","Typewords":["int64"]}]},
-	"RepoBuilds": {"Name":"RepoBuilds","Docs":"","Fields":[{"Name":"Repo","Docs":"","Typewords":["Repo"]},{"Name":"Builds","Docs":"","Typewords":["[]","Build"]}]},
-	"Repo": {"Name":"Repo","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"VCS","Docs":"","Typewords":["VCS"]},{"Name":"Origin","Docs":"","Typewords":["string"]},{"Name":"DefaultBranch","Docs":"","Typewords":["string"]},{"Name":"CheckoutPath","Docs":"","Typewords":["string"]},{"Name":"BuildScript","Docs":"","Typewords":["string"]},{"Name":"UID","Docs":"","Typewords":["nullable","uint32"]},{"Name":"HomeDiskUsage","Docs":"","Typewords":["int64"]},{"Name":"WebhookSecret","Docs":"","Typewords":["string"]},{"Name":"AllowGlobalWebhookSecrets","Docs":"","Typewords":["bool"]},{"Name":"GoAuto","Docs":"","Typewords":["bool"]},{"Name":"GoCur","Docs":"","Typewords":["bool"]},{"Name":"GoPrev","Docs":"","Typewords":["bool"]},{"Name":"GoNext","Docs":"","Typewords":["bool"]},{"Name":"Bubblewrap","Docs":"","Typewords":["bool"]},{"Name":"BubblewrapNoNet","Docs":"","Typewords":["bool"]},{"Name":"NotifyEmailAddrs","Docs":"","Typewords":["[]","string"]},{"Name":"BuildOnUpdatedToolchain","Docs":"","Typewords":["bool"]}]},
+	"Param": {"Name":"Param","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Value","Docs":"","Typewords":["string"]}]},
+	"Build": {"Name":"Build","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int32"]},{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"Branch","Docs":"","Typewords":["string"]},{"Name":"CommitHash","Docs":"","Typewords":["string"]},{"Name":"Status","Docs":"","Typewords":["BuildStatus"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Start","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Finish","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"ErrorMessage","Docs":"","Typewords":["string"]},{"Name":"Released","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"BuilddirRemoved","Docs":"","Typewords":["bool"]},{"Name":"Coverage","Docs":"","Typewords":["nullable","float32"]},{"Name":"CoverageReportFile","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"BuildScript","Docs":"","Typewords":["string"]},{"Name":"BuildScriptFile","Docs":"","Typewords":["string"]},{"Name":"Job","Docs":"","Typewords":["string"]},{"Name":"LowPrio","Docs":"","Typewords":["bool"]},{"Name":"PullRequest","Docs":"","Typewords":["int32"]},{"Name":"PullRequestSource","Docs":"","Typewords":["string"]},{"Name":"PullRequestTarget","Docs":"","Typewords":["string"]},{"Name":"RefType","Docs":"","Typewords":["RefType"]},{"Name":"Tag","Docs":"","Typewords":["string"]},{"Name":"PushBuildID","Docs":"","Typewords":["int32"]},{"Name":"PushPosition","Docs":"","Typewords":["int32"]},{"Name":"Bisect","Docs":"","Typewords":["Bisect"]},{"Name":"BisectBuildID","Docs":"","Typewords":["int32"]},{"Name":"UpstreamRepoName","Docs":"","Typewords":["string"]},{"Name":"UpstreamBuildID","Docs":"","Typewords":["int32"]},{"Name":"UpstreamVersion","Docs":"","Typewords":["string"]},{"Name":"UpstreamRepos","Docs":"","Typewords":["[]","string"]},{"Name":"LastLine","Docs":"","Typewords":["string"]},{"Name":"DiskUsage","Docs":"","Typewords":["int64"]},{"Name":"HomeDiskUsageDelta","Docs":"","Typewords":["int64"]},{"Name":"SupersededBy","Docs":"","Typewords":["int32"]},{"Name":"PeakMemory","Docs":"","Typewords":["int64"]},{"Name":"CPUNsec","Docs":"","Typewords":["int64"]},{"Name":"Params","Docs":"","Typewords":["[]","Param"]},{"Name":"Environment","Docs":"","Typewords":["[]","string"]},{"Name":"RunPrefix","Docs":"","Typewords":["[]","string"]},{"Name":"Results","Docs":"","Typewords":["[]","Result"]},{"Name":"TestsPassed","Docs":"","Typewords":["int32"]},{"Name":"TestsFailed","Docs":"","Typewords":["int32"]},{"Name":"TestsSkipped","Docs":"","Typewords":["int32"]},{"Name":"Steps","Docs":"","Typewords":["[]","Step"]}]},
+	"Bisect": {"Name":"Bisect","Docs":"","Fields":[{"Name":"Good","Docs":"","Typewords":["string"]},{"Name":"Commits","Docs":"","Typewords":["[]","string"]},{"Name":"GoodIndex","Docs":"","Typewords":["int32"]},{"Name":"BadIndex","Docs":"","Typewords":["int32"]},{"Name":"BuildID","Docs":"","Typewords":["int32"]},{"Name":"FirstBad","Docs":"","Typewords":["string"]},{"Name":"Error","Docs":"","Typewords":["string"]}]},
+	"Result": {"Name":"Result","Docs":"","Fields":[{"Name":"Command","Docs":"","Typewords":["string"]},{"Name":"Os","Docs":"","Typewords":["string"]},{"Name":"Arch","Docs":"","Typewords":["string"]},{"Name":"Toolchain","Docs":"","Typewords":["string"]},{"Name":"Filename","Docs":"","Typewords":["string"]},{"Name":"Filesize","Docs":"","Typewords":["int64"]},{"Name":"Checkout","Docs":"","Typewords":["string"]}]},
+	"Step": {"Name":"Step","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Output","Docs":"","Typewords":["string"]},{"Name":"Nsec","Docs":"","Typewords":["int64"]},{"Name":"ErrorMessage","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Coverage","Docs":"","Typewords":["nullable","float32"]},{"Name":"CoverageReportFile","Docs":"","Typewords":["string"]},{"Name":"Results","Docs":"","Typewords":["[]","Result"]},{"Name":"Tests","Docs":"","Typewords":["[]","TestPackage"]},{"Name":"Matrix","Docs":"","Typewords":["[]","Param"]}]},
+	"TestPackage": {"Name":"TestPackage","Docs":"","Fields":[{"Name":"Package","Docs":"","Typewords":["string"]},{"Name":"Status","Docs":"","Typewords":["TestStatus"]},{"Name":"Elapsed","Docs":"","Typewords":["float64"]},{"Name":"Output","Docs":"","Typewords":["string"]},{"Name":"Tests","Docs":"","Typewords":["[]","Test"]}]},
+	"Test": {"Name":"Test","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Status","Docs":"","Typewords":["TestStatus"]},{"Name":"Elapsed","Docs":"","Typewords":["float64"]},{"Name":"Output","Docs":"","Typewords":["string"]}]},
+	"QueueJob": {"Name":"QueueJob","Docs":"","Fields":[{"Name":"BuildID","Docs":"","Typewords":["int32"]},{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"Branch","Docs":"","Typewords":["string"]},{"Name":"LowPrio","Docs":"","Typewords":["bool"]},{"Name":"Active","Docs":"","Typewords":["bool"]},{"Name":"Position","Docs":"","Typewords":["int32"]}]},
+	"RepoBuilds": {"Name":"RepoBuilds","Docs":"","Fields":[{"Name":"Repo","Docs":"","Typewords":["Repo"]},{"Name":"Builds","Docs":"","Typewords":["[]","Build"]},{"Name":"PullRequestBuilds","Docs":"","Typewords":["[]","Build"]}]},
+	"Repo": {"Name":"Repo","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"VCS","Docs":"","Typewords":["VCS"]},{"Name":"Origin","Docs":"","Typewords":["string"]},{"Name":"DefaultBranch","Docs":"","Typewords":["string"]},{"Name":"CheckoutPath","Docs":"","Typewords":["string"]},{"Name":"BuildScript","Docs":"","Typewords":["string"]},{"Name":"UID","Docs":"","Typewords":["nullable","uint32"]},{"Name":"HomeDiskUsage","Docs":"","Typewords":["int64"]},{"Name":"WebhookSecret","Docs":"","Typewords":["string"]},{"Name":"AllowGlobalWebhookSecrets","Docs":"","Typewords":["bool"]},{"Name":"BuildScriptPath","Docs":"","Typewords":["string"]},{"Name":"IncludeBranches","Docs":"","Typewords":["[]","string"]},{"Name":"ExcludeBranches","Docs":"","Typewords":["[]","string"]},{"Name":"IncludeTags","Docs":"","Typewords":["[]","string"]},{"Name":"ExcludeTags","Docs":"","Typewords":["[]","string"]},{"Name":"IncludePaths","Docs":"","Typewords":["[]","string"]},{"Name":"ExcludePaths","Docs":"","Typewords":["[]","string"]},{"Name":"ReleaseTags","Docs":"","Typewords":["bool"]},{"Name":"PushCommitBuilds","Docs":"","Typewords":["int32"]},{"Name":"Bisect","Docs":"","Typewords":["bool"]},{"Name":"Downstreams","Docs":"","Typewords":["[]","Downstream"]},{"Name":"Jobs","Docs":"","Typewords":["[]","RepoJob"]},{"Name":"PollInterval","Docs":"","Typewords":["int32"]},{"Name":"PollBranches","Docs":"","Typewords":["[]","string"]},{"Name":"PollCommand","Docs":"","Typewords":["string"]},{"Name":"PollLast","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"PollError","Docs":"","Typewords":["string"]},{"Name":"GoAuto","Docs":"","Typewords":["bool"]},{"Name":"GoCur","Docs":"","Typewords":["bool"]},{"Name":"GoPrev","Docs":"","Typewords":["bool"]},{"Name":"GoNext","Docs":"","Typewords":["bool"]},{"Name":"GoParallel","Docs":"","Typewords":["bool"]},{"Name":"Matrix","Docs":"","Typewords":["[]","MatrixAxis"]},{"Name":"MaxBuilds","Docs":"","Typewords":["int32"]},{"Name":"SupersedeBuilds","Docs":"","Typewords":["bool"]},{"Name":"SupersedeRunning","Docs":"","Typewords":["bool"]},{"Name":"MaxDuration","Docs":"","Typewords":["int32"]},{"Name":"InactivityTimeout","Docs":"","Typewords":["int32"]},{"Name":"MaxMemoryMB","Docs":"","Typewords":["int32"]},{"Name":"MaxProcesses","Docs":"","Typewords":["int32"]},{"Name":"MaxCPUSeconds","Docs":"","Typewords":["int32"]},{"Name":"MaxOpenFiles","Docs":"","Typewords":["int32"]},{"Name":"MaxFileSizeMB","Docs":"","Typewords":["int32"]},{"Name":"Bubblewrap","Docs":"","Typewords":["bool"]},{"Name":"BubblewrapNoNet","Docs":"","Typewords":["bool"]},{"Name":"NotifyEmailAddrs","Docs":"","Typewords":["[]","string"]},{"Name":"BuildOnUpdatedToolchain","Docs":"","Typewords":["bool"]},{"Name":"Params","Docs":"","Typewords":["[]","Param"]},{"Name":"Environment","Docs":"","Typewords":["[]","string"]},{"Name":"RunPrefix","Docs":"","Typewords":["[]","string"]},{"Name":"ReplaceRunPrefix","Docs":"","Typewords":["bool"]},{"Name":"BranchEnvs","Docs":"","Typewords":["[]","BranchEnv"]},{"Name":"CommitStatus","Docs":"","Typewords":["CommitStatus"]}]},
+	"Downstream": {"Name":"Downstream","Docs":"","Fields":[{"Name":"Repo","Docs":"","Typewords":["string"]},{"Name":"UpstreamBranch","Docs":"","Typewords":["string"]},{"Name":"Branch","Docs":"","Typewords":["string"]},{"Name":"Condition","Docs":"","Typewords":["DownstreamCondition"]}]},
+	"RepoJob": {"Name":"RepoJob","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"BuildScript","Docs":"","Typewords":["string"]},{"Name":"BuildScriptPath","Docs":"","Typewords":["string"]},{"Name":"IncludeBranches","Docs":"","Typewords":["[]","string"]},{"Name":"ExcludeBranches","Docs":"","Typewords":["[]","string"]},{"Name":"IncludeTags","Docs":"","Typewords":["[]","string"]},{"Name":"ExcludeTags","Docs":"","Typewords":["[]","string"]},{"Name":"IncludePaths","Docs":"","Typewords":["[]","string"]},{"Name":"ExcludePaths","Docs":"","Typewords":["[]","string"]},{"Name":"GoAuto","Docs":"","Typewords":["bool"]},{"Name":"GoCur","Docs":"","Typewords":["bool"]},{"Name":"GoPrev","Docs":"","Typewords":["bool"]},{"Name":"GoNext","Docs":"","Typewords":["bool"]}]},
+	"MatrixAxis": {"Name":"MatrixAxis","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Values","Docs":"","Typewords":["[]","string"]}]},
+	"BranchEnv": {"Name":"BranchEnv","Docs":"","Fields":[{"Name":"Pattern","Docs":"","Typewords":["string"]},{"Name":"Environment","Docs":"","Typewords":["[]","string"]},{"Name":"RunPrefix","Docs":"","Typewords":["[]","string"]},{"Name":"ReplaceRunPrefix","Docs":"","Typewords":["bool"]}]},
+	"CommitStatus": {"Name":"CommitStatus","Docs":"","Fields":[{"Name":"Forge","Docs":"","Typewords":["Forge"]},{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Repository","Docs":"","Typewords":["string"]},{"Name":"TokenSecret","Docs":"","Typewords":["string"]}]},
+	"Schedule": {"Name":"Schedule","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int32"]},{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"Branch","Docs":"","Typewords":["string"]},{"Name":"Cron","Docs":"","Typewords":["string"]},{"Name":"LowPrio","Docs":"","Typewords":["bool"]},{"Name":"Next","Docs":"","Typewords":["timestamp"]},{"Name":"LastBuildID","Docs":"","Typewords":["int32"]}]},
+	"Secret": {"Name":"Secret","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int32"]},{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"File","Docs":"","Typewords":["bool"]},{"Name":"Updated","Docs":"","Typewords":["timestamp"]}]},
 	"GoToolchains": {"Name":"GoToolchains","Docs":"","Fields":[{"Name":"Go","Docs":"","Typewords":["string"]},{"Name":"GoPrev","Docs":"","Typewords":["string"]},{"Name":"GoNext","Docs":"","Typewords":["string"]}]},
-	"Settings": {"Name":"Settings","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int32"]},{"Name":"NotifyEmailAddrs","Docs":"","Typewords":["[]","string"]},{"Name":"GithubWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"GiteaWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"BitbucketWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"GoToolchainWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"RunPrefix","Docs":"","Typewords":["[]","string"]},{"Name":"Environment","Docs":"","Typewords":["[]","string"]},{"Name":"AutomaticGoToolchains","Docs":"","Typewords":["bool"]}]},
-	"BuildStatus": {"Name":"BuildStatus","Docs":"","Values":[{"Name":"StatusNew","Value":"new","Docs":""},{"Name":"StatusClone","Value":"clone","Docs":""},{"Name":"StatusBuild","Value":"build","Docs":""},{"Name":"StatusSuccess","Value":"success","Docs":""},{"Name":"StatusCancelled","Value":"cancelled","Docs":""}]},
+	"Settings": {"Name":"Settings","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int32"]},{"Name":"NotifyEmailAddrs","Docs":"","Typewords":["[]","string"]},{"Name":"GithubWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"GiteaWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"BitbucketWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"GoToolchainWebhookSecret","Docs":"","Typewords":["string"]},{"Name":"RunPrefix","Docs":"","Typewords":["[]","string"]},{"Name":"Environment","Docs":"","Typewords":["[]","string"]},{"Name":"MaxBuilds","Docs":"","Typewords":["int32"]},{"Name":"AutomaticGoToolchains","Docs":"","Typewords":["bool"]}]},
+	"BuildStatus": {"Name":"BuildStatus","Docs":"","Values":[{"Name":"StatusNew","Value":"new","Docs":""},{"Name":"StatusClone","Value":"clone","Docs":""},{"Name":"StatusBuild","Value":"build","Docs":""},{"Name":"StatusSuccess","Value":"success","Docs":""},{"Name":"StatusCancelled","Value":"cancelled","Docs":""},{"Name":"StatusTimeout","Value":"timeout","Docs":""},{"Name":"StatusSuperseded","Value":"superseded","Docs":""},{"Name":"StatusSkipped","Value":"skipped","Docs":""}]},
+	"RefType": {"Name":"RefType","Docs":"","Values":[{"Name":"RefBranch","Value":"branch","Docs":""},{"Name":"RefTag","Value":"tag","Docs":""},{"Name":"RefPullRequest","Value":"pullrequest","Docs":""}]},
+	"TestStatus": {"Name":"TestStatus","Docs":"","Values":[{"Name":"TestPass","Value":"pass","Docs":""},{"Name":"TestFail","Value":"fail","Docs":""},{"Name":"TestSkip","Value":"skip","Docs":""}]},
 	"VCS": {"Name":"VCS","Docs":"","Values":[{"Name":"VCSGit","Value":"git","Docs":""},{"Name":"VCSMercurial","Value":"mercurial","Docs":""},{"Name":"VCSCommand","Value":"command","Docs":""}]},
+	"DownstreamCondition": {"Name":"DownstreamCondition","Docs":"","Values":[{"Name":"DownstreamSuccess","Value":"success","Docs":""},{"Name":"DownstreamRelease","Value":"release","Docs":""}]},
+	"Forge": {"Name":"Forge","Docs":"","Values":[{"Name":"ForgeNone","Value":"","Docs":""},{"Name":"ForgeGithub","Value":"github","Docs":""},{"Name":"ForgeGitea","Value":"gitea","Docs":""},{"Name":"ForgeBitbucket","Value":"bitbucket","Docs":""}]},
 	"LogLevel": {"Name":"LogLevel","Docs":"","Values":[{"Name":"LogDebug","Value":"debug","Docs":""},{"Name":"LogInfo","Value":"info","Docs":""},{"Name":"LogWarn","Value":"warn","Docs":""},{"Name":"LogError","Value":"error","Docs":""}]},
 	"EventRepo": {"Name":"EventRepo","Docs":"EventRepo represents an update of a repository or creation of a repository.","Fields":[{"Name":"Repo","Docs":"","Typewords":["Repo"]}]},
 	"EventRemoveRepo": {"Name":"EventRemoveRepo","Docs":"EventRemoveRepo represents the removal of a repository.","Fields":[{"Name":"RepoName","Docs":"","Typewords":["string"]}]},
 	"EventBuild": {"Name":"EventBuild","Docs":"EventBuild represents an update to a build, or the start of a new build.\nOutput is not part of the build, see EventOutput below.","Fields":[{"Name":"Build","Docs":"","Typewords":["Build"]}]},
 	"EventRemoveBuild": {"Name":"EventRemoveBuild","Docs":"EventRemoveBuild represents the removal of a build from the database.","Fields":[{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"BuildID","Docs":"","Typewords":["int32"]}]},
 	"EventOutput": {"Name":"EventOutput","Docs":"EventOutput represents new output from a build.\nText only contains the newly added output, not the full output so far.","Fields":[{"Name":"BuildID","Docs":"","Typewords":["int32"]},{"Name":"Step","Docs":"During which the output was generated, eg `clone`, `build`.","Typewords":["string"]},{"Name":"Where","Docs":"`stdout` or `stderr`.","Typewords":["string"]},{"Name":"Text","Docs":"Lines of text written.","Typewords":["string"]}]},
+	"EventQueue": {"Name":"EventQueue","Docs":"EventQueue represents a change to the build queue, e.g. a build that was\nadded, started, finished or moved. Jobs holds all running and waiting builds.","Fields":[{"Name":"Jobs","Docs":"","Typewords":["[]","QueueJob"]}]},
+	"EventSchedule": {"Name":"EventSchedule","Docs":"EventSchedule represents the creation or update of a schedule, e.g. after it\ncreated a build and its next time changed.","Fields":[{"Name":"Schedule","Docs":"","Typewords":["Schedule"]}]},
+	"EventRemoveSchedule": {"Name":"EventRemoveSchedule","Docs":"EventRemoveSchedule represents the removal of a schedule.","Fields":[{"Name":"RepoName","Docs":"","Typewords":["string"]},{"Name":"ScheduleID","Docs":"","Typewords":["int32"]}]},
 }
 
 export const parser = {
+	Param: (v: any) => parse("Param", v) as Param,
 	Build: (v: any) => parse("Build", v) as Build,
+	Bisect: (v: any) => parse("Bisect", v) as Bisect,
 	Result: (v: any) => parse("Result", v) as Result,
 	Step: (v: any) => parse("Step", v) as Step,
+	TestPackage: (v: any) => parse("TestPackage", v) as TestPackage,
+	Test: (v: any) => parse("Test", v) as Test,
+	QueueJob: (v: any) => parse("QueueJob", v) as QueueJob,
 	RepoBuilds: (v: any) => parse("RepoBuilds", v) as RepoBuilds,
 	Repo: (v: any) => parse("Repo", v) as Repo,
+	Downstream: (v: any) => parse("Downstream", v) as Downstream,
+	RepoJob: (v: any) => parse("RepoJob", v) as RepoJob,
+	MatrixAxis: (v: any) => parse("MatrixAxis", v) as MatrixAxis,
+	BranchEnv: (v: any) => parse("BranchEnv", v) as BranchEnv,
+	CommitStatus: (v: any) => parse("CommitStatus", v) as CommitStatus,
+	Schedule: (v: any) => parse("Schedule", v) as Schedule,
+	Secret: (v: any) => parse("Secret", v) as Secret,
 	GoToolchains: (v: any) => parse("GoToolchains", v) as GoToolchains,
 	Settings: (v: any) => parse("Settings", v) as Settings,
 	BuildStatus: (v: any) => parse("BuildStatus", v) as BuildStatus,
+	RefType: (v: any) => parse("RefType", v) as RefType,
+	TestStatus: (v: any) => parse("TestStatus", v) as TestStatus,
 	VCS: (v: any) => parse("VCS", v) as VCS,
+	DownstreamCondition: (v: any) => parse("DownstreamCondition", v) as DownstreamCondition,
+	Forge: (v: any) => parse("Forge", v) as Forge,
 	LogLevel: (v: any) => parse("LogLevel", v) as LogLevel,
 	EventRepo: (v: any) => parse("EventRepo", v) as EventRepo,
 	EventRemoveRepo: (v: any) => parse("EventRemoveRepo", v) as EventRemoveRepo,
 	EventBuild: (v: any) => parse("EventBuild", v) as EventBuild,
 	EventRemoveBuild: (v: any) => parse("EventRemoveBuild", v) as EventRemoveBuild,
 	EventOutput: (v: any) => parse("EventOutput", v) as EventOutput,
+	EventQueue: (v: any) => parse("EventQueue", v) as EventQueue,
+	EventSchedule: (v: any) => parse("EventSchedule", v) as EventSchedule,
+	EventRemoveSchedule: (v: any) => parse("EventRemoveSchedule", v) as EventRemoveSchedule,
 }
 
 // The Ding API lets you compile git branches, build binaries, run tests, and
@@ -201,6 +482,9 @@ export const parser = {
 // - `build`, build was updated or created
 // - `removeBuild`, build was removed
 // - `output`, new lines of output from a command for an active build
+// - `queue`, the build queue changed, e.g. a build was added or started
+// - `schedule`, schedule was updated or created
+// - `removeSchedule`, schedule was removed
 // 
 // These types are described below, with an _event_-prefix. E.g. type _EventRepo_ describes the `repo` event.
 let defaultOptions: ClientOptions = {slicesNullable: true, mapsNullable: true, nullableOptional: true}
@@ -246,11 +530,26 @@ export class Client {
 	// 
 	// Low priority builds are executed after regular builds. And only one low
 	// priority build is running over all repo's.
-	async BuildCreate(password: string, repoName: string, branch: string, commit: string, lowPrio: boolean): Promise<Build> {
+	// 
+	// BuildParams sets values for parameters of the repository, other parameters get
+	// their default value.
+	// 
+	// A branch of the form "tags/<name>" builds the tag.
+	async BuildCreate(password: string, repoName: string, branch: string, commit: string, lowPrio: boolean, buildParams: Param[] | null): Promise<Build> {
 		const fn: string = "BuildCreate"
-		const paramTypes: string[][] = [["string"],["string"],["string"],["string"],["bool"]]
+		const paramTypes: string[][] = [["string"],["string"],["string"],["string"],["bool"],["[]","Param"]]
 		const returnTypes: string[][] = [["Build"]]
-		const params: any[] = [password, repoName, branch, commit, lowPrio]
+		const params: any[] = [password, repoName, branch, commit, lowPrio, buildParams]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Build
+	}
+
+	// BuildCreateJob is like BuildCreate, but builds a job of the repository, see
+	// Repo.Jobs. An empty job builds the build script of the repository.
+	async BuildCreateJob(password: string, repoName: string, job: string, branch: string, commit: string, lowPrio: boolean, buildParams: Param[] | null): Promise<Build> {
+		const fn: string = "BuildCreateJob"
+		const paramTypes: string[][] = [["string"],["string"],["string"],["string"],["string"],["bool"],["[]","Param"]]
+		const returnTypes: string[][] = [["Build"]]
+		const params: any[] = [password, repoName, job, branch, commit, lowPrio, buildParams]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Build
 	}
 
@@ -281,6 +580,48 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// Queue returns the running builds and the builds waiting in the queue. Builds
+	// are typically started in order of queue position, but limits on concurrent
+	// builds and low-prio builds may cause later builds to start earlier.
+	async Queue(password: string): Promise<QueueJob[] | null> {
+		const fn: string = "Queue"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","QueueJob"]]
+		const params: any[] = [password]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as QueueJob[] | null
+	}
+
+	// QueueMoveFront moves a build waiting in the queue to the front. It will be
+	// started before other waiting builds, as soon as limits on concurrent builds
+	// allow.
+	async QueueMoveFront(password: string, repoName: string, buildID: number): Promise<void> {
+		const fn: string = "QueueMoveFront"
+		const paramTypes: string[][] = [["string"],["string"],["int32"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [password, repoName, buildID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// QueueCancelRepo cancels all builds for the repository that are waiting in the
+	// queue. Running builds are not affected.
+	async QueueCancelRepo(password: string, repoName: string): Promise<void> {
+		const fn: string = "QueueCancelRepo"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [password, repoName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// QueuePromoteLowPrio turns a low-prio build waiting in the queue into a regular
+	// build, so it is no longer held back by other builds.
+	async QueuePromoteLowPrio(password: string, repoName: string, buildID: number): Promise<void> {
+		const fn: string = "QueuePromoteLowPrio"
+		const paramTypes: string[][] = [["string"],["string"],["int32"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [password, repoName, buildID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// ReleaseCreate release a build.
 	async ReleaseCreate(password: string, repoName: string, buildID: number): Promise<Build> {
 		const fn: string = "ReleaseCreate"
@@ -293,7 +634,10 @@ export class Client {
 	// RepoBuilds returns all repositories and recent build info for "active" branches.
 	// A branch is active if its name is "master" or "main" (for git), "default" (for hg), or
 	// "develop", or if the last build was less than 4 weeks ago. The most recent
-	// build is returned.
+	// build that was not skipped, and not of an earlier commit of a push or for a
+	// bisect, is returned, for each job of the repository.
+	// Builds for pull requests are returned separately, for pull requests with a build
+	// in the past week.
 	async RepoBuilds(password: string): Promise<RepoBuilds[] | null> {
 		const fn: string = "RepoBuilds"
 		const paramTypes: string[][] = [["string"]]
@@ -369,6 +713,73 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// Schedules returns the schedules of a repository.
+	async Schedules(password: string, repoName: string): Promise<Schedule[] | null> {
+		const fn: string = "Schedules"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = [["[]","Schedule"]]
+		const params: any[] = [password, repoName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Schedule[] | null
+	}
+
+	// ScheduleCreate adds a schedule to a repository, and sets the time of its first
+	// build.
+	async ScheduleCreate(password: string, schedule: Schedule): Promise<Schedule> {
+		const fn: string = "ScheduleCreate"
+		const paramTypes: string[][] = [["string"],["Schedule"]]
+		const returnTypes: string[][] = [["Schedule"]]
+		const params: any[] = [password, schedule]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Schedule
+	}
+
+	// ScheduleSave changes the branch, time specification and priority of a schedule,
+	// and sets the time of its next build.
+	async ScheduleSave(password: string, schedule: Schedule): Promise<Schedule> {
+		const fn: string = "ScheduleSave"
+		const paramTypes: string[][] = [["string"],["Schedule"]]
+		const returnTypes: string[][] = [["Schedule"]]
+		const params: any[] = [password, schedule]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Schedule
+	}
+
+	// ScheduleRemove removes a schedule from a repository. Builds created by the
+	// schedule are not affected.
+	async ScheduleRemove(password: string, repoName: string, scheduleID: number): Promise<void> {
+		const fn: string = "ScheduleRemove"
+		const paramTypes: string[][] = [["string"],["string"],["int32"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [password, repoName, scheduleID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// Secrets returns the secrets of a repository, without their values.
+	async Secrets(password: string, repoName: string): Promise<Secret[] | null> {
+		const fn: string = "Secrets"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = [["[]","Secret"]]
+		const params: any[] = [password, repoName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Secret[] | null
+	}
+
+	// SecretSave adds a secret to a repository, or replaces the secret with the same
+	// name. The value is stored encrypted and cannot be retrieved through the API.
+	async SecretSave(password: string, repoName: string, name: string, value: string, file: boolean): Promise<Secret> {
+		const fn: string = "SecretSave"
+		const paramTypes: string[][] = [["string"],["string"],["string"],["string"],["bool"]]
+		const returnTypes: string[][] = [["Secret"]]
+		const params: any[] = [password, repoName, name, value, file]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Secret
+	}
+
+	// SecretRemove removes a secret from a repository.
+	async SecretRemove(password: string, repoName: string, name: string): Promise<void> {
+		const fn: string = "SecretRemove"
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [password, repoName, name]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// Build returns the build, including steps output.
 	async Build(password: string, repoName: string, buildID: number): Promise<Build> {
 		const fn: string = "Build"
@@ -378,6 +789,18 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Build
 	}
 
+	// PushBuilds returns the builds for the commits of the push of a build, ordered
+	// from the first to the last commit of the push. Steps are not included. If the
+	// build is not part of a push with builds for earlier commits, no builds are
+	// returned.
+	async PushBuilds(password: string, repoName: string, buildID: number): Promise<Build[] | null> {
+		const fn: string = "PushBuilds"
+		const paramTypes: string[][] = [["string"],["string"],["int32"]]
+		const returnTypes: string[][] = [["[]","Build"]]
+		const params: any[] = [password, repoName, buildID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Build[] | null
+	}
+
 	// BuildRemove removes a build completely. Both from database and all local files.
 	async BuildRemove(password: string, buildID: number): Promise<void> {
 		const fn: string = "BuildRemove"
@@ -508,12 +931,12 @@ export class Client {
 	}
 	// ExampleSSE is a no-op.
 	// This function only serves to include documentation for the server-sent event types.
-	async ExampleSSE(): Promise<[EventRepo, EventRemoveRepo, EventBuild, EventRemoveBuild, EventOutput]> {
+	async ExampleSSE(): Promise<[EventRepo, EventRemoveRepo, EventBuild, EventRemoveBuild, EventOutput, EventQueue, EventSchedule, EventRemoveSchedule]> {
 		const fn: string = "ExampleSSE"
 		const paramTypes: string[][] = []
-		const returnTypes: string[][] = [["EventRepo"],["EventRemoveRepo"],["EventBuild"],["EventRemoveBuild"],["EventOutput"]]
+		const returnTypes: string[][] = [["EventRepo"],["EventRemoveRepo"],["EventBuild"],["EventRemoveBuild"],["EventOutput"],["EventQueue"],["EventSchedule"],["EventRemoveSchedule"]]
 		const params: any[] = []
-		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [EventRepo, EventRemoveRepo, EventBuild, EventRemoveBuild, EventOutput]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [EventRepo, EventRemoveRepo, EventBuild, EventRemoveBuild, EventOutput, EventQueue, EventSchedule, EventRemoveSchedule]
 	}
 }
 
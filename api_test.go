@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"testing"
 	"time"
 )
@@ -17,7 +23,7 @@ func TestAPI(t *testing.T) {
 	// Check auth for all methods.
 	tneederr(t, "user:badAuth", func() { api.BuildCancel(ctxbg, "badpass", "repoName", 123) })
 	tneederr(t, "user:badAuth", func() { api.BuildCleanupBuilddir(ctxbg, "badpass", "repoName", 123) })
-	tneederr(t, "user:badAuth", func() { api.BuildCreate(ctxbg, "badpass", "repoName", "main", "", false) })
+	tneederr(t, "user:badAuth", func() { api.BuildCreate(ctxbg, "badpass", "repoName", "main", "", false, nil) })
 	tneederr(t, "user:badAuth", func() { api.Build(ctxbg, "badpass", "repoName", 123) })
 	tneederr(t, "user:badAuth", func() { api.BuildRemove(ctxbg, "badpass", 123) })
 	tneederr(t, "user:badAuth", func() { api.BuildsCreateLowPrio(ctxbg, "badpass") })
@@ -28,6 +34,10 @@ func TestAPI(t *testing.T) {
 	tneederr(t, "user:badAuth", func() { api.GoToolchainRemove(ctxbg, "badpass", "go1.23.0") })
 	tneederr(t, "user:badAuth", func() { api.GoToolchainsListInstalled(ctxbg, "badpass") })
 	tneederr(t, "user:badAuth", func() { api.GoToolchainsListReleased(ctxbg, "badpass") })
+	tneederr(t, "user:badAuth", func() { api.Queue(ctxbg, "badpass") })
+	tneederr(t, "user:badAuth", func() { api.QueueCancelRepo(ctxbg, "badpass", "repoName") })
+	tneederr(t, "user:badAuth", func() { api.QueueMoveFront(ctxbg, "badpass", "repoName", 123) })
+	tneederr(t, "user:badAuth", func() { api.QueuePromoteLowPrio(ctxbg, "badpass", "repoName", 123) })
 	tneederr(t, "user:badAuth", func() { api.ReleaseCreate(ctxbg, "badpass", "repoName", 123) })
 	tneederr(t, "user:badAuth", func() { api.RepoBuilds(ctxbg, "badpass") })
 	tneederr(t, "user:badAuth", func() { api.RepoClearHomedir(ctxbg, "badpass", "repoName") })
@@ -35,6 +45,13 @@ func TestAPI(t *testing.T) {
 	tneederr(t, "user:badAuth", func() { api.Repo(ctxbg, "badpass", "repoName") })
 	tneederr(t, "user:badAuth", func() { api.RepoRemove(ctxbg, "badpass", "repoName") })
 	tneederr(t, "user:badAuth", func() { api.RepoSave(ctxbg, "badpass", Repo{}) })
+	tneederr(t, "user:badAuth", func() { api.ScheduleCreate(ctxbg, "badpass", Schedule{}) })
+	tneederr(t, "user:badAuth", func() { api.ScheduleRemove(ctxbg, "badpass", "repoName", 123) })
+	tneederr(t, "user:badAuth", func() { api.ScheduleSave(ctxbg, "badpass", Schedule{}) })
+	tneederr(t, "user:badAuth", func() { api.Schedules(ctxbg, "badpass", "repoName") })
+	tneederr(t, "user:badAuth", func() { api.SecretRemove(ctxbg, "badpass", "repoName", "NAME") })
+	tneederr(t, "user:badAuth", func() { api.SecretSave(ctxbg, "badpass", "repoName", "NAME", "value", false) })
+	tneederr(t, "user:badAuth", func() { api.Secrets(ctxbg, "badpass", "repoName") })
 	tneederr(t, "user:badAuth", func() { api.Settings(ctxbg, "badpass") })
 	tneederr(t, "user:badAuth", func() { api.SettingsSave(ctxbg, "badpass", Settings{}) })
 	tneederr(t, "user:badAuth", func() { api.LogLevel(ctxbg, "badpass") })
@@ -85,7 +102,7 @@ echo coverage-report: coverage.txt
 	api.ClearRepoHomedirs(ctxbg, config.Password)
 
 	// BuildCreate
-	b := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false)
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false, nil)
 
 	// Build
 	api.Build(ctxbg, config.Password, r.Name, b.ID)
@@ -114,7 +131,7 @@ echo coverage-report: coverage.txt
 	nr = api.Repo(ctxbg, config.Password, nr.Name)
 	nr.BuildScript = "#!/usr/bin/env bash\nsleep 3\n"
 	nr = api.RepoSave(ctxbg, config.Password, nr)
-	cb := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", true)
+	cb := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", true, nil)
 	api.BuildCancel(ctxbg, config.Password, r.Name, cb.ID)
 	api.BuildCleanupBuilddir(ctxbg, config.Password, r.Name, cb.ID)
 	api.BuildRemove(ctxbg, config.Password, cb.ID)
@@ -161,7 +178,7 @@ echo coverage-report: coverage.txt
 
 	r = Repo{Name: "g0", VCS: VCSGit, Origin: gitRepoDir, DefaultBranch: "main", CheckoutPath: "g0", BuildScript: buildScript}
 	r = api.RepoCreate(ctxbg, config.Password, r)
-	b = api.BuildCreate(ctxbg, config.Password, r.Name, r.DefaultBranch, "", false)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, r.DefaultBranch, "", false, nil)
 	twaitBuild(t, b, StatusSuccess)
 
 	// Test a build with a mercurial repo, if we can run it.
@@ -176,7 +193,7 @@ echo coverage-report: coverage.txt
 		run(hgRepoDir, "hg", "commit", "-m", "test", "file.txt")
 		r = Repo{Name: "hg", VCS: VCSMercurial, Origin: hgRepoDir, DefaultBranch: "default", CheckoutPath: "hgrepo", BuildScript: "#!/usr/bin/env bash\nset -e\necho building...\necho hi>myfile\necho version: 1.2.3\necho release: mycmd linux amd64 toolchain1.2.3 myfile\n"}
 		r = api.RepoCreate(ctxbg, config.Password, r)
-		b = api.BuildCreate(ctxbg, config.Password, r.Name, r.DefaultBranch, "", false)
+		b = api.BuildCreate(ctxbg, config.Password, r.Name, r.DefaultBranch, "", false, nil)
 		twaitBuild(t, b, StatusSuccess)
 	} else {
 		log.Printf("not testing build with mercurial repository")
@@ -206,6 +223,437 @@ echo coverage-report: coverage.txt
 	api.Version(ctxbg, config.Password)
 }
 
+func TestQueue(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	// Only one build at a time, so the others wait in the queue.
+	_, _, _, settings := api.Settings(ctxbg, config.Password)
+	settings.MaxBuilds = 1
+	api.SettingsSave(ctxbg, config.Password, settings)
+	defer func() {
+		settings.MaxBuilds = 0
+		api.SettingsSave(ctxbg, config.Password, settings)
+	}()
+
+	r := Repo{Name: "q", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "q", BuildScript: "#!/usr/bin/env bash\nsleep 10\n"}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	// Create builds one by one, waiting until each is in the queue, for a
+	// predictable order.
+	create := func(branch string, lowPrio bool) Build {
+		t.Helper()
+		b := api.BuildCreate(ctxbg, config.Password, r.Name, branch, "", lowPrio, nil)
+		twaitQueued(t, b)
+		return b
+	}
+	b1 := create("main", false)
+	b2 := create("a", false)
+	b3 := create("b", false)
+	b4 := create("c", true)
+
+	tcompare(t, api.Queue(ctxbg, config.Password), []QueueJob{
+		{b1.ID, r.Name, "main", false, true, 0},
+		{b2.ID, r.Name, "a", false, false, 1},
+		{b3.ID, r.Name, "b", false, false, 2},
+		{b4.ID, r.Name, "c", true, false, 3},
+	})
+
+	// Running builds are not in the queue.
+	tneederr(t, "user:error", func() { api.QueueMoveFront(ctxbg, config.Password, r.Name, b1.ID) })
+	tneederr(t, "user:error", func() { api.QueuePromoteLowPrio(ctxbg, config.Password, r.Name, b1.ID) })
+	tneederr(t, "user:notFound", func() { api.QueueCancelRepo(ctxbg, config.Password, "bogus") })
+
+	api.QueueMoveFront(ctxbg, config.Password, r.Name, b3.ID)
+	api.QueuePromoteLowPrio(ctxbg, config.Password, r.Name, b4.ID)
+	tcompare(t, api.Build(ctxbg, config.Password, r.Name, b4.ID).LowPrio, false)
+	tcompare(t, api.Queue(ctxbg, config.Password)[1:], []QueueJob{
+		{b3.ID, r.Name, "b", false, false, 1},
+		{b2.ID, r.Name, "a", false, false, 2},
+		{b4.ID, r.Name, "c", false, false, 3},
+	})
+
+	// Cancelling a single waiting build removes it from the queue.
+	api.BuildCancel(ctxbg, config.Password, r.Name, b2.ID)
+	twaitBuild(t, b2, StatusCancelled)
+	tcompare(t, len(api.Queue(ctxbg, config.Password)), 3)
+
+	api.QueueCancelRepo(ctxbg, config.Password, r.Name)
+	twaitBuild(t, b3, StatusCancelled)
+	twaitBuild(t, b4, StatusCancelled)
+	tcompare(t, len(api.Queue(ctxbg, config.Password)), 1)
+
+	api.BuildCancel(ctxbg, config.Password, r.Name, b1.ID)
+	twaitBuild(t, b1, StatusCancelled)
+	twaitQueueEmpty(t)
+}
+
+func TestSupersede(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "sup", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "sup", BuildScript: "#!/usr/bin/env bash\nsleep 10\n", SupersedeBuilds: true}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+	r.SupersedeBuilds = true
+	r = api.RepoSave(ctxbg, config.Password, r)
+
+	create := func(branch string) Build {
+		t.Helper()
+		b := api.BuildCreate(ctxbg, config.Password, r.Name, branch, "", false, nil)
+		twaitQueued(t, b)
+		return b
+	}
+
+	// b1 is running, b2 is waiting for b1 and is superseded by b3. A build for
+	// another branch isn't affected.
+	b1 := create("main")
+	b2 := create("main")
+	other := create("other")
+	b3 := create("main")
+	twaitBuild(t, b2, StatusSuperseded)
+	b2 = api.Build(ctxbg, config.Password, r.Name, b2.ID)
+	tcompare(t, b2.SupersededBy, b3.ID)
+	tcompare(t, api.Build(ctxbg, config.Password, r.Name, b1.ID).Finish == nil, true)
+	tcompare(t, api.Build(ctxbg, config.Password, r.Name, other.ID).Finish == nil, true)
+
+	// Low-prio builds don't supersede.
+	lp := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", true, nil)
+	twaitQueued(t, lp)
+	tcompare(t, api.Build(ctxbg, config.Password, r.Name, b3.ID).Finish == nil, true)
+
+	// Builds for a bisect (or of earlier commits of a push) are never superseded.
+	extra := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", true, nil)
+	twaitQueued(t, extra)
+	eb := Build{ID: extra.ID}
+	err := database.Get(ctxbg, &eb)
+	tcheck(t, err, "get build")
+	eb.BisectBuildID = b1.ID
+	err = database.Update(ctxbg, &eb)
+	tcheck(t, err, "update build")
+
+	// With SupersedeRunning, the running build is cancelled too.
+	r.SupersedeRunning = true
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b4 := create("main")
+	twaitBuild(t, b1, StatusSuperseded)
+	twaitBuild(t, b3, StatusSuperseded)
+	twaitBuild(t, lp, StatusSuperseded)
+	b1 = api.Build(ctxbg, config.Password, r.Name, b1.ID)
+	tcompare(t, b1.SupersededBy, b4.ID)
+	tcompare(t, b1.ErrorMessage, fmt.Sprintf("Superseded by build %d", b4.ID))
+	tcompare(t, api.Build(ctxbg, config.Password, r.Name, extra.ID).Finish == nil, true)
+
+	api.BuildCancel(ctxbg, config.Password, r.Name, b4.ID)
+	api.BuildCancel(ctxbg, config.Password, r.Name, other.ID)
+	api.BuildCancel(ctxbg, config.Password, r.Name, extra.ID)
+	twaitBuild(t, b4, StatusCancelled)
+	twaitBuild(t, other, StatusCancelled)
+	twaitBuild(t, extra, StatusCancelled)
+	twaitQueueEmpty(t)
+}
+
+func TestSchedule(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "sched", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "sched", BuildScript: "#!/usr/bin/env bash\necho building...\n"}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	tneederr(t, "user:error", func() { api.ScheduleCreate(ctxbg, config.Password, Schedule{RepoName: r.Name, Cron: "bogus"}) })
+	tneederr(t, "user:notFound", func() { api.ScheduleCreate(ctxbg, config.Password, Schedule{RepoName: "bogus", Cron: "@daily"}) })
+
+	s := api.ScheduleCreate(ctxbg, config.Password, Schedule{RepoName: r.Name, Cron: "@daily", LowPrio: true})
+	tcompare(t, s.Next.After(time.Now()), true)
+	tcompare(t, s.Next.Hour(), 0)
+	tcompare(t, api.Schedules(ctxbg, config.Password, r.Name), []Schedule{s})
+
+	s.Cron = "0 3 * * *"
+	s.Branch = "dev"
+	s = api.ScheduleSave(ctxbg, config.Password, s)
+	tcompare(t, s.Next.Hour(), 3)
+
+	// Not due yet.
+	now := time.Now()
+	err := runDueSchedules(ctxbg, now)
+	tcheck(t, err, "run schedules")
+	tcompare(t, len(api.Builds(ctxbg, config.Password, r.Name)), 0)
+
+	// Due, a build is created and the next time is set.
+	now = s.Next.Add(time.Minute)
+	err = runDueSchedules(ctxbg, now)
+	tcheck(t, err, "run schedules")
+	builds := api.Builds(ctxbg, config.Password, r.Name)
+	tcompare(t, len(builds), 1)
+	b := builds[0]
+	tcompare(t, b.Branch, "dev")
+	tcompare(t, b.LowPrio, true)
+	twaitBuild(t, b, StatusSuccess)
+	twaitQueueEmpty(t)
+	ns := api.Schedules(ctxbg, config.Password, r.Name)[0]
+	tcompare(t, ns.LastBuildID, b.ID)
+	tcompare(t, ns.Next.Equal(s.Next.AddDate(0, 0, 1)), true)
+
+	api.ScheduleRemove(ctxbg, config.Password, r.Name, s.ID)
+	tcompare(t, len(api.Schedules(ctxbg, config.Password, r.Name)), 0)
+	tneederr(t, "user:notFound", func() { api.ScheduleRemove(ctxbg, config.Password, r.Name, s.ID) })
+
+	// Schedules are removed along with their repository.
+	api.ScheduleCreate(ctxbg, config.Password, Schedule{RepoName: r.Name, Cron: "@hourly"})
+	api.RepoRemove(ctxbg, config.Password, r.Name)
+}
+
+func TestParams(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "params", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "params", BuildScript: "#!/usr/bin/env bash\necho long=$DING_PARAM_LONG target=$DING_PARAM_TARGET\n"}
+	r.Params = []Param{{"bad name", ""}}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.Params = []Param{{"LONG", "no"}, {"LONG", "yes"}}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.Params = []Param{{"LONG", "no"}, {"TARGET", "linux"}}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	tneederr(t, "user:error", func() { api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, []Param{{"BOGUS", "x"}}) })
+	tneederr(t, "user:error", func() {
+		api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, []Param{{"LONG", "yes"}, {"LONG", "no"}})
+	})
+
+	// Parameters not set get their default value.
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, []Param{{"LONG", "yes"}})
+	tcompare(t, b.Params, []Param{{"LONG", "yes"}, {"TARGET", "linux"}})
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[1].Output, "long=yes target=linux\n")
+
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	tcompare(t, b.Params, []Param{{"LONG", "no"}, {"TARGET", "linux"}})
+	twaitBuild(t, b, StatusSuccess)
+}
+
+func TestSecrets(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "secrets", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "secrets", BuildScript: "#!/usr/bin/env bash\nset -e\necho token=$TOKEN\necho key=$(cat $KEYFILE)\nprintf '%01020d%s\\n' 0 $TOKEN\n"}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	tneederr(t, "user:error", func() { api.SecretSave(ctxbg, config.Password, r.Name, "bad name", "x", false) })
+	tneederr(t, "user:error", func() { api.SecretSave(ctxbg, config.Password, r.Name, "DING_TOKEN", "x", false) })
+	tneederr(t, "user:error", func() { api.SecretSave(ctxbg, config.Password, r.Name, "TOKEN", "", false) })
+	tneederr(t, "user:error", func() { api.SecretSave(ctxbg, config.Password, r.Name, "TOKEN", "abc", false) })
+	tneederr(t, "user:error", func() { api.SecretSave(ctxbg, config.Password, r.Name, "PATH", "/tmp/evil", false) })
+	tneederr(t, "user:error", func() { api.SecretSave(ctxbg, config.Password, r.Name, "LD_PRELOAD", "/tmp/evil.so", false) })
+	tneederr(t, "user:notFound", func() { api.SecretSave(ctxbg, config.Password, "bogus", "TOKEN", "hunter2hunter2", false) })
+
+	api.SecretSave(ctxbg, config.Password, r.Name, "TOKEN", "oldtoken", false)
+	s := api.SecretSave(ctxbg, config.Password, r.Name, "TOKEN", "hunter2hunter2", false)
+	api.SecretSave(ctxbg, config.Password, r.Name, "KEYFILE", "sshkey123\n", true)
+
+	// Values are stored encrypted, and not returned through the API.
+	dbs := Secret{ID: s.ID}
+	err := database.Get(ctxbg, &dbs)
+	tcheck(t, err, "get secret")
+	if bytes.Contains(dbs.Encrypted, []byte("hunter2")) {
+		t.Fatalf("secret stored unencrypted")
+	}
+	secrets := api.Secrets(ctxbg, config.Password, r.Name)
+	tcompare(t, len(secrets), 2)
+	buf, err := json.Marshal(secrets)
+	tcheck(t, err, "marshal secrets")
+	if bytes.Contains(buf, []byte("Encrypted")) {
+		t.Fatalf("encrypted secret in api response: %s", buf)
+	}
+
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	// The last line is flushed halfway the token, which must still be masked.
+	tcompare(t, b.Steps[1].Output, "token=***\nkey=***\n"+strings.Repeat("0", 1020)+"***\n")
+
+	// Secret files are removed after the build.
+	_, err = os.Stat(fmt.Sprintf("%s/build/%s/%d/secrets", dingDataDir, r.Name, b.ID))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("secrets directory still present after build, err %v", err)
+	}
+
+	api.SecretRemove(ctxbg, config.Password, r.Name, "TOKEN")
+	tneederr(t, "user:notFound", func() { api.SecretRemove(ctxbg, config.Password, r.Name, "TOKEN") })
+	tcompare(t, len(api.Secrets(ctxbg, config.Password, r.Name)), 1)
+}
+
+func TestEnvironment(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	_, _, _, settings := api.Settings(ctxbg, config.Password)
+	settings.Environment = []string{"A=global", "B=global"}
+	settings.RunPrefix = []string{"env", "P1=global"}
+	api.SettingsSave(ctxbg, config.Password, settings)
+
+	r := Repo{Name: "env", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "env", BuildScript: "#!/usr/bin/env bash\necho $A $B $C $P1 $P2\n"}
+	r.Environment = []string{"bad"}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.Environment = nil
+	r.BranchEnvs = []BranchEnv{{Pattern: "[bad"}}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.BranchEnvs = nil
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	r.Environment = []string{"B=repo", "C=repo"}
+	r.RunPrefix = []string{"env", "P2=repo"}
+	r.BranchEnvs = []BranchEnv{{Pattern: "release/*", Environment: []string{"C=release"}, RunPrefix: []string{"env", "P2=release"}, ReplaceRunPrefix: true}}
+	r = api.RepoSave(ctxbg, config.Password, r)
+
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	tcompare(t, b.Environment, []string{"A=global", "B=repo", "C=repo"})
+	tcompare(t, b.RunPrefix, []string{"env", "P1=global", "env", "P2=repo"})
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[1].Output, "global repo repo global repo\n")
+
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "release/1", "", false, nil)
+	tcompare(t, b.Environment, []string{"A=global", "B=repo", "C=release"})
+	tcompare(t, b.RunPrefix, []string{"env", "P2=release"})
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[1].Output, "global repo release release\n")
+}
+
+func TestMatrix(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "matrix", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "matrix", BuildScript: "#!/usr/bin/env bash\necho $OS $TAGS $(basename $(dirname $PWD))\ntest $OS-$TAGS != openbsd-b\n"}
+	r.Matrix = []MatrixAxis{{"DING_OS", []string{"linux"}}}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.Matrix = []MatrixAxis{{"OS", []string{"linux/amd64"}}}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.Matrix = []MatrixAxis{{"OS", nil}}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.Matrix = []MatrixAxis{{"OS", []string{"linux", "openbsd"}}, {"TAGS", []string{"a", "b"}}}
+	r.GoParallel = true
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.ErrorMessage, "build:openbsd:b: build.sh: exit status 1")
+	tcompare(t, len(b.Steps), 5)
+	tcompare(t, b.Steps[1].Name, "build:linux:a")
+	tcompare(t, b.Steps[1].Output, "linux a checkout\n")
+	tcompare(t, b.Steps[1].Matrix, []Param{{"OS", "linux"}, {"TAGS", "a"}})
+	tcompare(t, b.Steps[1].ErrorMessage, "")
+	tcompare(t, b.Steps[4].Name, "build:openbsd:b")
+	tcompare(t, b.Steps[4].Output, "openbsd b checkout-openbsd-b\n")
+	tcompare(t, b.Steps[4].ErrorMessage, "build.sh: exit status 1")
+}
+
+func TestBuildScriptPath(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	origin := `mkdir -p checkout/$DING_CHECKOUTPATH/.ding
+cd checkout/$DING_CHECKOUTPATH
+case "$DING_PARAM_script" in
+file) printf '#!/bin/sh\necho from file\n' >.ding/build.sh;;
+link) ln -s /etc/passwd .ding/build.sh;;
+esac
+echo commit:0123abcd
+`
+	r := Repo{Name: "scriptpath", VCS: VCSCommand, Origin: origin, DefaultBranch: "main", CheckoutPath: "scriptpath", BuildScript: "#!/bin/sh\necho from settings\n", Params: []Param{{"script", ""}}}
+	for _, p := range []string{"/etc/passwd", "../build.sh", "a//b", "."} {
+		r.BuildScriptPath = p
+		tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	}
+	r.BuildScriptPath = ".ding/build.sh"
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	build := func(script string, status BuildStatus) Build {
+		t.Helper()
+		b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, []Param{{"script", script}})
+		twaitBuild(t, b, status)
+		return api.Build(ctxbg, config.Password, r.Name, b.ID)
+	}
+
+	// Without file in the checkout, the build script of the repository is used.
+	b := build("", StatusSuccess)
+	tcompare(t, b.BuildScriptFile, "")
+	tcompare(t, b.BuildScript, r.BuildScript)
+	tcompare(t, b.Steps[1].Output, "from settings\n")
+
+	b = build("file", StatusSuccess)
+	tcompare(t, b.BuildScriptFile, ".ding/build.sh")
+	tcompare(t, b.BuildScript, "#!/bin/sh\necho from file\n")
+	tcompare(t, b.Steps[1].Output, "from file\n")
+
+	// Symbolic links can't point outside the checkout.
+	b = build("link", StatusClone)
+	tcompare(t, b.BuildScriptFile, "")
+	tcompare(t, strings.Contains(b.ErrorMessage, "path escapes"), true)
+}
+
+func TestTimeout(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "to", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "to", BuildScript: "#!/usr/bin/env bash\necho building\nsleep 10\n"}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	r.MaxDuration = -1
+	tneederr(t, "user:error", func() { api.RepoSave(ctxbg, config.Password, r) })
+
+	r.MaxDuration = 1
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusTimeout)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.ErrorMessage, "timeout: build took longer than maximum duration of 1s")
+
+	r.MaxDuration = 0
+	r.InactivityTimeout = 1
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusTimeout)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.ErrorMessage, "timeout: no output for 1s")
+
+	// Steady output keeps the build alive.
+	r.InactivityTimeout = 2
+	r.BuildScript = "#!/usr/bin/env bash\nfor i in 1 2 3; do echo $i; sleep 1; done\n"
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+}
+
+func TestLimits(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{Name: "lim", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "lim", BuildScript: "#!/usr/bin/env bash\nset -e\necho nofile $(ulimit -n)\nhead -c 2000000 /dev/zero >big\n"}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	r.MaxProcesses = -1
+	tneederr(t, "user:error", func() { api.RepoSave(ctxbg, config.Password, r) })
+
+	// Writing a file larger than the limit fails.
+	r.MaxProcesses = 0
+	r.MaxFileSizeMB = 1
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+
+	r.MaxFileSizeMB = 0
+	r.MaxOpenFiles = 64
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, strings.HasPrefix(b.Steps[1].Output, "nofile 64\n"), true)
+	tcompare(t, b.PeakMemory > 0, true)
+	tcompare(t, b.CPUNsec > 0, true)
+}
+
 func TestToolchains(t *testing.T) {
 	if os.Getenv("DING_TEST_GOTOOLCHAINS") == "" {
 		t.Skip("skipping because DING_TEST_GOTOOLCHAINS is not set")
@@ -234,3 +682,92 @@ func TestToolchains(t *testing.T) {
 
 	api.GoToolchainRemove(ctxbg, config.Password, installed[0])
 }
+
+func TestGoToolchainSteps(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	// Fake toolchains, build.sh doesn't use them.
+	for _, goname := range []string{"go", "goprev"} {
+		p := path.Join(config.GoToolchainDir, goname)
+		os.Remove(p)
+		err := os.Symlink("go1.99."+goname, p)
+		tcheck(t, err, "symlink go toolchain")
+		defer os.Remove(p)
+	}
+
+	const buildScript = `#!/usr/bin/env bash
+set -e
+echo building with $DING_GOTOOLCHAIN $GOTOOLCHAIN
+echo hi>$DING_GOTOOLCHAIN.txt
+echo version: 1.2.3-$DING_GOTOOLCHAIN
+echo release: mycmd linux amd64 $GOTOOLCHAIN $DING_GOTOOLCHAIN.txt
+echo coverage: 50.0
+`
+	r := Repo{Name: "tc", VCS: VCSCommand, Origin: "sh -c 'echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'", DefaultBranch: "main", CheckoutPath: "tc", BuildScript: buildScript}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+	r.GoCur = true
+	r.GoPrev = true
+	r = api.RepoSave(ctxbg, config.Password, r)
+
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, len(b.Steps), 3)
+	tcompare(t, b.Steps[1].Name, "build:go")
+	tcompare(t, strings.HasPrefix(b.Steps[1].Output, "building with go go1.99.go\n"), true)
+	tcompare(t, b.Steps[1].Version, "1.2.3-go")
+	tcompare(t, b.Steps[2].Name, "build:goprev")
+	tcompare(t, b.Steps[2].Version, "1.2.3-goprev")
+	tcompare(t, b.Steps[2].Results[0].Toolchain, "go1.99.goprev")
+	tcompare(t, b.Version, "1.2.3-go")
+	tcompare(t, len(b.Results), 2)
+	tcompare(t, *b.Coverage, float32(50))
+	tcompare(t, b.LastLine, "coverage: 50.0")
+
+	// Failing goprev step stops the build, with an error message for that step.
+	r.BuildScript = "#!/usr/bin/env bash\necho $DING_GOTOOLCHAIN\ntest $DING_GOTOOLCHAIN = go\n"
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, len(b.Steps), 3)
+	tcompare(t, b.Steps[1].ErrorMessage, "")
+	tcompare(t, b.Steps[2].ErrorMessage, "build.sh: exit status 1")
+	tcompare(t, b.ErrorMessage, "build:goprev (go1.99.goprev): build.sh: exit status 1")
+	tcompare(t, b.LastLine, "goprev")
+
+	// Concurrent builds all run to completion, each in their own checkout.
+	r.GoParallel = true
+	r.BuildScript = buildScript + "pwd\ntest $DING_GOTOOLCHAIN = goprev\n"
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, len(b.Steps), 3)
+	tcompare(t, b.ErrorMessage, "build:go (go1.99.go): build.sh: exit status 1")
+	tcompare(t, b.Steps[1].ErrorMessage, "build.sh: exit status 1")
+	tcompare(t, b.Steps[2].ErrorMessage, "")
+	tcompare(t, strings.HasSuffix(b.Steps[2].Output, "/checkout-goprev/tc\n"), true)
+	tcompare(t, b.Steps[2].Results[0].Checkout, "checkout-goprev")
+
+	r.BuildScript = buildScript
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, len(b.Results), 2)
+	tcompare(t, b.Results[0].Checkout, "")
+	tcompare(t, b.Results[1].Checkout, "checkout-goprev")
+	api.ReleaseCreate(ctxbg, config.Password, r.Name, b.ID)
+
+	// The duration of the clone step includes all its commands, not only the last
+	// copy of the checkout.
+	r.Origin = "sh -c 'sleep 0.2; echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'"
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[0].Name, "clone")
+	tcompare(t, b.Steps[0].Nsec >= int64(200*time.Millisecond), true)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/bstore"
+)
+
+// At most this many commits between the last successful build and a failed build
+// are bisected.
+const maxBisectCommits = 1000
+
+// _bisectCommits returns the commits to bisect if build fails: the commits after
+// the commit of the previous build of the branch and job, if it was successful,
+// up to and including the commit of build. Listed with "git rev-list" in the
+// checkout, following only first parents. The zero value is returned if nothing
+// can be bisected.
+func _bisectCommits(ctx, cmdCtx context.Context, build Build, env []string, checkoutDir string) Bisect {
+	var good string
+	_dbread(ctx, func(tx *bstore.Tx) {
+		q := bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: build.RepoName, Branch: build.Branch})
+		q.FilterEqual("Job", build.Job)
+		q.FilterLess("ID", build.ID)
+		q.FilterNotEqual("Status", StatusSuperseded, StatusSkipped)
+		q.FilterFn(func(b Build) bool { return !extraBuild(b) })
+		q.SortDesc("ID")
+		q.Limit(1)
+		b, err := q.Get()
+		if err == bstore.ErrAbsent {
+			return
+		}
+		_checkf(err, "get previous build for branch")
+		if b.Status == StatusSuccess {
+			good = b.CommitHash
+		}
+	})
+	if good == "" || good == build.CommitHash {
+		return Bisect{}
+	}
+
+	log := slog.With("repo", build.RepoName, "buildid", build.ID)
+	git := func(args ...string) (string, error) {
+		argv := slices.Concat(build.RunPrefix, []string{"git"}, args)
+		cmd := exec.CommandContext(cmdCtx, argv[0], argv[1:]...)
+		cmd.Dir = checkoutDir
+		cmd.Env = env
+		buf, err := cmd.Output()
+		return string(buf), err
+	}
+	// E.g. after a force push, the previous commit is not an ancestor.
+	if _, err := git("merge-base", "--is-ancestor", good, build.CommitHash); err != nil {
+		log.Info("previous commit not an ancestor, not bisecting if build fails", "err", err)
+		return Bisect{}
+	}
+	out, err := git("rev-list", "--first-parent", "--reverse", good+".."+build.CommitHash)
+	if err != nil {
+		log.Info("listing commits for bisect, not bisecting if build fails", "err", err)
+		return Bisect{}
+	}
+	commits := strings.Fields(out)
+	if len(commits) == 0 || len(commits) > maxBisectCommits {
+		return Bisect{}
+	}
+	return Bisect{Good: good, Commits: commits, GoodIndex: -1, BadIndex: int32(len(commits) - 1)}
+}
+
+// _bisectNext takes the next step in the bisect of failed build b, and stores the
+// bisect state. If the first failing commit is known, it is stored. Otherwise,
+// unless the bisect was aborted, a low-priority build is started for the commit
+// halfway between the last known good and first known bad commit. The updated
+// build is returned.
+func _bisectNext(ctx context.Context, b Build) Build {
+	var start func()
+	bs := b.Bisect
+	if bs.Error != "" {
+		// Aborted.
+	} else if bs.BadIndex-bs.GoodIndex <= 1 {
+		bs.FirstBad = bs.Commits[bs.BadIndex]
+	} else {
+		commit := bs.Commits[(bs.GoodIndex+bs.BadIndex)/2]
+		repo, nb, buildDir, gotoolchains, err := prepareBuild(ctx, b.RepoName, b.Branch, commit, true, b.Params, buildOpts{bisectBuildID: b.ID, job: b.Job})
+		if err != nil {
+			bs.Error = fmt.Sprintf("creating build for commit %s: %v", commit, err)
+		} else {
+			bs.BuildID = nb.ID
+			start = func() {
+				err := doBuild(context.Background(), repo, nb, buildDir, gotoolchains, false)
+				if err != nil {
+					slog.Error("bisect build", "err", err, "buildid", nb.ID)
+				}
+			}
+		}
+	}
+
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		b = Build{ID: b.ID}
+		err := tx.Get(&b)
+		_checkf(err, "get build for bisect")
+		b.Bisect = bs
+		err = tx.Update(&b)
+		_checkf(err, "storing bisect state")
+	})
+	events <- EventBuild{b}
+
+	// Only started after storing the bisect state, the finished build looks it up.
+	if start != nil {
+		go start()
+	}
+	return b
+}
+
+// _bisectContinue processes the result of a finished build started by a bisect,
+// and takes the next step in the bisect. When the bisect is done, the failure
+// notification for the bisected build is sent, unless the branch has been fixed in
+// the mean time by a build of the same job.
+func _bisectContinue(ctx context.Context, settings Settings, repo Repo, b Build) {
+	var fb Build
+	var fixed bool
+	_dbread(ctx, func(tx *bstore.Tx) {
+		fb = Build{ID: b.BisectBuildID}
+		err := tx.Get(&fb)
+		if err == bstore.ErrAbsent {
+			return
+		}
+		_checkf(err, "get bisected build")
+
+		q := bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: fb.RepoName, Branch: fb.Branch})
+		q.FilterEqual("Job", fb.Job)
+		q.FilterGreater("ID", fb.ID)
+		q.FilterNotEqual("Status", StatusSuperseded, StatusSkipped)
+		q.FilterFn(func(x Build) bool { return x.Finish != nil && !extraBuild(x) })
+		q.SortDesc("ID")
+		q.Limit(1)
+		lb, err := q.Get()
+		if err != bstore.ErrAbsent {
+			_checkf(err, "get latest build of branch")
+			fixed = lb.Status == StatusSuccess
+		}
+	})
+	// The bisected build may have been removed.
+	if fb.Bisect.BuildID != b.ID {
+		return
+	}
+
+	bs := &fb.Bisect
+	bs.BuildID = 0
+	i := int32(slices.Index(bs.Commits, b.CommitHash))
+	switch {
+	case i <= bs.GoodIndex || i >= bs.BadIndex:
+		bs.Error = fmt.Sprintf("build %d is for unexpected commit %q", b.ID, b.CommitHash)
+	case b.Status == StatusSuccess:
+		bs.GoodIndex = i
+	case b.Status == StatusBuild:
+		bs.BadIndex = i
+	default:
+		bs.Error = fmt.Sprintf("build %d for commit %s did not finish: %s", b.ID, b.CommitHash, b.ErrorMessage)
+	}
+	fb = _bisectNext(ctx, fb)
+	if fb.Bisect.BuildID == 0 && !fixed {
+		_sendMailFailing(settings, repo, fb, fb.ErrorMessage)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBisect(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	client := &fakeClient{true, nil}
+	newSMTPClient = func() smtpClient { return client }
+
+	gitRepoDir := testGitRepo(t, "bisect")
+	commits := []string{
+		testGitCommit(t, gitRepoDir, "true"),
+		testGitCommit(t, gitRepoDir, "true"),
+		testGitCommit(t, gitRepoDir, "touch", "broken"),
+		testGitCommit(t, gitRepoDir, "true"),
+		testGitCommit(t, gitRepoDir, "true"),
+	}
+
+	r := Repo{
+		Name:          "bisect",
+		VCS:           VCSCommand,
+		Origin:        gitRepoDir,
+		DefaultBranch: "main",
+		CheckoutPath:  "bisect",
+		BuildScript:   "#!/usr/bin/env bash\nset -e\ntest ! -f broken\n",
+		Bisect:        true,
+	}
+	tneederr(t, "user:error", func() { api.RepoCreate(ctxbg, config.Password, r) })
+	r.VCS = VCSGit
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	good := api.BuildCreate(ctxbg, config.Password, r.Name, "main", commits[0], false, nil)
+	twaitBuild(t, good, StatusSuccess)
+	failed := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, failed, StatusBuild)
+
+	for i := 0; ; i++ {
+		failed = api.Build(ctxbg, config.Password, r.Name, failed.ID)
+		if failed.Bisect.BuildID == 0 {
+			break
+		} else if i >= 100 {
+			t.Fatalf("bisect not done in 10 seconds")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	tcompare(t, failed.Bisect.Good, commits[0])
+	tcompare(t, failed.Bisect.Commits, commits[1:])
+	tcompare(t, failed.Bisect.Error, "")
+	tcompare(t, failed.Bisect.FirstBad, commits[2])
+
+	// The commit halfway was built first, then the commit before it.
+	builds := api.Builds(ctxbg, config.Password, r.Name)
+	tcompare(t, len(builds), 4)
+	for i, commit := range []string{commits[1], commits[2]} {
+		b := builds[i]
+		tcompare(t, b.CommitHash, commit)
+		tcompare(t, b.BisectBuildID, failed.ID)
+		tcompare(t, b.LowPrio, true)
+	}
+
+	// A single failure notification, once the bisect was done.
+	tcompare(t, client.recipients, []string{config.Notify.Email})
+
+	// Bisect builds are not the latest of the branch.
+	for _, rb := range api.RepoBuilds(ctxbg, config.Password) {
+		if rb.Repo.Name == r.Name {
+			tcompare(t, len(rb.Builds), 1)
+			tcompare(t, rb.Builds[0].ID, failed.ID)
+		}
+	}
+
+	// A failure after a failure is not bisected.
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, len(b.Bisect.Commits), 0)
+}
@@ -87,20 +87,33 @@ func bitbucketHookHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing push event", http.StatusBadRequest)
 		return
 	}
+	params, err := webhookParams(r)
+	if err != nil {
+		slog.Debug("bitbucket webhook: bad parameters", "err", err)
+		http.Error(w, "bad parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ignored []string
 	for _, change := range event.Push.Changes {
 		if change.New == nil {
 			continue
 		}
-		var branch string
+		var kind, branch string
 		switch change.New.Type {
 		case "branch", "named_branch":
+			kind = "branch"
 			branch = change.New.Name
+			if reason := refIgnored(repo, kind, branch); reason != "" {
+				ignored = append(ignored, reason)
+				continue
+			}
 		case "tag":
-			// todo: fix for silly assumption that people only tag in master/default branch (eg after merge)
-			branch = "master"
-			if repo.VCS == "hg" {
-				branch = "default"
+			kind = "tag"
+			if reason := refIgnored(repo, kind, change.New.Name); reason != "" {
+				ignored = append(ignored, reason)
+				continue
 			}
+			branch = tagBranch(change.New.Name)
 		default:
 			// We ignore bookmarks.
 			continue
@@ -109,7 +122,7 @@ func bitbucketHookHandler(w http.ResponseWriter, r *http.Request) {
 		if change.New.Target != nil {
 			if change.New.Target.Type == "commit" {
 				commit := change.New.Target.Hash
-				repo, build, buildDir, gotoolchains, err := prepareBuild(r.Context(), repoName, branch, commit, false)
+				repo, build, buildDir, gotoolchains, err := prepareBuild(r.Context(), repoName, branch, commit, false, params, buildOpts{})
 				if err != nil {
 					slog.Error("bitbucket webhook: error starting build for push event", "repo", repoName, "branch", branch, "commit", commit, "err", err)
 					http.Error(w, "could not create build", http.StatusInternalServerError)
@@ -121,10 +134,15 @@ func bitbucketHookHandler(w http.ResponseWriter, r *http.Request) {
 						slog.Error("build", "err", err)
 					}
 				}()
+				startJobBuilds(r.Context(), repo, kind, change.New.Name, branch, commit, params, buildOpts{})
 			} else {
 				http.Error(w, "New build target is empty", http.StatusInternalServerError)
 			}
 		}
 	}
+	if len(ignored) > 0 {
+		webhookIgnored(w, ignored...)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
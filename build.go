@@ -8,14 +8,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mjl-/bstore"
@@ -29,30 +33,54 @@ import (
 // httpserve process can run commands to clone a repository. The root serve process
 // runs the actual builds.
 type buildCommand struct {
-	ctx    context.Context
-	cancel func()
+	ctx        context.Context
+	cancel     func()
+	refs       int          // Number of registrations, for concurrent build steps in the root process.
+	lastOutput atomic.Int64 // Time of last output of a command, in unix nanoseconds, for the inactivity timeout.
 }
 
 var buildIDCommands = struct {
 	sync.Mutex
-	commands map[int32]buildCommand
+	commands map[int32]*buildCommand
 }{
-	commands: make(map[int32]buildCommand),
+	commands: make(map[int32]*buildCommand),
 }
 
-// buildIDCommandRegister makes a new context for a buildID.
-// Once the build is done, buildIDCommandCancel must be called.
-func buildIDCommandRegister(buildID int32) buildCommand {
-	ctx, cancel := context.WithCancel(context.Background())
-	bc := buildCommand{ctx, cancel}
+// buildIDCommandRegister makes a new context for a buildID, or returns the
+// existing context if a command for the build is already registered, e.g. for
+// build steps running concurrently. Once the command is done,
+// buildIDCommandRelease or buildIDCommandCancel must be called.
+func buildIDCommandRegister(buildID int32) *buildCommand {
 	buildIDCommands.Lock()
-	buildIDCommands.commands[buildID] = bc
-	buildIDCommands.Unlock()
+	defer buildIDCommands.Unlock()
+	bc, ok := buildIDCommands.commands[buildID]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		bc = &buildCommand{ctx: ctx, cancel: cancel}
+		buildIDCommands.commands[buildID] = bc
+	}
+	bc.refs++
 	return bc
 }
 
+// buildIDCommandRelease is called when a command registered with
+// buildIDCommandRegister is done. The context is cleaned up when no other
+// commands for the build are still running.
+func buildIDCommandRelease(buildID int32, bc *buildCommand) {
+	buildIDCommands.Lock()
+	defer buildIDCommands.Unlock()
+	bc.refs--
+	if bc.refs > 0 {
+		return
+	}
+	if buildIDCommands.commands[buildID] == bc {
+		delete(buildIDCommands.commands, buildID)
+	}
+	bc.cancel()
+}
+
 // buildIDCommandCancel must be called to cleanup the context-with-cancel. It is
-// also called to abort a running command.
+// also called to abort running commands.
 func buildIDCommandCancel(buildID int32) {
 	buildIDCommands.Lock()
 	bc, ok := buildIDCommands.commands[buildID]
@@ -64,6 +92,78 @@ func buildIDCommandCancel(buildID int32) {
 	}
 }
 
+// buildIDCommandOutput records that a command of the build wrote output.
+func buildIDCommandOutput(buildID int32) {
+	buildIDCommands.Lock()
+	bc := buildIDCommands.commands[buildID]
+	buildIDCommands.Unlock()
+	if bc != nil {
+		bc.lastOutput.Store(time.Now().UnixNano())
+	}
+}
+
+// buildCancelCommands aborts the commands of a build, both in this process, like
+// cloning, and the build command controlled by the serve process.
+func buildCancelCommands(buildID int32) {
+	buildIDCommandCancel(buildID)
+
+	cancelMsg := msg{CancelCommand: &msgCancelCommand{buildID}}
+	go func() {
+		err := requestPrivileged(cancelMsg)
+		if err != nil {
+			slog.Error("requesting build cancel", "err", err)
+		}
+	}()
+}
+
+// watchBuild cancels the build when it runs longer than maxDuration, or when
+// its commands write no output for longer than inactivity. Zero durations mean no
+// limit. The returned function must be called when the build is done. It returns
+// the reason the build was cancelled, or an empty string.
+func watchBuild(bc *buildCommand, buildID int32, maxDuration, inactivity time.Duration) (stop func() (reason string)) {
+	start := time.Now()
+	bc.lastOutput.Store(start.UnixNano())
+
+	done := make(chan struct{})
+	result := make(chan string, 1)
+	go func() {
+		var reason string
+		defer func() {
+			result <- reason
+		}()
+
+		if maxDuration == 0 && inactivity == 0 {
+			<-done
+			return
+		}
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if maxDuration > 0 && now.Sub(start) >= maxDuration {
+					reason = fmt.Sprintf("timeout: build took longer than maximum duration of %s", maxDuration)
+				} else if inactivity > 0 && now.Sub(time.Unix(0, bc.lastOutput.Load())) >= inactivity {
+					reason = fmt.Sprintf("timeout: no output for %s", inactivity)
+				} else {
+					continue
+				}
+				slog.Info("cancelling build", "buildid", buildID, "reason", reason)
+				buildCancelCommands(buildID)
+				<-done
+				return
+			}
+		}
+	}()
+	return func() string {
+		close(done)
+		return <-result
+	}
+}
+
 func repoGoToolchains(repo Repo) (GoToolchains, error) {
 	var tc GoToolchains
 	if repo.GoAuto {
@@ -101,14 +201,173 @@ func repoGoToolchains(repo Repo) (GoToolchains, error) {
 	return tc, nil
 }
 
-func _prepareBuild(ctx context.Context, repoName, branch, commit string, lowPrio bool) (repo Repo, build Build, buildDir string, gotoolchains GoToolchains) {
+// _buildParams returns the values for all parameters of the repo, from params or
+// the defaults. Params must only have parameters of the repo.
+func _buildParams(repo Repo, params []Param) []Param {
+	values := map[string]string{}
+	for _, p := range params {
+		if _, ok := values[p.Name]; ok {
+			_userError(fmt.Sprintf("Duplicate parameter %q", p.Name))
+		}
+		if !slices.ContainsFunc(repo.Params, func(rp Param) bool { return rp.Name == p.Name }) {
+			_userError(fmt.Sprintf("Unknown parameter %q", p.Name))
+		}
+		if strings.ContainsRune(p.Value, 0) {
+			_userError(fmt.Sprintf("Value for parameter %q cannot contain NUL byte", p.Name))
+		}
+		values[p.Name] = p.Value
+	}
+
+	var l []Param
+	for _, rp := range repo.Params {
+		if v, ok := values[rp.Name]; ok {
+			rp.Value = v
+		}
+		l = append(l, rp)
+	}
+	return l
+}
+
+// parseParam parses a parameter of the form "name=value", as used on the
+// command-line and in webhook URLs.
+func parseParam(s string) (Param, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return Param{}, fmt.Errorf("parameter %q not of the form name=value", s)
+	}
+	return Param{name, value}, nil
+}
+
+// buildEnvironment returns the additional environment variables and run prefix
+// for a build of branch. The global settings are applied first, then those of
+// the repository, then those of each branch pattern that matches, in order. A
+// variable replaces an earlier variable with the same name. A run prefix is
+// appended to the run prefix so far, unless it is configured to replace it.
+func buildEnvironment(settings Settings, repo Repo, branch string) (env, runPrefix []string) {
+	add := func(l, prefix []string, replace bool) {
+		for _, kv := range l {
+			k, _, _ := strings.Cut(kv, "=")
+			env = slices.DeleteFunc(env, func(s string) bool { return strings.HasPrefix(s, k+"=") })
+			env = append(env, kv)
+		}
+		if replace {
+			runPrefix = nil
+		}
+		runPrefix = append(runPrefix, prefix...)
+	}
+	add(settings.Environment, settings.RunPrefix, true)
+	add(repo.Environment, repo.RunPrefix, repo.ReplaceRunPrefix)
+	for _, be := range repo.BranchEnvs {
+		if ok, _ := path.Match(be.Pattern, branch); ok {
+			add(be.Environment, be.RunPrefix, be.ReplaceRunPrefix)
+		}
+	}
+	return
+}
+
+// pullRequest is a pull request (GitHub) or merge request (Gitea) to build, from
+// a webhook.
+type pullRequest struct {
+	number int32
+	source string // Source branch, possibly in another repository.
+	target string // Branch the pull request is to be merged into.
+}
+
+// branch returns the branch name for builds of the pull request.
+func (pr pullRequest) branch() string {
+	return fmt.Sprintf("pull/%d", pr.number)
+}
+
+// tagBranch returns the branch name for builds of a tag.
+func tagBranch(tag string) string {
+	return "tags/" + tag
+}
+
+// pushEarlier returns whether b is a build of a commit before the head commit of
+// a push, see Repo.PushCommitBuilds. Such builds don't count as the latest build
+// of their branch.
+func pushEarlier(b Build) bool {
+	return b.PushBuildID != 0 && b.PushBuildID != b.ID
+}
+
+// extraBuild returns whether b is an additional build of an older commit of its
+// branch, for an earlier commit of a push or for a bisect. Such builds don't count
+// as the latest build of their branch.
+func extraBuild(b Build) bool {
+	return pushEarlier(b) || b.BisectBuildID != 0
+}
+
+// buildOpts holds optional details for creating a build.
+type buildOpts struct {
+	// If set, the build is for this pull request, and the branch of the build must be
+	// its branch().
+	pr *pullRequest
+
+	// Files changed by a push, from a webhook. If none are relevant according to the
+	// path patterns of the repository, the build is created with status skipped,
+	// otherwise the files are not listed again after the clone. Nil if not known.
+	changedFiles []string
+
+	// For builds of the commits of a push, see Build.PushBuildID. When creating the
+	// build of the head commit, pushBuildID is zero and is set to the ID of the new
+	// build.
+	pushBuildID  int32
+	pushPosition int32
+
+	// For builds started by a bisect, see Build.BisectBuildID.
+	bisectBuildID int32
+
+	// If set, the build is triggered by this build of an upstream repository, see
+	// Repo.Downstreams.
+	upstream *Build
+
+	// If set, the build is for this job of the repository, see Repo.Jobs.
+	job string
+}
+
+// jobRepo returns repo with the build scripts and Go toolchains of its job with
+// name, for creating and running builds of the job. The path patterns of the job
+// apply in addition to those of repo, see buildPathPatterns. For an empty name,
+// repo is returned as is. False is returned if the job does not exist.
+func jobRepo(repo Repo, name string) (Repo, bool) {
+	if name == "" {
+		return repo, true
+	}
+	for _, j := range repo.Jobs {
+		if j.Name == name {
+			repo.BuildScript = j.BuildScript
+			repo.BuildScriptPath = j.BuildScriptPath
+			repo.GoAuto = j.GoAuto
+			repo.GoCur = j.GoCur
+			repo.GoPrev = j.GoPrev
+			repo.GoNext = j.GoNext
+			return repo, true
+		}
+	}
+	return Repo{}, false
+}
+
+// _prepareBuild creates a new build. A branch of the form "tags/<name>", see
+// tagBranch, creates a build of the tag. Builds that are skipped are finished
+// immediately, callers must not start them.
+func _prepareBuild(ctx context.Context, repoName, branch, commit string, lowPrio bool, params []Param, opts buildOpts) (repo Repo, build Build, buildDir string, gotoolchains GoToolchains) {
 	_dbwrite(ctx, func(tx *bstore.Tx) {
 		repo = _repo(tx, repoName)
+		if r, ok := jobRepo(repo, opts.job); !ok {
+			_userError(fmt.Sprintf("Job %q not found", opts.job))
+		} else {
+			repo = r
+		}
 
 		var err error
 		gotoolchains, err = repoGoToolchains(repo)
 		_checkf(err, "get go toolchains to build for")
 
+		settings := Settings{ID: 1}
+		err = tx.Get(&settings)
+		_checkf(err, "get settings")
+		env, runPrefix := buildEnvironment(settings, repo, branch)
+
 		b := Build{
 			RepoName:    repo.Name,
 			Branch:      branch,
@@ -116,9 +375,51 @@ func _prepareBuild(ctx context.Context, repoName, branch, commit string, lowPrio
 			Status:      StatusNew,
 			LowPrio:     lowPrio,
 			BuildScript: repo.BuildScript,
+			Job:         opts.job,
+			Params:      _buildParams(repo, params),
+			Environment: env,
+			RunPrefix:   runPrefix,
+		}
+		if pr := opts.pr; pr != nil {
+			b.RefType = RefPullRequest
+			b.PullRequest = pr.number
+			b.PullRequestSource = pr.source
+			b.PullRequestTarget = pr.target
+		} else if tag, ok := strings.CutPrefix(branch, "tags/"); ok {
+			if tag == "" {
+				_userError("Tag cannot be empty")
+			}
+			b.RefType = RefTag
+			b.Tag = tag
+		} else {
+			b.RefType = RefBranch
+		}
+		if reason := pathsSkipReason(buildPathPatterns(repo, opts.job), opts.changedFiles); reason != "" && !lowPrio && b.RefType == RefBranch {
+			now := time.Now()
+			b.Status = StatusSkipped
+			b.Finish = &now
+			b.ErrorMessage = reason
+		} else if opts.changedFiles != nil {
+			b.pathsMatched = true
+		}
+		if opts.pushPosition > 0 && b.Status != StatusSkipped {
+			b.PushBuildID = opts.pushBuildID
+			b.PushPosition = opts.pushPosition
+		}
+		b.BisectBuildID = opts.bisectBuildID
+		if ub := opts.upstream; ub != nil {
+			b.UpstreamRepoName = ub.RepoName
+			b.UpstreamBuildID = ub.ID
+			b.UpstreamVersion = ub.Version
+			b.UpstreamRepos = append(slices.Clone(ub.UpstreamRepos), ub.RepoName)
 		}
 		err = tx.Insert(&b)
 		_checkf(err, "inserting new build into database")
+		if b.PushPosition > 0 && b.PushBuildID == 0 {
+			b.PushBuildID = b.ID
+			err = tx.Update(&b)
+			_checkf(err, "linking build to its push")
+		}
 
 		buildDir = fmt.Sprintf("%s/build/%s/%d", dingDataDir, repo.Name, b.ID)
 		err = os.MkdirAll(buildDir, 0777)
@@ -164,7 +465,7 @@ func _writeFile(path, content string) {
 	_checkf(err, "writing file")
 }
 
-func prepareBuild(ctx context.Context, repoName, branch, commit string, lowPrio bool) (repo Repo, build Build, buildDir string, gotoolchains GoToolchains, err error) {
+func prepareBuild(ctx context.Context, repoName, branch, commit string, lowPrio bool, params []Param, opts buildOpts) (repo Repo, build Build, buildDir string, gotoolchains GoToolchains, err error) {
 	if branch == "" {
 		err = fmt.Errorf("branch cannot be empty")
 		return
@@ -178,7 +479,7 @@ func prepareBuild(ctx context.Context, repoName, branch, commit string, lowPrio
 			}
 		}
 	}()
-	repo, build, buildDir, gotoolchains = _prepareBuild(ctx, repoName, branch, commit, lowPrio)
+	repo, build, buildDir, gotoolchains = _prepareBuild(ctx, repoName, branch, commit, lowPrio, params, opts)
 	return repo, build, buildDir, gotoolchains, nil
 }
 
@@ -197,19 +498,111 @@ func doBuild(ctx context.Context, repo Repo, build Build, buildDir string, gotoo
 }
 
 func _doBuild(ctx context.Context, repo Repo, build Build, buildDir string, gotoolchains GoToolchains, newGoToolchain bool) {
+	if build.Status == StatusSkipped {
+		return
+	}
+	if repo.SupersedeBuilds && !build.LowPrio {
+		_supersedeBuilds(ctx, repo, build)
+	}
+
 	job := job{
 		repo.Name,
+		build.Branch,
+		build.ID,
 		build.LowPrio,
-		make(chan struct{}),
+		false,
+		repo.MaxBuilds,
+		make(chan bool),
 	}
 	newJobs <- job
-	<-job.rc
+	if !<-job.rc {
+		// Removed from queue, build has been marked as cancelled.
+		return
+	}
 	defer func() {
-		finishedJobs <- job.repoName
+		finishedJobs <- job
 	}()
 	_doBuild0(ctx, repo, build, buildDir, gotoolchains, newGoToolchain)
 }
 
+// _supersedeBuilds cancels builds for the branch and job of build that are waiting
+// in the queue, and with SupersedeRunning, builds for the branch and job that are
+// running. They are marked as superseded by build.
+func _supersedeBuilds(ctx context.Context, repo Repo, build Build) {
+	// Only older builds are superseded, not e.g. builds of earlier commits of the same
+	// push, created after the build of the head commit. Builds of earlier commits and
+	// for bisects are never superseded: they are for older commits on purpose, and a
+	// bisect would be abandoned. Queued builds don't record their job, so we look up
+	// the candidates first.
+	older := map[int32]bool{}
+	_dbread(ctx, func(tx *bstore.Tx) {
+		q := bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: repo.Name, Branch: build.Branch})
+		q.FilterEqual("Job", build.Job)
+		q.FilterLess("ID", build.ID)
+		q.FilterFn(func(b Build) bool { return b.Finish == nil && !extraBuild(b) })
+		err := q.ForEach(func(b Build) error {
+			older[b.ID] = true
+			return nil
+		})
+		_checkf(err, "listing builds to supersede")
+	})
+	if len(older) == 0 {
+		return
+	}
+
+	var removed []job
+	var running []int32
+	jobQueueDo(func(q *jobQueue) {
+		removed = q.remove(func(j job) bool {
+			return j.repoName == repo.Name && older[j.buildID]
+		})
+		if repo.SupersedeRunning {
+			for _, j := range q.active {
+				if j.repoName == repo.Name && older[j.buildID] {
+					running = append(running, j.buildID)
+				}
+			}
+		}
+	})
+
+	var ids []int32
+	for _, j := range removed {
+		ids = append(ids, j.buildID)
+	}
+	ids = append(ids, running...)
+	if len(ids) == 0 {
+		return
+	}
+
+	var builds []Build
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		for _, id := range ids {
+			b := Build{ID: id}
+			err := tx.Get(&b)
+			_checkf(err, "get build to supersede")
+			if b.Finish != nil {
+				continue
+			}
+			now := time.Now()
+			b.Finish = &now
+			b.Status = StatusSuperseded
+			b.SupersededBy = build.ID
+			b.ErrorMessage = fmt.Sprintf("Superseded by build %d", build.ID)
+			b.Steps = _buildSteps(b)
+			err = tx.Update(&b)
+			_checkf(err, "marking build as superseded in database")
+			builds = append(builds, b)
+		}
+	})
+	for _, b := range builds {
+		slog.Info("build superseded", "repo", repo.Name, "branch", build.Branch, "buildid", b.ID, "supersededby", build.ID)
+		events <- EventBuild{b}
+	}
+	for _, id := range running {
+		buildCancelCommands(id)
+	}
+}
+
 func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, gotoolchains GoToolchains, newGoToolchain bool) {
 	slog.Debug("building", "repo", repo.Name, "buildid", build.ID)
 
@@ -228,6 +621,9 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 	err = database.Get(ctx, &settings)
 	_checkf(err, "get settings")
 
+	// Cancel the build if it takes too long, or seems stuck.
+	stopWatch := watchBuild(buildCmd, build.ID, time.Duration(repo.MaxDuration)*time.Second, time.Duration(repo.InactivityTimeout)*time.Second)
+
 	var homeDir string
 	if repo.UID != nil {
 		homeDir = fmt.Sprintf("%s/home/%s", dingDataDir, repo.Name)
@@ -235,7 +631,23 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		homeDir = fmt.Sprintf("%s/home", buildDir)
 	}
 
+	// Results of finished build steps, by name. Merged into the steps read from disk
+	// when the build is finished.
+	stepResults := map[string]Step{}
+
+	// Commits to bisect if the build fails, see Repo.Bisect. Listed after the clone.
+	var bisect Bisect
+
+	// Resource usage of the build script, over all build steps.
+	var usage struct {
+		sync.Mutex
+		peakMemory int64
+		cpuNsec    int64
+	}
+
 	defer func() {
+		timeoutReason := stopWatch()
+
 		build.DiskUsage = buildDiskUsage(buildDir)
 
 		var homeDiskUsage, homeDiskUsageDelta int64
@@ -255,7 +667,19 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 			b.Finish = &now
 			b.DiskUsage = build.DiskUsage
 			b.HomeDiskUsageDelta = homeDiskUsageDelta
+			usage.Lock()
+			b.PeakMemory = usage.peakMemory
+			b.CPUNsec = usage.cpuNsec
+			usage.Unlock()
 			b.Steps = _buildSteps(b)
+			for i, st := range b.Steps {
+				if sr, ok := stepResults[st.Name]; ok {
+					sr.Output = st.Output
+					sr.Nsec = st.Nsec
+					b.Steps[i] = sr
+				}
+			}
+			b.TestsPassed, b.TestsFailed, b.TestsSkipped = testCounts(b.Steps)
 			err = tx.Update(&b)
 			_checkf(err, "marking build as finished in database")
 
@@ -278,6 +702,12 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		_cleanupBuilds(ctx, repo.Name, build.Branch)
 
 		r := recover()
+		if r != nil && timeoutReason != "" {
+			// The error from the build is likely about the command being killed, the timeout
+			// is more helpful.
+			r = &sherpa.Error{Code: "user:error", Message: timeoutReason}
+		}
+		var superseded bool
 		if r != nil {
 			var errmsg string
 			if serr, ok := r.(*sherpa.Error); ok {
@@ -290,20 +720,53 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 				err := tx.Get(&b)
 				_checkf(err, "get build after error")
 				b.ErrorMessage = errmsg
+				if timeoutReason != "" {
+					b.Status = StatusTimeout
+				} else if b.SupersededBy != 0 {
+					// The build was cancelled due to a newer build, the error is not interesting.
+					superseded = true
+					b.Status = StatusSuperseded
+					b.ErrorMessage = fmt.Sprintf("Superseded by build %d", b.SupersededBy)
+				}
 				err = tx.Update(&b)
 				_checkf(err, "update error message for build in database")
 			})
 			events <- EventBuild{b}
+		}
+
+		if b.Status != StatusSkipped {
+			reportCommitStatus(repo, b, buildCommitState(b))
+		}
+
+		if r != nil {
 			if serr, ok := r.(*sherpa.Error); !ok || serr.Code != "user:error" {
 				panic(r)
 			}
 		}
 
-		// Get previous build status for same repo/branch, and send email when this breaks
-		// or fixes the build for this branch.
+		if b.BisectBuildID != 0 {
+			_bisectContinue(ctx, settings, repo, b)
+		}
+
+		// Superseded builds didn't break anything, and the newer build will send an
+		// email if needed. Skipped builds didn't build anything. Builds of earlier commits
+		// of a push and for bisects are not the latest state of the branch.
+		if superseded || b.Status == StatusSkipped || extraBuild(b) {
+			return
+		}
+
+		if r == nil && b.Status == StatusSuccess {
+			triggerDownstreams(ctx, repo, b, false)
+		}
+
+		// Get previous build status for same repo/branch/job, and send email when this
+		// breaks or fixes the build for this branch. Superseded and skipped builds, and
+		// builds of earlier commits of a push and for bisects don't count.
 		var prevStatus BuildStatus
 		_dbread(ctx, func(tx *bstore.Tx) {
-			q := bstore.QueryTx[Build](tx).FilterNonzero(Build{Branch: build.Branch, RepoName: repo.Name}).SortDesc("ID")
+			q := bstore.QueryTx[Build](tx).FilterNonzero(Build{Branch: build.Branch, RepoName: repo.Name}).FilterNotEqual("Status", StatusSuperseded, StatusSkipped).SortDesc("ID")
+			q.FilterEqual("Job", build.Job)
+			q.FilterFn(func(b Build) bool { return !extraBuild(b) })
 			_, err := q.Next()
 			if err == bstore.ErrAbsent {
 				return
@@ -322,7 +785,14 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 			} else {
 				errmsg = fmt.Sprintf("%v", r)
 			}
-			_sendMailFailing(settings, repo, build, errmsg)
+			// With a bisect, the notification is sent when the first failing commit is found.
+			if prevStatus == StatusSuccess && b.Status == StatusBuild && len(bisect.Commits) > 0 {
+				b.Bisect = bisect
+				b = _bisectNext(ctx, b)
+			}
+			if b.Bisect.BuildID == 0 {
+				_sendMailFailing(settings, repo, b, errmsg)
+			}
 		}
 		if r == nil && !(prevStatus == "" || prevStatus == StatusSuccess) {
 			_sendMailFixed(settings, repo, build)
@@ -373,6 +843,29 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		"DING_BRANCH=" + build.Branch,
 		"DING_COMMIT=" + build.CommitHash,
 	}
+	if build.PullRequest != 0 {
+		env = append(env,
+			fmt.Sprintf("DING_PULLREQUEST=%d", build.PullRequest),
+			"DING_PULLREQUEST_SOURCE="+build.PullRequestSource,
+			"DING_PULLREQUEST_TARGET="+build.PullRequestTarget,
+		)
+	}
+	if build.Tag != "" {
+		env = append(env, "DING_TAG="+build.Tag)
+	}
+	if build.Job != "" {
+		env = append(env, "DING_JOB="+build.Job)
+	}
+	if build.UpstreamBuildID != 0 {
+		env = append(env,
+			"DING_UPSTREAM_REPONAME="+build.UpstreamRepoName,
+			fmt.Sprintf("DING_UPSTREAM_BUILDID=%d", build.UpstreamBuildID),
+			"DING_UPSTREAM_VERSION="+build.UpstreamVersion,
+		)
+	}
+	for _, p := range build.Params {
+		env = append(env, "DING_PARAM_"+p.Name+"="+p.Value)
+	}
 	var toolchainDir, envToolchainDir string
 	if config.GoToolchainDir != "" {
 		toolchainDir = config.GoToolchainDir
@@ -393,14 +886,26 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 			env = append(env, "DING_TOOLCHAINDIR="+envToolchainDir)
 		}
 	}
-	env = append(env, settings.Environment...)
+	env = append(env, build.Environment...)
 
 	runPrefix := func(args ...string) []string {
-		if len(settings.RunPrefix) > 0 {
-			args = append(settings.RunPrefix, args...)
+		return slices.Concat(build.RunPrefix, args)
+	}
+
+	// The clone step runs multiple commands. Their durations are added up, and written
+	// when the step is done, or has failed.
+	var cloneElapsed time.Duration
+	cloneDone := false
+	finishClone := func() {
+		if cloneDone {
+			return
+		}
+		cloneDone = true
+		if err := writeStepNsec(buildDir, "clone", cloneElapsed); err != nil {
+			slog.Error("writing duration of clone step", "err", err)
 		}
-		return args
 	}
+	defer finishClone()
 
 	_updateStatus(StatusClone, true)
 	switch repo.VCS {
@@ -409,18 +914,46 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		// git source repo's. We have to clone as the user running ding. Otherwise, git
 		// clone won't work due to ssh refusing to run as a user without a username ("No
 		// user exists for uid ...")
-		err = run(buildCmd.ctx, build.ID, settings.RunPrefix, env, "clone", buildDir, buildDir, runPrefix("git", "clone", "--recursive", "--no-hardlinks", "--branch", build.Branch, repo.Origin, "checkout/"+repo.CheckoutPath)...)
-		_checkUserf(err, "cloning git repository")
+		if build.PullRequest == 0 {
+			// Git clone also accepts a tag for --branch.
+			ref := build.Branch
+			if build.Tag != "" {
+				ref = build.Tag
+			}
+			err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, buildDir, runPrefix("git", "clone", "--recursive", "--no-hardlinks", "--branch", ref, repo.Origin, "checkout/"+repo.CheckoutPath)...)
+			_checkUserf(err, "cloning git repository")
+		} else {
+			// The head of a pull request is not a branch, both GitHub and Gitea make it
+			// available as a ref we fetch after cloning. Submodules are initialized after
+			// checking out the revision.
+			prDir := buildDir + "/checkout/" + repo.CheckoutPath
+			err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, buildDir, runPrefix("git", "clone", "--no-checkout", "--no-hardlinks", repo.Origin, "checkout/"+repo.CheckoutPath)...)
+			_checkUserf(err, "cloning git repository")
+			err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, prDir, runPrefix("git", "fetch", "origin", fmt.Sprintf("refs/pull/%d/head", build.PullRequest))...)
+			_checkUserf(err, "fetching pull request")
+			err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, prDir, runPrefix("git", "checkout", "--detach", "FETCH_HEAD")...)
+			_checkUserf(err, "checkout pull request")
+		}
 	case VCSMercurial:
-		cmd := []string{"hg", "clone", "--branch", build.Branch}
-		if build.CommitHash != "" {
-			cmd = append(cmd, "--rev", build.CommitHash, "--updaterev", build.CommitHash)
+		// Mercurial only accepts named branches for --branch, a tag is a revision.
+		var cmd []string
+		if build.Tag == "" {
+			cmd = []string{"hg", "clone", "--branch", build.Branch}
+		} else {
+			cmd = []string{"hg", "clone"}
+		}
+		rev := build.CommitHash
+		if rev == "" {
+			rev = build.Tag
+		}
+		if rev != "" {
+			cmd = append(cmd, "--rev", rev, "--updaterev", rev)
 		}
 		cmd = append(cmd, repo.Origin, "checkout/"+repo.CheckoutPath)
-		err = run(buildCmd.ctx, build.ID, settings.RunPrefix, env, "clone", buildDir, buildDir, runPrefix(cmd...)...)
+		err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, buildDir, runPrefix(cmd...)...)
 		_checkUserf(err, "cloning mercurial repository")
 	case VCSCommand:
-		err = run(buildCmd.ctx, build.ID, settings.RunPrefix, env, "clone", buildDir, buildDir, runPrefix("sh", "-c", repo.Origin)...)
+		err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, buildDir, runPrefix("sh", "-c", repo.Origin)...)
 		_checkUserf(err, "cloning repository from command")
 	default:
 		_serverError("unexpected VCS " + string(repo.VCS))
@@ -471,11 +1004,93 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		})
 	}
 
+	// Without changes to relevant files since the previously built commit of the
+	// branch, the build is skipped. The defer above finishes the build. Changed files
+	// from a webhook that matched when creating the build are trusted.
+	if patterns := buildPathPatterns(repo, build.Job); repo.VCS == VCSGit && len(patterns) > 0 && !build.pathsMatched && !build.LowPrio && build.PullRequest == 0 && build.Tag == "" {
+		files := _changedFiles(ctx, buildCmd.ctx, build, env, checkoutDir)
+		if reason := pathsSkipReason(patterns, files); reason != "" {
+			_dbwrite(ctx, func(tx *bstore.Tx) {
+				b := Build{ID: build.ID}
+				err := tx.Get(&b)
+				_checkf(err, "get build to skip")
+				b.Status = StatusSkipped
+				b.ErrorMessage = reason
+				err = tx.Update(&b)
+				_checkf(err, "marking build as skipped in database")
+			})
+			return
+		}
+	}
+
+	if repo.Bisect && repo.VCS == VCSGit && build.RefType == RefBranch && !extraBuild(build) {
+		bisect = _bisectCommits(ctx, buildCmd.ctx, build, env, checkoutDir)
+	}
+
+	reportCommitStatus(repo, build, commitPending)
+
 	if repo.VCS == VCSGit {
-		err = run(buildCmd.ctx, build.ID, settings.RunPrefix, env, "clone", buildDir, checkoutDir, runPrefix("git", "checkout", "--detach", build.CommitHash)...)
+		err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, checkoutDir, runPrefix("git", "checkout", "--detach", build.CommitHash)...)
 		_checkUserf(err, "checkout revision")
+		if build.PullRequest != 0 {
+			err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, checkoutDir, runPrefix("git", "submodule", "update", "--init", "--recursive")...)
+			_checkUserf(err, "initializing submodules")
+		}
+	}
+
+	if repo.BuildScriptPath != "" {
+		build = _buildScriptFromCheckout(ctx, build, buildDir, checkoutDir, repo.BuildScriptPath)
+	}
+
+	// Without Go toolchains and build matrix, we have a single "build" step. Otherwise
+	// we run build.sh for each combination in its own step, so its output and results
+	// can be seen separately.
+	type buildStep struct {
+		name      string
+		goname    string
+		goversion string
+		matrix    []Param // Values for the axes of the build matrix.
+		checkout  string  // Directory in build dir, "checkout" or "checkout-<cell>", e.g. "checkout-goprev-linux".
+	}
+	buildSteps := []buildStep{{"build", "", "", nil, "checkout"}}
+	var zt GoToolchains
+	if gotoolchains != zt {
+		buildSteps = nil
+		addStep := func(goname, goversion string) {
+			if goversion != "" {
+				buildSteps = append(buildSteps, buildStep{"build:" + goname, goname, goversion, nil, "checkout"})
+			}
+		}
+		addStep("go", gotoolchains.Go)
+		addStep("goprev", gotoolchains.GoPrev)
+		addStep("gonext", gotoolchains.GoNext)
+	}
+	for _, axis := range repo.Matrix {
+		var l []buildStep
+		for _, bs := range buildSteps {
+			for _, v := range axis.Values {
+				nbs := bs
+				nbs.name += ":" + v
+				nbs.matrix = append(slices.Clone(bs.matrix), Param{axis.Name, v})
+				l = append(l, nbs)
+			}
+		}
+		buildSteps = l
 	}
 
+	// For concurrent build steps, all but the first step get their own copy of the
+	// checkout, so the steps don't interfere with each other.
+	parallel := repo.GoParallel && len(buildSteps) > 1
+	if parallel {
+		for i := range buildSteps[1:] {
+			bs := &buildSteps[1+i]
+			bs.checkout = "checkout-" + strings.ReplaceAll(strings.TrimPrefix(bs.name, "build:"), ":", "-")
+			err = run(buildCmd.ctx, build.ID, build.RunPrefix, env, "clone", &cloneElapsed, buildDir, buildDir, runPrefix("cp", "-Rp", "checkout", bs.checkout)...)
+			_checkUserf(err, "copying checkout for %s", bs.name)
+		}
+	}
+	finishClone()
+
 	var uid uint32
 	sharedHome := false
 	if config.IsolateBuilds.Enabled {
@@ -487,47 +1102,199 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		}
 	}
 
+	// Secrets are only available to the build script, not to the clone commands. File
+	// secrets are written before the chown below, which gives them to the build user.
+	// Pull requests can come from anyone, so their builds don't get secrets.
+	var secretEnv, secretValues []string
+	_dbread(ctx, func(tx *bstore.Tx) {
+		if build.PullRequest != 0 {
+			return
+		}
+		secrets, err := bstore.QueryTx[Secret](tx).FilterNonzero(Secret{RepoName: repo.Name}).SortAsc("Name").List()
+		_checkf(err, "listing secrets")
+		for _, s := range secrets {
+			value, err := decryptSecret(s)
+			_checkf(err, "decrypting secret")
+			secretValues = append(secretValues, value)
+			if !s.File {
+				secretEnv = append(secretEnv, s.Name+"="+value)
+				continue
+			}
+			secretsDir := buildDir + "/secrets"
+			err = os.MkdirAll(secretsDir, 0711)
+			_checkf(err, "creating directory for secrets")
+			err = os.WriteFile(secretsDir+"/"+s.Name, []byte(value), 0400)
+			_checkf(err, "writing secret file")
+			secretEnv = append(secretEnv, s.Name+"="+envBuildDir+"/secrets/"+s.Name)
+		}
+	})
+	defer os.RemoveAll(buildDir + "/secrets")
+	mask := newSecretMasker(secretValues)
+
 	chownMsg := msg{Chown: &msgChown{repo.Name, build.ID, sharedHome, uid}}
 	err = requestPrivileged(chownMsg)
 	_checkf(err, "chown")
 
 	_updateStatus(StatusBuild, false)
-	req := request{
-		msg{Build: &msgBuild{repo.Name, build.ID, uid, repo.CheckoutPath, settings.RunPrefix, env, toolchainDir, homeDir, repo.Bubblewrap, repo.BubblewrapNoNet, gotoolchains, newGoToolchain}},
-		nil,
-		make(chan buildResult),
-	}
-	rootRequests <- req
-	result := <-req.buildResponse
-	if result.err != nil {
-		_checkUserf(result.err, "building")
+
+	dldir := path.Clean(fmt.Sprintf("%s/build/%s/%d/dl", dingDataDir, repo.Name, build.ID))
+
+	limits := buildLimits{repo.MaxMemoryMB, repo.MaxCPUSeconds, repo.MaxProcesses, repo.MaxOpenFiles, repo.MaxFileSizeMB}
+
+	// Run a single build step, returning the step with its results or error message.
+	runStep := func(bs buildStep) (step Step) {
+		step.Name = bs.name
+		if bs.goname != "" {
+			step.Matrix = append(step.Matrix, Param{"DING_GOTOOLCHAIN", bs.goname})
+		}
+		step.Matrix = append(step.Matrix, bs.matrix...)
+
+		stepEnv := slices.Clone(env)
+		for _, p := range bs.matrix {
+			stepEnv = append(stepEnv, p.Name+"="+p.Value)
+		}
+
+		req := request{
+			msg{Build: &msgBuild{repo.Name, build.ID, uid, repo.CheckoutPath, bs.checkout, bs.name, build.RunPrefix, stepEnv, toolchainDir, homeDir, repo.Bubblewrap, repo.BubblewrapNoNet, bs.goname, bs.goversion, newGoToolchain, limits, secretEnv}},
+			nil,
+			make(chan buildResult),
+		}
+		rootRequests <- req
+		result := <-req.buildResponse
+		if result.err != nil {
+			step.ErrorMessage = "building: " + result.err.Error()
+			return
+		}
+
+		wait := make(chan error, 1)
+		go func() {
+			defer result.status.Close()
+
+			var status msgBuildStatus
+			err := gob.NewDecoder(result.status).Decode(&status)
+			xcheckf(err, "decoding gob from result.status")
+			if status.Error != "" {
+				err = fmt.Errorf("%s", status.Error)
+			}
+			usage.Lock()
+			usage.peakMemory = max(usage.peakMemory, status.PeakMemory)
+			usage.cpuNsec += status.CPUNsec
+			usage.Unlock()
+			wait <- err
+		}()
+		var elapsed time.Duration
+		err := track(build.ID, bs.name, buildDir, result.stdout, result.stderr, wait, mask, &elapsed)
+		if xerr := writeStepNsec(buildDir, bs.name, elapsed); xerr != nil && err == nil {
+			err = xerr
+		}
+		// Test results are also kept for failed steps, to show which tests failed.
+		tests, terr := parseTestsFile(dldir, buildDir+"/output/"+bs.name+".stdout", mask)
+		step.Tests = tests
+		if err != nil {
+			step.ErrorMessage = "build.sh: " + err.Error()
+			return
+		} else if terr != nil {
+			step.ErrorMessage = fmt.Sprintf("parse test results from output: %v", terr)
+			return
+		}
+
+		outputFile, err := os.Open(buildDir + "/output/" + bs.name + ".stdout")
+		if err != nil {
+			step.ErrorMessage = fmt.Sprintf("opening build output: %v", err)
+			return
+		}
+		defer outputFile.Close()
+		stepCheckoutDir := fmt.Sprintf("%s/%s/%s", buildDir, bs.checkout, repo.CheckoutPath)
+		step.Version, step.Results, step.Coverage, step.CoverageReportFile, err = parseResults(stepCheckoutDir, dldir, outputFile)
+		if err != nil {
+			step.ErrorMessage = fmt.Sprintf("parse results from output: %v", err)
+		}
+		if bs.checkout != "checkout" {
+			for i := range step.Results {
+				step.Results[i].Checkout = bs.checkout
+			}
+		}
+		return
 	}
 
-	wait := make(chan error, 1)
-	go func() {
-		defer result.status.Close()
+	// Sequential builds stop at the first failing step. Concurrent builds all run to
+	// completion.
+	steps := make([]Step, len(buildSteps))
+	var cancelled bool
+	if parallel {
+		// Register the steps first, so they are listed in a fixed order.
+		for _, bs := range buildSteps {
+			err := addStepName(buildDir+"/output", bs.name)
+			_checkf(err, "adding step name")
+		}
 
-		var r string
-		err = gob.NewDecoder(result.status).Decode(&r)
-		xcheckf(err, "decoding gob from result.status")
-		var err error
-		if r != "" {
-			err = fmt.Errorf("%s", r)
+		var wg sync.WaitGroup
+		for i, bs := range buildSteps {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				steps[i] = runStep(bs)
+			}()
 		}
-		wait <- err
-	}()
-	err = track(build.ID, "build", buildDir, result.stdout, result.stderr, wait)
-	_checkUserf(err, "build.sh")
+		wg.Wait()
+	} else {
+		for i, bs := range buildSteps {
+			// Don't start the next step if the build was cancelled.
+			if buildCmd.ctx.Err() != nil {
+				cancelled = true
+				break
+			}
+			steps[i] = runStep(bs)
+			if steps[i].ErrorMessage != "" {
+				break
+			}
+		}
+	}
 
-	outputFile, err := os.Open(buildDir + "/output/build.stdout")
-	_checkUserf(err, "opening build output")
-	defer func() {
-		_checkUserf(outputFile.Close(), "closing build output")
-	}()
+	// The results of the build are combined from the steps. The first step with a
+	// version or coverage determines the version and coverage of the build.
+	var errmsgs []string
+	for i, bs := range buildSteps {
+		if steps[i].Name == "" {
+			continue
+		}
+		stepResults[bs.name] = steps[i]
+		if steps[i].ErrorMessage == "" {
+			continue
+		} else if len(buildSteps) == 1 && bs.goname == "" {
+			errmsgs = append(errmsgs, steps[i].ErrorMessage)
+		} else if bs.goname != "" {
+			errmsgs = append(errmsgs, fmt.Sprintf("%s (%s): %s", bs.name, bs.goversion, steps[i].ErrorMessage))
+		} else {
+			errmsgs = append(errmsgs, fmt.Sprintf("%s: %s", bs.name, steps[i].ErrorMessage))
+		}
+	}
+	if len(errmsgs) > 0 {
+		_userError(strings.Join(errmsgs, "; "))
+	} else if cancelled {
+		_userError("build cancelled")
+	}
 
-	dldir := path.Clean(fmt.Sprintf("%s/build/%s/%d/dl", dingDataDir, repo.Name, build.ID))
-	version, results, coverage, coverageReportFile, err := parseResults(checkoutDir, dldir, outputFile)
-	_checkUserf(err, "parse results from output")
+	var version, coverageReportFile string
+	var coverage *float32
+	var results []Result
+	resultFiles := map[string]bool{}
+	for _, step := range steps {
+		if version == "" {
+			version = step.Version
+		}
+		if coverage == nil {
+			coverage = step.Coverage
+			coverageReportFile = step.CoverageReportFile
+		}
+		for _, r := range step.Results {
+			if resultFiles[r.Filename] {
+				_userError(fmt.Sprintf("%s: duplicate result for file %s", step.Name, r.Filename))
+			}
+			resultFiles[r.Filename] = true
+			results = append(results, r)
+		}
+	}
 
 	_dbwrite(ctx, func(tx *bstore.Tx) {
 		b = Build{ID: build.ID}
@@ -541,6 +1308,10 @@ func _doBuild0(ctx context.Context, repo Repo, build Build, buildDir string, got
 		err = tx.Update(&b)
 		_checkf(err, "marking build as success in database")
 		slog.Debug("updating build status", "buildid", build.ID, "status", b.Status)
+
+		if b.Tag != "" && repo.ReleaseTags {
+			_release(tx, repo, &b)
+		}
 	})
 	events <- EventBuild{b}
 }
@@ -555,11 +1326,41 @@ func _cleanupBuilds(ctx context.Context, repoName, branch string) {
 		builds, err = bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: repo.Name}).SortDesc("ID").List()
 		_checkf(err, "listing builds")
 	})
-	branchBuilds := map[string]int{} // Number of builds for branch.
+	// Builds of jobs of the repository are counted separately.
+	type branchJob struct {
+		branch, job string
+	}
+	branchBuilds := map[branchJob]int{} // Number of builds for branch.
+	prBuilds := map[branchJob]int{}     // Number of builds for pull request, by its branch.
 	for _, b := range builds {
 		if b.Finish == nil {
 			continue
 		}
+		key := branchJob{b.Branch, b.Job}
+		// Skipped builds and builds of earlier commits of a push or for bisects are
+		// removed after 30 days, and don't count towards the builds kept for a branch.
+		if b.Status == StatusSkipped || extraBuild(b) && b.Released == nil {
+			if time.Since(*b.Finish) > 30*24*time.Hour {
+				_dbwrite(ctx, func(tx *bstore.Tx) {
+					_removeBuild(tx, repoName, b.ID)
+				})
+				events <- EventRemoveBuild{repoName, b.ID}
+			}
+			continue
+		}
+		// For pull request builds, we keep max 3 of the latest builds per pull request
+		// and job, for at most 14 days.
+		if b.PullRequest != 0 && b.Released == nil {
+			if prBuilds[key] >= 3 || time.Since(*b.Finish) > 14*24*time.Hour {
+				_dbwrite(ctx, func(tx *bstore.Tx) {
+					_removeBuild(tx, repoName, b.ID)
+				})
+				events <- EventRemoveBuild{repoName, b.ID}
+			} else {
+				prBuilds[key]++
+			}
+			continue
+		}
 		// For release builds, we cleanup the builddir after 60 days.
 		if b.Released != nil {
 			if !b.BuilddirRemoved && time.Since(*b.Finish) > 60*24*time.Hour {
@@ -571,18 +1372,104 @@ func _cleanupBuilds(ctx context.Context, repoName, branch string) {
 					_checkf(err, "marking build directory as removed")
 				})
 			}
-			// For other builds, we keep max 10 of the latest builds per branch, but only if
-			// not older than 30 days, although we keep at least 1 for the default branch of
-			// the repo.
-		} else if branchBuilds[b.Branch] >= 10 || time.Since(*b.Finish) > 30*24*time.Hour && (repo.DefaultBranch != b.Branch || branchBuilds[b.Branch] > 0) {
+			// For other builds, we keep max 10 of the latest builds per branch and job, but
+			// only if not older than 30 days, although we keep at least 1 for the default
+			// branch of the repo.
+		} else if branchBuilds[key] >= 10 || time.Since(*b.Finish) > 30*24*time.Hour && (repo.DefaultBranch != b.Branch || branchBuilds[key] > 0) {
 			_dbwrite(ctx, func(tx *bstore.Tx) {
 				_removeBuild(tx, repoName, b.ID)
 			})
 			events <- EventRemoveBuild{repoName, b.ID}
 			continue
 		}
-		branchBuilds[b.Branch]++
+		branchBuilds[key]++
+	}
+}
+
+// maxBuildScriptSize is the maximum size of a build script read from the checkout.
+const maxBuildScriptSize = 1024 * 1024
+
+// _buildScriptFromCheckout reads the build script from file p in the checkout, see
+// Repo.BuildScriptPath. If the file exists, it replaces the build script of the
+// build, in the database and in the build directory. Symbolic links may not point
+// outside the checkout. The updated build is returned.
+func _buildScriptFromCheckout(ctx context.Context, build Build, buildDir, checkoutDir, p string) Build {
+	root, err := os.OpenRoot(checkoutDir)
+	_checkf(err, "opening checkout directory")
+	defer root.Close()
+	fi, err := root.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return build
+	}
+	_checkUserf(err, "build script from checkout")
+	if !fi.Mode().IsRegular() {
+		_userError(fmt.Sprintf("Build script %q in checkout is not a regular file", p))
+	} else if fi.Size() > maxBuildScriptSize {
+		_userError(fmt.Sprintf("Build script %q in checkout is larger than %d bytes", p, maxBuildScriptSize))
+	}
+	buf, err := root.ReadFile(p)
+	_checkUserf(err, "reading build script from checkout")
+
+	_writeFile(buildDir+"/scripts/build.sh", string(buf))
+	_dbwrite(ctx, func(tx *bstore.Tx) {
+		b := Build{ID: build.ID}
+		err := tx.Get(&b)
+		_checkf(err, "get build to store build script")
+		b.BuildScript = string(buf)
+		b.BuildScriptFile = p
+		err = tx.Update(&b)
+		_checkf(err, "storing build script from checkout")
+		build.BuildScript = b.BuildScript
+		build.BuildScriptFile = b.BuildScriptFile
+		events <- EventBuild{b}
+	})
+	return build
+}
+
+// _changedFiles returns the files changed between the commit of the previous build
+// of the branch and job and the commit of build, with "git diff" in the checkout.
+// Nil is returned if not known.
+func _changedFiles(ctx, cmdCtx context.Context, build Build, env []string, checkoutDir string) []string {
+	var prevCommit string
+	_dbread(ctx, func(tx *bstore.Tx) {
+		q := bstore.QueryTx[Build](tx).FilterNonzero(Build{RepoName: build.RepoName, Branch: build.Branch})
+		q.FilterEqual("Job", build.Job)
+		q.FilterLess("ID", build.ID)
+		q.FilterNotEqual("Status", StatusNew, StatusSkipped, StatusCancelled, StatusSuperseded)
+		q.FilterFn(func(b Build) bool { return b.Finish != nil && b.CommitHash != "" && !extraBuild(b) })
+		q.SortDesc("ID")
+		q.Limit(1)
+		b, err := q.Get()
+		if err == bstore.ErrAbsent {
+			return
+		}
+		_checkf(err, "get previous build for branch")
+		prevCommit = b.CommitHash
+	})
+	if prevCommit == "" || prevCommit == build.CommitHash {
+		return nil
+	}
+
+	argv := slices.Concat(build.RunPrefix, []string{"git", "diff", "-z", "--name-only", prevCommit, build.CommitHash})
+	cmd := exec.CommandContext(cmdCtx, argv[0], argv[1:]...)
+	cmd.Dir = checkoutDir
+	cmd.Env = env
+	buf, err := cmd.Output()
+	if err != nil {
+		// E.g. after a force push, the previous commit may not be known.
+		slog.Info("listing changed files, not skipping build", "repo", build.RepoName, "buildid", build.ID, "err", err)
+		return nil
 	}
+	return slices.DeleteFunc(strings.Split(string(buf), "\x00"), func(s string) bool { return s == "" })
+}
+
+// resultPath returns the path to a result file in the build directory.
+func resultPath(repoName string, buildID int32, checkoutPath string, res Result) string {
+	checkout := res.Checkout
+	if checkout == "" {
+		checkout = "checkout"
+	}
+	return fmt.Sprintf("%s/build/%s/%d/%s/%s/%s", dingDataDir, repoName, buildID, checkout, checkoutPath, res.Filename)
 }
 
 func parseResults(checkoutDir, dldir string, r io.Reader) (version string, results []Result, coverage *float32, coverageReportFile string, rerr error) {
@@ -598,7 +1485,7 @@ func parseResults(checkoutDir, dldir string, r io.Reader) (version string, resul
 				rerr = errors.New("invalid \"release:\"-line, should have 6 words: " + line)
 				return
 			}
-			result := Result{t[1], t[2], t[3], t[4], path.Clean(t[5]), 0}
+			result := Result{t[1], t[2], t[3], t[4], path.Clean(t[5]), 0, ""}
 			if !path.IsAbs(result.Filename) {
 				result.Filename = path.Join(checkoutDir, result.Filename)
 			}
@@ -719,6 +1606,7 @@ func setupCmd(cmdCtx context.Context, buildID int32, env []string, step, buildDi
 	cmd.Env = env
 	cmd.Stdout = stdoutw
 	cmd.Stderr = stderrw
+	killProcessGroup(cmd)
 
 	err = cmd.Start()
 	lcheck(err, "starting command")
@@ -730,15 +1618,45 @@ func setupCmd(cmdCtx context.Context, buildID int32, env []string, step, buildDi
 	return stdoutr, stderrr, c, nil
 }
 
-func run(cmdCtx context.Context, buildID int32, runPrefix []string, env []string, step, buildDir, workDir string, args ...string) error {
+// killProcessGroup makes cmd run in its own process group, and makes cancellation
+// kill the whole group. Otherwise child processes of e.g. a shell script keep
+// running after a cancel, keeping the output pipes open.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// run runs a command for step, see track. The time the command took is added to
+// elapsed.
+func run(cmdCtx context.Context, buildID int32, runPrefix []string, env []string, step string, elapsed *time.Duration, buildDir, workDir string, args ...string) error {
 	cmdstdout, cmdstderr, wait, err := setupCmd(cmdCtx, buildID, env, step, buildDir, workDir, args...)
 	if err != nil {
 		return fmt.Errorf("setting up command: %s", err)
 	}
-	return track(buildID, step, buildDir, cmdstdout, cmdstderr, wait)
+	return track(buildID, step, buildDir, cmdstdout, cmdstderr, wait, nil, elapsed)
+}
+
+// writeStepNsec writes the duration of step to its .nsec file in the output
+// directory, once the step is done.
+func writeStepNsec(buildDir, step string, elapsed time.Duration) error {
+	err := os.WriteFile(buildDir+"/output/"+step+".nsec", []byte(fmt.Sprintf("%d", elapsed)), 0644)
+	if err != nil {
+		return fmt.Errorf("writing nsec file: %v", err)
+	}
+	return nil
 }
 
-func track(buildID int32, step, buildDir string, cmdstdout, cmdstderr io.ReadCloser, wait <-chan error) (rerr error) {
+// track reads the output of a command and writes it to files in the output
+// directory and sends events for it. If mask is not nil, it is applied to the
+// output, to hide the values of secrets. The time the command took is added to
+// elapsed. A step can consist of multiple commands, the caller writes the .nsec
+// file of the step with writeStepNsec.
+func track(buildID int32, step, buildDir string, cmdstdout, cmdstderr io.ReadCloser, wait <-chan error, mask *secretMasker, elapsed *time.Duration) (rerr error) {
 	type Error struct {
 		err error
 	}
@@ -766,15 +1684,9 @@ func track(buildID int32, step, buildDir string, cmdstdout, cmdstderr io.ReadClo
 		cmdstderr.Close()
 	}()
 
-	// Write .nsec file when we're done here.
 	t0 := time.Now()
 	defer func() {
-		time.Since(t0)
-		nsec, err := os.Create(buildDir + "/output/" + step + ".nsec")
-		lcheck(err, "creating nsec file")
-		defer nsec.Close()
-		_, err = fmt.Fprintf(nsec, "%d", time.Since(t0))
-		lcheck(err, "writing nsec file")
+		*elapsed += time.Since(t0)
 	}()
 
 	appendFlags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
@@ -788,6 +1700,9 @@ func track(buildID int32, step, buildDir string, cmdstdout, cmdstderr io.ReadClo
 	lcheck(err, "creating stderr file")
 	defer stderr.Close()
 
+	err = addStepName(buildDir+"/output", step)
+	lcheck(err, "adding step name")
+
 	// Let it be known that we started this phase.
 	events <- EventOutput{buildID, step, "stdout", ""}
 
@@ -804,6 +1719,7 @@ func track(buildID int32, step, buildDir string, cmdstdout, cmdstderr io.ReadClo
 		for {
 			n, err := r.Read(buf[have:])
 			if n > 0 {
+				buildIDCommandOutput(buildID)
 				have += n
 				end := bytes.LastIndexByte(buf[:have], '\n')
 				if end < 0 && have == len(buf) {
@@ -832,16 +1748,19 @@ func track(buildID int32, step, buildDir string, cmdstdout, cmdstderr io.ReadClo
 	go linereader(cmdstdout, true)
 	go linereader(cmdstderr, false)
 	eofs := 0
-	for {
+	// Output of stdout and stderr held back until the next chunk, for masking secrets.
+	pending := map[bool]string{}
+	for eofs < 2 {
 		l := <-lines
-		if l.text == "" || l.err != nil {
+		eof := l.text == "" || l.err != nil
+		if eof {
 			if l.err != nil {
 				slog.Error("reading output from command", "err", l.err)
 			}
 			eofs++
-			if eofs >= 2 {
-				break
-			}
+		}
+		l.text, pending[l.stdout] = mask.maskChunk(pending[l.stdout]+l.text, eof)
+		if l.text == "" {
 			continue
 		}
 		_, err = output.Write([]byte(l.text))
@@ -875,23 +1794,72 @@ func buildDiskUsage(buildDir string) (diskUsage int64) {
 	return
 }
 
+var stepNamesLock sync.Mutex
+
+// addStepName adds step to the file "steps" in outputDir, if not already present.
+// The file lists the names of started steps, in order.
+func addStepName(outputDir, step string) error {
+	stepNamesLock.Lock()
+	defer stepNamesLock.Unlock()
+
+	names, err := readStepNames(outputDir)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(names, step) {
+		return nil
+	}
+	f, err := os.OpenFile(outputDir+"/steps", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, step)
+	if xerr := f.Close(); err == nil {
+		err = xerr
+	}
+	return err
+}
+
+// readStepNames returns the names of the steps started for a build. Builds from
+// before the steps file was introduced return nil.
+func readStepNames(outputDir string) ([]string, error) {
+	buf, err := os.ReadFile(outputDir + "/steps")
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(buf)), nil
+}
+
+// buildStepNames returns the names of the steps of a build, in order.
+func buildStepNames(b Build) []string {
+	outputDir := fmt.Sprintf("%s/build/%s/%d/output", dingDataDir, b.RepoName, b.ID)
+	names, err := readStepNames(outputDir)
+	_checkf(err, "reading step names")
+	if names != nil {
+		return names
+	}
+	// Old builds have fixed steps.
+	if b.Status == StatusClone {
+		return []string{string(StatusClone)}
+	}
+	return []string{string(StatusClone), string(StatusBuild)}
+}
+
 // _buildSteps reads steps from disk, for storing in build after finish.
 func _buildSteps(b Build) (steps []Step) {
 	steps = []Step{}
 
 	buildDir := fmt.Sprintf("%s/build/%s/%d/", dingDataDir, b.RepoName, b.ID)
 	outputDir := buildDir + "output/"
-	diskSteps := []BuildStatus{StatusClone, StatusBuild}
-	for _, stepName := range diskSteps {
-		base := outputDir + string(stepName)
+	for _, stepName := range buildStepNames(b) {
+		base := outputDir + stepName
 		steps = append(steps, Step{
-			Name:   string(stepName),
+			Name:   stepName,
 			Output: readFileLax(base + ".output"),
 			Nsec:   parseInt(readFileLax(base + ".nsec")),
 		})
-		if stepName == b.Status {
-			break
-		}
 	}
 	return
 }
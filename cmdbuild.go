@@ -31,6 +31,7 @@ func cmdBuild(args []string) {
 	}
 	var destdir string
 	var tmpdestdir bool
+	var params []Param
 
 	fs.BoolVar(&nobwrap, "nobwrap", false, "don't use bwrap; automatically used if available otherwise")
 	fs.BoolVar(&needbwrap, "needbwrap", false, "require bwrap, failing if not available")
@@ -42,8 +43,15 @@ func cmdBuild(args []string) {
 	fs.StringVar(&destdir, "destdir", "", "directory for build, must be empty or not exist; if not specified, a tmpdir is automatically created and removed after the build")
 	fs.StringVar(&clonecmd, "clone", "", "command to run to clone the repository, instead of looking for .git or .hg in the current directory")
 	fs.StringVar(&toolchainDir, "toolchaindir", toolchainDir, "directory to make available as toolchaindir; if $HOME/sdk exists, it is used as toolchaindir")
+	fs.Func("param", "set build parameter, available as $DING_PARAM_<name>, of the form name=value; can be specified multiple times", func(s string) error {
+		p, err := parseParam(s)
+		if err == nil {
+			params = append(params, p)
+		}
+		return err
+	})
 	fs.Usage = func() {
-		fmt.Fprintln(os.Stderr, "usage: ding build [-goauto] [-go] [-goprev] [-gonext] [-nobwrap] [-needbwrap] [-nonet] [-clone cmd] [-toolchaindir dir] [-destdir dir] cmd ...")
+		fmt.Fprintln(os.Stderr, "usage: ding build [-goauto] [-go] [-goprev] [-gonext] [-nobwrap] [-needbwrap] [-nonet] [-clone cmd] [-toolchaindir dir] [-destdir dir] [-param name=value ...] cmd ...")
 		fs.PrintDefaults()
 		os.Exit(2)
 	}
@@ -184,11 +192,14 @@ func cmdBuild(args []string) {
 	if toolchainDir != "" {
 		environment = append(environment, "DING_TOOLCHAINDIR=/home/ding/toolchain")
 	}
+	for _, p := range params {
+		environment = append(environment, "DING_PARAM_"+p.Name+"="+p.Value)
+	}
 
 	run := func(build bool, env []string, cmdargv ...string) ([]byte, []byte) {
 		var argv []string
 		if build && (needbwrap || (!nobwrap && hasBubblewrap(ctx))) {
-			argv = bwrapCmd(nonet, homeDir, buildDir, checkoutPath, toolchainDir)
+			argv = bwrapCmd(nonet, homeDir, buildDir, "checkout/"+checkoutPath, toolchainDir)
 			if bindBuildscript {
 				dstbuildscript := buildscript
 				if strings.HasPrefix(buildscript, workDir+"/") {
@@ -254,6 +265,17 @@ func cmdBuild(args []string) {
 		for _, r := range results {
 			fmt.Printf("- %#v\n", r)
 		}
+		tests, err := parseTests(downloadDir, bytes.NewReader(stdout), nil)
+		xlcheckf(err, "parsing test results")
+		if len(tests) > 0 {
+			steps := []Step{{Tests: tests}}
+			passed, failed, skipped := testCounts(steps)
+			fmt.Printf("tests: %d package(s), %d passed, %d failed, %d skipped\n", len(tests), passed, failed, skipped)
+			failing := failingTests(Build{Steps: steps})
+			for _, s := range failing {
+				fmt.Printf("- %s\n", s)
+			}
+		}
 
 		homeSize := buildDiskUsage(homeDir)
 		buildSize := buildDiskUsage(buildDir)
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// commitState is the state of a build as reported to a forge.
+type commitState string
+
+const (
+	commitPending   commitState = "pending"
+	commitSuccess   commitState = "success"
+	commitFailure   commitState = "failure"
+	commitCancelled commitState = "cancelled"
+)
+
+// buildCommitState returns the state to report for a finished build.
+func buildCommitState(b Build) commitState {
+	switch b.Status {
+	case StatusSuccess:
+		return commitSuccess
+	case StatusCancelled, StatusSuperseded:
+		return commitCancelled
+	}
+	return commitFailure
+}
+
+// Delays before retrying a failed request to post a commit status. Variable for
+// tests.
+var commitStatusRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+// commitStatusSeq tracks the last status reported per build. A pending status that
+// is still being retried must not overwrite the final status.
+var commitStatusSeq struct {
+	sync.Mutex
+	next int64
+	last map[int32]int64 // Build ID to sequence number of last reported status.
+}
+
+// reportCommitStatus posts the state of the build to the forge configured for
+// the repository, if any, in the background. Failed requests are retried.
+func reportCommitStatus(repo Repo, b Build, state commitState) {
+	if repo.CommitStatus.Forge == ForgeNone || b.CommitHash == "" {
+		return
+	}
+
+	commitStatusSeq.Lock()
+	if commitStatusSeq.last == nil {
+		commitStatusSeq.last = map[int32]int64{}
+	}
+	commitStatusSeq.next++
+	seq := commitStatusSeq.next
+	commitStatusSeq.last[b.ID] = seq
+	commitStatusSeq.Unlock()
+
+	// current returns whether no newer status was reported for the build. For final
+	// states, the build is forgotten.
+	current := func(done bool) bool {
+		commitStatusSeq.Lock()
+		defer commitStatusSeq.Unlock()
+		ok := commitStatusSeq.last[b.ID] == seq
+		if ok && done && state != commitPending {
+			delete(commitStatusSeq.last, b.ID)
+		}
+		return ok
+	}
+
+	go func() {
+		log := slog.With("repo", repo.Name, "buildid", b.ID, "commit", b.CommitHash, "state", state)
+		for i := 0; ; i++ {
+			if !current(false) {
+				return
+			}
+			err := postCommitStatus(context.Background(), repo, b, state)
+			if err == nil {
+				current(true)
+				return
+			}
+			if i >= len(commitStatusRetryDelays) {
+				log.Error("posting commit status, giving up", "err", err)
+				current(true)
+				return
+			}
+			log.Info("posting commit status, will retry", "err", err, "delay", commitStatusRetryDelays[i])
+			time.Sleep(commitStatusRetryDelays[i])
+		}
+	}()
+}
+
+// postCommitStatus makes a single request to the forge to set the status for the
+// commit of the build.
+func postCommitStatus(ctx context.Context, repo Repo, b Build, state commitState) error {
+	cs := repo.CommitStatus
+
+	var token string
+	err := database.Read(ctx, func(tx *bstore.Tx) error {
+		s, err := bstore.QueryTx[Secret](tx).FilterNonzero(Secret{RepoName: repo.Name, Name: cs.TokenSecret}).Get()
+		if err != nil {
+			return fmt.Errorf("get secret %q with token: %v", cs.TokenSecret, err)
+		}
+		token, err = decryptSecret(s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/#repo/%s/build/%d", config.BaseURL, repo.Name, b.ID)
+	description := map[commitState]string{
+		commitPending:   "Build %d running",
+		commitSuccess:   "Build %d succeeded",
+		commitFailure:   "Build %d failed",
+		commitCancelled: "Build %d cancelled",
+	}[state]
+	description = fmt.Sprintf(description, b.ID)
+	name := "ding/" + repo.Name
+	if b.Job != "" {
+		name += "/" + b.Job
+	}
+
+	var url string
+	var body any
+	switch cs.Forge {
+	case ForgeGithub, ForgeGitea:
+		base := cs.URL
+		if base == "" {
+			base = "https://api.github.com"
+		}
+		// Neither has a cancelled state.
+		st := string(state)
+		if state == commitCancelled {
+			st = "error"
+		}
+		url = fmt.Sprintf("%s/repos/%s/statuses/%s", strings.TrimSuffix(base, "/"), cs.Repository, b.CommitHash)
+		body = map[string]string{
+			"state":       st,
+			"target_url":  link,
+			"description": description,
+			"context":     name,
+		}
+	case ForgeBitbucket:
+		base := cs.URL
+		if base == "" {
+			base = "https://api.bitbucket.org/2.0"
+		}
+		st := map[commitState]string{
+			commitPending:   "INPROGRESS",
+			commitSuccess:   "SUCCESSFUL",
+			commitFailure:   "FAILED",
+			commitCancelled: "STOPPED",
+		}[state]
+		url = fmt.Sprintf("%s/repositories/%s/commit/%s/statuses/build", strings.TrimSuffix(base, "/"), cs.Repository, b.CommitHash)
+		body = map[string]string{
+			"key":         name,
+			"state":       st,
+			"url":         link,
+			"name":        name,
+			"description": description,
+		}
+	default:
+		return fmt.Errorf("unknown forge %q", cs.Forge)
+	}
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("new request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("response status %s: %q", resp.Status, msg)
+	}
+	return nil
+}
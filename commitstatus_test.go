@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeForge is an HTTP server for commit status requests, failing the first
+// request.
+type fakeForge struct {
+	sync.Mutex
+	requests int
+	posts    []fakeForgePost // Successful requests.
+}
+
+type fakeForgePost struct {
+	Path          string
+	Authorization string
+	Body          map[string]string
+}
+
+func (f *fakeForge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+	if f.requests == 1 {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	p := fakeForgePost{Path: r.URL.Path, Authorization: r.Header.Get("Authorization")}
+	if err := json.NewDecoder(r.Body).Decode(&p.Body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	f.posts = append(f.posts, p)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// waitPosts waits until n requests have succeeded, and returns them.
+func (f *fakeForge) waitPosts(t *testing.T, n int) []fakeForgePost {
+	t.Helper()
+	for range 100 {
+		f.Lock()
+		posts := f.posts
+		f.Unlock()
+		if len(posts) >= n {
+			return posts
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("no %d commit status posts in 5 seconds", n)
+	return nil
+}
+
+func TestCommitStatus(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	origDelays := commitStatusRetryDelays
+	commitStatusRetryDelays = []time.Duration{time.Millisecond}
+	defer func() {
+		commitStatusRetryDelays = origDelays
+	}()
+
+	forge := &fakeForge{}
+	srv := httptest.NewServer(forge)
+	defer srv.Close()
+
+	r := Repo{
+		Name:          "status",
+		VCS:           VCSCommand,
+		Origin:        "sh -c 'mkdir -p checkout/$DING_CHECKOUTPATH; echo commit:0123abcd'",
+		DefaultBranch: "main",
+		CheckoutPath:  "status",
+		BuildScript:   "#!/usr/bin/env bash\nsleep 0.2\necho ok\n",
+	}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+	api.SecretSave(ctxbg, config.Password, r.Name, "FORGE_TOKEN", "token1234", false)
+
+	save := func(cs CommitStatus) {
+		r.CommitStatus = cs
+		r = api.RepoSave(ctxbg, config.Password, r)
+	}
+	tneederr(t, "user:error", func() { save(CommitStatus{Forge: "bogus"}) })
+	tneederr(t, "user:error", func() { save(CommitStatus{Forge: ForgeGithub, Repository: "noslash", TokenSecret: "FORGE_TOKEN"}) })
+	tneederr(t, "user:error", func() { save(CommitStatus{Forge: ForgeGithub, Repository: "owner/name", TokenSecret: "bad name"}) })
+	tneederr(t, "user:error", func() { save(CommitStatus{Forge: ForgeGitea, Repository: "owner/name", TokenSecret: "FORGE_TOKEN"}) })
+	tneederr(t, "user:error", func() {
+		save(CommitStatus{Forge: ForgeGitea, URL: "ftp://host", Repository: "owner/name", TokenSecret: "FORGE_TOKEN"})
+	})
+	save(CommitStatus{Forge: ForgeGithub, URL: srv.URL, Repository: "owner/name", TokenSecret: "FORGE_TOKEN"})
+
+	// The first request fails, and is retried.
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	posts := forge.waitPosts(t, 2)
+	tcompare(t, len(posts), 2)
+	tcompare(t, posts[0].Path, "/repos/owner/name/statuses/0123abcd")
+	tcompare(t, posts[0].Authorization, "Bearer token1234")
+	tcompare(t, posts[0].Body["state"], "pending")
+	tcompare(t, posts[1].Body, map[string]string{
+		"state":       "success",
+		"target_url":  fmt.Sprintf("%s/#repo/status/build/%d", config.BaseURL, b.ID),
+		"description": fmt.Sprintf("Build %d succeeded", b.ID),
+		"context":     "ding/status",
+	})
+
+	// Failed build on gitea.
+	r.BuildScript = "#!/usr/bin/env bash\nexit 1\n"
+	save(CommitStatus{Forge: ForgeGitea, URL: srv.URL + "/api/v1", Repository: "owner/name", TokenSecret: "FORGE_TOKEN"})
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	posts = forge.waitPosts(t, 4)
+	tcompare(t, posts[2].Path, "/api/v1/repos/owner/name/statuses/0123abcd")
+	tcompare(t, posts[2].Body["state"], "pending")
+	tcompare(t, posts[3].Body["state"], "failure")
+
+	// Cancelled build on bitbucket.
+	r.CommitStatus = CommitStatus{Forge: ForgeBitbucket, URL: srv.URL, Repository: "workspace/name", TokenSecret: "FORGE_TOKEN"}
+	b.CommitHash = "4567cdef"
+	err := postCommitStatus(ctxbg, r, b, buildCommitState(Build{Status: StatusCancelled}))
+	tcheck(t, err, "post commit status")
+	posts = forge.waitPosts(t, 5)
+	tcompare(t, posts[4].Path, "/repositories/workspace/name/commit/4567cdef/statuses/build")
+	tcompare(t, posts[4].Body["state"], "STOPPED")
+	tcompare(t, posts[4].Body["key"], "ding/status")
+
+	// Missing token secret.
+	r.CommitStatus.TokenSecret = "OTHER"
+	err = postCommitStatus(ctxbg, r, b, commitSuccess)
+	if err == nil {
+		t.Fatalf("got nil error for missing token secret")
+	}
+}
@@ -14,6 +14,7 @@ type Settings struct {
 	GoToolchainWebhookSecret string   // Required in Authorization header value to webhook /gotoolchain.
 	RunPrefix                []string // Commands prefixed to the clone and build commands. E.g. /usr/bin/nice.
 	Environment              []string // Additional environment variables to set during clone and build.
+	MaxBuilds                int      // Maximum number of builds to run concurrently, including low-prio builds. Zero means no limit.
 
 	// If set, new "go", "goprev" and "gonext" (if present, for release candidates)
 	// are automatically downloaded and installed (symlinked as active).
@@ -26,11 +27,23 @@ type BuildStatus string
 // Statuses a build goes through. If a build fails, it will have a non-nil Finish,
 // and the status indicates the step that failed.
 const (
-	StatusNew       BuildStatus = "new"       // Build queued but not yet started.
-	StatusClone     BuildStatus = "clone"     // Cloning source code, e.g. from git.
-	StatusBuild     BuildStatus = "build"     // Building application.
-	StatusSuccess   BuildStatus = "success"   // Build was successful.
-	StatusCancelled BuildStatus = "cancelled" // Build was cancelled before finishing.
+	StatusNew        BuildStatus = "new"        // Build queued but not yet started.
+	StatusClone      BuildStatus = "clone"      // Cloning source code, e.g. from git.
+	StatusBuild      BuildStatus = "build"      // Building application.
+	StatusSuccess    BuildStatus = "success"    // Build was successful.
+	StatusCancelled  BuildStatus = "cancelled"  // Build was cancelled before finishing.
+	StatusTimeout    BuildStatus = "timeout"    // Build was cancelled because it took too long, or didn't write output for too long.
+	StatusSuperseded BuildStatus = "superseded" // Build was cancelled because a newer build for the same branch was started, see Build.SupersededBy.
+	StatusSkipped    BuildStatus = "skipped"    // Build was not needed because no files matching the path patterns of the repository changed.
+)
+
+// RefType is the kind of ref a build is for.
+type RefType string
+
+const (
+	RefBranch      RefType = "branch"
+	RefTag         RefType = "tag"
+	RefPullRequest RefType = "pullrequest"
 )
 
 // VCS indicates the mechanism to fetch the source code.
@@ -58,12 +71,127 @@ type Repo struct {
 	WebhookSecret             string  // If non-empty, a per-repo secret for incoming webhook calls.
 	AllowGlobalWebhookSecrets bool    // If set, global webhook secrets are allowed to start builds. Set initially during migrations. Will be ineffective when global webhooks have been unconfigured.
 
+	// If set, path of a file in the checkout, relative to the checkout path, e.g.
+	// ".ding/build.sh", with the build script. It is read after the clone, so the
+	// script of the built commit is used. If the file does not exist, BuildScript is
+	// used.
+	BuildScriptPath string
+
+	// Patterns for names of branches and tags, as for path.Match, for selecting the
+	// pushes that start a build through a webhook or "ding kick". If an include list
+	// is not empty, only matching names are built. Names matching an exclude pattern
+	// are not built. For pull requests, the source branch is matched. Builds created
+	// through the web interface are not filtered.
+	IncludeBranches []string
+	ExcludeBranches []string
+	IncludeTags     []string
+	ExcludeTags     []string
+
+	// Patterns for paths of files, for skipping builds when no relevant files
+	// changed since the previous build of the branch. Patterns are as for path.Match.
+	// A pattern without slash matches any element of a path, e.g. "*.md" or "docs",
+	// other patterns match a path or its leading directories, e.g. "cmd/*". If
+	// IncludePaths is not empty, only changes to matching files are relevant. Changes
+	// to files matching ExcludePaths are not relevant. Low-priority builds and
+	// builds of pull requests and tags are not skipped.
+	IncludePaths []string
+	ExcludePaths []string
+
+	// If set, successful builds of tags are released automatically, as with
+	// ReleaseCreate.
+	ReleaseTags bool
+
+	// If non-zero, for pushes of multiple commits through a webhook, low-priority
+	// builds are created for up to this many commits before the head commit, in
+	// addition to the build of the head commit. The most recent commits are built. At
+	// most 20.
+	PushCommitBuilds int32
+
+	// If set, when a build of a branch fails after a successful build of the branch,
+	// the commits in between are bisected: low-priority builds are created one at a
+	// time, in a binary search for the first failing commit. The failure notification
+	// is sent when the first failing commit is found, and mentions it. Only for git
+	// repositories, for up to 1000 commits.
+	Bisect bool
+
+	// Repositories to build after builds of this repository, e.g. services that
+	// depend on a library. Triggered builds get details about the upstream build in
+	// environment variables $DING_UPSTREAM_*. Only builds of the build script of the
+	// repository trigger builds, not builds of Jobs.
+	Downstreams []Downstream
+
+	// Additional named jobs, each with its own build script, triggers and Go
+	// toolchains, e.g. for linting, releases, or subprojects of a monorepo. A push
+	// through a webhook, "ding kick" or a poll creates a build of the build script of
+	// the repository, and a build for each job whose patterns match. Builds of jobs
+	// have their own history per branch.
+	Jobs []RepoJob
+
+	// If non-zero, the origin is checked for new commits every PollInterval seconds,
+	// for repositories without webhooks. A build is created for each polled branch
+	// whose head differs from the commit of its latest build.
+	PollInterval int32
+	PollBranches []string // Branches to poll. If empty, the default branch is polled.
+
+	// For VCS "command", required for polling: shell command that prints the head
+	// commit of branch $DING_BRANCH, as last line of the form "commit:<hash>", like
+	// the clone command.
+	PollCommand string
+
+	PollLast  *time.Time // Time of last poll, nil if never polled.
+	PollError string     // Error of last poll, empty if it was successful.
+
 	// Build with go toolchains. If set, PATH includes the go toolchain and GOTOOLCHAIN is set.
 	GoAuto bool // Build for each of the available go toolchains: go (current), goprev, gonext.
 	GoCur  bool
 	GoPrev bool
 	GoNext bool // If Go toolchain gonext doesn't exist, it is skipped.
 
+	// Run the build steps for the go toolchains and the build matrix concurrently,
+	// each in its own copy of the checkout, instead of sequentially. All steps run to
+	// completion, instead of stopping at the first failure.
+	GoParallel bool
+
+	// Axes of the build matrix, in addition to the Go toolchains. The build script is
+	// run for each combination of values, each in its own build step, with an
+	// environment variable per axis.
+	Matrix []MatrixAxis
+
+	// Maximum number of builds to run concurrently for this repo, for different
+	// branches. Builds for the same branch are never run concurrently. Zero means 1.
+	MaxBuilds int
+
+	// If set, a new build for a branch cancels builds for that branch that are waiting
+	// to start, marking them as superseded. Not for low-prio builds. Builds of earlier
+	// commits of a push and for bisects are not superseded.
+	SupersedeBuilds bool
+
+	// If set, along with SupersedeBuilds, a running build for the branch is cancelled
+	// too.
+	SupersedeRunning bool
+
+	// Maximum duration in seconds for the clone and build steps together. If the
+	// build takes longer, it is cancelled. Zero means no limit.
+	MaxDuration int
+
+	// If the clone or build commands don't write output for this many seconds, the
+	// build is assumed to be stuck and is cancelled. Zero means no limit.
+	InactivityTimeout int
+
+	// Maximum memory in megabytes for the build script. If ding is configured with a
+	// cgroup directory, the limit is for all processes of the build together,
+	// otherwise it limits the address space of each process. Zero means no limit.
+	MaxMemoryMB int
+
+	// Maximum number of processes for the build script. If ding is configured with a
+	// cgroup directory, the limit is for the processes of the build, otherwise for
+	// all processes of the UID of the build. Zero means no limit.
+	MaxProcesses int
+
+	MaxCPUSeconds int // Maximum CPU time in seconds for each process of the build script. Zero means no limit.
+	MaxOpenFiles  int // Maximum number of open files for each process of the build script. Zero means no limit.
+	MaxFileSizeMB int // Maximum size in megabytes of files written by the build script. Zero means no limit.
+
 	// If true, build is run with bubblewrap (bwrap) to isolate the environment
 	// further. Only the system, the build directory, home directory and toolchain
 	// directory is available.
@@ -80,6 +208,169 @@ type Repo struct {
 	// If set, automatically installed Go toolchains will trigger a low priority build
 	// for this repository.
 	BuildOnUpdatedToolchain bool
+
+	// Parameters that can be set when creating a build, with their default values.
+	Params []Param
+
+	// Additional environment variables of the form key=value, and commands prefixed
+	// to the clone and build commands. Combined with the global settings: variables
+	// replace global variables with the same name, and the run prefix is appended to
+	// the global run prefix.
+	Environment []string
+	RunPrefix   []string
+
+	// If set, RunPrefix replaces the global run prefix instead of being appended to
+	// it. With an empty RunPrefix, commands are run without prefix.
+	ReplaceRunPrefix bool
+
+	// Environment variables and run prefixes for branches matching a pattern. Applied
+	// after those of the repository, in order.
+	BranchEnvs []BranchEnv
+
+	// For reporting the status of builds to the commit status API of a forge.
+	CommitStatus CommitStatus
+}
+
+// Forge is a code hosting service with a commit status API.
+type Forge string
+
+// Forges for reporting commit statuses.
+const (
+	ForgeNone      Forge = ""
+	ForgeGithub    Forge = "github"
+	ForgeGitea     Forge = "gitea"
+	ForgeBitbucket Forge = "bitbucket"
+)
+
+// Bisect is the state of an automatic bisect, a binary search for the first failing
+// commit between the last successful build of a branch and a failed build.
+type Bisect struct {
+	Good    string   // Commit of the last successful build of the branch.
+	Commits []string // Commits after Good, up to and including the commit of the failed build, oldest first. Empty if no bisect was done.
+
+	// Indices in Commits of the last commit known to succeed (-1 for Good), and the
+	// first commit known to fail.
+	GoodIndex int32
+	BadIndex  int32
+
+	BuildID  int32  // Build of the commit currently being tested. Zero when the bisect is done.
+	FirstBad string // First failing commit, once found.
+	Error    string // If set, the bisect was aborted, e.g. because a build was cancelled.
+}
+
+// CommitStatus configures reporting build statuses for the commit of the build to
+// a forge: pending when the build starts, and success, failure or cancelled when
+// it finishes. Failed requests are retried.
+type CommitStatus struct {
+	Forge Forge // If empty, no statuses are reported.
+
+	// Base URL of the API, e.g. https://gitea.example.com/api/v1. Required for
+	// gitea. Defaults to https://api.github.com for github, and
+	// https://api.bitbucket.org/2.0 for bitbucket.
+	URL string
+
+	Repository string // Repository at the forge, of the form owner/name, or workspace/name for bitbucket.
+
+	// Name of a secret of the repository holding the access token, sent as bearer
+	// token. The secret is also available to builds.
+	TokenSecret string
+}
+
+// MatrixAxis is a dimension of the build matrix of a repository.
+type MatrixAxis struct {
+	Name   string   // Name of the environment variable, e.g. GOOS.
+	Values []string // Values of the environment variable, e.g. linux and openbsd.
+}
+
+// BranchEnv holds environment variables and a run prefix for builds of branches
+// matching a pattern.
+type BranchEnv struct {
+	Pattern          string   // Pattern for branch names, as for path.Match, e.g. "release/*".
+	Environment      []string // Of the form key=value.
+	RunPrefix        []string
+	ReplaceRunPrefix bool // If set, RunPrefix replaces the run prefix so far instead of being appended to it.
+}
+
+// Downstream is a repository to build after a build of an upstream repository.
+type Downstream struct {
+	Repo string // Name of the downstream repository.
+
+	// Pattern for branches of the upstream repository whose builds trigger a build, as
+	// for path.Match, e.g. "release/*". If empty, the default branch of the upstream
+	// repository.
+	UpstreamBranch string
+
+	Branch    string              // Branch of the downstream repository to build. If empty, its default branch.
+	Condition DownstreamCondition // When a build of the upstream repository triggers a build.
+}
+
+// DownstreamCondition is the condition for triggering a build of a downstream
+// repository.
+type DownstreamCondition string
+
+const (
+	DownstreamSuccess DownstreamCondition = "success" // After a successful build.
+	DownstreamRelease DownstreamCondition = "release" // After a build is released, e.g. a tag.
+)
+
+// RepoJob is a named job of a repository, with its own build script. The branch,
+// tag and path patterns are as for the repository, and are applied in addition to
+// those of the repository.
+type RepoJob struct {
+	Name            string // Name of the job, e.g. "lint", available to builds as $DING_JOB.
+	BuildScript     string
+	BuildScriptPath string // As for the repository.
+
+	IncludeBranches []string
+	ExcludeBranches []string
+	IncludeTags     []string
+	ExcludeTags     []string
+	IncludePaths    []string
+	ExcludePaths    []string
+
+	// Go toolchains to build with, as for the repository.
+	GoAuto bool
+	GoCur  bool
+	GoPrev bool
+	GoNext bool
+}
+
+// Schedule periodically creates a build for a branch of a repository, like cron.
+type Schedule struct {
+	ID       int32
+	RepoName string `bstore:"nonzero,ref Repo"`
+	Branch   string // If empty, the default branch of the repository.
+
+	// When to create builds, in crontab format with 5 fields: minute, hour, day of
+	// month, month, day of week. Fields can be "*", a number or name, a range, a list,
+	// and have a "/step". Shorthands @hourly, @daily, @weekly, @monthly and @yearly
+	// are also accepted. Times are in the local time zone of the ding server.
+	Cron string `bstore:"nonzero"`
+
+	LowPrio     bool      // Whether created builds are low-prio.
+	Next        time.Time // Time at which the next build is created. If ding wasn't running at that time, the build is created at startup.
+	LastBuildID int32     // ID of last build created by this schedule, 0 if none yet.
+}
+
+// Secret is a value for builds of a repository that is stored encrypted, with a
+// key in the data directory. Values are never returned through the API, and
+// are masked in the output of build steps.
+type Secret struct {
+	ID       int32
+	RepoName string `bstore:"nonzero,ref Repo,unique RepoName+Name"`
+
+	// Name of the environment variable in the build script, e.g. DEPLOY_TOKEN. Names
+	// starting with DING_ are reserved.
+	Name string `bstore:"nonzero"`
+
+	// If set, the value is written to a file in the build directory, readable only by
+	// the build, and the environment variable holds the path to the file. The file is
+	// removed after the build. Useful for SSH keys and other credentials that tools
+	// read from files.
+	File bool
+
+	Updated   time.Time
+	Encrypted []byte `json:"-"` // Nonce followed by the value encrypted with AES-256-GCM.
 }
 
 // Build is an attempt at building a repository.
@@ -100,10 +391,66 @@ type Build struct {
 	Version            string   // Version if this build, typically contains a semver version, with optional commit count/hash, perhaps a branch.
 	BuildScript        string
 
+	// If set, BuildScript was read from this file in the checkout, see
+	// Repo.BuildScriptPath. Otherwise it is the build script of the repository or its
+	// job at the time the build was created.
+	BuildScriptFile string
+
+	// Name of the job of the repository this build is for, see Repo.Jobs. Empty for
+	// builds of the build script of the repository. Builds of a job only supersede,
+	// and are compared with, earlier builds of the same job.
+	Job string
+
 	// Low-prio builds run after regular builds for a repo have finished. And we only
 	// run one low-prio build in ding at a time. Useful after a toolchain update.
 	LowPrio bool
 
+	// For builds of a pull request (GitHub) or merge request (Gitea), started through
+	// a webhook: the number of the pull request, and its source branch (possibly in
+	// another repository) and target branch. Branch is "pull/<number>" for these
+	// builds. Zero for other builds.
+	PullRequest       int32
+	PullRequestSource string
+	PullRequestTarget string
+
+	// Kind of ref the build is for. Empty for builds created before the ref type was
+	// recorded, which are for branches.
+	RefType RefType
+
+	// For builds of a tag, the name of the tag. Branch is "tags/<name>" for these
+	// builds.
+	Tag string
+
+	// For builds of a push with multiple commits, if the repository builds each commit
+	// of a push: the ID of the build of the head commit of the push, and the position
+	// of the commit among the built commits of the push, starting at 1. The head build
+	// has its own ID and the highest position, the builds of earlier commits are
+	// low-priority. Zero for other builds.
+	PushBuildID  int32
+	PushPosition int32
+
+	// For a build that failed after a successful build of its branch, with
+	// Repo.Bisect: the search for the first failing commit. Zero value for other
+	// builds.
+	Bisect Bisect
+
+	// For builds started by a bisect, the ID of the failed build being bisected. Zero
+	// for other builds.
+	BisectBuildID int32
+
+	// For builds triggered by a build of an upstream repository, see
+	// Repo.Downstreams: the name of the upstream repository, and the ID and version
+	// of its build. Available to the build as $DING_UPSTREAM_REPONAME,
+	// $DING_UPSTREAM_BUILDID and $DING_UPSTREAM_VERSION. Empty for other builds.
+	UpstreamRepoName string
+	UpstreamBuildID  int32
+	UpstreamVersion  string
+
+	// Repositories in the chain of triggers that led to this build, starting with the
+	// first. Builds are not triggered for repositories already in the chain, to
+	// prevent cycles.
+	UpstreamRepos []string
+
 	LastLine  string // Last line of output, when build has completed.
 	DiskUsage int64  // Disk usage for build.
 
@@ -111,9 +458,47 @@ type Build struct {
 	// Disk usage can shrink, e.g. after a cleanup.
 	HomeDiskUsageDelta int64
 
+	// If set, this build was cancelled because of a newer build for the same branch,
+	// with this ID. The status is "superseded".
+	SupersededBy int32
+
+	// Peak memory usage in bytes of the build script. If ding is configured with a
+	// cgroup directory, this is for all processes of the build together, otherwise
+	// for the largest process. Zero if unknown.
+	PeakMemory int64
+
+	CPUNsec int64 // User and system CPU time used by the build script, for all build steps.
+
+	// Values for all parameters of the repository at the time the build was created.
+	// Available during clone and build as environment variables.
+	Params []Param
+
+	// Additional environment variables and run prefix the build was created with, from
+	// the global settings, the repository and matching branch patterns. The DING_
+	// variables are not included.
+	Environment []string
+	RunPrefix   []string
+
 	Results []Result // Only set for success builds.
 
+	// Number of tests over all build steps, see Step.Tests. Set for finished builds.
+	TestsPassed  int32
+	TestsFailed  int32
+	TestsSkipped int32
+
 	Steps []Step // Only set for finished builds.
+
+	// Set for a new build of a push whose changed files, from the webhook, match the
+	// path patterns. The changed files are then not listed again after the clone. Not
+	// stored.
+	pathsMatched bool
+}
+
+// Param is a named parameter for a build. Its value is available during clone and
+// build as environment variable DING_PARAM_<name>.
+type Param struct {
+	Name  string // Letters, digits and underscore.
+	Value string // Default value for a parameter of a repository, the value used for a build.
 }
 
 // Result is a file created during a build, as the result of a build.
@@ -128,11 +513,60 @@ type Result struct {
 	// For releases, the file is stored gzipped at <dataDir>/release/<repoName>/<buildID>/<basename of filename>.gz.
 	Filename string
 	Filesize int64 // Size of filename.
+
+	// Directory in the build directory with the checkout that has the file. Empty
+	// means "checkout". Set to e.g. "checkout-goprev" or "checkout-goprev-linux" for
+	// build steps of Go toolchains and build matrices that ran concurrently.
+	Checkout string
 }
 
 // Step is one phase of a build and stores the output generated in that step.
 type Step struct {
-	Name   string // Mostly same values as build.status.
+	Name   string // Mostly same values as build.status. Builds for Go toolchains and build matrices have a build step per combination, e.g. "build:go" and "build:goprev:linux:amd64".
 	Output string // Combined output of stdout and stderr.
 	Nsec   int64  // Time it took this step to finish, initially 0.
+
+	ErrorMessage       string   // Set if the step failed, e.g. the exit status of build.sh. This field and the fields below are only set for build steps of finished builds.
+	Version            string   // From "version:" line in output.
+	Coverage           *float32 // Test coverage in percentage, from 0 to 100.
+	CoverageReportFile string   // Relative to URL /dl/<reponame>/<buildid>.
+	Results            []Result
+
+	// Results of tests per package, from "go test -json" output of the build script,
+	// or from a file referenced by a "go-test-json:" or "junit:" line. Also set for
+	// failed build steps.
+	Tests []TestPackage
+
+	// For build steps of a combination of Go toolchain and build matrix, the
+	// environment variable of each axis with its value. The Go toolchain is the
+	// DING_GOTOOLCHAIN axis. Only set for finished builds.
+	Matrix []Param
+}
+
+// TestPackage holds the results of the tests of a Go package or of a test suite
+// in a JUnit XML report.
+type TestPackage struct {
+	Package string     // Import path, or name of the test suite.
+	Status  TestStatus // Failed if no final status was seen, e.g. when the test binary crashed.
+	Elapsed float64    // In seconds.
+	Output  string     // Output of the package outside its tests, e.g. a build error. Only kept for failed packages, possibly truncated.
+	Tests   []Test
 }
+
+// Test is the result of a single test.
+type Test struct {
+	Name    string // Go subtests include the name of their parent, e.g. "TestX/sub". JUnit tests can be prefixed with their class name.
+	Status  TestStatus
+	Elapsed float64 // In seconds.
+	Output  string  // Only kept for failed tests, possibly truncated.
+}
+
+// TestStatus is the status of a test or package. JUnit tests with an error are
+// failed.
+type TestStatus string
+
+const (
+	TestPass TestStatus = "pass"
+	TestFail TestStatus = "fail"
+	TestSkip TestStatus = "skip"
+)
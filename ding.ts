@@ -75,6 +75,9 @@ const streams = {
 	build: new Stream<api.EventBuild>(),
 	removeBuild: new Stream<api.EventRemoveBuild>(),
 	output: new Stream<api.EventOutput>(),
+	queue: new Stream<api.EventQueue>(),
+	schedule: new Stream<api.EventSchedule>(),
+	removeSchedule: new Stream<api.EventRemoveSchedule>(),
 }
 
 let sseElem = dom.span('Disconnected from live updates.') // Shown in UI next to logout button.
@@ -109,6 +112,9 @@ const initEventSource = () => {
 	eventSource.addEventListener('build', (e: MessageEvent) => streams.build.send(api.parser.EventBuild(JSON.parse(e.data))))
 	eventSource.addEventListener('removeBuild', (e: MessageEvent) => streams.removeBuild.send(api.parser.EventRemoveBuild(JSON.parse(e.data))))
 	eventSource.addEventListener('output', (e: MessageEvent) => streams.output.send(api.parser.EventOutput(JSON.parse(e.data))))
+	eventSource.addEventListener('queue', (e: MessageEvent) => streams.queue.send(api.parser.EventQueue(JSON.parse(e.data))))
+	eventSource.addEventListener('schedule', (e: MessageEvent) => streams.schedule.send(api.parser.EventSchedule(JSON.parse(e.data))))
+	eventSource.addEventListener('removeSchedule', (e: MessageEvent) => streams.removeSchedule.send(api.parser.EventRemoveSchedule(JSON.parse(e.data))))
 }
 
 // Atexit helps run cleanup code when a page is unloaded. A page has an atexit to
@@ -241,6 +247,17 @@ const formatCoverage = (repo: api.Repo, b: api.Build) => {
 	return anchor === 'report' ? '' : anchor
 }
 
+const formatTests = (b: api.Build) => {
+	if (!b.TestsPassed && !b.TestsFailed && !b.TestsSkipped) {
+		return ''
+	}
+	return dom.span(
+		attr.title(b.TestsPassed+' passed, '+b.TestsFailed+' failed, '+b.TestsSkipped+' skipped'),
+		''+b.TestsPassed,
+		b.TestsFailed ? [' / ', dom.span(style({color: colors.red}), ''+b.TestsFailed)] : [],
+	)
+}
+
 const age0 = (mins: boolean, start: Date, end?: Date | undefined): [HTMLElement, () => void] => {
 	const second = 1
 	const minute = 60*second
@@ -310,7 +327,9 @@ const formatBuildSize = (b: api.Build) =>
 	)
 
 const statusColor = (b: api.Build) => {
-	if (b.ErrorMessage || b.Finish && b.Status !== api.BuildStatus.StatusSuccess) {
+	if (b.Status === api.BuildStatus.StatusSuperseded || b.Status === api.BuildStatus.StatusSkipped) {
+		return colors.gray
+	} else if (b.ErrorMessage || b.Finish && b.Status !== api.BuildStatus.StatusSuccess) {
 		return colors.red
 	} else if (b.Released) {
 		return colors.blue
@@ -329,6 +348,12 @@ const buildStatus = (b: api.Build) => {
 	return dom.span(s, style({fontSize: '.9em', color: 'white', backgroundColor: statusColor(b), padding: '0 .2em', borderRadius: '.15em'}))
 }
 
+// Ordinal returns e.g. "1st", "2nd", "3rd", "4th".
+const ordinal = (n: number) => {
+	const suffix = n%100 >= 11 && n%100 <= 13 ? 'th' : ['th', 'st', 'nd', 'rd'][n%10] || 'th'
+	return ''+n+suffix
+}
+
 const buildErrmsg = (b: api.Build) => {
 	let msg = b.ErrorMessage
 	if (b.ErrorMessage && b.LastLine) {
@@ -337,6 +362,26 @@ const buildErrmsg = (b: api.Build) => {
 	return msg ? dom.span(style({maxWidth: '40em', display: 'inline-block'}), msg) : []
 }
 
+const buildBranch = (b: api.Build) => {
+	const job = b.Job ? [' ', dom.span(b.Job, style({color: colors.gray}), attr.title('Job of the repository.'))] : []
+	if (!b.PullRequest) {
+		return [b.Branch, job]
+	}
+	return [dom.span('PR #'+b.PullRequest, attr.title('Pull request from '+b.PullRequestSource+' into '+b.PullRequestTarget+'.')), job]
+}
+
+const pollError = (repo: api.Repo) => {
+	if (!repo.PollInterval || !repo.PollError) {
+		return []
+	}
+	return [' ', dom.span('!', style({color: colors.red, fontWeight: 'bold'}), attr.title('Last poll for new commits failed: '+repo.PollError))]
+}
+
+// extraBuild returns whether the build is for an older commit of its branch, for
+// an earlier commit of a push or for a bisect, built in addition to the latest
+// commit.
+const extraBuild = (b: api.Build) => !!b.PushBuildID && b.PushBuildID !== b.ID || !!b.BisectBuildID
+
 const popupOpts = (opaque: boolean, ...kids: ElemArg[]) => {
 	const origFocus = document.activeElement
 	const close = () => {
@@ -395,6 +440,7 @@ const popupRepoAdd = async (haveBubblewrap: boolean, haveGoToolchainDir: boolean
 	let gocur: HTMLInputElement
 	let goprev: HTMLInputElement
 	let gonext: HTMLInputElement
+	let goparallel: HTMLInputElement
 	let fieldset: HTMLFieldSetElement
 
 	let branchChanged = false
@@ -450,11 +496,46 @@ const popupRepoAdd = async (haveBubblewrap: boolean, haveGoToolchainDir: boolean
 					WebhookSecret: '',
 					AllowGlobalWebhookSecrets: false,
 					BuildScript: '',
+					BuildScriptPath: '',
 					HomeDiskUsage: 0,
 					GoAuto: goauto.checked,
 					GoCur: gocur.checked,
 					GoPrev: goprev.checked,
 					GoNext: gonext.checked,
+					GoParallel: goparallel.checked,
+					MaxBuilds: 0,
+					SupersedeBuilds: false,
+					SupersedeRunning: false,
+					MaxDuration: 0,
+					InactivityTimeout: 0,
+					MaxMemoryMB: 0,
+					MaxProcesses: 0,
+					MaxCPUSeconds: 0,
+					MaxOpenFiles: 0,
+					MaxFileSizeMB: 0,
+					Params: [],
+					Matrix: [],
+					Environment: [],
+					RunPrefix: [],
+					ReplaceRunPrefix: false,
+					BranchEnvs: [],
+					IncludeBranches: [],
+					ExcludeBranches: [],
+					IncludeTags: [],
+					ExcludeTags: [],
+					IncludePaths: [],
+					ExcludePaths: [],
+					ReleaseTags: false,
+					PushCommitBuilds: 0,
+					Bisect: false,
+					Downstreams: [],
+					Jobs: [],
+					PollInterval: 0,
+					PollBranches: [],
+					PollCommand: '',
+					PollLast: null,
+					PollError: '',
+					CommitStatus: {Forge: api.Forge.ForgeNone, URL: '', Repository: '', TokenSecret: ''},
 				}
 				const r = await authed(() => client.RepoCreate(password, repo), fieldset)
 				location.hash = '#repo/'+encodeURIComponent(r.Name)
@@ -502,7 +583,7 @@ const popupRepoAdd = async (haveBubblewrap: boolean, haveGoToolchainDir: boolean
 						' Prevent network access from build script. Only active if bubblewrap is active.',
 						attr.title('Hide network interfaces from the build script. Only a loopback device is available.'),
 					),
-					dom.div('Build for Go toolchains', style({whiteSpace: 'nowrap'}), attr.title('The build script will be run for each of the selected Go toolchains. The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.')),
+					dom.div('Build for Go toolchains', style({whiteSpace: 'nowrap'}), attr.title('The build script will be run for each of the selected Go toolchains, each in its own build step, e.g. "build:goprev". The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.')),
 					dom.div(
 						dom.label(
 							goauto=dom.input(attr.type('checkbox'), haveGoToolchainDir ? attr.checked('') : '', function change() {
@@ -530,6 +611,11 @@ const popupRepoAdd = async (haveBubblewrap: boolean, haveGoToolchainDir: boolean
 							' Go next',
 							attr.title('Release candidate of Go toolchain, if available.'),
 						), ' ',
+						dom.label(
+							goparallel=dom.input(attr.type('checkbox')),
+							' Concurrently',
+							attr.title('Run the build steps for the selected Go toolchains and build matrix concurrently instead of sequentially. All steps run to completion, instead of stopping at the first failure. Steps other than the first run in a copy of the checkout, at e.g. $DING_BUILDDIR/checkout-goprev-linux/$DING_CHECKOUTPATH.'),
+						), ' ',
 					),
 					dom.div(),
 					dom.label(
@@ -562,7 +648,7 @@ const pageHome = async (): Promise<Page> => {
 	const rblFavicon = () => {
 		let busy = false
 		for (const rb of rbl) {
-			for (const b of (rb.Builds || [])) {
+			for (const b of [...(rb.Builds || []), ...(rb.PullRequestBuilds || [])]) {
 				if (!b.Finish) {
 					busy = true
 					break
@@ -612,22 +698,23 @@ const pageHome = async (): Promise<Page> => {
 				dom.tbody(
 					rbl.length === 0 ? dom.tr(dom.td(attr.colspan('10'), 'No repositories', style({textAlign: 'left'}))) : [],
 					rbl.map(rb => {
-						if ((rb.Builds || []).length === 0) {
+						const builds = [...(rb.Builds || []), ...(rb.PullRequestBuilds || [])]
+						if (builds.length === 0) {
 							return dom.tr(
-								dom.td(link('#repo/'+encodeURIComponent(rb.Repo.Name), rb.Repo.Name))
+								dom.td(link('#repo/'+encodeURIComponent(rb.Repo.Name), rb.Repo.Name), pollError(rb.Repo))
 							)
 						}
-						return (rb.Builds || []).map((b, i) =>
+						return builds.map((b, i) =>
 							dom.tr(
-								i === 0 ? dom.td(link('#repo/'+encodeURIComponent(rb.Repo.Name), rb.Repo.Name), attr.rowspan(''+(rb.Builds || []).length)) : [],
+								i === 0 ? dom.td(link('#repo/'+encodeURIComponent(rb.Repo.Name), rb.Repo.Name), pollError(rb.Repo), attr.rowspan(''+builds.length)) : [],
 								dom.td(link('#repo/'+encodeURIComponent(rb.Repo.Name)+'/build/'+b.ID, ''+b.ID)),
 								dom.td(buildStatus(b)),
 								dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''),
-								dom.td(b.Branch),
+								dom.td(buildBranch(b)),
 								dom.td(b.Version, b.CommitHash ? attr.title('Commit '+b.CommitHash) : []),
 								dom.td(formatCoverage(rb.Repo, b)),
 								dom.td(formatBuildSize(b)),
-								i === 0 ? dom.td(attr.rowspan(''+(rb.Builds || []).length), rb.Repo.UID ? dom.span(formatSize(rb.Repo.HomeDiskUsage), attr.title('Of reused home directory')) : []) : [],
+								i === 0 ? dom.td(attr.rowspan(''+builds.length), rb.Repo.UID ? dom.span(formatSize(rb.Repo.HomeDiskUsage), attr.title('Of reused home directory')) : []) : [],
 								dom.td(atexit.ageMins(b.Created, undefined)),
 								dom.td(style({textAlign: 'left'}), buildErrmsg(b)),
 							)
@@ -641,19 +728,27 @@ const pageHome = async (): Promise<Page> => {
 	render()
 
 	page.subscribe(streams.build, (e: api.EventBuild) => {
+		// Only the latest commit of a branch is shown.
+		if (extraBuild(e.Build)) {
+			return
+		}
 		const rbi = rbl.findIndex(rb => rb.Repo.Name === e.Build.RepoName)
 		if (rbi < 0) {
 			return
 		}
 		const rb = rbl[rbi]
-		const builds = rb.Builds || []
+		const builds = (e.Build.PullRequest ? rb.PullRequestBuilds : rb.Builds) || []
 		const i = builds.findIndex(b => b.ID === e.Build.ID)
 		if (i < 0) {
 			builds.unshift(e.Build)
 		} else {
 			builds[i] = e.Build
 		}
-		rb.Builds = builds
+		if (e.Build.PullRequest) {
+			rb.PullRequestBuilds = builds
+		} else {
+			rb.Builds = builds
+		}
 		rbl.splice(rbi, 1)
 		rbl.unshift(rb)
 		rblFavicon()
@@ -665,6 +760,7 @@ const pageHome = async (): Promise<Page> => {
 			return
 		}
 		rb.Builds = (rb.Builds || []).filter(b => b.ID !== e.BuildID)
+		rb.PullRequestBuilds = (rb.PullRequestBuilds || []).filter(b => b.ID !== e.BuildID)
 		rblFavicon()
 		render()
 	})
@@ -676,7 +772,7 @@ const pageHome = async (): Promise<Page> => {
 				return
 			}
 		}
-		rbl.unshift({Repo: ev.Repo, Builds: []})
+		rbl.unshift({Repo: ev.Repo, Builds: [], PullRequestBuilds: []})
 		render()
 	})
 	page.subscribe(streams.removeRepo, (ev: api.EventRemoveRepo) => {
@@ -863,6 +959,7 @@ const pageSettings = async (): Promise<Page> => {
 	let notifyEmailAddrs: HTMLInputElement
 	let runPrefix: HTMLInputElement
 	let environment: HTMLTextAreaElement
+	let maxBuilds: HTMLInputElement
 	let automaticGoToolchains: HTMLInputElement
 	let goToolchainWebhookSecret: HTMLInputElement
 	let githubSecret: HTMLInputElement
@@ -902,6 +999,7 @@ const pageSettings = async (): Promise<Page> => {
 				settings.NotifyEmailAddrs = notifyEmailAddrs.value.split(',').map(s => s.trim()).filter(s => !!s)
 				settings.RunPrefix = runPrefix.value.split(' ').map(s => s.trim()).filter(s => !!s)
 				settings.Environment = environment.value.split('\n').map(s => s.trim()).filter(s => !!s)
+				settings.MaxBuilds = parseInt(maxBuilds.value) || 0
 				settings.AutomaticGoToolchains = automaticGoToolchains.checked
 				settings.GoToolchainWebhookSecret = goToolchainWebhookSecret.value
 				settings.GithubWebhookSecret = githubSecret.value
@@ -922,6 +1020,8 @@ const pageSettings = async (): Promise<Page> => {
 					runPrefix=dom.input(attr.value((settings.RunPrefix || []).join(' '))),
 					dom.div('Additional environment variables', style({whiteSpace: 'nowrap'}), attr.title('Of the form key=value, one per line.')),
 					environment=dom.textarea((settings.Environment || []).map(s => s+'\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows(''+Math.max(8, (settings.Environment || []).length+1))),
+					dom.div('Max concurrent builds', style({whiteSpace: 'nowrap'}), attr.title('Maximum number of builds to run concurrently, including low-priority builds. Zero means no limit. Queued builds are started in order, but builds for repositories with fewer running builds go first.')),
+					maxBuilds=dom.input(attr.type('number'), attr.min('0'), attr.value(''+settings.MaxBuilds)),
 					dom.div(),
 					dom.label(
 						automaticGoToolchains=dom.input(attr.type('checkbox'), settings.AutomaticGoToolchains ? attr.checked('') : []),
@@ -968,6 +1068,16 @@ const pageDocs = async (): Promise<Page> => {
 
 		dom.h1('Webhooks'),
 		dom.p('For each project to build, first configure a repository and a build script. Optionally configure the code repository to call a ding webhook to start a build. For git, this can be done with post-receive shell script in .git/hooks, or through various settings in web apps like gitea, github and bitbucket. For custom scripts, run ', dom.tt('ding kick baseURL repoName branch commit < password-file'), ' to start a build, where baseURL could be http://localhost:6084 (for default settings), and password is what you use for logging in. For externally-defined webhook formats, ensure the ding webhook listener is publicly accessible (e.g. through a reverse proxy), and configure these paths for the respective services: ', dom.tt('https://.../gitea/<repo>'), ', ', dom.tt('https://.../github/<repo>'), ' or ', dom.tt('https://.../bitbucket/<repo>/<secret>'), '. Gitea includes a "secret" in an Authorization header, github signs its request payload, for bitbucket you must include a secret value in the URL they send the webhook too. These secrets must be configured in the ding configuration file.'),
+		dom.p('Pull request events from github and merge request events from gitea also start builds, when a pull request is opened, reopened or receives new commits. The head of the pull request is fetched from ref ', dom.tt('refs/pull/<number>/head'), ', and the build gets branch name ', dom.tt('pull/<number>'), '. Pull requests can come from anyone, so builds of pull requests do not get the secrets of the repository. Only the 3 most recent builds of each pull request are kept, for at most 14 days.'),
+		dom.p('The result of builds can be reported back to github, gitea and bitbucket, as commit status with a link to the build, by configuring "Commit status" for a repository. The access token for the API of the forge is stored as a secret of the repository.'),
+		dom.p('Repositories without webhooks, e.g. on plain SSH git servers or local mercurial repositories, can be polled for new commits. Ding runs ', dom.tt('git ls-remote'), ' or ', dom.tt('hg identify'), ' for the polled branches, or the configured poll command for VCS "command", and creates a build for each branch whose head differs from the commit of its latest build. An error from the last poll is shown with the repository.'),
+		dom.p('For pushes with multiple commits through a github or gitea webhook, the earlier commits can also be built, by setting the number of commits of a push to build for a repository. The last commit is built as usual, the earlier commits get low-priority builds that do not count as the latest build of the branch. The build page shows the builds of all commits of the push, with the first failed commit highlighted.'),
+		dom.p('For git repositories, failures can be bisected automatically. When a build of a branch fails after a successful build, ding builds commits in between with low-priority builds, one at a time, in a binary search for the first failing commit, following first parents of merges. The first failing commit is shown with the failed build and mentioned in the failure notification, which is sent when the bisect is done.'),
+		dom.p('Repositories can have downstream repositories, that are built after a successful build, or after a release, of the upstream repository, e.g. services that depend on a library. Triggered builds get details of the upstream build in environment variables. Cycles of triggers are prevented: a repository is not triggered again by a chain of builds it started.'),
+		dom.p('A repository can have additional named jobs, each with its own build script, branch, tag and path patterns, and Go toolchains, e.g. a quick lint job, a release job for tags, or a job per subproject of a monorepo. A single push builds the build script of the repository and each matching job, from a single repository configuration and webhook. Builds show the job they are for, and each job has its own history per branch, for notifications and commit statuses.'),
+		dom.p('Pushed tags start a build of the tag, with branch name ', dom.tt('tags/<name>'), ' and the tag in ', dom.tt('$DING_TAG'), '. Builds of tags can be released automatically when successful. A tag can also be built with ', dom.tt('ding kick'), ' or through the web interface, with branch ', dom.tt('tags/<name>'), '.'),
+		dom.p('Repositories can have include and exclude patterns for branches and tags, to only start builds for pushes of some branches or tags, e.g. to skip branches like "wip/*". The webhook responds with the reason a push was ignored.'),
+		dom.p('Repositories can also have include and exclude patterns for paths. Builds are skipped when none of the files changed since the previous build of the branch are relevant, e.g. for changes to documentation only. Changed files are taken from the commits in the webhook payload if available, or determined with "git diff" after the clone. Skipped builds get status "skipped" and are removed after 30 days.'),
 
 		dom.h1('Authentication'),
 		dom.p('Ding only has simple password-based authentication, with a single password for the entire system. Everyone with the password can see all repositories, builds and scripts, and modify all data.'),
@@ -984,10 +1094,12 @@ const pageDocs = async (): Promise<Page> => {
 data/
     build/<repoName>/<buildID>/       ($DING_BUILDDIR during builds)
         checkout/$DING_CHECKOUTPATH/  (working directory for build.sh)
+        checkout-<cell>/              (copies of checkout, for concurrent build steps for Go toolchains and build matrix)
         scripts/
             build.sh                  (copied from database before build)
         output/
-            {clone,build}.{stdout,stderr,output,nsec}
+            {clone,build,build:<goname>:<matrix values>}.{stdout,stderr,output,nsec}
+            steps                     (names of started steps)
         home/                         (for builds with unique $HOME/uid)
         dl/                           (files stored here are available at /dl/file/<repoName>/<buildID>/)
     release/<repoName>/<buildID>/
@@ -1013,6 +1125,10 @@ const docsBuildScript = (): HTMLElement => {
 		dom.h1('Build script environment'),
 		dom.p('The build script is run in a clean environment. It should exit with status 0 only when successful. Patterns in the output indicate where build results can be found, such as files and test coverage, see below.'),
 		dom.p('The working directory is set to $DING_BUILDDIR/checkout/$DING_CHECKOUTPATH.'),
+		dom.p('The build script can be read from a file in the repository, e.g. ', dom.tt('.ding/build.sh'), ', by configuring a build script file. The file is read after the clone, at the commit being built, so changes to the script are versioned with the code, and builds of older commits run the script of that commit. If the file does not exist, the build script configured in ding is used. Each build shows the script it ran, and where it came from.'),
+		dom.p('Build parameters configured for the repository are available as $DING_PARAM_<name>. Values can be set when creating a build, with ', dom.tt('ding kick -param name=value ...'), ', or with query string parameters like ', dom.tt('?param=name=value'), ' in webhook URLs. Parameters without a value get their default.'),
+		dom.p('For repositories with a build matrix, the build script is run for each combination of values, with the value of each axis in the environment variable with the name of the axis. Output files of build steps that ran concurrently should have different names, e.g. with $GOOS in the name.'),
+		dom.p('Secrets configured for the repository are available to the build script, not to clone commands, as environment variables with the name of the secret. For secrets stored as file, the variable holds the path of a file in $DING_BUILDDIR/secrets that is removed after the build. Values of secrets are replaced with "***" in the output of the build script.'),
 		dom.p('Only a single build will be run for a repository.'),
 
 		dom.h2('Example'),
@@ -1096,7 +1212,11 @@ git diff --exit-code
 		dom.ul(
 			dom.li("$HOME, an initially empty directory; for repo's with per-build unique UIDs, equal to $DING_BUILDDIR/home, with reused $HOME/uid set to data/home/$DING_REPONAME."),
 			dom.li('$DING_REPONAME, name of the repository'),
-			dom.li('$DING_BRANCH, the branch of the build'),
+			dom.li('$DING_BRANCH, the branch of the build, "pull/<number>" for pull requests, "tags/<name>" for tags'),
+			dom.li('$DING_TAG, only for builds of tags, with the name of the tag'),
+			dom.li('$DING_JOB, only for builds of a job of the repository, with the name of the job'),
+			dom.li('$DING_UPSTREAM_REPONAME, $DING_UPSTREAM_BUILDID and $DING_UPSTREAM_VERSION, only for builds triggered by a build of an upstream repository, with the name of the upstream repository, and the ID and version of its build'),
+			dom.li('$DING_PULLREQUEST, $DING_PULLREQUEST_SOURCE and $DING_PULLREQUEST_TARGET, only for builds of pull requests, with the number and source and target branch of the pull request'),
 			dom.li('$DING_COMMIT, the commit id/hash, empty if not yet known'),
 			dom.li('$DING_BUILDID, the build number, unique over all builds in ding'),
 			dom.li('$DING_BUILDDIR, where all files related to the build are stored, set to data/build/$DING_REPONAME/$DING_BUILDID/'),
@@ -1134,19 +1254,29 @@ git diff --exit-code
 
 		dom.p('Filename (must be relative to $DING_DOWNLOADDIR) for more details about the code coverage, e.g. an html coverage file:'),
 		dom.p(dom._class('indent'), dom.tt('coverage-report:', ' ', dom.i(dom._class('mono'), 'file'))),
+
+		dom.p('Filename (must be relative to $DING_DOWNLOADDIR) with the output of "go test -json", for storing the results of the individual Go tests. Lines of "go test -json" written directly to standard output are picked up too. Test results are also stored for failed builds, and notifications about failing builds list the failing tests:'),
+		dom.p(dom._class('indent'), dom.tt('go-test-json:', ' ', dom.i(dom._class('mono'), 'file'))),
+
+		dom.p('Filename (must be relative to $DING_DOWNLOADDIR) of a JUnit XML report, e.g. from Java or JavaScript test runners. Test suites are stored like Go packages:'),
+		dom.p(dom._class('indent'), dom.tt('junit:', ' ', dom.i(dom._class('mono'), 'file'))),
 	)
 }
 
 const pageRepo = async (repoName: string): Promise<Page> => {
 	const page = new Page()
-	let [repo, builds0, [, mailEnabled, haveGoToolchainDir, settings]] = await authed(() =>
+	let [repo, builds0, [, mailEnabled, haveGoToolchainDir, settings], schedules0, secrets0] = await authed(() =>
 		Promise.all([
 			client.Repo(password, repoName),
 			client.Builds(password, repoName),
 			client.Settings(password),
+			client.Schedules(password, repoName),
+			client.Secrets(password, repoName),
 		])
 	)
 	let builds = builds0 || []
+	let schedules = schedules0 || []
+	let secrets = secrets0 || []
 
 	if (builds.length === 0) {
 		setFavicon(favicons.gray)
@@ -1162,31 +1292,33 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 
 		dom._kids(buildsElem,
 			dom.h1('Builds'),
+			repo.PollInterval && repo.PollError ? dom.p(style({color: colors.red}), 'Last poll for new commits failed: ', repo.PollError) : [],
 			dom.table(
 				dom._class('striped', 'wide'),
 				dom.thead(
 					dom.tr(
-						['ID', 'Branch', 'Status', 'Duration', 'Version', 'Coverage', 'Disk usage', 'Age'].map(s => dom.th(s)),
+						['ID', 'Branch', 'Status', 'Duration', 'Version', 'Coverage', 'Tests', 'Disk usage', 'Age'].map(s => dom.th(s)),
 						dom.th(style({textAlign: 'left'}), 'Error'),
 						dom.th('Actions'),
 					),
 				),
 				dom.tbody(
-					builds.length === 0 ? dom.tr(dom.td(attr.colspan('10'), 'No builds', style({textAlign: 'left'}))) : [],
+					builds.length === 0 ? dom.tr(dom.td(attr.colspan('11'), 'No builds', style({textAlign: 'left'}))) : [],
 					builds.map(b =>
 						dom.tr(
 							dom.td(link('#repo/'+encodeURIComponent(repo.Name)+'/build/'+b.ID, ''+b.ID)),
-							dom.td(b.Branch),
+							dom.td(buildBranch(b)),
 							dom.td(buildStatus(b)),
 							dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''),
 							dom.td(b.Version, b.CommitHash ? attr.title('Commit '+b.CommitHash) : []),
 							dom.td(formatCoverage(repo, b)),
+							dom.td(formatTests(b)),
 							dom.td(formatBuildSize(b)),
 							dom.td(atexit.ageMins(b.Created, undefined)),
 							dom.td(style({textAlign: 'left'}), buildErrmsg(b)),
 							dom.td(
-								dom.clickbutton('Rebuild', attr.title('Start new build.'), async function click(e: TargetDisableable) {
-									const nb = await authed(() => client.BuildCreate(password, repo.Name, b.Branch, b.CommitHash, false), e.target)
+								dom.clickbutton('Rebuild', b.PullRequest ? [attr.disabled(''), attr.title('Builds for pull requests are only started through webhooks.')] : attr.title('Start new build.'), async function click(e: TargetDisableable) {
+									const nb = await authed(() => client.BuildCreateJob(password, repo.Name, b.Job, b.Branch, b.CommitHash, false, b.Params || []), e.target)
 									if (!builds.find(b => b.ID === nb.ID)) {
 										builds.unshift(nb)
 										renderBuilds()
@@ -1236,6 +1368,174 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 		}
 		renderBuilds()
 	})
+	page.subscribe(streams.repo, (e: api.EventRepo) => {
+		if (e.Repo.Name !== repo.Name) {
+			return
+		}
+		// Only the state of polling, the settings form is not updated.
+		repo.PollLast = e.Repo.PollLast
+		repo.PollError = e.Repo.PollError
+		renderBuilds()
+	})
+
+	const schedulesElem = dom.div()
+	const renderSchedules = () => {
+		let branch: HTMLInputElement
+		let cron: HTMLInputElement
+		let lowprio: HTMLInputElement
+		let fieldset: HTMLFieldSetElement
+
+		dom._kids(schedulesElem,
+			dom.h1('Schedules'),
+			dom.p('Builds are created periodically for schedules, e.g. nightly builds. Times are in crontab format, in the time zone of the ding server.'),
+			dom.table(
+				dom._class('striped', 'wide'),
+				dom.thead(
+					dom.tr(
+						['Branch', 'Schedule', 'Low priority', 'Next build', 'Last build', 'Actions'].map(s => dom.th(s)),
+					),
+				),
+				dom.tbody(
+					schedules.length === 0 ? dom.tr(dom.td(attr.colspan('6'), 'No schedules', style({textAlign: 'left'}))) : [],
+					schedules.map(s =>
+						dom.tr(
+							dom.td(s.Branch || dom.span(repo.DefaultBranch, attr.title('Default branch.'))),
+							dom.td(dom.tt(s.Cron)),
+							dom.td(s.LowPrio ? 'yes' : 'no'),
+							dom.td(s.Next.toLocaleString(), attr.title(s.Next.toString())),
+							dom.td(s.LastBuildID ? link('#repo/'+encodeURIComponent(repo.Name)+'/build/'+s.LastBuildID, ''+s.LastBuildID) : '-'),
+							dom.td(
+								dom.clickbutton('Remove', attr.title('Remove schedule. Builds created by the schedule are kept.'), async function click(e: TargetDisableable) {
+									await authed(() => client.ScheduleRemove(password, repo.Name, s.ID), e.target)
+									schedules = schedules.filter(xs => xs.ID !== s.ID)
+									renderSchedules()
+								}),
+							),
+						)
+					),
+				),
+			),
+			dom.br(),
+			dom.form(
+				async function submit(e: SubmitEvent) {
+					e.stopPropagation()
+					e.preventDefault()
+					const ns: api.Schedule = {
+						ID: 0,
+						RepoName: repo.Name,
+						Branch: branch.value,
+						Cron: cron.value,
+						LowPrio: lowprio.checked,
+						Next: new Date(),
+						LastBuildID: 0,
+					}
+					const s = await authed(() => client.ScheduleCreate(password, ns), fieldset)
+					if (!schedules.find(xs => xs.ID === s.ID)) {
+						schedules.push(s)
+					}
+					renderSchedules()
+				},
+				fieldset=dom.fieldset(
+					branch=dom.input(attr.placeholder('Branch, empty for default'), attr.title('Branch to build. If empty, the default branch of the repository is built.')), ' ',
+					cron=dom.input(attr.required(''), attr.placeholder('0 3 * * *'), attr.title('Minute, hour, day of month, month, day of week. Fields can be "*", a number or name, a range like "1-5", a list like "1,15", and have a step like "*/15". Shorthands @hourly, @daily, @weekly, @monthly and @yearly are also accepted.')), ' ',
+					dom.label(
+						lowprio=dom.input(attr.type('checkbox')),
+						' Low priority',
+						attr.title('Create low-priority builds, only started when no other builds are in progress.'),
+					), ' ',
+					dom.submitbutton('Add schedule'),
+				),
+			),
+		)
+	}
+	renderSchedules()
+
+	page.subscribe(streams.schedule, (e: api.EventSchedule) => {
+		if (e.Schedule.RepoName !== repo.Name) {
+			return
+		}
+		const i = schedules.findIndex(s => s.ID === e.Schedule.ID)
+		if (i < 0) {
+			schedules.push(e.Schedule)
+		} else {
+			schedules[i] = e.Schedule
+		}
+		renderSchedules()
+	})
+	page.subscribe(streams.removeSchedule, (e: api.EventRemoveSchedule) => {
+		if (e.RepoName !== repo.Name) {
+			return
+		}
+		schedules = schedules.filter(s => s.ID !== e.ScheduleID)
+		renderSchedules()
+	})
+
+	const secretsElem = dom.div()
+	const renderSecrets = () => {
+		let name: HTMLInputElement
+		let value: HTMLTextAreaElement
+		let file: HTMLInputElement
+		let fieldset: HTMLFieldSetElement
+
+		dom._kids(secretsElem,
+			dom.h1('Secrets'),
+			dom.p('Secrets are available to the build script as environment variables, or as files with the environment variable holding the path. Values are stored encrypted, cannot be viewed after saving, and are replaced with "***" in the build output. Builds of pull requests do not get secrets.'),
+			dom.table(
+				dom._class('striped', 'wide'),
+				dom.thead(
+					dom.tr(
+						['Name', 'Type', 'Updated', 'Actions'].map(s => dom.th(s)),
+					),
+				),
+				dom.tbody(
+					secrets.length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'No secrets', style({textAlign: 'left'}))) : [],
+					secrets.map(s =>
+						dom.tr(
+							dom.td(dom.tt(s.Name)),
+							dom.td(s.File ? 'file' : 'environment'),
+							dom.td(s.Updated.toLocaleString(), attr.title(s.Updated.toString())),
+							dom.td(
+								dom.clickbutton('Remove', async function click(e: TargetDisableable) {
+									await authed(() => client.SecretRemove(password, repo.Name, s.Name), e.target)
+									secrets = secrets.filter(xs => xs.ID !== s.ID)
+									renderSecrets()
+								}),
+							),
+						)
+					),
+				),
+			),
+			dom.br(),
+			dom.form(
+				async function submit(e: SubmitEvent) {
+					e.stopPropagation()
+					e.preventDefault()
+					const s = await authed(() => client.SecretSave(password, repo.Name, name.value, value.value, file.checked), fieldset)
+					secrets = secrets.filter(xs => xs.ID !== s.ID)
+					secrets.push(s)
+					secrets.sort((a, b) => a.Name < b.Name ? -1 : 1)
+					renderSecrets()
+				},
+				fieldset=dom.fieldset(
+					dom.div(
+						name=dom.input(attr.required(''), attr.placeholder('NAME'), attr.title('Name of the environment variable. Saving a secret with an existing name replaces it.')), ' ',
+						dom.label(
+							file=dom.input(attr.type('checkbox')),
+							' As file',
+							attr.title('Write the value to a file in the build directory, and set the environment variable to its path. For e.g. SSH keys. The file is removed after the build.'),
+						),
+					),
+					dom.div(
+						value=dom.textarea(attr.required(''), attr.placeholder('Value'), attr.rows('3'), style({width: '100%'})),
+					),
+					dom.div(
+						dom.submitbutton('Save secret'),
+					),
+				),
+			),
+		)
+	}
+	renderSecrets()
 
 	let name: HTMLInputElement
 	let vcs: HTMLSelectElement
@@ -1253,12 +1553,184 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 	let gocur: HTMLInputElement
 	let goprev: HTMLInputElement
 	let gonext: HTMLInputElement
+	let goparallel: HTMLInputElement
 	let notifyEmailAddrs: HTMLInputElement
+	let maxBuilds: HTMLInputElement
+	let supersedeBuilds: HTMLInputElement
+	let supersedeRunning: HTMLInputElement
+	let maxDuration: HTMLInputElement
+	let inactivityTimeout: HTMLInputElement
+	let maxMemoryMB: HTMLInputElement
+	let maxProcesses: HTMLInputElement
+	let maxCPUSeconds: HTMLInputElement
+	let maxOpenFiles: HTMLInputElement
+	let maxFileSizeMB: HTMLInputElement
+	let params: HTMLTextAreaElement
+	let matrix: HTMLTextAreaElement
+	let environment: HTMLTextAreaElement
+	let runPrefix: HTMLInputElement
+	let replaceRunPrefix: HTMLInputElement
+	let branchEnvsBox: HTMLElement
+	let downstreamsBox: HTMLElement
 	let webhookSecret: HTMLInputElement
 	let allowGlobalWebhookSecrets: HTMLInputElement
+	let includeBranches: HTMLInputElement
+	let excludeBranches: HTMLInputElement
+	let includeTags: HTMLInputElement
+	let excludeTags: HTMLInputElement
+	let includePaths: HTMLInputElement
+	let excludePaths: HTMLInputElement
+	let releaseTags: HTMLInputElement
+	let pushCommitBuilds: HTMLInputElement
+	let bisectFailures: HTMLInputElement
+	let pollInterval: HTMLInputElement
+	let pollBranches: HTMLInputElement
+	let pollCommand: HTMLInputElement
+	let commitStatusForge: HTMLSelectElement
+	let commitStatusURL: HTMLInputElement
+	let commitStatusRepository: HTMLInputElement
+	let commitStatusTokenSecret: HTMLInputElement
 	let buildScript: HTMLTextAreaElement
+	let buildScriptPath: HTMLInputElement
+	let jobsBox: HTMLElement
 	let fieldset: HTMLFieldSetElement
 
+	type BranchEnvView = {
+		root: HTMLElement
+		pattern: HTMLInputElement
+		environment: HTMLTextAreaElement
+		runPrefix: HTMLInputElement
+		replaceRunPrefix: HTMLInputElement
+	}
+	let branchEnvViews: BranchEnvView[] = []
+	const newBranchEnvView = (be: api.BranchEnv): BranchEnvView => {
+		let pattern: HTMLInputElement
+		let environment: HTMLTextAreaElement
+		let runPrefix: HTMLInputElement
+		let replaceRunPrefix: HTMLInputElement
+		const root = dom.div(
+			style({marginBottom: '1ex'}),
+			dom.div(
+				pattern=dom.input(attr.required(''), attr.value(be.Pattern), attr.placeholder('release/*'), attr.title('Pattern for branch names, with * matching any text except slashes, ? matching a single character, and [...] for character classes.')), ' ',
+				runPrefix=dom.input(attr.value((be.RunPrefix || []).join(' ')), attr.placeholder('Command prefix'), attr.title('Commands prefixed to the clone and build commands, appended to the prefix so far.')), ' ',
+				dom.label(
+					replaceRunPrefix=dom.input(attr.type('checkbox'), be.ReplaceRunPrefix ? attr.checked('') : []),
+					' Replace prefix',
+					attr.title('Use this command prefix instead of the prefix so far.'),
+				), ' ',
+				dom.clickbutton('Remove', function click() {
+					branchEnvViews = branchEnvViews.filter(v => v.root !== root)
+					root.remove()
+				}),
+			),
+			environment=dom.textarea((be.Environment || []).map(s => s+'\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows(''+Math.max(2, (be.Environment || []).length+1))),
+		)
+		return {root: root, pattern: pattern, environment: environment, runPrefix: runPrefix, replaceRunPrefix: replaceRunPrefix}
+	}
+
+	type DownstreamView = {
+		root: HTMLElement
+		repoName: HTMLInputElement
+		upstreamBranch: HTMLInputElement
+		branch: HTMLInputElement
+		condition: HTMLSelectElement
+	}
+	let downstreamViews: DownstreamView[] = []
+	const newDownstreamView = (d: api.Downstream): DownstreamView => {
+		let repoName: HTMLInputElement
+		let upstreamBranch: HTMLInputElement
+		let branch: HTMLInputElement
+		let condition: HTMLSelectElement
+		const root = dom.div(
+			style({marginBottom: '1ex'}),
+			repoName=dom.input(attr.required(''), attr.value(d.Repo), attr.placeholder('Repository'), attr.title('Name of the downstream repository to build.')), ' ',
+			upstreamBranch=dom.input(attr.value(d.UpstreamBranch), attr.placeholder('Upstream branch'), attr.title('Pattern for branches of this repository whose builds trigger a build, with * matching any text except slashes. The default branch if empty.')), ' ',
+			branch=dom.input(attr.value(d.Branch), attr.placeholder('Branch'), attr.title('Branch of the downstream repository to build. Its default branch if empty.')), ' ',
+			condition=dom.select(
+				dom.option('On success', attr.value('success'), d.Condition === api.DownstreamCondition.DownstreamSuccess ? attr.selected('') : []),
+				dom.option('On release', attr.value('release'), d.Condition === api.DownstreamCondition.DownstreamRelease ? attr.selected('') : []),
+			), ' ',
+			dom.clickbutton('Remove', function click() {
+				downstreamViews = downstreamViews.filter(v => v.root !== root)
+				root.remove()
+			}),
+		)
+		return {root: root, repoName: repoName, upstreamBranch: upstreamBranch, branch: branch, condition: condition}
+	}
+
+	type JobView = {
+		root: HTMLElement
+		name: HTMLInputElement
+		goauto: HTMLInputElement
+		gocur: HTMLInputElement
+		goprev: HTMLInputElement
+		gonext: HTMLInputElement
+		includeBranches: HTMLInputElement
+		excludeBranches: HTMLInputElement
+		includeTags: HTMLInputElement
+		excludeTags: HTMLInputElement
+		includePaths: HTMLInputElement
+		excludePaths: HTMLInputElement
+		buildScript: HTMLTextAreaElement
+		buildScriptPath: HTMLInputElement
+	}
+	let jobViews: JobView[] = []
+	const newJobView = (j: api.RepoJob): JobView => {
+		let name: HTMLInputElement
+		let goauto: HTMLInputElement
+		let gocur: HTMLInputElement
+		let goprev: HTMLInputElement
+		let gonext: HTMLInputElement
+		let includeBranches: HTMLInputElement
+		let excludeBranches: HTMLInputElement
+		let includeTags: HTMLInputElement
+		let excludeTags: HTMLInputElement
+		let includePaths: HTMLInputElement
+		let excludePaths: HTMLInputElement
+		let buildScript: HTMLTextAreaElement
+		let buildScriptPath: HTMLInputElement
+		const root = dom.div(
+			style({marginBottom: '2ex'}),
+			dom.div(
+				style({marginBottom: '.5ex'}),
+				name=dom.input(attr.required(''), attr.value(j.Name), attr.placeholder('Name, e.g. lint'), attr.title('Name of the job, with letters, digits and any of ._-, available to builds as $DING_JOB.')), ' ',
+				dom.label(
+					goauto=dom.input(attr.type('checkbox'), j.GoAuto ? attr.checked('') : [], function change() {
+						if (goauto.checked) {
+							gocur.checked = false
+							goprev.checked = false
+							gonext.checked = false
+						}
+					}),
+					' Go auto',
+				), ' ',
+				dom.label(gocur=dom.input(attr.type('checkbox'), j.GoCur ? attr.checked('') : [], function change() { goauto.checked = false }), ' Go latest'), ' ',
+				dom.label(goprev=dom.input(attr.type('checkbox'), j.GoPrev ? attr.checked('') : [], function change() { goauto.checked = false }), ' Go previous'), ' ',
+				dom.label(gonext=dom.input(attr.type('checkbox'), j.GoNext ? attr.checked('') : [], function change() { goauto.checked = false }), ' Go next'), ' ',
+				dom.clickbutton('Remove', function click() {
+					jobViews = jobViews.filter(v => v.root !== root)
+					root.remove()
+				}),
+			),
+			dom.div(
+				style({display: 'grid', columnGap: '.5em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr 1fr', marginBottom: '.5ex'}),
+				'Branches',
+				includeBranches=dom.input(attr.value((j.IncludeBranches || []).join(' ')), attr.placeholder('Include')),
+				excludeBranches=dom.input(attr.value((j.ExcludeBranches || []).join(' ')), attr.placeholder('Exclude')),
+				'Tags',
+				includeTags=dom.input(attr.value((j.IncludeTags || []).join(' ')), attr.placeholder('Include')),
+				excludeTags=dom.input(attr.value((j.ExcludeTags || []).join(' ')), attr.placeholder('Exclude')),
+				'Paths',
+				includePaths=dom.input(attr.value((j.IncludePaths || []).join(' ')), attr.placeholder('Include, e.g. cmd/tool/')),
+				excludePaths=dom.input(attr.value((j.ExcludePaths || []).join(' ')), attr.placeholder('Exclude')),
+				dom.div('Script file', style({whiteSpace: 'nowrap'})),
+				buildScriptPath=dom.input(attr.value(j.BuildScriptPath), attr.placeholder('e.g. .ding/lint.sh'), attr.title('Path of a file in the checkout with the build script of the job, read at the built commit. The build script below is used if the file does not exist.'), style({gridColumn: 'span 2'})),
+			),
+			buildScript=dom.textarea(j.BuildScript, attr.required(''), attr.rows('8'), style({width: '100%'})),
+		)
+		return {root: root, name: name, goauto: goauto, gocur: gocur, goprev: goprev, gonext: gonext, includeBranches: includeBranches, excludeBranches: excludeBranches, includeTags: includeTags, excludeTags: excludeTags, includePaths: includePaths, excludePaths: excludePaths, buildScript: buildScript, buildScriptPath: buildScriptPath}
+	}
+
 	const originTextareaBox = dom.div(
 		originTextarea=dom.textarea(repo.Origin, attr.required(''), attr.rows('5'), style({width: '100%'})),
 		dom.div('Script that clones a repository into checkout/$DING_CHECKOUTPATH.'),
@@ -1297,13 +1769,15 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 				await authed(() => client.RepoClearHomedir(password, repo.Name), e.target)
 			}) : [], ' ',
 			dom.clickbutton('Build', attr.title('Start a build for the default branch of this repository.'), async function click(e: TargetDisableable) {
-				const nb = await authed(() => client.BuildCreate(password, repo.Name, repo.DefaultBranch, '', false), e.target)
+				const nb = await authed(() => client.BuildCreate(password, repo.Name, repo.DefaultBranch, '', false, []), e.target)
 				location.hash = '#repo/'+encodeURIComponent(repo.Name)+'/build/'+nb.ID
 			}), ' ',
 			dom.clickbutton('Build ...', attr.title('Create build for specific branch, possibly low-priority.'), async function click() {
 				let branch: HTMLInputElement
 				let commit: HTMLInputElement
 				let lowprio: HTMLInputElement
+				let job: HTMLSelectElement | undefined
+				const paramInputs = (repo.Params || []).map(p => dom.input(attr.value(p.Value)))
 
 				const close = popup(
 					dom.h1('New build'),
@@ -1311,7 +1785,7 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 						async function submit(e: SubmitEvent) {
 							e.stopPropagation()
 							e.preventDefault()
-							const nb = await authed(() => client.BuildCreate(password, repo.Name, branch.value, commit.value, lowprio.checked), fieldset)
+							const nb = await authed(() => client.BuildCreateJob(password, repo.Name, job ? job.value : '', branch.value, commit.value, lowprio.checked, (repo.Params || []).map((p, i) => ({Name: p.Name, Value: paramInputs[i].value}))), fieldset)
 							if (!builds.find(b => b.ID === nb.ID)) {
 								builds.unshift(nb)
 								renderBuilds()
@@ -1321,10 +1795,21 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 						dom.fieldset(
 							dom.div(
 								style({display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top'}),
+								(repo.Jobs || []).length === 0 ? [] : [
+									'Job',
+									job=dom.select(
+										dom.option('Build script of repository', attr.value('')),
+										(repo.Jobs || []).map(j => dom.option(j.Name)),
+									),
+								],
 								'Branch',
 								branch=dom.input(attr.required(''), attr.value(repo.DefaultBranch)),
 								dom.div('Commit (optional)', style({whiteSpace: 'nowrap'})),
 								commit=dom.input(),
+								(repo.Params || []).map((p, i) => [
+									dom.div(dom.tt(p.Name), attr.title('Build parameter, available as $DING_PARAM_'+p.Name+'.')),
+									paramInputs[i],
+								]),
 								dom.div(),
 								dom.label(
 									lowprio=dom.input(attr.type('checkbox')),
@@ -1338,6 +1823,9 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 					),
 				)
 				branch.focus()
+			}), ' ',
+			dom.clickbutton('Cancel queued builds', attr.title('Cancel all builds for this repository that are waiting to start. Running builds are not affected.'), async function click(e: TargetDisableable) {
+				await authed(() => client.QueueCancelRepo(password, repo.Name), e.target)
 			}),
 		),
 		dom.div(
@@ -1365,11 +1853,87 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 								WebhookSecret: webhookSecret.value,
 								AllowGlobalWebhookSecrets: allowGlobalWebhookSecrets.checked,
 								BuildScript: buildScript.value,
+								BuildScriptPath: buildScriptPath.value,
 								HomeDiskUsage: 0,
 								GoAuto: goauto.checked,
 								GoCur: gocur.checked,
 								GoPrev: goprev.checked,
 								GoNext: gonext.checked,
+								GoParallel: goparallel.checked,
+								MaxBuilds: parseInt(maxBuilds.value) || 0,
+								SupersedeBuilds: supersedeBuilds.checked,
+								SupersedeRunning: supersedeRunning.checked,
+								MaxDuration: parseInt(maxDuration.value) || 0,
+								InactivityTimeout: parseInt(inactivityTimeout.value) || 0,
+								MaxMemoryMB: parseInt(maxMemoryMB.value) || 0,
+								MaxProcesses: parseInt(maxProcesses.value) || 0,
+								MaxCPUSeconds: parseInt(maxCPUSeconds.value) || 0,
+								MaxOpenFiles: parseInt(maxOpenFiles.value) || 0,
+								MaxFileSizeMB: parseInt(maxFileSizeMB.value) || 0,
+								Params: params.value.split('\n').map(s => s.trim()).filter(s => !!s).map(s => {
+									const t = s.split('=')
+									return {Name: t[0], Value: t.slice(1).join('=')}
+								}),
+								Matrix: matrix.value.split('\n').map(s => s.trim()).filter(s => !!s).map(s => {
+									const t = s.split('=')
+									return {Name: t[0].trim(), Values: t.slice(1).join('=').split(' ').map(s => s.trim()).filter(s => !!s)}
+								}),
+								Environment: environment.value.split('\n').map(s => s.trim()).filter(s => !!s),
+								RunPrefix: runPrefix.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								ReplaceRunPrefix: replaceRunPrefix.checked,
+								BranchEnvs: branchEnvViews.map(v => {
+									return {
+										Pattern: v.pattern.value,
+										Environment: v.environment.value.split('\n').map(s => s.trim()).filter(s => !!s),
+										RunPrefix: v.runPrefix.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										ReplaceRunPrefix: v.replaceRunPrefix.checked,
+									}
+								}),
+								IncludeBranches: includeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								ExcludeBranches: excludeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								IncludeTags: includeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								ExcludeTags: excludeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								IncludePaths: includePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								ExcludePaths: excludePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								ReleaseTags: releaseTags.checked,
+								PushCommitBuilds: parseInt(pushCommitBuilds.value) || 0,
+								Bisect: bisectFailures.checked,
+								Downstreams: downstreamViews.map(v => {
+									return {
+										Repo: v.repoName.value,
+										UpstreamBranch: v.upstreamBranch.value,
+										Branch: v.branch.value,
+										Condition: v.condition.value as api.DownstreamCondition,
+									}
+								}),
+								Jobs: jobViews.map(v => {
+									return {
+										Name: v.name.value,
+										BuildScript: v.buildScript.value,
+										BuildScriptPath: v.buildScriptPath.value,
+										IncludeBranches: v.includeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										ExcludeBranches: v.excludeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										IncludeTags: v.includeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										ExcludeTags: v.excludeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										IncludePaths: v.includePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										ExcludePaths: v.excludePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+										GoAuto: v.goauto.checked,
+										GoCur: v.gocur.checked,
+										GoPrev: v.goprev.checked,
+										GoNext: v.gonext.checked,
+									}
+								}),
+								PollInterval: parseInt(pollInterval.value) || 0,
+								PollBranches: pollBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+								PollCommand: pollCommand.value,
+								PollLast: null,
+								PollError: '',
+								CommitStatus: {
+									Forge: commitStatusForge.value as api.Forge,
+									URL: commitStatusURL.value,
+									Repository: commitStatusRepository.value,
+									TokenSecret: commitStatusTokenSecret.value,
+								},
 							}
 							repo = await authed(() => client.RepoSave(password, nr), fieldset)
 							dom._kids(pageElem, render())
@@ -1394,6 +1958,34 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 								checkoutPath=dom.input(attr.value(repo.CheckoutPath), attr.required(''), attr.title('Name of the directory to checkout the repository. Go builds may use this name for the binary it creates.')),
 								dom.div('Notify email addresses', style({whiteSpace: 'nowrap'}), mailEnabled ? [] : [' *', attr.title('No SMTP server is configured for outgoing emails.')]),
 								notifyEmailAddrs=dom.input(attr.value((repo.NotifyEmailAddrs || []).join(', ')), attr.title('Comma-separated list of email address that will receive notifications when a build breaks or is fixed. If empty, the email address configured in the configuration file receives a notification, if any.'), attr.placeholder((settings.NotifyEmailAddrs || []).join(', ') || 'user@example.org, other@example.org')),
+								dom.div('Max concurrent builds', style({whiteSpace: 'nowrap'}), attr.title('Builds for different branches of this repository can run concurrently, up to this number. Builds for the same branch never run concurrently. Zero means 1.')),
+								maxBuilds=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxBuilds)),
+								dom.div(),
+								dom.label(
+									supersedeBuilds=dom.input(attr.type('checkbox'), repo.SupersedeBuilds ? attr.checked('') : []),
+									' Supersede waiting builds for a branch by a new build',
+									attr.title('When a new build for a branch is created, builds for that branch that are waiting to start are cancelled and marked as superseded. Low-priority builds do not supersede other builds.'),
+								),
+								dom.div(),
+								dom.label(
+									supersedeRunning=dom.input(attr.type('checkbox'), repo.SupersedeRunning ? attr.checked('') : []),
+									' Also cancel a running build for the branch',
+									attr.title('Along with superseding waiting builds, also cancel a running build for the branch.'),
+								),
+								dom.div('Max duration (seconds)', style({whiteSpace: 'nowrap'}), attr.title('Maximum duration in seconds for the clone and build steps together. If the build takes longer, it is cancelled with status timeout. Zero means no limit.')),
+								maxDuration=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxDuration)),
+								dom.div('Inactivity timeout (seconds)', style({whiteSpace: 'nowrap'}), attr.title('If the clone or build commands do not write output for this many seconds, the build is assumed to be stuck and is cancelled with status timeout. Zero means no limit.')),
+								inactivityTimeout=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.InactivityTimeout)),
+								dom.div('Max memory (MB)', style({whiteSpace: 'nowrap'}), attr.title('Maximum memory for the build script. If ding is configured with a cgroup directory, the limit is for all processes of the build together, otherwise it limits the address space of each process. Zero means no limit.')),
+								maxMemoryMB=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxMemoryMB)),
+								dom.div('Max processes', style({whiteSpace: 'nowrap'}), attr.title('Maximum number of processes for the build script. If ding is configured with a cgroup directory, the limit is for the processes of the build, otherwise for all processes of the UID of the build. Zero means no limit.')),
+								maxProcesses=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxProcesses)),
+								dom.div('Max CPU time (seconds)', style({whiteSpace: 'nowrap'}), attr.title('Maximum CPU time for each process of the build script. Zero means no limit.')),
+								maxCPUSeconds=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxCPUSeconds)),
+								dom.div('Max open files', style({whiteSpace: 'nowrap'}), attr.title('Maximum number of open files for each process of the build script. Zero means no limit.')),
+								maxOpenFiles=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxOpenFiles)),
+								dom.div('Max file size (MB)', style({whiteSpace: 'nowrap'}), attr.title('Maximum size of files written by the build script. Zero means no limit.')),
+								maxFileSizeMB=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.MaxFileSizeMB)),
 								dom.div(),
 								dom.label(
 									reuseUID=dom.input(attr.type('checkbox'), repo.UID !== null ? attr.checked('') : []),
@@ -1412,7 +2004,7 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 									' Prevent network access from build script. Only active if bubblewrap is active.',
 									attr.title('Hide network interfaces from the build script. Only a loopback device is available.'),
 								),
-								dom.div('Build for Go toolchains', style({whiteSpace: 'nowrap'}), attr.title('The build script will be run for each of the selected Go toolchains. The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.' + !haveGoToolchainDir ? ' Warning: No Go toolchain directory is configured in the configuration file.' : '')),
+								dom.div('Build for Go toolchains', style({whiteSpace: 'nowrap'}), attr.title('The build script will be run for each of the selected Go toolchains, each in its own build step, e.g. "build:goprev". The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.' + !haveGoToolchainDir ? ' Warning: No Go toolchain directory is configured in the configuration file.' : '')),
 								dom.div(
 									dom.label(
 										goauto=dom.input(attr.type('checkbox'), repo.GoAuto ? attr.checked('') : [], function change() {
@@ -1440,12 +2032,43 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 										' Go next',
 										attr.title('Release candidate of Go toolchain, if available.'),
 									), ' ',
+									dom.label(
+										goparallel=dom.input(attr.type('checkbox'), repo.GoParallel ? attr.checked('') : []),
+										' Concurrently',
+										attr.title('Run the build steps for the selected Go toolchains and build matrix concurrently instead of sequentially. All steps run to completion, instead of stopping at the first failure. Steps other than the first run in a copy of the checkout, at e.g. $DING_BUILDDIR/checkout-goprev-linux/$DING_CHECKOUTPATH.'),
+									), ' ',
 								),
 								dom.div(),
 								dom.label(
 									buildOnUpdatedToolchain=dom.input(attr.type('checkbox'), repo.BuildOnUpdatedToolchain ? attr.checked('') : []),
 									' Schedule a low-priority build when new toolchains are automatically installed.',
 								),
+								dom.div('Build matrix', style({whiteSpace: 'nowrap'}), attr.title('Axes of the build matrix, one per line, of the form NAME=value1 value2 ... The build script is run for each combination of values, and of the selected Go toolchains, each in its own build step, e.g. "build:goprev:linux:amd64". The value of each axis is available in the environment variable with the name of the axis.')),
+								matrix=dom.textarea((repo.Matrix || []).map(a => a.Name+'='+(a.Values || []).join(' ')+'\n').join(''), attr.placeholder('GOOS=linux openbsd\nCGO_ENABLED=0 1\n...'), attr.rows(''+Math.max(2, (repo.Matrix || []).length+1))),
+								dom.div('Build parameters', style({whiteSpace: 'nowrap'}), attr.title('Parameters that can be set when creating a build, of the form name=default, one per line. Names consist of letters, digits and underscore. Values are available during clone and build as $DING_PARAM_<name>.')),
+								params=dom.textarea((repo.Params || []).map(p => p.Name+'='+p.Value+'\n').join(''), attr.placeholder('name=default\nname=default\n...'), attr.rows(''+Math.max(2, (repo.Params || []).length+1))),
+								dom.div('Environment variables', style({whiteSpace: 'nowrap'}), attr.title('Additional environment variables for clone and build, of the form key=value, one per line. They replace global variables with the same name.')),
+								environment=dom.textarea((repo.Environment || []).map(s => s+'\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows(''+Math.max(2, (repo.Environment || []).length+1))),
+								dom.div('Command prefix', style({whiteSpace: 'nowrap'}), attr.title('Commands prefixed to the clone and build commands, appended to the global prefix, e.g. "nice -n 19".')),
+								dom.div(
+									runPrefix=dom.input(attr.value((repo.RunPrefix || []).join(' '))), ' ',
+									dom.label(
+										replaceRunPrefix=dom.input(attr.type('checkbox'), repo.ReplaceRunPrefix ? attr.checked('') : []),
+										' Replace global prefix',
+										attr.title('Use this command prefix instead of the global prefix. With an empty prefix, commands are run without prefix.'),
+									),
+								),
+								dom.div('Branch environments', style({whiteSpace: 'nowrap'}), attr.title('Environment variables and command prefix for branches matching a pattern. Applied after those of the repository, in order.')),
+								dom.div(
+									branchEnvsBox=dom.div(
+										(branchEnvViews = (repo.BranchEnvs || []).map(be => newBranchEnvView(be))).map(v => v.root),
+									),
+									dom.clickbutton('Add branch environment', function click() {
+										const v = newBranchEnvView({Pattern: '', Environment: [], RunPrefix: [], ReplaceRunPrefix: false})
+										branchEnvViews.push(v)
+										branchEnvsBox.appendChild(v.root)
+									}),
+								),
 								dom.div('Webhook secrets', style({whiteSpace: 'nowrap'})),
 								dom.div(
 									webhookSecret=dom.input(attr.value(repo.WebhookSecret)),
@@ -1458,6 +2081,74 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 										' Allow global webhook secrets',
 									),
 								),
+								dom.div('Push filters', style({whiteSpace: 'nowrap'}), attr.title('Space-separated patterns for names of branches and tags, with * matching any text except slashes, for selecting the pushes that start a build through a webhook or "ding kick". If include patterns are set, only matching names are built. Names matching an exclude pattern are not built. For pull requests, the source branch is matched. Builds started through this web interface are not filtered.')),
+								dom.div(
+									style({display: 'grid', columnGap: '.5em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr 1fr'}),
+									'Branches',
+									includeBranches=dom.input(attr.value((repo.IncludeBranches || []).join(' ')), attr.placeholder('Include, e.g. main release/*')),
+									excludeBranches=dom.input(attr.value((repo.ExcludeBranches || []).join(' ')), attr.placeholder('Exclude, e.g. wip/* dependabot/*')),
+									'Tags',
+									includeTags=dom.input(attr.value((repo.IncludeTags || []).join(' ')), attr.placeholder('Include, e.g. v*')),
+									excludeTags=dom.input(attr.value((repo.ExcludeTags || []).join(' ')), attr.placeholder('Exclude')),
+								),
+								dom.div('Paths', style({whiteSpace: 'nowrap'}), attr.title('Space-separated patterns for files changed by a push. A pattern without slash matches any file or directory name, e.g. *.md. A pattern with a slash matches a path from the root of the repository, or a directory leading to it, e.g. docs/ or cmd/*. A file is relevant if it matches an include pattern (or no include patterns are set) and does not match an exclude pattern. If none of the changed files are relevant, the build is marked as skipped. Low-priority builds, builds for pull requests and tags, and builds of the same commit as the previous build are never skipped.')),
+								dom.div(
+									style({display: 'grid', columnGap: '.5em', gridTemplateColumns: '1fr 1fr'}),
+									includePaths=dom.input(attr.value((repo.IncludePaths || []).join(' ')), attr.placeholder('Include, e.g. *.go go.mod')),
+									excludePaths=dom.input(attr.value((repo.ExcludePaths || []).join(' ')), attr.placeholder('Exclude, e.g. docs/ *.md')),
+								),
+								dom.div(),
+								dom.label(
+									releaseTags=dom.input(attr.type('checkbox'), repo.ReleaseTags ? attr.checked('') : []),
+									' Release successful builds of tags',
+									attr.title('Builds of tags, e.g. from a webhook for a pushed tag, are marked as released when successful, as with the Release button of a build.'),
+								),
+								dom.div('Commits of push', style({whiteSpace: 'nowrap'}), attr.title('Number of earlier commits of a push through a webhook to also build, besides the last commit. The earlier commits get low-priority builds, and the build page of each shows the status of all commits of the push, to find the commit that broke the build. Zero only builds the last commit. At most 20.')),
+								dom.div(
+									pushCommitBuilds=dom.input(attr.type('number'), attr.min('0'), attr.max('20'), attr.value(''+repo.PushCommitBuilds), attr.title('Number of earlier commits of a push through a webhook to also build, besides the last commit. The earlier commits get low-priority builds, and the build page of each shows the status of all commits of the push, to find the commit that broke the build. Zero only builds the last commit. At most 20.')),
+								),
+								dom.div(),
+								dom.label(
+									bisectFailures=dom.input(attr.type('checkbox'), repo.Bisect ? attr.checked('') : []),
+									' Bisect failures',
+									attr.title('When a build of a branch fails after a successful build of the branch, build the commits in between with low-priority builds, one at a time, in a binary search for the first failing commit. The failure notification is sent once the first failing commit is found. Only for git repositories.'),
+								),
+								dom.div('Downstream repositories', style({whiteSpace: 'nowrap'}), attr.title('Repositories to build after builds of this repository, e.g. services that depend on a library. A build is triggered after a successful build or after a release of a build of matching upstream branches, the default branch if empty. The triggered build gets the upstream repository, build ID and version in $DING_UPSTREAM_REPONAME, $DING_UPSTREAM_BUILDID and $DING_UPSTREAM_VERSION. Repositories already in the chain of triggers are not built again.')),
+								dom.div(
+									downstreamsBox=dom.div(
+										(downstreamViews = (repo.Downstreams || []).map(d => newDownstreamView(d))).map(v => v.root),
+									),
+									dom.clickbutton('Add downstream repository', function click() {
+										const v = newDownstreamView({Repo: '', UpstreamBranch: '', Branch: '', Condition: api.DownstreamCondition.DownstreamSuccess})
+										downstreamViews.push(v)
+										downstreamsBox.appendChild(v.root)
+									}),
+								),
+								dom.div('Poll for commits', style({whiteSpace: 'nowrap'}), attr.title('Check the origin for new commits, for repositories without webhooks. A build is created for each polled branch whose head differs from the commit of its latest build. Git repositories are checked with git ls-remote, mercurial repositories with hg identify.')),
+								dom.div(
+									style({display: 'grid', columnGap: '.5em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr'}),
+									'Interval',
+									pollInterval=dom.input(attr.type('number'), attr.min('0'), attr.value(''+repo.PollInterval), attr.title('Seconds between polls, at least 60. Zero disables polling.')),
+									'Branches',
+									pollBranches=dom.input(attr.value((repo.PollBranches || []).join(' ')), attr.placeholder('Space-separated, default branch if empty')),
+									'Command',
+									pollCommand=dom.input(attr.value(repo.PollCommand), attr.placeholder('For VCS command'), attr.title('For VCS command, required for polling: shell command that prints the head commit of branch $DING_BRANCH, as last line of the form commit:<hash>, like the clone command.')),
+								),
+								dom.div('Commit status', style({whiteSpace: 'nowrap'}), attr.title('Report the status of builds for their commit to a forge: pending when a build starts, and success, failure or cancelled when it finishes. The status links to the build in ding. Failed requests are retried.')),
+								dom.div(
+									commitStatusForge=dom.select(
+										dom.option('None', attr.value(''), repo.CommitStatus.Forge === '' ? attr.selected('') : []),
+										dom.option('github', repo.CommitStatus.Forge === 'github' ? attr.selected('') : []),
+										dom.option('gitea', repo.CommitStatus.Forge === 'gitea' ? attr.selected('') : []),
+										dom.option('bitbucket', repo.CommitStatus.Forge === 'bitbucket' ? attr.selected('') : []),
+									), ' ',
+									commitStatusRepository=dom.input(attr.value(repo.CommitStatus.Repository), attr.placeholder('owner/name'), attr.title('Repository at the forge, of the form owner/name, or workspace/name for bitbucket.')), ' ',
+									commitStatusTokenSecret=dom.input(attr.value(repo.CommitStatus.TokenSecret), attr.placeholder('Token secret'), attr.title('Name of a secret of this repository holding the access token, sent as bearer token. The secret is also available to builds.')),
+									dom.br(),
+									commitStatusURL=dom.input(attr.value(repo.CommitStatus.URL), attr.placeholder('https://gitea.example.com/api/v1'), attr.title('Base URL of the API. Required for gitea. Defaults to https://api.github.com for github, and https://api.bitbucket.org/2.0 for bitbucket.'), style({width: '100%'})),
+								),
+								dom.div('Build script file', style({whiteSpace: 'nowrap'}), attr.title('Path of a file in the checkout with the build script, relative to the checkout path. It is read after the clone, so the build script is versioned with the code, and builds of older commits use their own script. The build script below is used if the file does not exist.')),
+								buildScriptPath=dom.input(attr.value(repo.BuildScriptPath), attr.placeholder('e.g. .ding/build.sh')),
 							),
 							dom.div(
 								dom.label(
@@ -1466,6 +2157,18 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 								),
 							),
 							dom.br(),
+							dom.div(
+								dom.div('Jobs', style({marginBottom: '.25ex'}), attr.title('Additional named jobs, each with its own build script, e.g. for linting, releases, or subprojects of a monorepo. A push through a webhook, "ding kick" or a poll starts a build of the build script above, and of each job whose patterns match. Branch, tag and path patterns are applied in addition to those of the repository. Go toolchains replace those of the repository. Builds of a job are compared with earlier builds of the same job, for notifications, skipping and superseding. The job name is available as $DING_JOB.')),
+								jobsBox=dom.div(
+									(jobViews = (repo.Jobs || []).map(j => newJobView(j))).map(v => v.root),
+								),
+								dom.clickbutton('Add job', function click() {
+									const v = newJobView({Name: '', BuildScript: '', BuildScriptPath: '', IncludeBranches: [], ExcludeBranches: [], IncludeTags: [], ExcludeTags: [], IncludePaths: [], ExcludePaths: [], GoAuto: false, GoCur: false, GoPrev: false, GoNext: false})
+									jobViews.push(v)
+									jobsBox.appendChild(v.root)
+								}),
+							),
+							dom.br(),
 							dom.div(
 								dom.submitbutton('Save')
 							),
@@ -1473,6 +2176,10 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 					),
 				),
 				dom.br(),
+				schedulesElem,
+				dom.br(),
+				secretsElem,
+				dom.br(),
 				dom.h1('Webhooks'),
 				dom.p('Configure the following webhook URLs to trigger builds:'),
 				dom.ul(
@@ -1488,6 +2195,7 @@ const pageRepo = async (repoName: string): Promise<Page> => {
 				(settings.RunPrefix || []).length > 0 ? dom.p('Build commands are prefixed with: ', dom.tt((settings.RunPrefix || []).join(' '))) : dom.p('Build commands are not run within other commands.'),
 				dom.div('Additional environments available during builds:'),
 				(settings.Environment || []).length === 0 ? dom.p('None') : dom.ul((settings.Environment || []).map(s => dom.li(dom.tt(s)))),
+				dom.p('The environment variables and command prefixes of the repository and matching branches are applied after these. Each build shows the environment and command prefix it was created with.'),
 			),
 		),
 	]
@@ -1506,30 +2214,145 @@ const basename = (s: string) => {
 
 const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 	const page = new Page()
-	let [repo, b] = await authed(() =>
+	let [repo, b, queue, pushBuilds] = await authed(() =>
 		Promise.all([
 			client.Repo(password, repoName),
 			client.Build(password, repoName, buildID),
+			client.Queue(password),
+			client.PushBuilds(password, repoName, buildID),
 		])
 	)
 	let steps = b.Steps || []
 	let results = b.Results || []
 
+	// Position in the queue while the build is waiting to start.
+	const queueElem = dom.span()
+	const renderQueue = () => {
+		const qj = (queue || []).find(qj => qj.BuildID === b.ID)
+		if (!qj || qj.Active) {
+			dom._kids(queueElem)
+			return
+		}
+		dom._kids(queueElem,
+			' ', ordinal(qj.Position), ' in line ',
+			qj.Position > 1 ? dom.clickbutton('Move to front', attr.title('Start this build before other waiting builds.'), async function click(e: TargetDisableable) {
+				await authed(() => client.QueueMoveFront(password, repo.Name, b.ID), e.target)
+			}) : [],
+			qj.LowPrio ? [' ', dom.clickbutton('Promote', attr.title('Turn this low-priority build into a regular build.'), async function click(e: TargetDisableable) {
+				await authed(() => client.QueuePromoteLowPrio(password, repo.Name, b.ID), e.target)
+			})] : [],
+		)
+	}
+	renderQueue()
+
+	// Builds for the commits of the push this build is part of, oldest first. The first
+	// failed build likely has the commit that broke the build.
+	const pushElem = dom.div()
+	const renderPush = () => {
+		const l = pushBuilds || []
+		if (l.length === 0) {
+			dom._kids(pushElem)
+			return
+		}
+		const firstFailed = l.find(pb => pb.Finish && pb.Status === api.BuildStatus.StatusBuild)
+		dom._kids(pushElem,
+			dom.h2('Push'),
+			dom.table(
+				dom.tr(
+					['Position', 'Build', 'Commit', 'Status'].map(s => dom.th(s)),
+					dom.th(style({textAlign: 'left'}), 'Error'),
+				),
+				l.map(pb =>
+					dom.tr(
+						dom.td(''+pb.PushPosition),
+						dom.td(pb.ID === b.ID ? ''+pb.ID : link('#repo/'+encodeURIComponent(repo.Name)+'/build/'+pb.ID, ''+pb.ID)),
+						dom.td(pb.CommitHash),
+						dom.td(buildStatus(pb), pb === firstFailed ? [' ', dom.span('first failure', style({color: colors.red, fontWeight: 'bold'}), attr.title('Earliest commit of the push with a failed build, likely the commit that broke the build.'))] : []),
+						dom.td(style({textAlign: 'left'}), buildErrmsg(pb)),
+					)
+				),
+			),
+		)
+	}
+	renderPush()
+
 	// Builds that were started with this view open. We'll show links to these builds in the top bar.
 	let moreBuilds: number[] = []
 	let moreBuildsElem = dom.span()
 	page.updateRoot = moreBuildsElem
 
-	const stepColor = () => {
+	const stepColor = (step: api.Step) => {
 		if (!b.Finish) {
 			return colors.gray
 		}
-		if (b.Status == api.BuildStatus.StatusSuccess) {
+		if (step.ErrorMessage) {
+			return colors.red
+		}
+		// If another step has an error message, this step succeeded.
+		if (b.Status == api.BuildStatus.StatusSuccess || steps.find(st => st.ErrorMessage)) {
 			return colors.green
 		}
 		return colors.red
 	}
 
+	// Status of each combination of the build matrix, with the values of the last axis
+	// as columns.
+	const matrixGrid = () => {
+		const cells = steps.filter(st => (st.Matrix || []).length > 0)
+		if (cells.length === 0) {
+			return []
+		}
+		const axes = (cells[0].Matrix || []).map(p => p.Name)
+		const rowKey = (st: api.Step) => (st.Matrix || []).slice(0, -1).map(p => p.Value).join(' ')
+		const colKey = (st: api.Step) => (st.Matrix || [])[axes.length-1].Value
+		const rows: string[] = []
+		const columns: string[] = []
+		for (const st of cells) {
+			if (!rows.includes(rowKey(st))) {
+				rows.push(rowKey(st))
+			}
+			if (!columns.includes(colKey(st))) {
+				columns.push(colKey(st))
+			}
+		}
+		return dom.div(
+			dom.h2('Matrix'),
+			dom.table(
+				dom.tr(
+					dom.th(axes.slice(0, -1).join(' ')),
+					columns.map(col => dom.th(axes[axes.length-1]+'='+col)),
+				),
+				rows.map(row =>
+					dom.tr(
+						dom.td(row),
+						columns.map(col => {
+							const st = cells.find(st => rowKey(st) === row && colKey(st) === col)
+							if (!st) {
+								return dom.td('-', attr.title('Not built.'))
+							}
+							return dom.td(dom.span(st.ErrorMessage ? 'failed' : 'ok', attr.title(st.Name+(st.ErrorMessage ? ': '+st.ErrorMessage : '')), style({fontSize: '.9em', color: 'white', backgroundColor: stepColor(st), padding: '0 .2em', borderRadius: '.15em'})))
+						}),
+					)
+				),
+			),
+		)
+	}
+
+	// State of the bisect for this failed build, or the bisect this build is part of.
+	const bisectInfo = () => {
+		const bs = b.Bisect
+		if (b.BisectBuildID) {
+			return dom.p('Build for the bisect of ', link('#repo/'+encodeURIComponent(repo.Name)+'/build/'+b.BisectBuildID, 'build '+b.BisectBuildID), '.')
+		} else if ((bs.Commits || []).length === 0) {
+			return []
+		} else if (bs.FirstBad) {
+			return dom.p('First failing commit, found by bisect: ', dom.tt(bs.FirstBad))
+		} else if (bs.Error) {
+			return dom.p('Bisect for the first failing commit failed: ', bs.Error)
+		}
+		return dom.p('Bisecting ', ''+(bs.Commits || []).length, ' commits since last successful commit ', dom.tt(bs.Good), ', ', ''+(bs.BadIndex-bs.GoodIndex-1), ' commits left, testing in ', link('#repo/'+encodeURIComponent(repo.Name)+'/build/'+bs.BuildID, 'build '+bs.BuildID), '.')
+	}
+
 	dom._kids(crumbElem,
 		dom.span(link('#', 'Home'), ' / ', link('#repo/'+encodeURIComponent(repo.Name), 'Repo '+repo.Name), ' / ', 'Build '+b.ID),
 	)
@@ -1550,12 +2373,37 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 		root: HTMLElement
 		output: HTMLElement
 	}
+	// Summary of Go test results of a step, with the failed tests and their output.
+	const testsView = (tests: api.TestPackage[]) => {
+		const all = tests.map(p => p.Tests || []).flat()
+		const count = (status: api.TestStatus) => all.filter(t => t.Status === status).length
+		const failed = (p: api.TestPackage) => (p.Tests || []).filter(t => t.Status === api.TestStatus.TestFail && !(p.Tests || []).find(t2 => t2.Status === api.TestStatus.TestFail && t2.Name.startsWith(t.Name+'/')))
+		return dom.div(
+			style({marginBottom: '1ex'}),
+			dom.div('Tests: ', ''+count(api.TestStatus.TestPass), ' passed, ', ''+count(api.TestStatus.TestFail), ' failed, ', ''+count(api.TestStatus.TestSkip), ' skipped, in ', ''+tests.length, ' packages'),
+			tests.filter(p => p.Status === api.TestStatus.TestFail).map(p => {
+				const l = failed(p)
+				if (l.length === 0) {
+					return [dom.div(style({color: colors.red}), 'Package ', dom.tt(p.Package), ' failed'), p.Output ? dom.pre(p.Output) : []]
+				}
+				return l.map(t => [dom.div(style({color: colors.red}), 'Test ', dom.tt(t.Name), ' in ', dom.tt(p.Package), ' failed (', t.Elapsed.toFixed(3), 's)'), t.Output ? dom.pre(t.Output) : []])
+			}),
+		)
+	}
 	const newStepView = (step: api.Step) => {
-		const stepOutput = dom.pre(step.Output, style({borderLeft: '4px solid '+stepColor()}))
+		const stepOutput = dom.pre(step.Output, style({borderLeft: '4px solid '+stepColor(step)}))
 		const v: StepView = {
 			output: stepOutput,
 			root: dom.div(
 				dom.h2(step.Name, step.Nsec ? ' (' + (step.Nsec/(1000*1000*1000)).toFixed(3)+'s)' : ''),
+				step.Version || step.Coverage || step.CoverageReportFile || (step.Results || []).length > 0 ? dom.div(
+					style({marginBottom: '1ex'}),
+					step.Version ? ['Version ', step.Version, ' '] : [],
+					step.Coverage || step.CoverageReportFile ? ['Coverage ', formatCoverage(repo, {...b, Coverage: step.Coverage, CoverageReportFile: step.CoverageReportFile}), ' '] : [],
+					(step.Results || []).length > 0 ? ['Results ', ''+(step.Results || []).length] : [],
+				) : [],
+				step.ErrorMessage ? dom.div(style({marginBottom: '1ex', color: colors.red}), step.ErrorMessage) : [],
+				(step.Tests || []).length > 0 ? testsView(step.Tests || []) : [],
 				stepOutput,
 				dom.br(),
 			)
@@ -1581,8 +2429,8 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 				dom.clickbutton('Cancel build', attr.title('Abort this build, causing it to fail.'), b.Finish ? attr.disabled('') : [], async function click(e: TargetDisableable) {
 					await authed(() => client.BuildCancel(password, repo.Name, b.ID), e.target)
 				}), ' ',
-				dom.clickbutton('Rebuild', attr.title('Start a new build for this branch and commit.'), async function click(e: TargetDisableable) {
-					const nb = await authed(() => client.BuildCreate(password, repo.Name, b.Branch, b.CommitHash, false), e.target)
+				dom.clickbutton('Rebuild', b.PullRequest ? [attr.disabled(''), attr.title('Builds for pull requests are only started through webhooks.')] : attr.title('Start a new build for this branch and commit.'), async function click(e: TargetDisableable) {
+					const nb = await authed(() => client.BuildCreateJob(password, repo.Name, b.Job, b.Branch, b.CommitHash, false, b.Params || []), e.target)
 					location.hash = '#repo/'+encodeURIComponent(repo.Name)+'/build/'+nb.ID
 				}), ' ',
 				dom.clickbutton('Release', b.Released || b.Status !== api.BuildStatus.StatusSuccess ? attr.disabled('') : [], attr.title("Mark this build as released. Results of releases are not automatically removed. Build directories of releases can otherwise still be automatically removed, but this is done later than for builds that aren't released."), async function click(e: TargetDisableable) {
@@ -1594,21 +2442,31 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 				dom.h1('Summary'),
 				dom.table(
 					dom.tr(
-						['Status', 'Branch', 'Duration', 'Version', 'Commit', 'Coverage', 'Disk usage', 'Age'].map(s => dom.th(s)),
+						['Status', 'Branch', 'Duration', 'Version', 'Commit', 'Coverage', 'Tests', 'Disk usage', 'Peak memory', 'CPU time', 'Age'].map(s => dom.th(s)),
 						dom.th(style({textAlign: 'left'}), 'Error'),
 					),
 					dom.tr(
-						dom.td(buildStatus(b)),
-						dom.td(b.Branch),
+						dom.td(buildStatus(b), queueElem),
+						dom.td(buildBranch(b)),
 						dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''),
 						dom.td(b.Version),
 						dom.td(b.CommitHash),
 						dom.td(formatCoverage(repo, b)),
+						dom.td(formatTests(b)),
 						dom.td(formatBuildSize(b)),
+						dom.td(b.PeakMemory ? formatSize(b.PeakMemory) : ''),
+						dom.td(b.CPUNsec ? (b.CPUNsec/(1000*1000*1000)).toFixed(1)+'s' : ''),
 						dom.td(atexit.ageMins(b.Created, undefined)),
-						dom.td(style({textAlign: 'left'}), b.ErrorMessage ? dom.div(b.ErrorMessage, style({maxWidth: '40em'})) : []),
+						dom.td(style({textAlign: 'left'}), b.SupersededBy ? dom.div('Superseded by ', link('#repo/'+encodeURIComponent(repo.Name)+'/build/'+b.SupersededBy, 'build '+b.SupersededBy)) : (b.ErrorMessage ? dom.div(b.ErrorMessage, style({maxWidth: '40em'})) : [])),
 					),
 				),
+				b.UpstreamBuildID ? dom.p('Triggered by ', link('#repo/'+encodeURIComponent(b.UpstreamRepoName)+'/build/'+b.UpstreamBuildID, 'build '+b.UpstreamBuildID), ' of upstream repository ', b.UpstreamRepoName, b.UpstreamVersion ? ', version '+b.UpstreamVersion : '', '.') : [],
+				(b.Params || []).length === 0 ? [] : dom.p('Parameters: ', (b.Params || []).map((p, i) => [i > 0 ? ', ' : '', dom.tt(p.Name+'='+p.Value)])),
+				(b.Environment || []).length === 0 ? [] : dom.p('Environment: ', (b.Environment || []).map((s, i) => [i > 0 ? ', ' : '', dom.tt(s)])),
+				(b.RunPrefix || []).length === 0 ? [] : dom.p('Command prefix: ', dom.tt((b.RunPrefix || []).join(' '))),
+				matrixGrid(),
+				pushElem,
+				bisectInfo(),
 			),
 			dom.br(),
 			dom.div(
@@ -1653,6 +2511,7 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 					dom.br(),
 					dom.div(
 						dom.h1('Build script'),
+						b.BuildScriptFile ? dom.p('Read from ', dom.tt(b.BuildScriptFile), ' in the checkout.') : dom.p('From the settings of the repository.'),
 						dom.pre(b.BuildScript),
 					),
 				),
@@ -1665,9 +2524,17 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 		if (e.Build.RepoName !== repo.Name) {
 			return
 		}
+		const pbi = (pushBuilds || []).findIndex(pb => pb.ID === e.Build.ID)
+		if (pbi >= 0 && pushBuilds) {
+			pushBuilds[pbi] = e.Build
+			renderPush()
+		}
 		if (e.Build.ID === b.ID) {
 			b = e.Build
 			results = b.Results || []
+			if (b.Steps) {
+				steps = b.Steps
+			}
 			render()
 			buildSetFavicon(b)
 		} else if (!moreBuilds.includes(e.Build.ID)) {
@@ -1682,6 +2549,10 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 		moreBuilds = moreBuilds.filter(bID => bID !== e.BuildID)
 		renderMoreBuilds()
 	})
+	page.subscribe(streams.queue, (e: api.EventQueue) => {
+		queue = e.Jobs || []
+		renderQueue()
+	})
 	page.subscribe(streams.output, (e: api.EventOutput) => {
 		if (e.BuildID !== b.ID) {
 			return
@@ -1692,9 +2563,12 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 				Name: e.Step as api.BuildStatus,
 				Output: '',
 				Nsec: 0,
+				ErrorMessage: '',
+				Version: '',
+				CoverageReportFile: '',
 			}
-			for (const sv of stepViews) {
-				sv.output.style.borderLeftColor = stepColor()
+			for (let i = 0; i < stepViews.length; i++) {
+				stepViews[i].output.style.borderLeftColor = stepColor(steps[i])
 			}
 			steps.push(st)
 			const sv = newStepView(st)
@@ -1704,7 +2578,7 @@ const pageBuild = async (repoName: string, buildID: number): Promise<Page> => {
 		// Scroll new text into view if bottom is already visible.
 		const scroll = Math.abs(document.body.getBoundingClientRect().bottom  - window.innerHeight) < 50
 		st.Output += e.Text
-		stepViews[stepViews.length-1].output.innerText += e.Text
+		stepViews[steps.indexOf(st)].output.innerText += e.Text
 		if (scroll) {
 			window.scroll({top: document.body.scrollHeight})
 		}
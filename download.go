@@ -75,7 +75,7 @@ func serveDownload(w http.ResponseWriter, r *http.Request) {
 		if what == "release" {
 			p = fmt.Sprintf("%s/release/%s/%d/%s", dingDataDir, repoName, buildID, path.Base(res.Filename))
 		} else {
-			p = fmt.Sprintf("%s/build/%s/%d/checkout/%s/%s", dingDataDir, repoName, buildID, repo.CheckoutPath, res.Filename)
+			p = resultPath(repoName, b.ID, repo.CheckoutPath, res)
 		}
 		files = append(files, archiveFile{p, res.Filesize})
 	}
@@ -32,7 +32,7 @@ echo coverage-report: coverage.txt
 	}
 	api.RepoCreate(ctxbg, config.Password, r)
 
-	b := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false)
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false, nil)
 	twaitBuild(t, b, StatusSuccess)
 
 	testGet := func(h http.HandlerFunc, path string, expCode int) {
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"slices"
+)
+
+// triggerDownstreams starts builds for the downstream repositories of repo whose
+// condition is met by build b, see Repo.Downstreams. For a successful build,
+// release is false, and downstreams with condition "release" are only triggered
+// if b was released automatically. For a release of an earlier build, release is
+// true and only downstreams with condition "release" are triggered. Builds of pull
+// requests and of jobs of the repository don't trigger builds. Repositories
+// already in the chain of triggers of b are skipped.
+func triggerDownstreams(ctx context.Context, repo Repo, b Build, release bool) {
+	if b.PullRequest != 0 || b.Job != "" {
+		return
+	}
+	log := slog.With("repo", repo.Name, "buildid", b.ID)
+	for _, d := range repo.Downstreams {
+		switch d.Condition {
+		case DownstreamSuccess:
+			if release {
+				continue
+			}
+		case DownstreamRelease:
+			if b.Released == nil {
+				continue
+			}
+		}
+		pattern := d.UpstreamBranch
+		if pattern == "" {
+			pattern = repo.DefaultBranch
+		}
+		if ok, _ := path.Match(pattern, b.Branch); !ok {
+			continue
+		}
+		if d.Repo == repo.Name || slices.Contains(b.UpstreamRepos, d.Repo) {
+			log.Info("not triggering build of downstream repository already in chain of triggers", "downstream", d.Repo, "chain", b.UpstreamRepos)
+			continue
+		}
+
+		branch := d.Branch
+		if branch == "" {
+			dr := Repo{Name: d.Repo}
+			if err := database.Get(ctx, &dr); err != nil {
+				log.Error("get downstream repository", "err", err, "downstream", d.Repo)
+				continue
+			}
+			branch = dr.DefaultBranch
+		}
+		dr, nb, buildDir, gotoolchains, err := prepareBuild(ctx, d.Repo, branch, "", b.LowPrio, nil, buildOpts{upstream: &b})
+		if err != nil {
+			log.Error("creating build for downstream repository", "err", err, "downstream", d.Repo, "branch", branch)
+			continue
+		}
+		log.Info("triggered build for downstream repository", "downstream", d.Repo, "branch", branch, "downstreambuildid", nb.ID)
+		go func() {
+			err := doBuild(context.Background(), dr, nb, buildDir, gotoolchains, false)
+			if err != nil {
+				slog.Error("downstream build", "err", err, "buildid", nb.ID)
+			}
+		}()
+	}
+}
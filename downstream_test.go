@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownstream(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	newRepo := func(name, buildScript string) Repo {
+		r := Repo{
+			Name:          name,
+			VCS:           VCSCommand,
+			Origin:        "sh -c 'mkdir -p checkout/$DING_CHECKOUTPATH; echo commit:0123abcd'",
+			DefaultBranch: "main",
+			CheckoutPath:  name,
+			BuildScript:   buildScript,
+		}
+		return api.RepoCreate(ctxbg, config.Password, r)
+	}
+	lib := newRepo("lib", "#!/usr/bin/env bash\necho version: v1.2.3\n")
+	svc := newRepo("svc", "#!/usr/bin/env bash\nset -e\ntest -z \"$DING_UPSTREAM_REPONAME\" -o \"$DING_UPSTREAM_VERSION\" = v1.2.3\n")
+	rel := newRepo("rel", "#!/usr/bin/env bash\nset -e\ntest \"$DING_UPSTREAM_REPONAME\" = lib\n")
+
+	save := func(r Repo, downstreams ...Downstream) Repo {
+		r.Downstreams = downstreams
+		return api.RepoSave(ctxbg, config.Password, r)
+	}
+	tneederr(t, "user:error", func() { save(lib, Downstream{Repo: "bogus", Condition: DownstreamSuccess}) })
+	tneederr(t, "user:error", func() { save(lib, Downstream{Repo: "lib", Condition: DownstreamSuccess}) })
+	tneederr(t, "user:error", func() { save(lib, Downstream{Repo: "svc"}) })
+	tneederr(t, "user:error", func() { save(lib, Downstream{Repo: "svc", UpstreamBranch: "[", Condition: DownstreamSuccess}) })
+	lib = save(lib, Downstream{Repo: "svc", Condition: DownstreamSuccess}, Downstream{Repo: "rel", Condition: DownstreamRelease})
+	// Cycle, builds of lib and svc don't trigger each other endlessly.
+	svc = save(svc, Downstream{Repo: "lib", Branch: "main", Condition: DownstreamSuccess})
+
+	waitBuilds := func(repoName string, n int) []Build {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			builds := api.Builds(ctxbg, config.Password, repoName)
+			if len(builds) >= n {
+				tcompare(t, len(builds), n)
+				return builds
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("no %d builds for repo %s in 10 seconds", n, repoName)
+		return nil
+	}
+
+	lb := api.BuildCreate(ctxbg, config.Password, lib.Name, "main", "", false, nil)
+	twaitBuild(t, lb, StatusSuccess)
+	sb := waitBuilds(svc.Name, 1)[0]
+	tcompare(t, sb.UpstreamRepoName, lib.Name)
+	tcompare(t, sb.UpstreamBuildID, lb.ID)
+	tcompare(t, sb.UpstreamVersion, "v1.2.3")
+	tcompare(t, sb.UpstreamRepos, []string{lib.Name})
+	twaitBuild(t, sb, StatusSuccess)
+
+	// The build of svc triggered by lib does not trigger lib again.
+	sb = api.Build(ctxbg, config.Password, svc.Name, sb.ID)
+	triggerDownstreams(ctxbg, svc, sb, false)
+	waitBuilds(lib.Name, 1)
+
+	// A build of svc triggers lib, which does not trigger svc again.
+	sb2 := api.BuildCreate(ctxbg, config.Password, svc.Name, "main", "", false, nil)
+	twaitBuild(t, sb2, StatusSuccess)
+	lb2 := waitBuilds(lib.Name, 2)[0]
+	tcompare(t, lb2.UpstreamRepos, []string{svc.Name})
+	twaitBuild(t, lb2, StatusSuccess)
+	lb2 = api.Build(ctxbg, config.Password, lib.Name, lb2.ID)
+	triggerDownstreams(ctxbg, lib, lb2, false)
+	waitBuilds(svc.Name, 2)
+
+	// Only builds of the default branch of lib trigger builds.
+	db := api.BuildCreate(ctxbg, config.Password, lib.Name, "dev", "", false, nil)
+	twaitBuild(t, db, StatusSuccess)
+	db = api.Build(ctxbg, config.Password, lib.Name, db.ID)
+	triggerDownstreams(ctxbg, lib, db, false)
+	waitBuilds(svc.Name, 2)
+
+	// A release triggers a build of rel.
+	waitBuilds(rel.Name, 0)
+	api.ReleaseCreate(ctxbg, config.Password, lib.Name, lb.ID)
+	rb := waitBuilds(rel.Name, 1)[0]
+	tcompare(t, rb.UpstreamBuildID, lb.ID)
+	twaitBuild(t, rb, StatusSuccess)
+}
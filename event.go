@@ -63,3 +63,36 @@ func (e EventOutput) eventString() (string, []byte, error) {
 	buf, err := json.Marshal(e)
 	return "output", buf, err
 }
+
+// EventSchedule represents the creation or update of a schedule, e.g. after it
+// created a build and its next time changed.
+type EventSchedule struct {
+	Schedule Schedule
+}
+
+func (e EventSchedule) eventString() (string, []byte, error) {
+	buf, err := json.Marshal(e)
+	return "schedule", buf, err
+}
+
+// EventRemoveSchedule represents the removal of a schedule.
+type EventRemoveSchedule struct {
+	RepoName   string
+	ScheduleID int32
+}
+
+func (e EventRemoveSchedule) eventString() (string, []byte, error) {
+	buf, err := json.Marshal(e)
+	return "removeSchedule", buf, err
+}
+
+// EventQueue represents a change to the build queue, e.g. a build that was
+// added, started, finished or moved. Jobs holds all running and waiting builds.
+type EventQueue struct {
+	Jobs []QueueJob
+}
+
+func (e EventQueue) eventString() (string, []byte, error) {
+	buf, err := json.Marshal(e)
+	return "queue", buf, err
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/mjl-/bstore"
@@ -15,8 +15,26 @@ type giteaEvent struct {
 	Repository struct {
 		Name string `json:"name"`
 	} `json:"repository"`
-	Ref   string `json:"ref"`
-	After string `json:"after"`
+	Ref     string          `json:"ref"`
+	Before  string          `json:"before"`
+	After   string          `json:"after"`
+	Commits []webhookCommit `json:"commits"`
+}
+
+// giteaPullRequestEvent is sent for pull request events, with header X-Gitea-Event
+// "pull_request".
+type giteaPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int32  `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
 }
 
 func giteaHookHandler(w http.ResponseWriter, r *http.Request) {
@@ -68,22 +86,22 @@ func giteaHookHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
-	branch := repo.DefaultBranch
-	if strings.HasPrefix(event.Ref, "refs/heads/") {
-		branch = event.Ref[len("refs/heads/"):]
-	}
-	commit := event.After
-	repo, build, buildDir, gotoolchains, err := prepareBuild(r.Context(), repoName, branch, commit, false)
-	if err != nil {
-		slog.Error("gitea webhook: error starting build for push event", "repo", repoName, "branch", branch, "commit", commit, "err", err)
-		http.Error(w, "could not create build", http.StatusInternalServerError)
-		return
-	}
-	go func() {
-		err := doBuild(context.Background(), repo, build, buildDir, gotoolchains, false)
-		if err != nil {
-			slog.Error("build", "err", err)
+	ev := webhookEvent{ref: event.Ref, before: event.Before, after: event.After, commits: event.Commits}
+	if r.Header.Get("X-Gitea-Event") == "pull_request" {
+		var prevent giteaPullRequestEvent
+		err = json.Unmarshal(buf, &prevent)
+		if err != nil || prevent.Number <= 0 {
+			slog.Debug("gitea webhook: bad pull request event", "err", err, "number", prevent.Number)
+			http.Error(w, "bad pull request event", http.StatusBadRequest)
+			return
 		}
-	}()
-	w.WriteHeader(http.StatusNoContent)
+		// Only build for new commits, not for e.g. closed or labeled pull requests.
+		if !slices.Contains([]string{"opened", "reopened", "synchronized"}, prevent.Action) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		ev.pr = &pullRequest{prevent.Number, prevent.PullRequest.Head.Ref, prevent.PullRequest.Base.Ref}
+		ev.prCommit = prevent.PullRequest.Head.SHA
+	}
+	webhookBuild(w, r, "gitea", repo, ev)
 }
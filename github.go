@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/hex"
@@ -9,6 +8,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/mjl-/bstore"
@@ -18,8 +18,27 @@ type githubEvent struct {
 	Repository struct {
 		Name string `json:"name"`
 	} `json:"repository"`
-	Ref   string `json:"ref"`
-	After string `json:"after"`
+	Ref     string          `json:"ref"`
+	Before  string          `json:"before"`
+	After   string          `json:"after"`
+	Forced  bool            `json:"forced"`
+	Commits []webhookCommit `json:"commits"`
+}
+
+// githubPullRequestEvent is sent for pull request events, with header X-GitHub-Event
+// "pull_request".
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int32  `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
 }
 
 func githubHookHandler(w http.ResponseWriter, r *http.Request) {
@@ -89,24 +108,24 @@ func githubHookHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
-	branch := repo.DefaultBranch
-	if strings.HasPrefix(event.Ref, "refs/heads/") {
-		branch = event.Ref[len("refs/heads/"):]
-	}
-	commit := event.After
-	repo, build, buildDir, gotoolchains, err := prepareBuild(r.Context(), repoName, branch, commit, false)
-	if err != nil {
-		slog.Error("github webhook: error starting build for push event", "repo", repoName, "branch", branch, "commit", commit)
-		http.Error(w, "could not create build", http.StatusInternalServerError)
-		return
-	}
-	go func() {
-		err := doBuild(context.Background(), repo, build, buildDir, gotoolchains, false)
-		if err != nil {
-			slog.Error("build", "err", err)
+	ev := webhookEvent{ref: event.Ref, before: event.Before, after: event.After, forced: event.Forced, commits: event.Commits}
+	if r.Header.Get("X-GitHub-Event") == "pull_request" {
+		var prevent githubPullRequestEvent
+		err = json.Unmarshal(buf, &prevent)
+		if err != nil || prevent.Number <= 0 {
+			slog.Debug("github webhook: bad pull request event", "err", err, "number", prevent.Number)
+			http.Error(w, "bad pull request event", http.StatusBadRequest)
+			return
 		}
-	}()
-	w.WriteHeader(http.StatusNoContent)
+		// Only build for new commits, not for e.g. closed or labeled pull requests.
+		if !slices.Contains([]string{"opened", "reopened", "synchronize"}, prevent.Action) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		ev.pr = &pullRequest{prevent.Number, prevent.PullRequest.Head.Ref, prevent.PullRequest.Base.Ref}
+		ev.prCommit = prevent.PullRequest.Head.SHA
+	}
+	webhookBuild(w, r, "github", repo, ev)
 }
 
 func hmacsha1(key string, data []byte) []byte {
@@ -27,16 +27,7 @@ import (
 	"github.com/mjl-/sherpaprom"
 )
 
-type job struct {
-	repoName string
-	lowPrio  bool
-	rc       chan struct{}
-}
-
 var (
-	newJobs      chan job
-	finishedJobs chan string // repoName
-
 	rootRequests = make(chan request) // For http-serve, managing comms to privileged process.
 )
 
@@ -126,6 +117,10 @@ func servehttp(args []string) {
 	})
 
 	startJobManager()
+	settings := Settings{ID: 1}
+	err = database.Get(context.Background(), &settings)
+	xcheckf(err, "get settings")
+	jobsMaxBuilds <- settings.MaxBuilds
 
 	sq := bstore.QueryDB[Build](context.Background(), database)
 	sq.FilterFn(func(b Build) bool {
@@ -161,6 +156,11 @@ func servehttp(args []string) {
 		repo := Repo{Name: b.RepoName}
 		err := database.Get(context.Background(), &repo)
 		xcheckf(err, "get repo for new build")
+		repo, ok := jobRepo(repo, b.Job)
+		if !ok {
+			slog.Error("job for new build not found, skipping", "repo", b.RepoName, "buildid", b.ID, "job", b.Job)
+			continue
+		}
 
 		gotoolchains, err := repoGoToolchains(repo)
 		if err != nil {
@@ -170,17 +170,23 @@ func servehttp(args []string) {
 
 		job := job{
 			b.RepoName,
+			b.Branch,
+			b.ID,
 			b.LowPrio,
-			make(chan struct{}),
+			false,
+			repo.MaxBuilds,
+			make(chan bool),
 		}
 		newJobs <- job
 		go func() {
-			<-job.rc
+			if !<-job.rc {
+				return
+			}
 			defer func() {
 				if x := recover(); x != nil {
 					slog.Error("build panic for build at startup", "err", x)
 				}
-				finishedJobs <- job.repoName
+				finishedJobs <- job
 			}()
 
 			buildDir := fmt.Sprintf("%s/build/%s/%d", dingDataDir, b.RepoName, b.ID)
@@ -189,6 +195,9 @@ func servehttp(args []string) {
 		}()
 	}
 
+	go runSchedules()
+	go runPolls()
+
 	// If enabled, we check once per day whether new go toolchains have been released, and install them if so.
 	go func() {
 		// Don't check immediately. So we don't hit this during development all the time.
@@ -358,70 +367,6 @@ func serveUnprivileged(dec *gob.Decoder, enc *gob.Encoder, unixconn *net.UnixCon
 	}
 }
 
-func startJobManager() {
-	newJobs = make(chan job, 1)
-	finishedJobs = make(chan string, 1)
-
-	go func() {
-		active := map[string]bool{} // Repo name -> is low prio.
-		pending := map[string][]job{}
-		pendingLowPrio := []job{}
-		lowPrioBusy := false
-
-		kick := func(repoName string) {
-			if _, ok := active[repoName]; ok {
-				return
-			}
-			jobs := pending[repoName]
-			if len(jobs) == 0 {
-				return
-			}
-			job := jobs[0]
-			pending[repoName] = jobs[1:]
-			active[repoName] = false
-			job.rc <- struct{}{}
-		}
-
-		kickLowPrio := func() {
-			if lowPrioBusy {
-				return
-			}
-			for i, job := range pendingLowPrio {
-				_, ok := active[job.repoName]
-				if len(pending[job.repoName]) == 0 && !ok {
-					lowPrioBusy = true
-					pendingLowPrio = append(pendingLowPrio[:i], pendingLowPrio[i+1:]...)
-					active[job.repoName] = true
-					job.rc <- struct{}{}
-					return
-				}
-			}
-		}
-
-		for {
-			select {
-			case job := <-newJobs:
-				if job.lowPrio {
-					pendingLowPrio = append(pendingLowPrio, job)
-					kickLowPrio()
-				} else {
-					pending[job.repoName] = append(pending[job.repoName], job)
-					kick(job.repoName)
-				}
-
-			case repoName := <-finishedJobs:
-				lowPrio := active[repoName]
-				delete(active, repoName)
-				kick(repoName)
-				if lowPrio {
-					lowPrioBusy = false
-					kickLowPrio()
-				}
-			}
-		}
-	}()
-}
-
 func serveAsset(w http.ResponseWriter, r *http.Request) {
 	path := path.Join("web", r.URL.Path[1:])
 	w.Header().Set("Cache-Control", "no-cache, max-age=0")
@@ -519,7 +464,7 @@ func serveResult(w http.ResponseWriter, r *http.Request) {
 		suffix := "/" + filename
 		for _, res := range b.Results {
 			if res.Filename == filename || strings.HasSuffix(res.Filename, suffix) {
-				p = fmt.Sprintf("%s/build/%s/%d/checkout/%s/%s", dingDataDir, repoName, b.ID, repo.CheckoutPath, res.Filename)
+				p = resultPath(repoName, b.ID, repo.CheckoutPath, res)
 				break
 			}
 		}
@@ -13,18 +13,43 @@ type msgBuild struct {
 	BuildID         int32
 	UID             uint32 // UID to run this build under. Ignored if IsolateBuilds is entirely off. Otherwise it is set to either a unique UID, or a fixed UID per repo, depending on configuration.
 	CheckoutPath    string
-	RunPrefix       []string // From settings.
-	Env             []string // Including from settings.Environment
+	Checkout        string   // Directory in build dir with checkouts. Either "checkout", or "checkout-<cell>" for build steps of Go toolchains and build matrices running concurrently, e.g. "checkout-goprev-linux".
+	Step            string   // Name of the build step, e.g. "build:goprev:linux", unique within the build. Used for the cgroup of the step.
+	RunPrefix       []string // From settings, repo and branch.
+	Env             []string // Including environment from settings, repo and branch.
 	ToolchainDir    string
 	HomeDir         string
 	Bubblewrap      bool
 	BubblewrapNoNet bool
 
-	// If non-empty, we do builds for one or more go toolchains.
-	GoToolchains GoToolchains
+	// If non-empty, we do a build for a single go toolchain, with Goname one of
+	// "go", "goprev" or "gonext", and Goversion like "go1.23.4".
+	Goname    string
+	Goversion string
 
 	// Whether the reason for this build was the installation of a new Go toolchain.
 	NewGoToolchain bool
+
+	Limits buildLimits // From repo.
+
+	SecretEnv []string // Environment variables for secrets. Kept separate from Env so they are not logged.
+}
+
+// buildLimits are resource limits for a build command. Zero means no limit.
+type buildLimits struct {
+	MemoryMB   int
+	CPUSeconds int
+	Processes  int
+	OpenFiles  int
+	FileSizeMB int
+}
+
+// msgBuildStatus is written to the status fd of a build by the root process when
+// the build command has finished.
+type msgBuildStatus struct {
+	Error      string // Empty if the command succeeded.
+	PeakMemory int64  // In bytes. Zero if unknown.
+	CPUNsec    int64  // User and system time.
 }
 
 // Chown the home, checkout and download dir of a build.
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"slices"
+)
+
+type job struct {
+	repoName  string
+	branch    string
+	buildID   int32
+	lowPrio   bool
+	front     bool      // Moved to front of queue through the API, started before other jobs if possible.
+	maxBuilds int       // From repo, at most this many builds for the repo run concurrently, for different branches. Zero means 1.
+	rc        chan bool // Receives true when the job can start, false when it was removed from the queue.
+}
+
+// jobQueue holds the state of the job manager. It is only accessed from the job
+// manager goroutine, other goroutines send functions through jobCommands.
+type jobQueue struct {
+	pending   []job // In order of arrival, or moved to the front.
+	active    []job
+	maxBuilds int
+}
+
+var (
+	newJobs       chan job
+	finishedJobs  chan job
+	jobsMaxBuilds chan int             // Maximum number of builds to run concurrently, from settings. Zero means no limit.
+	jobCommands   chan func(*jobQueue) // Functions to execute in the job manager, for inspecting/changing the queue.
+)
+
+// jobQueueDo calls fn with the job queue from the job manager goroutine, and
+// waits for it to complete. fn must not panic.
+func jobQueueDo(fn func(q *jobQueue)) {
+	done := make(chan struct{})
+	jobCommands <- func(q *jobQueue) {
+		defer close(done)
+		fn(q)
+	}
+	<-done
+}
+
+// queueJobs returns the jobs in the queue, for use in the API and events.
+func (q *jobQueue) queueJobs() []QueueJob {
+	l := []QueueJob{}
+	for _, j := range q.active {
+		l = append(l, QueueJob{j.buildID, j.repoName, j.branch, j.lowPrio, true, 0})
+	}
+	for i, j := range q.pending {
+		l = append(l, QueueJob{j.buildID, j.repoName, j.branch, j.lowPrio, false, i + 1})
+	}
+	return l
+}
+
+// remove removes pending jobs for which fn returns true, and signals their
+// waiters that they will not be started. The removed jobs are returned.
+func (q *jobQueue) remove(fn func(j job) bool) (removed []job) {
+	var pending []job
+	for _, j := range q.pending {
+		if fn(j) {
+			removed = append(removed, j)
+			j.rc <- false
+		} else {
+			pending = append(pending, j)
+		}
+	}
+	q.pending = pending
+	return removed
+}
+
+// jobNext returns the index in pending of the job to start next, or -1 if no job
+// can be started.
+//
+// At most maxBuilds jobs are active, unless maxBuilds is zero. Each repo has at
+// most job.maxBuilds active builds (but at least 1), and builds for the same
+// branch of a repo never run concurrently. Low-prio jobs only start when no other
+// low-prio job is active, and the repo has no active or pending regular jobs.
+//
+// To be fair to all repos, regular jobs for repos with fewer active builds are
+// started first. Otherwise jobs are started in order of arrival. Jobs moved to
+// the front of the queue are started before all others.
+func jobNext(pending, active []job, maxBuilds int) int {
+	if maxBuilds > 0 && len(active) >= maxBuilds {
+		return -1
+	}
+
+	repoActive := map[string]int{}
+	branchActive := map[[2]string]bool{}
+	lowPrioBusy := false
+	for _, j := range active {
+		repoActive[j.repoName]++
+		branchActive[[2]string{j.repoName, j.branch}] = true
+		lowPrioBusy = lowPrioBusy || j.lowPrio
+	}
+
+	repoPending := map[string]bool{}
+	best := -1
+	for i, j := range pending {
+		if j.lowPrio {
+			continue
+		}
+		repoPending[j.repoName] = true
+		if repoActive[j.repoName] >= max(1, j.maxBuilds) || branchActive[[2]string{j.repoName, j.branch}] {
+			continue
+		}
+		if best < 0 || j.front && !pending[best].front || j.front == pending[best].front && repoActive[j.repoName] < repoActive[pending[best].repoName] {
+			best = i
+		}
+	}
+	if best >= 0 || lowPrioBusy {
+		return best
+	}
+
+	for i, j := range pending {
+		if j.lowPrio && repoActive[j.repoName] == 0 && !repoPending[j.repoName] {
+			return i
+		}
+	}
+	return -1
+}
+
+func startJobManager() {
+	newJobs = make(chan job, 1)
+	finishedJobs = make(chan job, 1)
+	jobsMaxBuilds = make(chan int)
+	jobCommands = make(chan func(*jobQueue))
+
+	go func() {
+		q := &jobQueue{}
+
+		kick := func() {
+			for {
+				i := jobNext(q.pending, q.active, q.maxBuilds)
+				if i < 0 {
+					return
+				}
+				job := q.pending[i]
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				q.active = append(q.active, job)
+				job.rc <- true
+			}
+		}
+
+		// Last state of the queue sent as event. Events are only sent for changes, not
+		// for read-only commands like listing the queue.
+		var last []QueueJob
+
+		for {
+			select {
+			case job := <-newJobs:
+				q.pending = append(q.pending, job)
+
+			case job := <-finishedJobs:
+				for i, j := range q.active {
+					if j.rc == job.rc {
+						q.active = append(q.active[:i], q.active[i+1:]...)
+						break
+					}
+				}
+
+			case q.maxBuilds = <-jobsMaxBuilds:
+
+			case fn := <-jobCommands:
+				fn(q)
+			}
+			kick()
+			if l := q.queueJobs(); !slices.Equal(l, last) {
+				last = l
+				events <- EventQueue{l}
+			}
+		}
+	}()
+}
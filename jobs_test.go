@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJobNext(t *testing.T) {
+	j := func(repoName, branch string, lowPrio bool, maxBuilds int) job {
+		return job{repoName, branch, 0, lowPrio, false, maxBuilds, nil}
+	}
+
+	test := func(pending, active []job, maxBuilds, exp int) {
+		t.Helper()
+		tcompare(t, jobNext(pending, active, maxBuilds), exp)
+	}
+
+	test(nil, nil, 0, -1)
+	test([]job{j("a", "main", false, 0)}, nil, 0, 0)
+
+	// Global limit.
+	test([]job{j("a", "main", false, 0)}, []job{j("b", "main", false, 0)}, 1, -1)
+	test([]job{j("a", "main", false, 0)}, []job{j("b", "main", false, 0)}, 2, 0)
+
+	// One build per repo by default.
+	test([]job{j("a", "dev", false, 0), j("b", "main", false, 0)}, []job{j("a", "main", false, 0)}, 0, 1)
+
+	// More builds for a repo, but not for the same branch.
+	test([]job{j("a", "main", false, 2), j("a", "dev", false, 2)}, []job{j("a", "main", false, 2)}, 0, 1)
+	test([]job{j("a", "dev", false, 2)}, []job{j("a", "main", false, 2), j("a", "other", false, 2)}, 0, -1)
+
+	// Repos with fewer active builds go first, otherwise in order of arrival.
+	test([]job{j("a", "x", false, 3), j("a", "y", false, 3), j("b", "main", false, 0)}, []job{j("a", "main", false, 3)}, 0, 2)
+	test([]job{j("a", "x", false, 3), j("b", "main", false, 0)}, nil, 0, 0)
+
+	// Low-prio jobs wait for regular jobs of repo, and other low-prio jobs.
+	test([]job{j("a", "main", true, 0), j("a", "dev", false, 0)}, []job{j("a", "main", false, 0)}, 0, -1)
+	test([]job{j("a", "main", true, 0), j("b", "main", true, 0)}, []job{j("c", "main", true, 0)}, 0, -1)
+	test([]job{j("a", "main", true, 0), j("b", "main", true, 0)}, []job{j("a", "main", false, 0)}, 0, 1)
+	test([]job{j("a", "main", true, 0), j("b", "main", false, 0)}, nil, 0, 1)
+
+	// Jobs moved to the front go first, if they can be started.
+	front := j("a", "x", false, 3)
+	front.front = true
+	test([]job{j("b", "main", false, 0), front}, []job{j("a", "main", false, 3)}, 0, 1)
+	test([]job{j("b", "main", false, 0), front}, []job{j("a", "x", false, 3)}, 0, 0)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// junitSuite is a test suite in a JUnit XML report. The root element of a report
+// is "testsuites" or a single "testsuite". Some tools nest test suites.
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Time   string       `xml:"time,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string         `xml:"name,attr"`
+	Classname string         `xml:"classname,attr"`
+	Time      string         `xml:"time,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	Errors    []junitFailure `xml:"error"`
+	Skipped   *struct{}      `xml:"skipped"`
+	SystemOut string         `xml:"system-out"`
+	SystemErr string         `xml:"system-err"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitTime parses a duration in seconds from a JUnit report. Some tools write
+// thousands separators. Invalid values are returned as 0.
+func junitTime(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	return v
+}
+
+// addJUnitFile reads a JUnit XML report from file name in root. Each test suite
+// with test cases is added as a package, named after the file if the suite has no
+// name.
+func (g *testResults) addJUnitFile(root *os.Root, name string) error {
+	f, err := root.Open(name)
+	if err != nil {
+		return fmt.Errorf("bad file in \"junit:\"-line: %v", err)
+	}
+	defer f.Close()
+
+	var report struct {
+		XMLName xml.Name
+		junitSuite
+	}
+	if err := xml.NewDecoder(f).Decode(&report); err != nil {
+		return fmt.Errorf("parsing junit report %s: %v", name, err)
+	}
+	if report.XMLName.Local != "testsuites" && report.XMLName.Local != "testsuite" {
+		return fmt.Errorf("parsing junit report %s: unexpected root element %q", name, report.XMLName.Local)
+	}
+	g.addJUnitSuite(report.junitSuite, name)
+	return nil
+}
+
+func (g *testResults) addJUnitSuite(s junitSuite, fileName string) {
+	if len(s.Cases) > 0 {
+		p := TestPackage{Package: s.Name, Status: TestSkip, Elapsed: junitTime(s.Time)}
+		if p.Package == "" {
+			p.Package = fileName
+		}
+		for _, c := range s.Cases {
+			t := Test{Name: c.Name, Status: TestPass, Elapsed: junitTime(c.Time)}
+			// Classes are often the suite, but not always, e.g. for pytest.
+			if c.Classname != "" && c.Classname != s.Name && !strings.HasPrefix(c.Name, c.Classname) {
+				t.Name = c.Classname + "." + c.Name
+			}
+			if failures := append(c.Failures, c.Errors...); len(failures) > 0 {
+				t.Status = TestFail
+				for _, f := range failures {
+					t.Output = appendTestOutput(t.Output, g.mask.Replace(strings.TrimSpace(f.Message+"\n"+f.Text)+"\n"))
+				}
+				t.Output = appendTestOutput(t.Output, g.mask.Replace(c.SystemOut))
+				t.Output = appendTestOutput(t.Output, g.mask.Replace(c.SystemErr))
+			} else if c.Skipped != nil {
+				t.Status = TestSkip
+			}
+
+			// A suite fails if a test failed, and is skipped if all its tests were skipped.
+			if t.Status == TestFail || t.Status == TestPass && p.Status == TestSkip {
+				p.Status = t.Status
+			}
+			p.Tests = append(p.Tests, t)
+		}
+		g.packages = append(g.packages, p)
+	}
+	for _, ss := range s.Suites {
+		g.addJUnitSuite(ss, fileName)
+	}
+}
@@ -13,8 +13,16 @@ import (
 
 func kick(args []string) {
 	fs := flag.NewFlagSet("kick", flag.ExitOnError)
+	var params []Param
+	fs.Func("param", "set build parameter, of the form name=value; can be specified multiple times", func(s string) error {
+		p, err := parseParam(s)
+		if err == nil {
+			params = append(params, p)
+		}
+		return err
+	})
 	fs.Usage = func() {
-		fmt.Fprintln(os.Stderr, "usage: ding kick baseURL repoName branch commit < password-file")
+		fmt.Fprintln(os.Stderr, "usage: ding kick [-param name=value ...] baseURL repoName branch commit < password-file")
 		fs.PrintDefaults()
 	}
 	fs.Parse(args)
@@ -35,11 +43,42 @@ func kick(args []string) {
 	client, err := client.New(baseURL, []string{"build"})
 	xcheckf(err, "initializing sherpa client")
 
+	// Pushes of branches and tags (of the form "tags/<name>") can be ignored by the
+	// patterns of the repository.
+	var repo Repo
+	err = client.Call(context.Background(), &repo, "Repo", password, repoName)
+	xcheckf(err, "get repository")
+	kind, name := "branch", branch
+	if tag, ok := strings.CutPrefix(branch, "tags/"); ok {
+		kind, name = "tag", tag
+	}
+	if reason := refIgnored(repo, kind, name); reason != "" {
+		_, err = fmt.Println("push ignored:", reason)
+		xcheckf(err, "write")
+		return
+	}
+
 	var build struct {
 		ID int64
 	}
-	err = client.Call(context.Background(), &build, "CreateBuild", password, repoName, branch, commit, false)
+	if len(params) == 0 {
+		// Older ding versions don't have BuildCreate.
+		err = client.Call(context.Background(), &build, "CreateBuild", password, repoName, branch, commit, false)
+	} else {
+		err = client.Call(context.Background(), &build, "BuildCreate", password, repoName, branch, commit, false, params)
+	}
 	xcheckf(err, "building")
 	_, err = fmt.Println("buildId", build.ID)
 	xcheckf(err, "write")
+
+	// Jobs of the repository with matching patterns are built too.
+	for _, j := range repo.Jobs {
+		if jobIgnored(j, kind, name) != "" {
+			continue
+		}
+		err = client.Call(context.Background(), &build, "BuildCreateJob", password, repoName, j.Name, branch, commit, false, params)
+		xcheckf(err, "building job")
+		_, err = fmt.Println("buildId", build.ID, "job", j.Name)
+		xcheckf(err, "write")
+	}
 }
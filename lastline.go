@@ -7,21 +7,22 @@ import (
 )
 
 func setLastLine(b *Build) {
-	// todo: should just try reading from build.output, then clone.output.
-
-	var status BuildStatus
+	b.LastLine = ""
 	switch b.Status {
-	case StatusClone:
-		status = b.Status
-	case StatusBuild, StatusSuccess:
-		status = StatusBuild
+	case StatusClone, StatusBuild, StatusSuccess:
 	default:
-		b.LastLine = ""
 		return
 	}
-	b.LastLine = ""
 
-	path := fmt.Sprintf("%s/build/%s/%d/output/%s.output", dingDataDir, b.RepoName, b.ID, status)
+	// Read from the last step that was started. For builds with a build step per Go
+	// toolchain, that is the last toolchain that was built for, or the one that failed.
+	names := buildStepNames(*b)
+	if len(names) == 0 {
+		return
+	}
+	step := names[len(names)-1]
+
+	path := fmt.Sprintf("%s/build/%s/%d/output/%s.output", dingDataDir, b.RepoName, b.ID, step)
 	f, err := os.Open(path)
 	if err != nil {
 		if !os.IsNotExist(err) {
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var rlimitResources = map[string]int{
+	"as":     unix.RLIMIT_AS,
+	"cpu":    unix.RLIMIT_CPU,
+	"nproc":  unix.RLIMIT_NPROC,
+	"nofile": unix.RLIMIT_NOFILE,
+	"fsize":  unix.RLIMIT_FSIZE,
+}
+
+// execLimits sets rlimits and executes a command. It is run as the first command
+// of a build, before the build script, because Go cannot set rlimits for a new
+// process between fork and exec.
+func execLimits(args []string) {
+	i := slices.Index(args, "--")
+	if i < 0 || i == len(args)-1 {
+		log.Fatalf("usage: ding exec-limits [resource=value ...] -- command [args ...]")
+	}
+	for _, s := range args[:i] {
+		k, v, _ := strings.Cut(s, "=")
+		res, ok := rlimitResources[k]
+		if !ok {
+			log.Fatalf("unknown resource %q", k)
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			log.Fatalf("parsing value for resource %q: %v", k, err)
+		}
+		err = unix.Setrlimit(res, &unix.Rlimit{Cur: n, Max: n})
+		if err != nil {
+			log.Fatalf("setting rlimit %q: %v", k, err)
+		}
+	}
+	argv := args[i+1:]
+	err := unix.Exec(argv[0], argv, os.Environ())
+	log.Fatalf("exec: %v", err)
+}
+
+// commandLimiter applies resource limits to a build command, and gathers resource
+// usage once the command has finished.
+type commandLimiter struct {
+	buildCgroup string   // Cgroup directory for the build, holds the limits. Empty if cgroups are not used.
+	cgroup      string   // Cgroup directory for the command, a child of buildCgroup.
+	cgroupFile  *os.File // Opened cgroup, for starting the command in the cgroup.
+}
+
+// limitCommand prepares cmd, which must not have been started yet, to run with the
+// resource limits. If config.CgroupDir is set, the command is started in a new
+// cgroup for the build, with limits on memory and processes. Other limits are
+// set as rlimits by running the command through "ding exec-limits". The finish
+// method must be called after the command has finished, also when it failed to
+// start.
+func limitCommand(cmd *exec.Cmd, buildID int32, step string, limits buildLimits) (rl *commandLimiter, rerr error) {
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	rl = &commandLimiter{}
+	defer func() {
+		if rerr != nil {
+			rl.finish(nil)
+			rl = nil
+		}
+	}()
+
+	var rlimits []string
+	addLimit := func(resource string, v int64) {
+		if v > 0 {
+			rlimits = append(rlimits, fmt.Sprintf("%s=%d", resource, v))
+		}
+	}
+
+	if config.CgroupDir != "" {
+		rl.buildCgroup = filepath.Join(config.CgroupDir, fmt.Sprintf("build-%d", buildID))
+		if err := os.Mkdir(rl.buildCgroup, 0755); err != nil && !os.IsExist(err) {
+			return rl, fmt.Errorf("creating cgroup for build: %v", err)
+		}
+		write := func(name string, v int64) error {
+			if v <= 0 {
+				return nil
+			}
+			return os.WriteFile(filepath.Join(rl.buildCgroup, name), []byte(fmt.Sprintf("%d", v)), 0644)
+		}
+		if err := write("memory.max", int64(limits.MemoryMB)*1024*1024); err != nil {
+			return rl, fmt.Errorf("setting cgroup memory limit: %v", err)
+		}
+		if err := write("pids.max", int64(limits.Processes)); err != nil {
+			return rl, fmt.Errorf("setting cgroup process limit: %v", err)
+		}
+
+		// Processes can only be in leaf cgroups when controllers are enabled, so the
+		// command gets its own cgroup within the cgroup of the build.
+		rl.cgroup = filepath.Join(rl.buildCgroup, step)
+		if err := os.Mkdir(rl.cgroup, 0755); err != nil {
+			return rl, fmt.Errorf("creating cgroup for build step: %v", err)
+		}
+		f, err := os.Open(rl.cgroup)
+		if err != nil {
+			return rl, fmt.Errorf("open cgroup: %v", err)
+		}
+		rl.cgroupFile = f
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	} else {
+		addLimit("as", int64(limits.MemoryMB)*1024*1024)
+		addLimit("nproc", int64(limits.Processes))
+	}
+	addLimit("cpu", int64(limits.CPUSeconds))
+	addLimit("nofile", int64(limits.OpenFiles))
+	addLimit("fsize", int64(limits.FileSizeMB)*1024*1024)
+
+	if len(rlimits) > 0 {
+		// We execute ourselves through /proc/self/exe. The path of the ding binary may
+		// not be accessible to the build user.
+		args := append([]string{"/proc/self/exe", "exec-limits"}, rlimits...)
+		args = append(args, "--", cmd.Path)
+		cmd.Args = append(args, cmd.Args[1:]...)
+		cmd.Path = "/proc/self/exe"
+	}
+	return rl, nil
+}
+
+// finish returns the peak memory usage and CPU time of the command, and removes
+// the cgroup of the command. The peak memory usage is for the whole build when
+// cgroups are used, and for the largest process otherwise.
+func (rl *commandLimiter) finish(ps *os.ProcessState) (peakMemory, cpuNsec int64) {
+	if ps != nil {
+		cpuNsec = int64(ps.UserTime() + ps.SystemTime())
+		if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+			peakMemory = int64(ru.Maxrss) * 1024
+		}
+	}
+
+	if rl.cgroupFile != nil {
+		rl.cgroupFile.Close()
+	}
+	if rl.cgroup == "" {
+		return
+	}
+
+	if buf, err := os.ReadFile(filepath.Join(rl.buildCgroup, "memory.peak")); err == nil {
+		if v, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64); err == nil {
+			peakMemory = v
+		}
+	}
+	if buf, err := os.ReadFile(filepath.Join(rl.cgroup, "cpu.stat")); err == nil {
+		for _, line := range strings.Split(string(buf), "\n") {
+			if s, ok := strings.CutPrefix(line, "usage_usec "); ok {
+				if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+					cpuNsec = v * 1000
+				}
+			}
+		}
+	}
+
+	// Kill processes that are still around, e.g. daemons started by the build
+	// script. The cgroup can only be removed once it has no processes left.
+	if err := os.WriteFile(filepath.Join(rl.cgroup, "cgroup.kill"), []byte("1"), 0644); err != nil {
+		slog.Error("killing processes in cgroup", "err", err, "cgroup", rl.cgroup)
+	}
+	var err error
+	for range 50 {
+		err = os.Remove(rl.cgroup)
+		if err == nil || os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		slog.Error("removing cgroup for build step", "err", err, "cgroup", rl.cgroup)
+	}
+	// The cgroup of the build can still be in use by other steps running concurrently.
+	os.Remove(rl.buildCgroup)
+	return
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestCgroupSteps(t *testing.T) {
+	testEnv(t)
+
+	cgroupDir := config.CgroupDir
+	config.CgroupDir = t.TempDir()
+	defer func() { config.CgroupDir = cgroupDir }()
+
+	// Two matrix cells for the same Go toolchain run concurrently, each in their own
+	// cgroup.
+	var names []string
+	for _, step := range []string{"build:go:linux", "build:go:openbsd"} {
+		names = append(names, cgroupStepName(step))
+		rl, err := limitCommand(exec.Command("true"), 1, cgroupStepName(step), buildLimits{})
+		tcheck(t, err, "limit command for step")
+		defer rl.cgroupFile.Close()
+	}
+	tcompare(t, names, []string{"build-go-linux", "build-go-openbsd"})
+
+	tcompare(t, cgroupStepName("../build"), "---build")
+	tcompare(t, cgroupStepName(""), "build")
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+)
+
+func execLimits(args []string) {
+	log.Fatalf("resource limits are only supported on linux")
+}
+
+type commandLimiter struct{}
+
+// limitCommand only succeeds if no limits are set, resource limits are only
+// supported on Linux.
+func limitCommand(cmd *exec.Cmd, buildID int32, step string, limits buildLimits) (*commandLimiter, error) {
+	if limits != (buildLimits{}) {
+		return nil, errors.New("resource limits are only supported on linux")
+	}
+	return &commandLimiter{}, nil
+}
+
+func (rl *commandLimiter) finish(ps *os.ProcessState) (peakMemory, cpuNsec int64) {
+	if ps != nil {
+		cpuNsec = int64(ps.UserTime() + ps.SystemTime())
+	}
+	return
+}
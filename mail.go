@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 )
 
 func repoRecipients(settings Settings, r Repo) []string {
@@ -12,25 +13,45 @@ func repoRecipients(settings Settings, r Repo) []string {
 	return addrs
 }
 
+// mailRepoName returns the name of the repository for messages about build,
+// along with the job of the build, if any.
+func mailRepoName(repo Repo, build Build) string {
+	if build.Job != "" {
+		return fmt.Sprintf("%s job %s", repo.Name, build.Job)
+	}
+	return repo.Name
+}
+
+// Maximum number of failing tests listed in a notification about a failing build.
+const maxMailTests = 20
+
 func _sendMailFailing(settings Settings, repo Repo, build Build, errmsg string) {
 	link := fmt.Sprintf("%s/#repo/%s/build/%d", config.BaseURL, repo.Name, build.ID)
-	subject := fmt.Sprintf("ding: failure: repo %s branch %s failing", repo.Name, build.Branch)
+	subject := fmt.Sprintf("ding: failure: repo %s branch %s failing", mailRepoName(repo, build), build.Branch)
+	var bisect string
+	if build.Bisect.FirstBad != "" {
+		bisect = fmt.Sprintf("First failing commit, found by bisect:\n\n\t%s\n\n", build.Bisect.FirstBad)
+	} else if build.Bisect.Error != "" {
+		bisect = fmt.Sprintf("Bisect for the first failing commit failed:\n\n\t%s\n\n", build.Bisect.Error)
+	}
+	details := fmt.Sprintf("Last output:\n\n\t%s\n\t%s\n\n", build.LastLine, errmsg)
+	if tests := failingTests(build); len(tests) > 0 {
+		if len(tests) > maxMailTests {
+			tests = append(tests[:maxMailTests], fmt.Sprintf("... and %d more", len(tests)-maxMailTests))
+		}
+		details = fmt.Sprintf("Failing tests:\n\n\t%s\n\n\t%s\n\n", strings.Join(tests, "\n\t"), errmsg)
+	}
 	textMsg := fmt.Sprintf(`Hi!
 
 Your build for branch %s on repo %s is now failing:
 
 	%s
 
-Last output:
-
-	%s
-	%s
-
-Please fix, thanks!
+%s%sPlease fix, thanks!
 
 Cheers,
 Ding
-`, build.Branch, repo.Name, link, build.LastLine, errmsg)
+`, build.Branch, mailRepoName(repo, build), link, details, bisect)
 
 	if addrs := repoRecipients(settings, repo); len(addrs) > 0 {
 		_sendmail(addrs, subject, textMsg)
@@ -39,7 +60,7 @@ Ding
 
 func _sendMailFixed(settings Settings, repo Repo, build Build) {
 	link := fmt.Sprintf("%s/#repo/%s/build/%d", config.BaseURL, repo.Name, build.ID)
-	subject := fmt.Sprintf("ding: resolved: repo %s branch %s is building again", repo.Name, build.Branch)
+	subject := fmt.Sprintf("ding: resolved: repo %s branch %s is building again", mailRepoName(repo, build), build.Branch)
 	textMsg := fmt.Sprintf(`Hi!
 
 You fixed the build for branch %s on repo %s:
@@ -50,7 +71,7 @@ You're the bomb, keep it up!
 
 Cheers,
 Ding
-`, build.Branch, repo.Name, link)
+`, build.Branch, mailRepoName(repo, build), link)
 
 	if addrs := repoRecipients(settings, repo); len(addrs) > 0 {
 		_sendmail(addrs, subject, textMsg)
@@ -15,7 +15,7 @@ func TestMail(t *testing.T) {
 	// Check email is sent when build starts failing.
 	r := Repo{Name: "mailtest", VCS: VCSCommand, Origin: "exit 1", DefaultBranch: "main", CheckoutPath: "mailtest", BuildScript: "#!/usr/bin/env bash\necho hi\n"}
 	r = api.RepoCreate(ctxbg, config.Password, r)
-	b := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false)
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false, nil)
 	twaitBuild(t, b, StatusClone)
 	tcompare(t, client.recipients, []string{config.Notify.Email})
 	client.recipients = nil
@@ -24,7 +24,7 @@ func TestMail(t *testing.T) {
 	r.Origin = "echo clone..; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ..."
 	r.NotifyEmailAddrs = []string{"addr1@ding.example", "addr2@ding.example"}
 	r = api.RepoSave(ctxbg, config.Password, r)
-	b = api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "unused", "", false, nil)
 	twaitBuild(t, b, StatusSuccess)
 	tcompare(t, client.recipients, r.NotifyEmailAddrs)
 	client.recipients = nil
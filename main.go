@@ -32,7 +32,7 @@ func init() {
 
 var (
 	database *bstore.DB
-	dbtypes  = []any{Settings{}, Repo{}, Build{}}
+	dbtypes  = []any{Settings{}, Repo{}, Build{}, Schedule{}, Secret{}}
 )
 
 // Config is read from the static config file, changing it requires restarting
@@ -44,6 +44,7 @@ type Config struct {
 	DataDir               string `sconf-doc:"Directory where all data is stored for builds, releases, home directories. In case of isolate builds, this must have a umask 027 and owned by the ding uid/gid. Can be an absolute path, or a path relative to the ding working directory."`
 	GoToolchainDir        string `sconf:"optional" sconf-doc:"Directory containing Go toolchains, for easy installation of new Go versions. Go toolchains are assumed to be in directories named after their version, e.g. go1.13.8. All names starting with 'go' are assumed to be Go toolchains. Active versions are marked by a symlink named go, goprev and optionally gonext to one of the versioned directories. Ding needs write access to this directory to download new toolchains. If configured, this directory is available during a build as DING_TOOLCHAINDIR."`
 	BaseURL               string `sconf-doc:"URL to point to from notifications about failed builds."`
+	CgroupDir             string `sconf:"optional" sconf-doc:"Linux only. Directory in the cgroup v2 file system, e.g. /sys/fs/cgroup/ding-builds, in which a cgroup is created for each build. If set, the memory and process limits of a repository apply to all processes of a build together, and peak memory usage is measured for the whole build. The directory must be writable by the root ding process, must not contain processes itself, and must have the memory and pids controllers enabled in its cgroup.subtree_control. If not set, these limits are applied to each build process individually with rlimits."`
 	IsolateBuilds         struct {
 		Enabled  bool   `sconf-doc:"If false, we run all build commands as the user running ding and the settings below do not apply.  If true, we run builds with unique UIDs."`
 		UIDStart uint32 `sconf-doc:"We'll use UIDStart + buildID as the unix UID to run the commands under."`
@@ -158,6 +159,9 @@ func main() {
 	case "serve-http":
 		// Undocumented, for unpriviliged http process.
 		servehttp(args)
+	case "exec-limits":
+		// Undocumented, for setting rlimits before starting a build command.
+		execLimits(args)
 	case "quickstart":
 		quickstart(args)
 	case "build":
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/gob"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
 	"reflect"
 	"strings"
 	"syscall"
@@ -65,7 +67,79 @@ func twaitBuild(t *testing.T, b Build, expStatus BuildStatus) {
 	t.Fatalf("no build result in 10 seconds")
 }
 
+// twaitQueued waits until the build is in the job queue, waiting or running.
+func twaitQueued(t *testing.T, b Build) {
+	t.Helper()
+	api := Ding{}
+	for i := 0; i < 100; i++ {
+		for _, qj := range api.Queue(ctxbg, config.Password) {
+			if qj.BuildID == b.ID {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("build not in queue in 1 second")
+}
+
+// twaitQueueEmpty waits until no builds are waiting or running. Build IDs are
+// reused by the next test, so cancelled builds must be done before it starts.
+func twaitQueueEmpty(t *testing.T) {
+	t.Helper()
+	api := Ding{}
+	for i := 0; i < 100; i++ {
+		if len(api.Queue(ctxbg, config.Password)) == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("queue not empty in 10 seconds")
+}
+
+// testRun runs a command in dir, failing the test if it fails, and returns its
+// output without surrounding whitespace.
+func testRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command(args[0], args[1:]...)
+	c.Dir = dir
+	output, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("run in %q, args %v: %v, output: %s", dir, args, err, output)
+	}
+	return string(bytes.TrimSpace(output))
+}
+
+// testGitRepo creates a new git repository "gitrepo-<name>" in the data directory,
+// with branch main and a user for commits, and returns its path.
+func testGitRepo(t *testing.T, name string) string {
+	t.Helper()
+	dir := dingDataDir + "/gitrepo-" + name
+	os.RemoveAll(dir)
+	testRun(t, ".", "git", "init", "--initial-branch=main", dir)
+	testRun(t, dir, "git", "config", "user.name", "ding")
+	testRun(t, dir, "git", "config", "user.email", "ding@ding.example")
+	return dir
+}
+
+// testGitCommit runs the command args in git repository dir, if any, and commits
+// all changes, returning the hash of the new commit.
+func testGitCommit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if len(args) > 0 {
+		testRun(t, dir, args...)
+	}
+	testRun(t, dir, "git", "add", "-A")
+	testRun(t, dir, "git", "commit", "--allow-empty", "-m", "test")
+	return testRun(t, dir, "git", "rev-parse", "HEAD")
+}
+
 func TestMain(m *testing.M) {
+	// Builds with resource limits are started through "ding exec-limits", which is
+	// the test binary during tests.
+	if len(os.Args) > 1 && os.Args[1] == "exec-limits" {
+		execLimits(os.Args[2:])
+	}
+
 	config.Password = "test1234"
 	config.DataDir = "testdata/tmp"
 	config.ShowSherpaErrors = true
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pathMatch returns whether file matches pattern. A pattern without slash is
+// matched against each element of the path. Other patterns are matched against
+// the path and each of its leading directories.
+func pathMatch(pattern, file string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	elems := strings.Split(file, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, e := range elems {
+			if ok, _ := path.Match(pattern, e); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range elems {
+		if ok, _ := path.Match(pattern, strings.Join(elems[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathPatterns are the include and exclude patterns for paths of a repository or
+// one of its jobs.
+type pathPatterns struct {
+	include, exclude []string
+}
+
+// buildPathPatterns returns the path patterns for builds of repo, followed by
+// those of its job with name job, if any. A changed file is only relevant if it
+// matches all of them. Repositories and jobs without path patterns are left out.
+func buildPathPatterns(repo Repo, job string) []pathPatterns {
+	var l []pathPatterns
+	add := func(include, exclude []string) {
+		if len(include) > 0 || len(exclude) > 0 {
+			l = append(l, pathPatterns{include, exclude})
+		}
+	}
+	add(repo.IncludePaths, repo.ExcludePaths)
+	for _, j := range repo.Jobs {
+		if job != "" && j.Name == job {
+			add(j.IncludePaths, j.ExcludePaths)
+		}
+	}
+	return l
+}
+
+// pathsSkipReason returns why a build can be skipped because none of the changed
+// files are relevant according to the path patterns, see buildPathPatterns. The
+// empty string is returned if the build is needed, including when no path
+// patterns are configured or files is empty.
+func pathsSkipReason(patterns []pathPatterns, files []string) string {
+	if len(patterns) == 0 || len(files) == 0 {
+		return ""
+	}
+	matchAny := func(patterns []string, file string) bool {
+		for _, pat := range patterns {
+			if pathMatch(pat, file) {
+				return true
+			}
+		}
+		return false
+	}
+	relevant := func(f string) bool {
+		for _, pp := range patterns {
+			if matchAny(pp.exclude, f) || len(pp.include) > 0 && !matchAny(pp.include, f) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, f := range files {
+		if relevant(f) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("Skipped, none of the %d changed files match the path patterns", len(files))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestPathMatch(t *testing.T) {
+	test := func(pattern, file string, exp bool) {
+		t.Helper()
+		tcompare(t, pathMatch(pattern, file), exp)
+	}
+	test("*.md", "README.md", true)
+	test("*.md", "docs/intro.md", true)
+	test("docs", "docs/a/b.html", true)
+	test("docs/", "docs/a/b.html", true)
+	test("docs", "cmd/docs.go", false)
+	test("cmd/*", "cmd/ding/main.go", true)
+	test("cmd/*", "main.go", false)
+	test("cmd/*.go", "cmd/ding/main.go", false)
+	test("web/ding.js", "web/ding.js", true)
+
+	repo := Repo{ExcludePaths: []string{"docs", "*.md"}}
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, ""), nil), "")
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, ""), []string{"docs/index.html", "README.md"}) != "", true)
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, ""), []string{"docs/index.html", "main.go"}), "")
+	repo = Repo{IncludePaths: []string{"*.go"}, ExcludePaths: []string{"*_test.go"}}
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, ""), []string{"main.go"}), "")
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, ""), []string{"main_test.go", "Makefile"}) != "", true)
+
+	// Patterns of a job apply in addition to those of the repository.
+	repo = Repo{ExcludePaths: []string{"docs"}, Jobs: []RepoJob{{Name: "html", IncludePaths: []string{"*.html"}}}}
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, "html"), []string{"docs/index.html"}) != "", true)
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, "html"), []string{"main.go"}) != "", true)
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, "html"), []string{"index.html"}), "")
+	tcompare(t, pathsSkipReason(buildPathPatterns(repo, ""), []string{"main.go"}), "")
+}
+
+func TestPathsSkip(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	gitRepoDir := testGitRepo(t, "paths")
+	commit := func(file string) string {
+		t.Helper()
+		err := os.WriteFile(gitRepoDir+"/"+file, []byte(file), 0644)
+		tcheck(t, err, "write file")
+		return testGitCommit(t, gitRepoDir)
+	}
+	os.Mkdir(gitRepoDir+"/docs", 0755)
+	commit("main.go")
+
+	r := Repo{
+		Name:          "paths",
+		VCS:           VCSGit,
+		Origin:        gitRepoDir,
+		DefaultBranch: "main",
+		CheckoutPath:  "paths",
+		BuildScript:   "#!/usr/bin/env bash\necho building\n",
+		ExcludePaths:  []string{"docs", "*.md"},
+	}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	r.IncludePaths = []string{"["}
+	tneederr(t, "user:error", func() { api.RepoSave(ctxbg, config.Password, r) })
+	r.IncludePaths = nil
+
+	// First build, nothing to compare with.
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+
+	// Only docs changed since last build, skipped after looking at the checkout.
+	commit("docs/index.html")
+	commit("README.md")
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSkipped)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.ErrorMessage, "Skipped, none of the 2 changed files match the path patterns")
+
+	// Rebuilding the same commit as the last build is never skipped.
+	prev := api.Builds(ctxbg, config.Password, r.Name)[1]
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", prev.CommitHash, false, nil)
+	twaitBuild(t, b, StatusSuccess)
+
+	// Low-prio builds are not skipped.
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", true, nil)
+	twaitBuild(t, b, StatusSuccess)
+
+	// Relevant change.
+	commit("other.go")
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+
+	// Webhook with only docs changes, skipped immediately.
+	event := githubEvent{
+		Ref:    "refs/heads/main",
+		Before: "e8dab6168e75a88346bc0d2b95ea8227552debf2",
+		After:  "1111111111111111111111111111111111111111",
+		Commits: []webhookCommit{
+			{Added: []string{"docs/new.html"}},
+			{Modified: []string{"CHANGES.md"}},
+		},
+	}
+	hook := func(event githubEvent) {
+		t.Helper()
+		body := toJSON(event)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/github/paths", bytes.NewReader(body))
+		req.Header.Set("X-Hub-Signature", fmt.Sprintf("sha1=%x", hmacsha1(r.WebhookSecret, body)))
+		githubHookHandler(w, req)
+		tcompare(t, w.Code, http.StatusNoContent)
+	}
+	hook(event)
+	b = api.Builds(ctxbg, config.Password, r.Name)[0]
+	tcompare(t, b.Status, StatusSkipped)
+	tcompare(t, b.CommitHash, "1111111111111111111111111111111111111111")
+	if b.Finish == nil {
+		t.Fatalf("skipped build not finished")
+	}
+
+	// Skipped builds are not shown as the latest build of a branch.
+	rbl := api.RepoBuilds(ctxbg, config.Password)
+	tcompare(t, rbl[0].Builds[0].Status, StatusSuccess)
+
+	// New branch, files not known from webhook, so build is not skipped.
+	event.Before = "0000000000000000000000000000000000000000"
+	event.After = testRun(t, gitRepoDir, "git", "rev-parse", "HEAD")
+	hook(event)
+	b = api.Builds(ctxbg, config.Password, r.Name)[0]
+	twaitBuild(t, b, StatusSuccess)
+
+	// Matching changed files from the webhook are trusted, the files are not listed
+	// again after the clone, where only docs changed.
+	event.Before = event.After
+	event.After = commit("docs/more.html")
+	event.Commits = []webhookCommit{{Modified: []string{"main.go"}}}
+	hook(event)
+	b = api.Builds(ctxbg, config.Password, r.Name)[0]
+	twaitBuild(t, b, StatusSuccess)
+
+	// The exclude patterns of the repository also apply to builds of jobs.
+	r.Jobs = []RepoJob{{Name: "html", BuildScript: "#!/usr/bin/env bash\necho html\n", IncludePaths: []string{"*.html"}}}
+	r = api.RepoSave(ctxbg, config.Password, r)
+	event.Before = event.After
+	event.After = "2222222222222222222222222222222222222222"
+	event.Commits = []webhookCommit{{Added: []string{"docs/new.html"}}}
+	hook(event)
+	builds := api.Builds(ctxbg, config.Password, r.Name)
+	tcompare(t, []string{builds[0].Job, builds[1].Job}, []string{"html", ""})
+	tcompare(t, []BuildStatus{builds[0].Status, builds[1].Status}, []BuildStatus{StatusSkipped, StatusSkipped})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// runPolls polls the origins of repositories with polling enabled for new
+// commits, checking every 10 seconds which repositories are due. It never
+// returns.
+func runPolls() {
+	for {
+		if err := runDuePolls(context.Background(), time.Now()); err != nil {
+			slog.Error("polling repositories", "err", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// runDuePolls polls the repositories that have not been polled in the past poll
+// interval.
+func runDuePolls(ctx context.Context, now time.Time) error {
+	q := bstore.QueryDB[Repo](ctx, database).FilterGreater("PollInterval", int32(0))
+	q.FilterFn(func(r Repo) bool {
+		return r.PollLast == nil || !now.Before(r.PollLast.Add(time.Duration(r.PollInterval)*time.Second))
+	})
+	repos, err := q.List()
+	if err != nil {
+		return fmt.Errorf("listing repositories to poll: %v", err)
+	}
+	for _, repo := range repos {
+		pollRepo(ctx, repo, now)
+	}
+	return nil
+}
+
+// pollRepo looks up the heads of the polled branches of the repository, and
+// creates builds for heads that differ from the commit of the latest build of
+// the branch. Likewise for the matching jobs of the repository, each compared
+// with its own latest build. The time of the poll and errors are stored in the
+// repository.
+func pollRepo(ctx context.Context, repo Repo, now time.Time) {
+	log := slog.With("repo", repo.Name)
+
+	settings := Settings{ID: 1}
+	if err := database.Get(ctx, &settings); err != nil {
+		log.Error("get settings for poll", "err", err)
+		return
+	}
+
+	var errmsgs []string
+	branches := repo.PollBranches
+	if len(branches) == 0 {
+		branches = []string{repo.DefaultBranch}
+	}
+	for _, branch := range branches {
+		head, err := pollHead(ctx, settings, repo, branch)
+		if err != nil {
+			errmsgs = append(errmsgs, fmt.Sprintf("%s: %v", branch, err))
+			continue
+		}
+		if need, err := pollNeedsBuild(ctx, repo.Name, "", branch, head); err != nil {
+			log.Error("checking whether polled branch needs build", "err", err, "branch", branch)
+		} else if need {
+			r, build, buildDir, gotoolchains, err := prepareBuild(ctx, repo.Name, branch, head, false, nil, buildOpts{})
+			if err != nil {
+				errmsgs = append(errmsgs, fmt.Sprintf("%s: creating build: %v", branch, err))
+			} else {
+				log.Info("starting build for new commit found by poll", "branch", branch, "commit", head, "buildid", build.ID)
+				go func() {
+					err := doBuild(context.Background(), r, build, buildDir, gotoolchains, false)
+					if err != nil {
+						log.Error("polled build", "err", err, "buildid", build.ID)
+					}
+				}()
+			}
+		}
+
+		// Each job has its own latest build, we only start builds for jobs that need one.
+		jr := repo
+		jr.Jobs = slices.DeleteFunc(slices.Clone(repo.Jobs), func(j RepoJob) bool {
+			need, err := pollNeedsBuild(ctx, repo.Name, j.Name, branch, head)
+			if err != nil {
+				log.Error("checking whether polled branch needs build of job", "err", err, "branch", branch, "job", j.Name)
+			}
+			return !need
+		})
+		startJobBuilds(ctx, jr, "branch", branch, branch, head, nil, buildOpts{})
+	}
+
+	err := database.Write(ctx, func(tx *bstore.Tx) error {
+		repo = Repo{Name: repo.Name}
+		if err := tx.Get(&repo); err != nil {
+			return err
+		}
+		repo.PollLast = &now
+		repo.PollError = strings.Join(errmsgs, "; ")
+		return tx.Update(&repo)
+	})
+	if err != nil {
+		log.Error("storing poll result", "err", err)
+		return
+	}
+	events <- EventRepo{repo}
+}
+
+// pollHead returns the commit of the head of branch at the origin of the
+// repository.
+func pollHead(ctx context.Context, settings Settings, repo Repo, branch string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	// Like the clone command, without a build directory.
+	env, runPrefix := buildEnvironment(settings, repo, branch)
+	env = slices.Concat([]string{
+		"DING_REPONAME=" + repo.Name,
+		"DING_BRANCH=" + branch,
+		"DING_CHECKOUTPATH=" + repo.CheckoutPath,
+	}, env)
+
+	var argv []string
+	switch repo.VCS {
+	case VCSGit:
+		argv = []string{"git", "ls-remote", repo.Origin, "refs/heads/" + branch}
+	case VCSMercurial:
+		argv = []string{"hg", "identify", "--id", "--rev", branch, repo.Origin}
+	case VCSCommand:
+		argv = []string{"sh", "-c", repo.PollCommand}
+	default:
+		return "", fmt.Errorf("unexpected vcs %q", repo.VCS)
+	}
+	argv = slices.Concat(runPrefix, argv)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = env
+	killProcessGroup(cmd)
+	buf, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", err
+	}
+
+	out := strings.TrimSpace(string(buf))
+	var head string
+	switch repo.VCS {
+	case VCSGit:
+		// The ref is a pattern for ls-remote, it also matches longer refs ending in it,
+		// like refs/heads/feature/refs/heads/main. Empty if the branch does not exist.
+		for _, line := range strings.Split(out, "\n") {
+			if h, ref, ok := strings.Cut(line, "\t"); ok && ref == "refs/heads/"+branch {
+				head = h
+				break
+			}
+		}
+	case VCSMercurial:
+		head = out
+	case VCSCommand:
+		l := strings.Split(out, "\n")
+		s, ok := strings.CutPrefix(l[len(l)-1], "commit:")
+		if !ok {
+			return "", errors.New(`output of poll command should end with "commit:" followed by the commit id/hash`)
+		}
+		head = strings.TrimSpace(s)
+	}
+	if head == "" {
+		return "", errors.New("branch not found")
+	}
+	return head, nil
+}
+
+// pollNeedsBuild returns whether the latest build of the branch, of job or the
+// build script of the repository if empty, is for another commit than head.
+// While a build without known commit is waiting or running, no build is needed.
+func pollNeedsBuild(ctx context.Context, repoName, job, branch, head string) (bool, error) {
+	q := bstore.QueryDB[Build](ctx, database).FilterNonzero(Build{RepoName: repoName, Branch: branch})
+	q.FilterEqual("Job", job)
+	q.FilterFn(func(b Build) bool { return (b.CommitHash != "" || b.Finish == nil) && !extraBuild(b) })
+	q.SortDesc("ID")
+	q.Limit(1)
+	b, err := q.Get()
+	if err == bstore.ErrAbsent {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	} else if b.CommitHash == "" {
+		return false, nil
+	}
+	// Mercurial identify prints a short hash, builds can have the full hash.
+	return !strings.HasPrefix(b.CommitHash, head) && !strings.HasPrefix(head, b.CommitHash), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	gitRepoDir := testGitRepo(t, "poll")
+	testGitCommit(t, gitRepoDir)
+
+	r := Repo{
+		Name:          "poll",
+		VCS:           VCSGit,
+		Origin:        gitRepoDir,
+		DefaultBranch: "main",
+		CheckoutPath:  "poll",
+		BuildScript:   "#!/usr/bin/env bash\necho building\n",
+	}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	save := func(interval int32, branches []string, command string) {
+		r.PollInterval = interval
+		r.PollBranches = branches
+		r.PollCommand = command
+		r = api.RepoSave(ctxbg, config.Password, r)
+	}
+	tneederr(t, "user:error", func() { save(10, nil, "") })
+	tneederr(t, "user:error", func() { save(-1, nil, "") })
+	tneederr(t, "user:error", func() { save(60, []string{""}, "") })
+	save(60, []string{"main", "missing"}, "")
+
+	now := time.Now()
+	poll := func(at time.Time, expBuilds int) []Build {
+		t.Helper()
+		err := runDuePolls(ctxbg, at)
+		tcheck(t, err, "run due polls")
+		builds := api.Builds(ctxbg, config.Password, r.Name)
+		tcompare(t, len(builds), expBuilds)
+		for _, b := range builds {
+			twaitBuild(t, b, StatusSuccess)
+		}
+		return builds
+	}
+
+	// First poll builds main, and reports the missing branch.
+	builds := poll(now, 1)
+	tcompare(t, builds[0].Branch, "main")
+	tcompare(t, builds[0].CommitHash, testRun(t, gitRepoDir, "git", "rev-parse", "HEAD"))
+	r = api.Repo(ctxbg, config.Password, r.Name)
+	tcompare(t, r.PollLast != nil, true)
+	tcompare(t, r.PollError, "missing: branch not found")
+
+	// Not due yet, and no change.
+	poll(now.Add(30*time.Second), 1)
+	poll(now.Add(60*time.Second), 1)
+
+	// New commit, found at next poll. Another branch with a name ending in the ref of
+	// the branch, listed first by ls-remote, is not mistaken for the branch.
+	testRun(t, gitRepoDir, "git", "branch", "feature/refs/heads/main")
+	testGitCommit(t, gitRepoDir)
+	poll(now.Add(90*time.Second), 1)
+	builds = poll(now.Add(120*time.Second), 2)
+	tcompare(t, builds[0].CommitHash, testRun(t, gitRepoDir, "git", "rev-parse", "HEAD"))
+
+	// A build of the commit through other means, e.g. the web interface, prevents a
+	// build by the poll.
+	save(60, nil, "")
+	testGitCommit(t, gitRepoDir)
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	poll(now.Add(180*time.Second), 3)
+	r = api.Repo(ctxbg, config.Password, r.Name)
+	tcompare(t, r.PollError, "")
+
+	// Jobs are checked on their own: a job without a build of the head is built, while
+	// the build script of the repository isn't built again.
+	r.Jobs = []RepoJob{{Name: "lint", BuildScript: "#!/usr/bin/env bash\necho lint\n"}}
+	save(60, nil, "")
+	builds = poll(now.Add(240*time.Second), 4)
+	tcompare(t, builds[0].Job, "lint")
+	tcompare(t, builds[0].CommitHash, testRun(t, gitRepoDir, "git", "rev-parse", "HEAD"))
+	poll(now.Add(300*time.Second), 4)
+	r.Jobs = nil
+
+	// Command, printing the commit like the clone command.
+	r.VCS = VCSCommand
+	r.Origin = "sh -c 'mkdir -p checkout/$DING_CHECKOUTPATH; echo commit:0123abcd'"
+	tneederr(t, "user:error", func() { save(60, nil, "") })
+	save(60, nil, "echo polling $DING_BRANCH; echo commit:0123abcd")
+	builds = poll(now.Add(360*time.Second), 5)
+	tcompare(t, builds[0].CommitHash, "0123abcd")
+	poll(now.Add(420*time.Second), 5)
+
+	save(60, nil, "echo no commit")
+	poll(now.Add(480*time.Second), 5)
+	r = api.Repo(ctxbg, config.Password, r.Name)
+	tcompare(t, r.PollError, `main: output of poll command should end with "commit:" followed by the commit id/hash`)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// jobIgnored returns why a push of a branch or tag (kind) with name should not
+// start a build of job j, due to its include/exclude patterns. It returns the
+// empty string if a build should be started. The patterns of the repository are
+// checked separately, with refIgnored.
+func jobIgnored(j RepoJob, kind, name string) string {
+	r := Repo{
+		IncludeBranches: j.IncludeBranches,
+		ExcludeBranches: j.ExcludeBranches,
+		IncludeTags:     j.IncludeTags,
+		ExcludeTags:     j.ExcludeTags,
+	}
+	return refIgnored(r, kind, name)
+}
+
+// startJobBuilds creates and starts builds for the jobs of repo whose patterns
+// match a push of a branch or tag (kind) with name, see Repo.Jobs. The created
+// builds are returned, errors are logged.
+func startJobBuilds(ctx context.Context, repo Repo, kind, name, branch, commit string, params []Param, opts buildOpts) []Build {
+	var builds []Build
+	for _, j := range repo.Jobs {
+		if reason := jobIgnored(j, kind, name); reason != "" {
+			slog.Debug("not building job", "repo", repo.Name, "job", j.Name, "reason", reason)
+			continue
+		}
+		opts.job = j.Name
+		jr, build, buildDir, gotoolchains, err := prepareBuild(ctx, repo.Name, branch, commit, false, params, opts)
+		if err != nil {
+			slog.Error("creating build for job", "err", err, "repo", repo.Name, "job", j.Name, "branch", branch, "commit", commit)
+			continue
+		}
+		go func() {
+			err := doBuild(context.Background(), jr, build, buildDir, gotoolchains, false)
+			if err != nil {
+				slog.Error("job build", "err", err, "buildid", build.ID)
+			}
+		}()
+		builds = append(builds, build)
+	}
+	return builds
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRepoJobs(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	r := Repo{
+		Name:          "jobs",
+		VCS:           VCSCommand,
+		Origin:        "sh -c 'mkdir -p checkout/$DING_CHECKOUTPATH; echo commit:0123abcd'",
+		DefaultBranch: "main",
+		CheckoutPath:  "jobs",
+		BuildScript:   "#!/usr/bin/env bash\ntest -z \"$DING_JOB\"\n",
+	}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	save := func(jobs ...RepoJob) Repo {
+		nr := r
+		nr.Jobs = jobs
+		return api.RepoSave(ctxbg, config.Password, nr)
+	}
+	const script = "#!/usr/bin/env bash\n"
+	tneederr(t, "user:error", func() { save(RepoJob{Name: "bad name", BuildScript: script}) })
+	tneederr(t, "user:error", func() { save(RepoJob{Name: "lint", BuildScript: script}, RepoJob{Name: "lint", BuildScript: script}) })
+	tneederr(t, "user:error", func() { save(RepoJob{Name: "lint"}) })
+	tneederr(t, "user:error", func() { save(RepoJob{Name: "lint", BuildScript: script, IncludeBranches: []string{"["}}) })
+	tneederr(t, "user:error", func() { save(RepoJob{Name: "lint", BuildScript: script, ExcludePaths: []string{"/"}}) })
+	r = save(
+		RepoJob{Name: "lint", BuildScript: script + "test \"$DING_JOB\" = lint\n", ExcludeBranches: []string{"wip/*"}},
+		RepoJob{Name: "release", BuildScript: script + "test \"$DING_TAG\" = v1.0.0\n", IncludeBranches: []string{"release/*"}, IncludeTags: []string{"v*"}},
+	)
+
+	jobs := func(builds []Build) (l []string) {
+		for _, b := range builds {
+			l = append(l, b.Job)
+		}
+		slices.Sort(l)
+		return
+	}
+
+	// A push of a branch only builds the matching jobs.
+	builds := startJobBuilds(ctxbg, r, "branch", "main", "main", "", nil, buildOpts{})
+	tcompare(t, jobs(builds), []string{"lint"})
+	tcompare(t, builds[0].BuildScript, r.Jobs[0].BuildScript)
+	twaitBuild(t, builds[0], StatusSuccess)
+	tcompare(t, len(startJobBuilds(ctxbg, r, "branch", "wip/x", "wip/x", "", nil, buildOpts{})), 0)
+
+	builds = startJobBuilds(ctxbg, r, "tag", "v1.0.0", tagBranch("v1.0.0"), "", nil, buildOpts{})
+	tcompare(t, jobs(builds), []string{"lint", "release"})
+	for _, b := range builds {
+		twaitBuild(t, b, StatusSuccess)
+	}
+
+	tneederr(t, "user:notFound", func() { api.BuildCreateJob(ctxbg, config.Password, "bogus", "lint", "main", "", false, nil) })
+	tneederr(t, "user:error", func() { api.BuildCreateJob(ctxbg, config.Password, r.Name, "bogus", "main", "", false, nil) })
+
+	// The build script of the repository and each job have their own latest build.
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	for _, rb := range api.RepoBuilds(ctxbg, config.Password) {
+		if rb.Repo.Name != r.Name {
+			continue
+		}
+		main := slices.DeleteFunc(rb.Builds, func(b Build) bool { return b.Branch != "main" })
+		tcompare(t, jobs(main), []string{"", "lint"})
+	}
+}
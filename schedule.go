@@ -0,0 +1,247 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// cronSchedule is a parsed crontab time specification. Each field is a bitmap of
+// the matching values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// Whether day of month and day of week start with "*", e.g. "*" or "*/2". If both
+	// are restricted, a day matches if either matches, like cron.
+	domAny, dowAny bool
+}
+
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDays   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCron parses a time specification in crontab format.
+func parseCron(s string) (cs cronSchedule, err error) {
+	s = strings.TrimSpace(s)
+	if v, ok := cronShorthands[strings.ToLower(s)]; ok {
+		s = v
+	}
+	t := strings.Fields(s)
+	if len(t) != 5 {
+		return cs, fmt.Errorf("need 5 fields (minute, hour, day of month, month, day of week), or a shorthand like @daily")
+	}
+	if cs.minute, err = parseCronField(t[0], 0, 59, 0, nil); err != nil {
+		return cs, fmt.Errorf("minute: %v", err)
+	}
+	if cs.hour, err = parseCronField(t[1], 0, 23, 0, nil); err != nil {
+		return cs, fmt.Errorf("hour: %v", err)
+	}
+	if cs.dom, err = parseCronField(t[2], 1, 31, 0, nil); err != nil {
+		return cs, fmt.Errorf("day of month: %v", err)
+	}
+	if cs.month, err = parseCronField(t[3], 1, 12, 1, cronMonths); err != nil {
+		return cs, fmt.Errorf("month: %v", err)
+	}
+	// Day of week 7 is Sunday too.
+	if cs.dow, err = parseCronField(t[4], 0, 7, 0, cronDays); err != nil {
+		return cs, fmt.Errorf("day of week: %v", err)
+	}
+	if cs.dow&(1<<7) != 0 {
+		cs.dow |= 1 << 0
+	}
+	cs.domAny = strings.HasPrefix(t[2], "*")
+	cs.dowAny = strings.HasPrefix(t[4], "*")
+	if cs.next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return cs, fmt.Errorf("schedule never matches")
+	}
+	return cs, nil
+}
+
+// parseCronField parses a comma-separated list of "*", values and ranges, each
+// with an optional "/step". Names, if any, start at value nameOffset.
+func parseCronField(s string, min, max, nameOffset int, names []string) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return nameOffset + i, nil
+			}
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("bad value %q", s)
+		}
+		if v < min || v > max {
+			return 0, fmt.Errorf("value %d out of range %d-%d", v, min, max)
+		}
+		return v, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rs, stepStr, haveStep := strings.Cut(part, "/")
+		step := 1
+		if haveStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepStr)
+			}
+		}
+
+		var lo, hi int
+		if rs == "*" {
+			lo, hi = min, max
+		} else if los, his, ok := strings.Cut(rs, "-"); ok {
+			var err error
+			if lo, err = value(los); err != nil {
+				return 0, err
+			}
+			if hi, err = value(his); err != nil {
+				return 0, err
+			}
+			// Sunday ending a range of days of week is 7, e.g. "mon-sun".
+			if max == 7 && hi == 0 && lo > hi {
+				hi = 7
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("bad range %q", rs)
+			}
+		} else {
+			var err error
+			if lo, err = value(rs); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if haveStep {
+				hi = max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (cs cronSchedule) dayMatch(t time.Time) bool {
+	dom := cs.dom&(1<<t.Day()) != 0
+	dow := cs.dow&(1<<int(t.Weekday())) != 0
+	if !cs.domAny && !cs.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first matching time after t, in the location of t. The zero
+// time is returned if nothing matches within 5 years, e.g. for February 30.
+func (cs cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if cs.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		} else if !cs.dayMatch(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		} else if cs.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		} else if cs.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// runSchedules creates builds for schedules when they are due. It wakes up at the
+// start of each minute. It never returns.
+func runSchedules() {
+	for {
+		now := time.Now()
+		if err := runDueSchedules(context.Background(), now); err != nil {
+			slog.Error("running schedules", "err", err)
+		}
+		time.Sleep(time.Until(now.Truncate(time.Minute).Add(time.Minute)))
+	}
+}
+
+// runDueSchedules creates builds for schedules with a next time at or before now,
+// and sets their next time. Schedules that were due multiple times, e.g. while
+// ding wasn't running, only create a single build.
+func runDueSchedules(ctx context.Context, now time.Time) error {
+	schedules, err := bstore.QueryDB[Schedule](ctx, database).FilterLessEqual("Next", now).List()
+	if err != nil {
+		return fmt.Errorf("listing due schedules: %v", err)
+	}
+	for _, s := range schedules {
+		runSchedule(ctx, s, now)
+	}
+	return nil
+}
+
+func runSchedule(ctx context.Context, s Schedule, now time.Time) {
+	log := slog.With("repo", s.RepoName, "schedule", s.ID)
+
+	repo := Repo{Name: s.RepoName}
+	err := database.Get(ctx, &repo)
+	if err != nil {
+		log.Error("get repo for schedule", "err", err)
+		return
+	}
+
+	var buildID int32
+	branch := cmp.Or(s.Branch, repo.DefaultBranch)
+	repo, build, buildDir, gotoolchains, err := prepareBuild(ctx, repo.Name, branch, "", s.LowPrio, nil, buildOpts{})
+	if err != nil {
+		log.Error("preparing scheduled build", "err", err)
+	} else {
+		buildID = build.ID
+		log.Info("starting scheduled build", "branch", branch, "buildid", build.ID)
+		go func() {
+			err := doBuild(context.Background(), repo, build, buildDir, gotoolchains, false)
+			if err != nil {
+				log.Error("scheduled build", "err", err, "buildid", build.ID)
+			}
+		}()
+	}
+
+	// The next time is set even if we could not create a build. We don't want to retry
+	// every minute.
+	err = database.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Get(&s); err != nil {
+			return err
+		}
+		cs, err := parseCron(s.Cron)
+		if err != nil {
+			return fmt.Errorf("parsing cron: %v", err)
+		}
+		s.Next = cs.next(now)
+		if buildID != 0 {
+			s.LastBuildID = buildID
+		}
+		return tx.Update(&s)
+	})
+	if err != nil {
+		log.Error("updating schedule after run", "err", err)
+		return
+	}
+	events <- EventSchedule{s}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	next := func(spec string, now, exp string) {
+		t.Helper()
+		cs, err := parseCron(spec)
+		tcheck(t, err, "parse cron")
+		tm, err := time.Parse("2006-01-02 15:04", now)
+		tcheck(t, err, "parse time")
+		tcompare(t, cs.next(tm).Format("2006-01-02 15:04"), exp)
+	}
+
+	next("* * * * *", "2024-01-01 10:00", "2024-01-01 10:01")
+	next("@hourly", "2024-01-01 10:00", "2024-01-01 11:00")
+	next("@daily", "2024-01-01 10:00", "2024-01-02 00:00")
+	next("0 3 * * *", "2024-01-01 03:00", "2024-01-02 03:00")
+	next("0 3 * * *", "2024-01-01 02:59", "2024-01-01 03:00")
+	next("*/15 * * * *", "2024-01-01 10:16", "2024-01-01 10:30")
+	next("5-10/2 * * * *", "2024-01-01 10:07", "2024-01-01 10:09")
+	next("0 0 * * mon", "2024-01-01 00:00", "2024-01-08 00:00") // 2024-01-01 is a Monday.
+	next("0 0 * * 7", "2024-01-01 00:00", "2024-01-07 00:00")
+	next("0 0 1 jan-mar *", "2024-03-05 00:00", "2025-01-01 00:00")
+	next("0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00")
+	next("0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00")
+
+	// Day of month and day of week both restricted: either matches.
+	next("0 0 15 * fri", "2024-01-01 00:00", "2024-01-05 00:00")
+	next("0 0 15 * fri", "2024-01-13 00:00", "2024-01-15 00:00")
+
+	// Day of month with a step isn't restricted: both must match.
+	next("0 0 */2 * fri", "2024-01-01 00:00", "2024-01-05 00:00")
+	next("0 0 */2 * fri", "2024-01-05 00:00", "2024-01-19 00:00")
+
+	// Ranges of days of week can end at Sunday.
+	next("0 0 * * mon-sun", "2024-01-01 00:00", "2024-01-02 00:00")
+	next("0 0 * * sat-sun", "2024-01-06 00:00", "2024-01-07 00:00")
+	next("0 0 * * fri-7", "2024-01-07 00:00", "2024-01-12 00:00")
+
+	bad := func(spec string) {
+		t.Helper()
+		_, err := parseCron(spec)
+		if err == nil {
+			t.Fatalf("parse cron %q: expected error", spec)
+		}
+	}
+	bad("")
+	bad("* * * *")
+	bad("60 * * * *")
+	bad("* 24 * * *")
+	bad("* * 0 * *")
+	bad("* * * 13 *")
+	bad("*/0 * * * *")
+	bad("5-1 * * * *")
+	bad("x * * * *")
+	bad("@often")
+	bad("0 0 30 2 *")
+}
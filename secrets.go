@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// secretKey is the key for encrypting secrets, stored in the data directory. It is
+// created when first needed.
+var secretKey struct {
+	sync.Mutex
+	key []byte
+}
+
+func loadSecretKey() ([]byte, error) {
+	secretKey.Lock()
+	defer secretKey.Unlock()
+	if secretKey.key != nil {
+		return secretKey.key, nil
+	}
+
+	p := filepath.Join(config.DataDir, "secrets.key")
+	key, err := os.ReadFile(p)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, 32)
+		cryptorand.Read(key)
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("creating secrets key file: %v", err)
+		}
+		_, err = f.Write(key)
+		if xerr := f.Close(); err == nil {
+			err = xerr
+		}
+		if err != nil {
+			os.Remove(p)
+			return nil, fmt.Errorf("writing secrets key file: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("reading secrets key file: %v", err)
+	} else if len(key) != 32 {
+		return nil, fmt.Errorf("secrets key file %s must be 32 bytes, got %d", p, len(key))
+	}
+	secretKey.key = key
+	return key, nil
+}
+
+func secretAEAD() (cipher.AEAD, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// The repo and secret name are authenticated along with the value, so an
+// encrypted value cannot be used for another secret.
+func secretAdditionalData(repoName, name string) []byte {
+	return []byte(repoName + "\x00" + name)
+}
+
+// encryptSecret returns the nonce followed by the encrypted value.
+func encryptSecret(repoName, name, value string) ([]byte, error) {
+	aead, err := secretAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	cryptorand.Read(nonce)
+	return aead.Seal(nonce, nonce, []byte(value), secretAdditionalData(repoName, name)), nil
+}
+
+func decryptSecret(s Secret) (string, error) {
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(s.Encrypted) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted secret too short")
+	}
+	nonce := s.Encrypted[:aead.NonceSize()]
+	buf, err := aead.Open(nil, nonce, s.Encrypted[aead.NonceSize():], secretAdditionalData(s.RepoName, s.Name))
+	if err != nil {
+		return "", fmt.Errorf("decrypting secret %q: %v", s.Name, err)
+	}
+	return string(buf), nil
+}
+
+// Minimum length of text to mask in the output of builds. Masking shorter
+// values would garble the output. Shorter values are not accepted for secrets.
+const secretMaskMinLength = 4
+
+// Names of environment variables that secrets cannot override. They are set by
+// ding, or change how the commands of the build are run.
+var secretReservedNames = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"PWD",
+	"TMPDIR",
+	"IFS",
+	"ENV",
+	"BASH_ENV",
+	"GOTOOLCHAIN",
+	"GOROOT",
+}
+
+// secretMasker replaces the values of secrets in build output with "***". Output
+// is handled per line, so multi-line values, e.g. of keys in files, are masked
+// line by line. A nil secretMasker leaves output as is.
+type secretMasker struct {
+	values   []string // Lines of values, longest first.
+	replacer *strings.Replacer
+}
+
+// newSecretMasker returns a masker for values, or nil if no value needs masking.
+func newSecretMasker(values []string) *secretMasker {
+	var l []string
+	for _, v := range values {
+		for _, line := range strings.Split(v, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) >= secretMaskMinLength && !slices.Contains(l, line) {
+				l = append(l, line)
+			}
+		}
+	}
+	if len(l) == 0 {
+		return nil
+	}
+	// Longest first, so a value that contains another value is masked as a whole.
+	slices.SortFunc(l, func(a, b string) int { return len(b) - len(a) })
+	var oldnew []string
+	for _, s := range l {
+		oldnew = append(oldnew, s, "***")
+	}
+	return &secretMasker{l, strings.NewReplacer(oldnew...)}
+}
+
+// Replace returns s with the values of secrets masked.
+func (m *secretMasker) Replace(s string) string {
+	if m == nil {
+		return s
+	}
+	return m.replacer.Replace(s)
+}
+
+// maskChunk masks text, consisting of the rest returned by the previous call
+// followed by the next chunk of output. Chunks can end halfway a line, so a value
+// can be split over two chunks. The end of text that could be the start of a
+// value is held back and returned as rest, to be passed again with the next
+// chunk. Values don't span lines, so nothing is held back if text ends with a
+// newline. For the last chunk, final must be set, and rest is empty.
+func (m *secretMasker) maskChunk(text string, final bool) (masked, rest string) {
+	if m == nil || final || strings.HasSuffix(text, "\n") {
+		return m.Replace(text), ""
+	}
+	cut := max(len(text)-(len(m.values[0])-1), strings.LastIndexByte(text, '\n')+1)
+	// Occurrences of values that start before cut and end after it are held back
+	// as a whole. Moving cut back can create a new overlap with a longer value.
+	for changed := true; changed; {
+		changed = false
+		for _, v := range m.values {
+			from := max(0, cut-len(v)+1)
+			if i := strings.Index(text[from:], v); i >= 0 && from+i < cut {
+				cut = from + i
+				changed = true
+			}
+		}
+	}
+	return m.Replace(text[:cut]), text[cut:]
+}
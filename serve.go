@@ -250,9 +250,31 @@ func doMsgChown(msg *msgChown, enc *gob.Encoder) error {
 	if err == nil {
 		err = chown(buildDir + "/checkout")
 	}
+	// Copies of the checkout for build steps that run concurrently.
+	if entries, xerr := os.ReadDir(buildDir); err == nil && xerr == nil {
+		for _, e := range entries {
+			if e.IsDir() && strings.HasPrefix(e.Name(), "checkout-") {
+				if err = chown(buildDir + "/" + e.Name()); err != nil {
+					break
+				}
+			}
+		}
+	}
 	if err == nil {
 		err = chown(buildDir + "/dl")
 	}
+	// Files with secrets. The directory itself stays owned by ding, so it can remove
+	// the files after the build.
+	if entries, xerr := os.ReadDir(buildDir + "/secrets"); err == nil && xerr == nil {
+		for _, e := range entries {
+			if !e.Type().IsRegular() {
+				continue
+			}
+			if err = os.Lchown(buildDir+"/secrets/"+e.Name(), int(msg.UID), int(config.IsolateBuilds.DingGID)); err != nil {
+				break
+			}
+		}
+	}
 	return err
 }
 
@@ -332,7 +354,9 @@ func doMsgCancelCommand(msg *msgCancelCommand, enc *gob.Encoder) error {
 	return nil
 }
 
-func bwrapCmd(nonet bool, homeDir, buildDir, checkoutPath, toolchainDir string) []string {
+// bwrapCmd returns the bwrap command for running in workPath, a path relative to
+// buildDir, e.g. "checkout/<checkoutpath>".
+func bwrapCmd(nonet bool, homeDir, buildDir, workPath, toolchainDir string) []string {
 	argv := []string{"bwrap", "--die-with-parent"}
 	if nonet {
 		argv = append(argv, "--unshare-all")
@@ -356,16 +380,16 @@ func bwrapCmd(nonet bool, homeDir, buildDir, checkoutPath, toolchainDir string)
 	if toolchainDir != "" {
 		argv = append(argv, "--bind", toolchainDir, "/home/ding/toolchain")
 	}
-	argv = append(argv, "--chdir", "/home/ding/build/checkout/"+checkoutPath)
+	argv = append(argv, "--chdir", "/home/ding/build/"+workPath)
 	return argv
 }
 
 func doMsgBuild(msg *msgBuild, enc *gob.Encoder, unixconn *net.UnixConn) error {
 	buildCommand := buildIDCommandRegister(msg.BuildID)
-	needCancel := true
+	needRelease := true
 	defer func() {
-		if needCancel {
-			buildIDCommandCancel(msg.BuildID)
+		if needRelease {
+			buildIDCommandRelease(msg.BuildID, buildCommand)
 		}
 	}()
 
@@ -374,50 +398,42 @@ func doMsgBuild(msg *msgBuild, enc *gob.Encoder, unixconn *net.UnixConn) error {
 	}
 
 	buildDir := fmt.Sprintf("%s/build/%s/%d", dingDataDir, msg.RepoName, msg.BuildID)
-	workDir := fmt.Sprintf("%s/checkout/%s", buildDir, msg.CheckoutPath)
+	if msg.Checkout != "checkout" && (!strings.HasPrefix(msg.Checkout, "checkout-") || strings.Contains(msg.Checkout, "/")) {
+		return errBadParams
+	}
+	workPath := msg.Checkout + "/" + msg.CheckoutPath
+	workDir := buildDir + "/" + workPath
 	if path.Clean(buildDir) != buildDir || path.Clean(workDir) != workDir {
 		return errBadParams
 	}
 
-	var buildEnvs [][]string
-	var zt GoToolchains
-	if msg.GoToolchains == zt {
-		buildEnvs = append(buildEnvs, msg.Env)
-	} else {
-		addBuildEnv := func(goversion, goname string) {
-			if goversion == "" {
-				return
-			}
-			slog.Debug("will be building for go toolchain", "repo", msg.RepoName, "goname", goname, "goversion", goversion)
-			env := append([]string{}, msg.Env...)
-			gotoolchainpath := msg.ToolchainDir
-			if msg.Bubblewrap {
-				gotoolchainpath = "/home/ding/toolchain"
-			}
-			gotoolchainpath = path.Join(gotoolchainpath, goname, "bin")
-			var have bool
-			for i, e := range env {
-				if strings.HasPrefix(e, "PATH=") {
-					env[i] = "PATH=" + gotoolchainpath + ":" + strings.TrimPrefix(e, "PATH=")
-					have = true
-					break
-				}
-			}
-			if !have {
-				env = append(env, "PATH="+gotoolchainpath+":/usr/bin:/bin:/usr/local/bin")
-			}
-			env = append(env, "GOTOOLCHAIN="+goversion)
-			env = append(env, "DING_GOTOOLCHAIN="+goname)
-			if msg.NewGoToolchain {
-				env = append(env, "DING_NEWGOTOOLCHAIN=yes")
+	env := msg.Env
+	if msg.Goname != "" {
+		if msg.Goname != "go" && msg.Goname != "goprev" && msg.Goname != "gonext" || !validGoversion(msg.Goversion) {
+			return errBadParams
+		}
+		slog.Debug("building for go toolchain", "repo", msg.RepoName, "goname", msg.Goname, "goversion", msg.Goversion)
+		env = append([]string{}, msg.Env...)
+		gotoolchainpath := msg.ToolchainDir
+		if msg.Bubblewrap {
+			gotoolchainpath = "/home/ding/toolchain"
+		}
+		gotoolchainpath = path.Join(gotoolchainpath, msg.Goname, "bin")
+		var have bool
+		for i, e := range env {
+			if strings.HasPrefix(e, "PATH=") {
+				env[i] = "PATH=" + gotoolchainpath + ":" + strings.TrimPrefix(e, "PATH=")
+				have = true
+				break
 			}
-			buildEnvs = append(buildEnvs, env)
 		}
-		addBuildEnv(msg.GoToolchains.Go, "go")
-		addBuildEnv(msg.GoToolchains.GoPrev, "goprev")
-		addBuildEnv(msg.GoToolchains.GoNext, "gonext")
-		if len(buildEnvs) == 0 {
-			return fmt.Errorf("internal error: no go toolchain build envs")
+		if !have {
+			env = append(env, "PATH="+gotoolchainpath+":/usr/bin:/bin:/usr/local/bin")
+		}
+		env = append(env, "GOTOOLCHAIN="+msg.Goversion)
+		env = append(env, "DING_GOTOOLCHAIN="+msg.Goname)
+		if msg.NewGoToolchain {
+			env = append(env, "DING_NEWGOTOOLCHAIN=yes")
 		}
 	}
 
@@ -449,58 +465,79 @@ func doMsgBuild(msg *msgBuild, enc *gob.Encoder, unixconn *net.UnixConn) error {
 	outr.Close()
 	errr.Close()
 	statusr.Close()
-	needCancel = false
+	needRelease = false
 
 	argv := []string{}
 	envBuildDir := buildDir
 	if msg.Bubblewrap {
 		envBuildDir = "/home/ding/build"
-		argv = bwrapCmd(msg.BubblewrapNoNet, msg.HomeDir, buildDir, msg.CheckoutPath, msg.ToolchainDir)
+		argv = bwrapCmd(msg.BubblewrapNoNet, msg.HomeDir, buildDir, workPath, msg.ToolchainDir)
 	}
 	argv = append(argv, msg.RunPrefix...)
 	argv = append(argv, envBuildDir+"/scripts/build.sh")
 
-	// todo: we are now running each build command in the build step, with one big output. should split them up and show their results separately too. including their own test coverage.
-
 	go func() {
 		defer outw.Close()
 		defer errw.Close()
 		defer statusw.Close()
-		defer buildIDCommandCancel(msg.BuildID)
-
-		var err error
-		for _, env := range buildEnvs {
-			cmd := exec.CommandContext(buildCommand.ctx, argv[0], argv[1:]...)
-			cmd.Dir = workDir
-			cmd.Env = env
-			cmd.Stdout = outw
-			cmd.Stderr = errw
-			uidgid := ""
-			if config.IsolateBuilds.Enabled {
-				uidgid = fmt.Sprintf("%d/%d", msg.UID, config.IsolateBuilds.DingGID)
-				cmd.SysProcAttr = &syscall.SysProcAttr{
-					Credential: &syscall.Credential{
-						Uid:    msg.UID,
-						Gid:    config.IsolateBuilds.DingGID,
-						Groups: []uint32{},
-					},
-				}
+		defer buildIDCommandRelease(msg.BuildID, buildCommand)
+
+		cmd := exec.CommandContext(buildCommand.ctx, argv[0], argv[1:]...)
+		cmd.Dir = workDir
+		// Secrets are added separately, so they don't end up in the debug log below.
+		cmd.Env = append(append([]string{}, env...), msg.SecretEnv...)
+		cmd.Stdout = outw
+		cmd.Stderr = errw
+		uidgid := ""
+		if config.IsolateBuilds.Enabled {
+			uidgid = fmt.Sprintf("%d/%d", msg.UID, config.IsolateBuilds.DingGID)
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Credential: &syscall.Credential{
+					Uid:    msg.UID,
+					Gid:    config.IsolateBuilds.DingGID,
+					Groups: []uint32{},
+				},
 			}
+		}
+		killProcessGroup(cmd)
 
-			slog.Debug("running build command", "repo", msg.RepoName, "buildid", msg.BuildID, "builddir", buildDir, "workdir", workDir, "cmd", argv, "uidgid", uidgid, "env", env)
+		var status msgBuildStatus
+		limiter, err := limitCommand(cmd, msg.BuildID, cgroupStepName(msg.Step), msg.Limits)
+		if err != nil {
+			slog.Error("applying resource limits", "err", err)
+			status.Error = fmt.Sprintf("applying resource limits: %v", err)
+		} else {
+			slog.Debug("running build command", "repo", msg.RepoName, "buildid", msg.BuildID, "builddir", buildDir, "workdir", workDir, "cmd", cmd.Args, "uidgid", uidgid, "env", env)
 
-			if err = cmd.Start(); err != nil {
+			err := cmd.Start()
+			if err != nil {
 				slog.Error("starting command", "err", err)
-				break
-			}
-			if err = cmd.Wait(); err != nil {
+			} else if err = cmd.Wait(); err != nil {
 				slog.Error("command result", "err", err)
-				break
 			}
+			status.Error = errstr(err)
+			status.PeakMemory, status.CPUNsec = limiter.finish(cmd.ProcessState)
 		}
-		err = gob.NewEncoder(statusw).Encode(errstr(err))
+		err = gob.NewEncoder(statusw).Encode(status)
 		xcheckf(err, "writing status to http-serve")
 	}()
 
 	return nil
 }
+
+// cgroupStepName returns the name for the cgroup of a build step, e.g.
+// "build-goprev-linux" for step "build:goprev:linux". Steps of a build can run
+// concurrently, so each needs its own cgroup. The step name comes from the
+// unprivileged process, other characters than letters, digits, underscore and dash
+// are replaced.
+func cgroupStepName(step string) string {
+	if step == "" {
+		return "build"
+	}
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' {
+			return c
+		}
+		return '-'
+	}, step)
+}
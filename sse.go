@@ -15,6 +15,9 @@ import (
 // - `build`, build was updated or created
 // - `removeBuild`, build was removed
 // - `output`, new lines of output from a command for an active build
+// - `queue`, the build queue changed, e.g. a build was added or started
+// - `schedule`, schedule was updated or created
+// - `removeSchedule`, schedule was removed
 //
 // These types are described below, with an _event_-prefix. E.g. type _EventRepo_ describes the `repo` event.
 type SSE struct {
@@ -22,7 +25,7 @@ type SSE struct {
 
 // ExampleSSE is a no-op.
 // This function only serves to include documentation for the server-sent event types.
-func (SSE) ExampleSSE() (repo EventRepo, removeRepo EventRemoveRepo, build EventBuild, removeBuild EventRemoveBuild, output EventOutput) {
+func (SSE) ExampleSSE() (repo EventRepo, removeRepo EventRemoveRepo, build EventBuild, removeBuild EventRemoveBuild, output EventOutput, queue EventQueue, schedule EventSchedule, removeSchedule EventRemoveSchedule) {
 	return
 }
 
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// goTestEvent is a line of "go test -json" output, see "go doc test2json".
+type goTestEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64
+	Output      string
+	ImportPath  string // For actions "build-output" and "build-fail".
+	FailedBuild string // For action "fail" of a package that failed to build.
+}
+
+// Maximum size of the output kept for a failed test or package.
+const maxTestOutput = 16 * 1024
+
+// testResults gathers the results of tests from "go test -json" events and JUnit
+// XML reports.
+type testResults struct {
+	packages    []TestPackage
+	packageIdx  map[string]int    // Index in packages.
+	testIdx     map[[2]string]int // Package and test name to index in Tests of package.
+	buildOutput map[string]string // By import path.
+
+	// Applied to output and failure messages, which can come from files the build
+	// script wrote without masking.
+	mask *secretMasker
+}
+
+func newTestResults(mask *secretMasker) *testResults {
+	return &testResults{packageIdx: map[string]int{}, testIdx: map[[2]string]int{}, buildOutput: map[string]string{}, mask: mask}
+}
+
+// appendTestOutput appends s to output, truncating at maxTestOutput.
+func appendTestOutput(output, s string) string {
+	if len(output) >= maxTestOutput {
+		return output
+	}
+	output += s
+	if len(output) > maxTestOutput {
+		output = output[:maxTestOutput] + "\n...\n"
+	}
+	return output
+}
+
+func (g *testResults) add(ev goTestEvent) {
+	ev.Output = g.mask.Replace(ev.Output)
+	switch ev.Action {
+	case "build-output":
+		g.buildOutput[ev.ImportPath] = appendTestOutput(g.buildOutput[ev.ImportPath], ev.Output)
+		return
+	}
+	if ev.Package == "" {
+		return
+	}
+
+	pi, ok := g.packageIdx[ev.Package]
+	if !ok {
+		pi = len(g.packages)
+		g.packageIdx[ev.Package] = pi
+		g.packages = append(g.packages, TestPackage{Package: ev.Package})
+	}
+	p := &g.packages[pi]
+
+	if ev.Test == "" {
+		switch ev.Action {
+		case "output":
+			p.Output = appendTestOutput(p.Output, ev.Output)
+		case "pass", "fail", "skip":
+			p.Status = TestStatus(ev.Action)
+			p.Elapsed = ev.Elapsed
+			if ev.FailedBuild != "" {
+				p.Output = appendTestOutput(p.Output, g.buildOutput[ev.FailedBuild])
+			}
+		}
+		return
+	}
+
+	key := [2]string{ev.Package, ev.Test}
+	ti, ok := g.testIdx[key]
+	if !ok {
+		ti = len(p.Tests)
+		g.testIdx[key] = ti
+		p.Tests = append(p.Tests, Test{Name: ev.Test})
+	}
+	t := &p.Tests[ti]
+	switch ev.Action {
+	case "output":
+		t.Output = appendTestOutput(t.Output, ev.Output)
+	case "pass", "fail", "skip":
+		t.Status = TestStatus(ev.Action)
+		t.Elapsed = ev.Elapsed
+	}
+}
+
+// results returns the gathered results. Tests and packages without final status
+// are marked as failed. Output is only kept for failures.
+func (g *testResults) results() []TestPackage {
+	for i := range g.packages {
+		p := &g.packages[i]
+		for j := range p.Tests {
+			t := &p.Tests[j]
+			if t.Status == "" {
+				t.Status = TestFail
+			}
+			if t.Status != TestFail {
+				t.Output = ""
+			}
+		}
+		if p.Status == "" {
+			p.Status = TestFail
+		}
+		if p.Status != TestFail {
+			p.Output = ""
+		}
+	}
+	return g.packages
+}
+
+// addLine adds line if it is a test event, and ignores it otherwise.
+func (g *testResults) addLine(line string) {
+	if !strings.HasPrefix(line, `{"`) {
+		return
+	}
+	var ev goTestEvent
+	if json.Unmarshal([]byte(line), &ev) == nil && ev.Action != "" {
+		g.add(ev)
+	}
+}
+
+// addGoTestFile reads "go test -json" output from file name in root.
+func (g *testResults) addGoTestFile(root *os.Root, name string) error {
+	f, err := root.Open(name)
+	if err != nil {
+		return fmt.Errorf("bad file in \"go-test-json:\"-line: %v", err)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadString('\n')
+		g.addLine(line)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading go test json file %s: %v", name, err)
+		}
+	}
+}
+
+// parseTests returns the test results from r, the stdout of a build step. Lines
+// of "go test -json" written directly to stdout are detected automatically. Lines
+// "go-test-json: file" and "junit: file" read "go test -json" output and JUnit XML
+// reports from a file in dldir, the $DING_DOWNLOADDIR of the build. Values of
+// secrets in test output are masked with mask, which can be nil.
+func parseTests(dldir string, r io.Reader, mask *secretMasker) ([]TestPackage, error) {
+	g := newTestResults(mask)
+	var files [][2]string // Instruction and file relative to dldir.
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if t := strings.Fields(line); len(t) > 0 && (t[0] == "go-test-json:" || t[0] == "junit:") {
+			if len(t) != 2 {
+				return nil, fmt.Errorf("invalid %q-line, should have 1 parameter: %s", t[0], strings.TrimSpace(line))
+			}
+			p := path.Clean(t[1])
+			if !path.IsAbs(p) {
+				p = path.Join(dldir, p)
+			}
+			if !strings.HasPrefix(p, dldir+"/") {
+				return nil, fmt.Errorf("file in %q-line must be within $DING_DOWNLOADDIR", t[0])
+			}
+			files = append(files, [2]string{t[0], strings.TrimPrefix(p, dldir+"/")})
+		} else {
+			g.addLine(line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading build output: %v", err)
+		}
+	}
+
+	if len(files) > 0 {
+		// The files are written by the build script, don't follow symlinks out of the
+		// download directory.
+		root, err := os.OpenRoot(dldir)
+		if err != nil {
+			return nil, fmt.Errorf("opening download directory: %v", err)
+		}
+		defer root.Close()
+		for _, f := range files {
+			if f[0] == "junit:" {
+				err = g.addJUnitFile(root, f[1])
+			} else {
+				err = g.addGoTestFile(root, f[1])
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(g.packages) == 0 {
+		return nil, nil
+	}
+	return g.results(), nil
+}
+
+// parseTestsFile is like parseTests, reading the output from file p.
+func parseTestsFile(dldir, p string, mask *secretMasker) ([]TestPackage, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("opening build output: %v", err)
+	}
+	defer f.Close()
+	return parseTests(dldir, f, mask)
+}
+
+// failingTests returns the failed tests of the build steps of b, as package
+// followed by test name. Parent tests of failed subtests are not included. Failed
+// packages without failed tests, e.g. due to a build error, are listed by package
+// only.
+func failingTests(b Build) []string {
+	var l []string
+	seen := map[string]bool{}
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			l = append(l, s)
+		}
+	}
+	for _, st := range b.Steps {
+		for _, p := range st.Tests {
+			if p.Status != TestFail {
+				continue
+			}
+			var n int
+			for _, t := range p.Tests {
+				if t.Status != TestFail {
+					continue
+				}
+				n++
+				var parent bool
+				for _, t2 := range p.Tests {
+					if t2.Status == TestFail && strings.HasPrefix(t2.Name, t.Name+"/") {
+						parent = true
+						break
+					}
+				}
+				if !parent {
+					add(p.Package + " " + t.Name)
+				}
+			}
+			if n == 0 {
+				add(p.Package)
+			}
+		}
+	}
+	return l
+}
+
+// testCounts returns the number of passed, failed and skipped tests of the steps.
+func testCounts(steps []Step) (passed, failed, skipped int32) {
+	for _, st := range steps {
+		for _, p := range st.Tests {
+			for _, t := range p.Tests {
+				switch t.Status {
+				case TestPass:
+					passed++
+				case TestFail:
+					failed++
+				case TestSkip:
+					skipped++
+				}
+			}
+		}
+	}
+	return
+}
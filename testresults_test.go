@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTestResults(t *testing.T) {
+	testEnv(t)
+	api := Ding{}
+
+	const script = `#!/usr/bin/env bash
+cat <<'EOF'
+{"Action":"start","Package":"example.org/a"}
+{"Action":"run","Package":"example.org/a","Test":"TestA"}
+{"Action":"output","Package":"example.org/a","Test":"TestA","Output":"a_test.go:10: bad\n"}
+{"Action":"fail","Package":"example.org/a","Test":"TestA","Elapsed":0.5}
+{"Action":"run","Package":"example.org/a","Test":"TestB"}
+{"Action":"output","Package":"example.org/a","Test":"TestB","Output":"ok\n"}
+{"Action":"pass","Package":"example.org/a","Test":"TestB","Elapsed":0.25}
+{"Action":"run","Package":"example.org/a","Test":"TestC"}
+{"Action":"run","Package":"example.org/a","Test":"TestC/sub"}
+{"Action":"fail","Package":"example.org/a","Test":"TestC/sub","Elapsed":0}
+{"Action":"fail","Package":"example.org/a","Test":"TestC","Elapsed":0}
+{"Action":"output","Package":"example.org/a","Output":"FAIL\n"}
+{"Action":"fail","Package":"example.org/a","Elapsed":1.5}
+EOF
+cat >$DING_DOWNLOADDIR/b.json <<'EOF'
+{"Action":"output","Package":"example.org/b","Output":"?   \texample.org/b\t[no test files]\n"}
+{"Action":"skip","Package":"example.org/b","Elapsed":0}
+EOF
+echo go-test-json: b.json
+exit 1
+`
+	r := Repo{
+		Name:          "gotests",
+		VCS:           VCSCommand,
+		Origin:        "sh -c 'mkdir -p checkout/$DING_CHECKOUTPATH; echo commit:0123abcd'",
+		DefaultBranch: "main",
+		CheckoutPath:  "gotests",
+		BuildScript:   script,
+	}
+	r = api.RepoCreate(ctxbg, config.Password, r)
+
+	// Test results are stored for a failing build.
+	b := api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[1].Tests, []TestPackage{
+		{
+			Package: "example.org/a",
+			Status:  TestFail,
+			Elapsed: 1.5,
+			Output:  "FAIL\n",
+			Tests: []Test{
+				{Name: "TestA", Status: TestFail, Elapsed: 0.5, Output: "a_test.go:10: bad\n"},
+				{Name: "TestB", Status: TestPass, Elapsed: 0.25},
+				{Name: "TestC", Status: TestFail},
+				{Name: "TestC/sub", Status: TestFail},
+			},
+		},
+		{Package: "example.org/b", Status: TestSkip},
+	})
+	tcompare(t, failingTests(b), []string{"example.org/a TestA", "example.org/a TestC/sub"})
+	tcompare(t, []int32{b.TestsPassed, b.TestsFailed, b.TestsSkipped}, []int32{1, 3, 0})
+
+	// A test binary that crashed leaves the running test without status.
+	r.BuildScript = `#!/usr/bin/env bash
+echo '{"Action":"run","Package":"example.org/a","Test":"TestA"}'
+echo 'panic: boom'
+`
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, failingTests(b), []string{"example.org/a TestA"})
+
+	// JUnit XML reports are parsed into the same results.
+	r.BuildScript = `#!/usr/bin/env bash
+cat >$DING_DOWNLOADDIR/junit.xml <<'EOF'
+<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite name="com.example.FooTest" tests="3" time="1,001.5">
+		<testcase classname="com.example.FooTest" name="works" time="0.5"/>
+		<testcase classname="com.example.FooTest" name="breaks" time="1">
+			<failure message="expected 1, got 2" type="AssertionError">at FooTest.java:10</failure>
+		</testcase>
+		<testcase classname="com.example.FooTest" name="later"><skipped/></testcase>
+	</testsuite>
+	<testsuite name="pytest">
+		<testcase classname="tests.test_x" name="test_y" time="0"/>
+	</testsuite>
+</testsuites>
+EOF
+echo junit: junit.xml
+`
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[1].Tests, []TestPackage{
+		{
+			Package: "com.example.FooTest",
+			Status:  TestFail,
+			Elapsed: 1001.5,
+			Tests: []Test{
+				{Name: "works", Status: TestPass, Elapsed: 0.5},
+				{Name: "breaks", Status: TestFail, Elapsed: 1, Output: "expected 1, got 2\nat FooTest.java:10\n"},
+				{Name: "later", Status: TestSkip},
+			},
+		},
+		{Package: "pytest", Status: TestPass, Tests: []Test{{Name: "tests.test_x.test_y", Status: TestPass}}},
+	})
+	tcompare(t, failingTests(b), []string{"com.example.FooTest breaks"})
+	tcompare(t, []int32{b.TestsPassed, b.TestsFailed, b.TestsSkipped}, []int32{2, 1, 1})
+
+	// Secrets in output from files are masked.
+	api.SecretSave(ctxbg, config.Password, r.Name, "TOKEN", "hunter2hunter2", false)
+	r.BuildScript = `#!/usr/bin/env bash
+cat >$DING_DOWNLOADDIR/test.json <<EOF
+{"Action":"output","Package":"example.org/a","Test":"TestA","Output":"token $TOKEN\\n"}
+{"Action":"fail","Package":"example.org/a","Test":"TestA"}
+{"Action":"fail","Package":"example.org/a"}
+EOF
+cat >$DING_DOWNLOADDIR/junit.xml <<EOF
+<testsuite name="suite"><testcase name="t"><failure message="token $TOKEN"/></testcase></testsuite>
+EOF
+echo go-test-json: test.json
+echo junit: junit.xml
+`
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	tcompare(t, b.Steps[1].Tests[0].Tests[0].Output, "token ***\n")
+	tcompare(t, b.Steps[1].Tests[1].Tests[0].Output, "token ***\n")
+	api.SecretRemove(ctxbg, config.Password, r.Name, "TOKEN")
+
+	// Files must be in the download directory.
+	r.BuildScript = "#!/usr/bin/env bash\necho go-test-json: /etc/passwd\n"
+	r = api.RepoSave(ctxbg, config.Password, r)
+	b = api.BuildCreate(ctxbg, config.Password, r.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusBuild)
+	b = api.Build(ctxbg, config.Password, r.Name, b.ID)
+	if !strings.Contains(b.ErrorMessage, "$DING_DOWNLOADDIR") {
+		t.Fatalf("got error message %q, expected error about download directory", b.ErrorMessage)
+	}
+}
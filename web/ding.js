@@ -240,7 +240,25 @@ var api;
 		BuildStatus["StatusBuild"] = "build";
 		BuildStatus["StatusSuccess"] = "success";
 		BuildStatus["StatusCancelled"] = "cancelled";
+		BuildStatus["StatusTimeout"] = "timeout";
+		BuildStatus["StatusSuperseded"] = "superseded";
+		BuildStatus["StatusSkipped"] = "skipped";
 	})(BuildStatus = api.BuildStatus || (api.BuildStatus = {}));
+	// RefType is the kind of ref a build is for.
+	let RefType;
+	(function (RefType) {
+		RefType["RefBranch"] = "branch";
+		RefType["RefTag"] = "tag";
+		RefType["RefPullRequest"] = "pullrequest";
+	})(RefType = api.RefType || (api.RefType = {}));
+	// TestStatus is the status of a test or package. JUnit tests with an error are
+	// failed.
+	let TestStatus;
+	(function (TestStatus) {
+		TestStatus["TestPass"] = "pass";
+		TestStatus["TestFail"] = "fail";
+		TestStatus["TestSkip"] = "skip";
+	})(TestStatus = api.TestStatus || (api.TestStatus = {}));
 	// VCS indicates the mechanism to fetch the source code.
 	let VCS;
 	(function (VCS) {
@@ -250,6 +268,21 @@ var api;
 		// past/future systems.
 		VCS["VCSCommand"] = "command";
 	})(VCS = api.VCS || (api.VCS = {}));
+	// DownstreamCondition is the condition for triggering a build of a downstream
+	// repository.
+	let DownstreamCondition;
+	(function (DownstreamCondition) {
+		DownstreamCondition["DownstreamSuccess"] = "success";
+		DownstreamCondition["DownstreamRelease"] = "release";
+	})(DownstreamCondition = api.DownstreamCondition || (api.DownstreamCondition = {}));
+	// Forge is a code hosting service with a commit status API.
+	let Forge;
+	(function (Forge) {
+		Forge["ForgeNone"] = "";
+		Forge["ForgeGithub"] = "github";
+		Forge["ForgeGitea"] = "gitea";
+		Forge["ForgeBitbucket"] = "bitbucket";
+	})(Forge = api.Forge || (api.Forge = {}));
 	// LogLevel indicates the severity of a log message.
 	let LogLevel;
 	(function (LogLevel) {
@@ -258,42 +291,80 @@ var api;
 		LogLevel["LogWarn"] = "warn";
 		LogLevel["LogError"] = "error";
 	})(LogLevel = api.LogLevel || (api.LogLevel = {}));
-	api.structTypes = { "Build": true, "EventBuild": true, "EventOutput": true, "EventRemoveBuild": true, "EventRemoveRepo": true, "EventRepo": true, "GoToolchains": true, "Repo": true, "RepoBuilds": true, "Result": true, "Settings": true, "Step": true };
-	api.stringsTypes = { "BuildStatus": true, "LogLevel": true, "VCS": true };
+	api.structTypes = { "Bisect": true, "BranchEnv": true, "Build": true, "CommitStatus": true, "Downstream": true, "EventBuild": true, "EventOutput": true, "EventQueue": true, "EventRemoveBuild": true, "EventRemoveRepo": true, "EventRemoveSchedule": true, "EventRepo": true, "EventSchedule": true, "GoToolchains": true, "MatrixAxis": true, "Param": true, "QueueJob": true, "Repo": true, "RepoBuilds": true, "RepoJob": true, "Result": true, "Schedule": true, "Secret": true, "Settings": true, "Step": true, "Test": true, "TestPackage": true };
+	api.stringsTypes = { "BuildStatus": true, "DownstreamCondition": true, "Forge": true, "LogLevel": true, "RefType": true, "TestStatus": true, "VCS": true };
 	api.intsTypes = {};
 	api.types = {
-		"Build": { "Name": "Build", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int32"] }, { "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "Branch", "Docs": "", "Typewords": ["string"] }, { "Name": "CommitHash", "Docs": "", "Typewords": ["string"] }, { "Name": "Status", "Docs": "", "Typewords": ["BuildStatus"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Start", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Finish", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "ErrorMessage", "Docs": "", "Typewords": ["string"] }, { "Name": "Released", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "BuilddirRemoved", "Docs": "", "Typewords": ["bool"] }, { "Name": "Coverage", "Docs": "", "Typewords": ["nullable", "float32"] }, { "Name": "CoverageReportFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScript", "Docs": "", "Typewords": ["string"] }, { "Name": "LowPrio", "Docs": "", "Typewords": ["bool"] }, { "Name": "LastLine", "Docs": "", "Typewords": ["string"] }, { "Name": "DiskUsage", "Docs": "", "Typewords": ["int64"] }, { "Name": "HomeDiskUsageDelta", "Docs": "", "Typewords": ["int64"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "Result"] }, { "Name": "Steps", "Docs": "", "Typewords": ["[]", "Step"] }] },
-		"Result": { "Name": "Result", "Docs": "", "Fields": [{ "Name": "Command", "Docs": "", "Typewords": ["string"] }, { "Name": "Os", "Docs": "", "Typewords": ["string"] }, { "Name": "Arch", "Docs": "", "Typewords": ["string"] }, { "Name": "Toolchain", "Docs": "", "Typewords": ["string"] }, { "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "Filesize", "Docs": "", "Typewords": ["int64"] }] },
-		"Step": { "Name": "Step", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Output", "Docs": "", "Typewords": ["string"] }, { "Name": "Nsec", "Docs": "", "Typewords": ["int64"] }] },
-		"RepoBuilds": { "Name": "RepoBuilds", "Docs": "", "Fields": [{ "Name": "Repo", "Docs": "", "Typewords": ["Repo"] }, { "Name": "Builds", "Docs": "", "Typewords": ["[]", "Build"] }] },
-		"Repo": { "Name": "Repo", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "VCS", "Docs": "", "Typewords": ["VCS"] }, { "Name": "Origin", "Docs": "", "Typewords": ["string"] }, { "Name": "DefaultBranch", "Docs": "", "Typewords": ["string"] }, { "Name": "CheckoutPath", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScript", "Docs": "", "Typewords": ["string"] }, { "Name": "UID", "Docs": "", "Typewords": ["nullable", "uint32"] }, { "Name": "HomeDiskUsage", "Docs": "", "Typewords": ["int64"] }, { "Name": "WebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "AllowGlobalWebhookSecrets", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoAuto", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoCur", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoPrev", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoNext", "Docs": "", "Typewords": ["bool"] }, { "Name": "Bubblewrap", "Docs": "", "Typewords": ["bool"] }, { "Name": "BubblewrapNoNet", "Docs": "", "Typewords": ["bool"] }, { "Name": "NotifyEmailAddrs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "BuildOnUpdatedToolchain", "Docs": "", "Typewords": ["bool"] }] },
+		"Param": { "Name": "Param", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Value", "Docs": "", "Typewords": ["string"] }] },
+		"Build": { "Name": "Build", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int32"] }, { "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "Branch", "Docs": "", "Typewords": ["string"] }, { "Name": "CommitHash", "Docs": "", "Typewords": ["string"] }, { "Name": "Status", "Docs": "", "Typewords": ["BuildStatus"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Start", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Finish", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "ErrorMessage", "Docs": "", "Typewords": ["string"] }, { "Name": "Released", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "BuilddirRemoved", "Docs": "", "Typewords": ["bool"] }, { "Name": "Coverage", "Docs": "", "Typewords": ["nullable", "float32"] }, { "Name": "CoverageReportFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScript", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScriptFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Job", "Docs": "", "Typewords": ["string"] }, { "Name": "LowPrio", "Docs": "", "Typewords": ["bool"] }, { "Name": "PullRequest", "Docs": "", "Typewords": ["int32"] }, { "Name": "PullRequestSource", "Docs": "", "Typewords": ["string"] }, { "Name": "PullRequestTarget", "Docs": "", "Typewords": ["string"] }, { "Name": "RefType", "Docs": "", "Typewords": ["RefType"] }, { "Name": "Tag", "Docs": "", "Typewords": ["string"] }, { "Name": "PushBuildID", "Docs": "", "Typewords": ["int32"] }, { "Name": "PushPosition", "Docs": "", "Typewords": ["int32"] }, { "Name": "Bisect", "Docs": "", "Typewords": ["Bisect"] }, { "Name": "BisectBuildID", "Docs": "", "Typewords": ["int32"] }, { "Name": "UpstreamRepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "UpstreamBuildID", "Docs": "", "Typewords": ["int32"] }, { "Name": "UpstreamVersion", "Docs": "", "Typewords": ["string"] }, { "Name": "UpstreamRepos", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "LastLine", "Docs": "", "Typewords": ["string"] }, { "Name": "DiskUsage", "Docs": "", "Typewords": ["int64"] }, { "Name": "HomeDiskUsageDelta", "Docs": "", "Typewords": ["int64"] }, { "Name": "SupersededBy", "Docs": "", "Typewords": ["int32"] }, { "Name": "PeakMemory", "Docs": "", "Typewords": ["int64"] }, { "Name": "CPUNsec", "Docs": "", "Typewords": ["int64"] }, { "Name": "Params", "Docs": "", "Typewords": ["[]", "Param"] }, { "Name": "Environment", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "RunPrefix", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "Result"] }, { "Name": "TestsPassed", "Docs": "", "Typewords": ["int32"] }, { "Name": "TestsFailed", "Docs": "", "Typewords": ["int32"] }, { "Name": "TestsSkipped", "Docs": "", "Typewords": ["int32"] }, { "Name": "Steps", "Docs": "", "Typewords": ["[]", "Step"] }] },
+		"Bisect": { "Name": "Bisect", "Docs": "", "Fields": [{ "Name": "Good", "Docs": "", "Typewords": ["string"] }, { "Name": "Commits", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "GoodIndex", "Docs": "", "Typewords": ["int32"] }, { "Name": "BadIndex", "Docs": "", "Typewords": ["int32"] }, { "Name": "BuildID", "Docs": "", "Typewords": ["int32"] }, { "Name": "FirstBad", "Docs": "", "Typewords": ["string"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }] },
+		"Result": { "Name": "Result", "Docs": "", "Fields": [{ "Name": "Command", "Docs": "", "Typewords": ["string"] }, { "Name": "Os", "Docs": "", "Typewords": ["string"] }, { "Name": "Arch", "Docs": "", "Typewords": ["string"] }, { "Name": "Toolchain", "Docs": "", "Typewords": ["string"] }, { "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "Filesize", "Docs": "", "Typewords": ["int64"] }, { "Name": "Checkout", "Docs": "", "Typewords": ["string"] }] },
+		"Step": { "Name": "Step", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Output", "Docs": "", "Typewords": ["string"] }, { "Name": "Nsec", "Docs": "", "Typewords": ["int64"] }, { "Name": "ErrorMessage", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Coverage", "Docs": "", "Typewords": ["nullable", "float32"] }, { "Name": "CoverageReportFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "Result"] }, { "Name": "Tests", "Docs": "", "Typewords": ["[]", "TestPackage"] }, { "Name": "Matrix", "Docs": "", "Typewords": ["[]", "Param"] }] },
+		"TestPackage": { "Name": "TestPackage", "Docs": "", "Fields": [{ "Name": "Package", "Docs": "", "Typewords": ["string"] }, { "Name": "Status", "Docs": "", "Typewords": ["TestStatus"] }, { "Name": "Elapsed", "Docs": "", "Typewords": ["float64"] }, { "Name": "Output", "Docs": "", "Typewords": ["string"] }, { "Name": "Tests", "Docs": "", "Typewords": ["[]", "Test"] }] },
+		"Test": { "Name": "Test", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Status", "Docs": "", "Typewords": ["TestStatus"] }, { "Name": "Elapsed", "Docs": "", "Typewords": ["float64"] }, { "Name": "Output", "Docs": "", "Typewords": ["string"] }] },
+		"QueueJob": { "Name": "QueueJob", "Docs": "", "Fields": [{ "Name": "BuildID", "Docs": "", "Typewords": ["int32"] }, { "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "Branch", "Docs": "", "Typewords": ["string"] }, { "Name": "LowPrio", "Docs": "", "Typewords": ["bool"] }, { "Name": "Active", "Docs": "", "Typewords": ["bool"] }, { "Name": "Position", "Docs": "", "Typewords": ["int32"] }] },
+		"RepoBuilds": { "Name": "RepoBuilds", "Docs": "", "Fields": [{ "Name": "Repo", "Docs": "", "Typewords": ["Repo"] }, { "Name": "Builds", "Docs": "", "Typewords": ["[]", "Build"] }, { "Name": "PullRequestBuilds", "Docs": "", "Typewords": ["[]", "Build"] }] },
+		"Repo": { "Name": "Repo", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "VCS", "Docs": "", "Typewords": ["VCS"] }, { "Name": "Origin", "Docs": "", "Typewords": ["string"] }, { "Name": "DefaultBranch", "Docs": "", "Typewords": ["string"] }, { "Name": "CheckoutPath", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScript", "Docs": "", "Typewords": ["string"] }, { "Name": "UID", "Docs": "", "Typewords": ["nullable", "uint32"] }, { "Name": "HomeDiskUsage", "Docs": "", "Typewords": ["int64"] }, { "Name": "WebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "AllowGlobalWebhookSecrets", "Docs": "", "Typewords": ["bool"] }, { "Name": "BuildScriptPath", "Docs": "", "Typewords": ["string"] }, { "Name": "IncludeBranches", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ExcludeBranches", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IncludeTags", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ExcludeTags", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IncludePaths", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ExcludePaths", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReleaseTags", "Docs": "", "Typewords": ["bool"] }, { "Name": "PushCommitBuilds", "Docs": "", "Typewords": ["int32"] }, { "Name": "Bisect", "Docs": "", "Typewords": ["bool"] }, { "Name": "Downstreams", "Docs": "", "Typewords": ["[]", "Downstream"] }, { "Name": "Jobs", "Docs": "", "Typewords": ["[]", "RepoJob"] }, { "Name": "PollInterval", "Docs": "", "Typewords": ["int32"] }, { "Name": "PollBranches", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PollCommand", "Docs": "", "Typewords": ["string"] }, { "Name": "PollLast", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "PollError", "Docs": "", "Typewords": ["string"] }, { "Name": "GoAuto", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoCur", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoPrev", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoNext", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoParallel", "Docs": "", "Typewords": ["bool"] }, { "Name": "Matrix", "Docs": "", "Typewords": ["[]", "MatrixAxis"] }, { "Name": "MaxBuilds", "Docs": "", "Typewords": ["int32"] }, { "Name": "SupersedeBuilds", "Docs": "", "Typewords": ["bool"] }, { "Name": "SupersedeRunning", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxDuration", "Docs": "", "Typewords": ["int32"] }, { "Name": "InactivityTimeout", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxMemoryMB", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxProcesses", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxCPUSeconds", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxOpenFiles", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFileSizeMB", "Docs": "", "Typewords": ["int32"] }, { "Name": "Bubblewrap", "Docs": "", "Typewords": ["bool"] }, { "Name": "BubblewrapNoNet", "Docs": "", "Typewords": ["bool"] }, { "Name": "NotifyEmailAddrs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "BuildOnUpdatedToolchain", "Docs": "", "Typewords": ["bool"] }, { "Name": "Params", "Docs": "", "Typewords": ["[]", "Param"] }, { "Name": "Environment", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "RunPrefix", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReplaceRunPrefix", "Docs": "", "Typewords": ["bool"] }, { "Name": "BranchEnvs", "Docs": "", "Typewords": ["[]", "BranchEnv"] }, { "Name": "CommitStatus", "Docs": "", "Typewords": ["CommitStatus"] }] },
+		"Downstream": { "Name": "Downstream", "Docs": "", "Fields": [{ "Name": "Repo", "Docs": "", "Typewords": ["string"] }, { "Name": "UpstreamBranch", "Docs": "", "Typewords": ["string"] }, { "Name": "Branch", "Docs": "", "Typewords": ["string"] }, { "Name": "Condition", "Docs": "", "Typewords": ["DownstreamCondition"] }] },
+		"RepoJob": { "Name": "RepoJob", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScript", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildScriptPath", "Docs": "", "Typewords": ["string"] }, { "Name": "IncludeBranches", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ExcludeBranches", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IncludeTags", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ExcludeTags", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IncludePaths", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ExcludePaths", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "GoAuto", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoCur", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoPrev", "Docs": "", "Typewords": ["bool"] }, { "Name": "GoNext", "Docs": "", "Typewords": ["bool"] }] },
+		"MatrixAxis": { "Name": "MatrixAxis", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Values", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"BranchEnv": { "Name": "BranchEnv", "Docs": "", "Fields": [{ "Name": "Pattern", "Docs": "", "Typewords": ["string"] }, { "Name": "Environment", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "RunPrefix", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReplaceRunPrefix", "Docs": "", "Typewords": ["bool"] }] },
+		"CommitStatus": { "Name": "CommitStatus", "Docs": "", "Fields": [{ "Name": "Forge", "Docs": "", "Typewords": ["Forge"] }, { "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Repository", "Docs": "", "Typewords": ["string"] }, { "Name": "TokenSecret", "Docs": "", "Typewords": ["string"] }] },
+		"Schedule": { "Name": "Schedule", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int32"] }, { "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "Branch", "Docs": "", "Typewords": ["string"] }, { "Name": "Cron", "Docs": "", "Typewords": ["string"] }, { "Name": "LowPrio", "Docs": "", "Typewords": ["bool"] }, { "Name": "Next", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastBuildID", "Docs": "", "Typewords": ["int32"] }] },
+		"Secret": { "Name": "Secret", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int32"] }, { "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "File", "Docs": "", "Typewords": ["bool"] }, { "Name": "Updated", "Docs": "", "Typewords": ["timestamp"] }] },
 		"GoToolchains": { "Name": "GoToolchains", "Docs": "", "Fields": [{ "Name": "Go", "Docs": "", "Typewords": ["string"] }, { "Name": "GoPrev", "Docs": "", "Typewords": ["string"] }, { "Name": "GoNext", "Docs": "", "Typewords": ["string"] }] },
-		"Settings": { "Name": "Settings", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int32"] }, { "Name": "NotifyEmailAddrs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "GithubWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "GiteaWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "BitbucketWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "GoToolchainWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "RunPrefix", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Environment", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "AutomaticGoToolchains", "Docs": "", "Typewords": ["bool"] }] },
-		"BuildStatus": { "Name": "BuildStatus", "Docs": "", "Values": [{ "Name": "StatusNew", "Value": "new", "Docs": "" }, { "Name": "StatusClone", "Value": "clone", "Docs": "" }, { "Name": "StatusBuild", "Value": "build", "Docs": "" }, { "Name": "StatusSuccess", "Value": "success", "Docs": "" }, { "Name": "StatusCancelled", "Value": "cancelled", "Docs": "" }] },
+		"Settings": { "Name": "Settings", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int32"] }, { "Name": "NotifyEmailAddrs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "GithubWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "GiteaWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "BitbucketWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "GoToolchainWebhookSecret", "Docs": "", "Typewords": ["string"] }, { "Name": "RunPrefix", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Environment", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MaxBuilds", "Docs": "", "Typewords": ["int32"] }, { "Name": "AutomaticGoToolchains", "Docs": "", "Typewords": ["bool"] }] },
+		"BuildStatus": { "Name": "BuildStatus", "Docs": "", "Values": [{ "Name": "StatusNew", "Value": "new", "Docs": "" }, { "Name": "StatusClone", "Value": "clone", "Docs": "" }, { "Name": "StatusBuild", "Value": "build", "Docs": "" }, { "Name": "StatusSuccess", "Value": "success", "Docs": "" }, { "Name": "StatusCancelled", "Value": "cancelled", "Docs": "" }, { "Name": "StatusTimeout", "Value": "timeout", "Docs": "" }, { "Name": "StatusSuperseded", "Value": "superseded", "Docs": "" }, { "Name": "StatusSkipped", "Value": "skipped", "Docs": "" }] },
+		"RefType": { "Name": "RefType", "Docs": "", "Values": [{ "Name": "RefBranch", "Value": "branch", "Docs": "" }, { "Name": "RefTag", "Value": "tag", "Docs": "" }, { "Name": "RefPullRequest", "Value": "pullrequest", "Docs": "" }] },
+		"TestStatus": { "Name": "TestStatus", "Docs": "", "Values": [{ "Name": "TestPass", "Value": "pass", "Docs": "" }, { "Name": "TestFail", "Value": "fail", "Docs": "" }, { "Name": "TestSkip", "Value": "skip", "Docs": "" }] },
 		"VCS": { "Name": "VCS", "Docs": "", "Values": [{ "Name": "VCSGit", "Value": "git", "Docs": "" }, { "Name": "VCSMercurial", "Value": "mercurial", "Docs": "" }, { "Name": "VCSCommand", "Value": "command", "Docs": "" }] },
+		"DownstreamCondition": { "Name": "DownstreamCondition", "Docs": "", "Values": [{ "Name": "DownstreamSuccess", "Value": "success", "Docs": "" }, { "Name": "DownstreamRelease", "Value": "release", "Docs": "" }] },
+		"Forge": { "Name": "Forge", "Docs": "", "Values": [{ "Name": "ForgeNone", "Value": "", "Docs": "" }, { "Name": "ForgeGithub", "Value": "github", "Docs": "" }, { "Name": "ForgeGitea", "Value": "gitea", "Docs": "" }, { "Name": "ForgeBitbucket", "Value": "bitbucket", "Docs": "" }] },
 		"LogLevel": { "Name": "LogLevel", "Docs": "", "Values": [{ "Name": "LogDebug", "Value": "debug", "Docs": "" }, { "Name": "LogInfo", "Value": "info", "Docs": "" }, { "Name": "LogWarn", "Value": "warn", "Docs": "" }, { "Name": "LogError", "Value": "error", "Docs": "" }] },
 		"EventRepo": { "Name": "EventRepo", "Docs": "EventRepo represents an update of a repository or creation of a repository.", "Fields": [{ "Name": "Repo", "Docs": "", "Typewords": ["Repo"] }] },
 		"EventRemoveRepo": { "Name": "EventRemoveRepo", "Docs": "EventRemoveRepo represents the removal of a repository.", "Fields": [{ "Name": "RepoName", "Docs": "", "Typewords": ["string"] }] },
 		"EventBuild": { "Name": "EventBuild", "Docs": "EventBuild represents an update to a build, or the start of a new build.\nOutput is not part of the build, see EventOutput below.", "Fields": [{ "Name": "Build", "Docs": "", "Typewords": ["Build"] }] },
 		"EventRemoveBuild": { "Name": "EventRemoveBuild", "Docs": "EventRemoveBuild represents the removal of a build from the database.", "Fields": [{ "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "BuildID", "Docs": "", "Typewords": ["int32"] }] },
 		"EventOutput": { "Name": "EventOutput", "Docs": "EventOutput represents new output from a build.\nText only contains the newly added output, not the full output so far.", "Fields": [{ "Name": "BuildID", "Docs": "", "Typewords": ["int32"] }, { "Name": "Step", "Docs": "During which the output was generated, eg `clone`, `build`.", "Typewords": ["string"] }, { "Name": "Where", "Docs": "`stdout` or `stderr`.", "Typewords": ["string"] }, { "Name": "Text", "Docs": "Lines of text written.", "Typewords": ["string"] }] },
+		"EventQueue": { "Name": "EventQueue", "Docs": "EventQueue represents a change to the build queue, e.g. a build that was\nadded, started, finished or moved. Jobs holds all running and waiting builds.", "Fields": [{ "Name": "Jobs", "Docs": "", "Typewords": ["[]", "QueueJob"] }] },
+		"EventSchedule": { "Name": "EventSchedule", "Docs": "EventSchedule represents the creation or update of a schedule, e.g. after it\ncreated a build and its next time changed.", "Fields": [{ "Name": "Schedule", "Docs": "", "Typewords": ["Schedule"] }] },
+		"EventRemoveSchedule": { "Name": "EventRemoveSchedule", "Docs": "EventRemoveSchedule represents the removal of a schedule.", "Fields": [{ "Name": "RepoName", "Docs": "", "Typewords": ["string"] }, { "Name": "ScheduleID", "Docs": "", "Typewords": ["int32"] }] },
 	};
 	api.parser = {
+		Param: (v) => api.parse("Param", v),
 		Build: (v) => api.parse("Build", v),
+		Bisect: (v) => api.parse("Bisect", v),
 		Result: (v) => api.parse("Result", v),
 		Step: (v) => api.parse("Step", v),
+		TestPackage: (v) => api.parse("TestPackage", v),
+		Test: (v) => api.parse("Test", v),
+		QueueJob: (v) => api.parse("QueueJob", v),
 		RepoBuilds: (v) => api.parse("RepoBuilds", v),
 		Repo: (v) => api.parse("Repo", v),
+		Downstream: (v) => api.parse("Downstream", v),
+		RepoJob: (v) => api.parse("RepoJob", v),
+		MatrixAxis: (v) => api.parse("MatrixAxis", v),
+		BranchEnv: (v) => api.parse("BranchEnv", v),
+		CommitStatus: (v) => api.parse("CommitStatus", v),
+		Schedule: (v) => api.parse("Schedule", v),
+		Secret: (v) => api.parse("Secret", v),
 		GoToolchains: (v) => api.parse("GoToolchains", v),
 		Settings: (v) => api.parse("Settings", v),
 		BuildStatus: (v) => api.parse("BuildStatus", v),
+		RefType: (v) => api.parse("RefType", v),
+		TestStatus: (v) => api.parse("TestStatus", v),
 		VCS: (v) => api.parse("VCS", v),
+		DownstreamCondition: (v) => api.parse("DownstreamCondition", v),
+		Forge: (v) => api.parse("Forge", v),
 		LogLevel: (v) => api.parse("LogLevel", v),
 		EventRepo: (v) => api.parse("EventRepo", v),
 		EventRemoveRepo: (v) => api.parse("EventRemoveRepo", v),
 		EventBuild: (v) => api.parse("EventBuild", v),
 		EventRemoveBuild: (v) => api.parse("EventRemoveBuild", v),
 		EventOutput: (v) => api.parse("EventOutput", v),
+		EventQueue: (v) => api.parse("EventQueue", v),
+		EventSchedule: (v) => api.parse("EventSchedule", v),
+		EventRemoveSchedule: (v) => api.parse("EventRemoveSchedule", v),
 	};
 	// The Ding API lets you compile git branches, build binaries, run tests, and
 	// publish binaries.
@@ -307,6 +378,9 @@ var api;
 	// - `build`, build was updated or created
 	// - `removeBuild`, build was removed
 	// - `output`, new lines of output from a command for an active build
+	// - `queue`, the build queue changed, e.g. a build was added or started
+	// - `schedule`, schedule was updated or created
+	// - `removeSchedule`, schedule was removed
 	// 
 	// These types are described below, with an _event_-prefix. E.g. type _EventRepo_ describes the `repo` event.
 	let defaultOptions = { slicesNullable: true, mapsNullable: true, nullableOptional: true };
@@ -346,11 +420,25 @@ var api;
 		// 
 		// Low priority builds are executed after regular builds. And only one low
 		// priority build is running over all repo's.
-		async BuildCreate(password, repoName, branch, commit, lowPrio) {
+		// 
+		// BuildParams sets values for parameters of the repository, other parameters get
+		// their default value.
+		// 
+		// A branch of the form "tags/<name>" builds the tag.
+		async BuildCreate(password, repoName, branch, commit, lowPrio, buildParams) {
 			const fn = "BuildCreate";
-			const paramTypes = [["string"], ["string"], ["string"], ["string"], ["bool"]];
+			const paramTypes = [["string"], ["string"], ["string"], ["string"], ["bool"], ["[]", "Param"]];
+			const returnTypes = [["Build"]];
+			const params = [password, repoName, branch, commit, lowPrio, buildParams];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// BuildCreateJob is like BuildCreate, but builds a job of the repository, see
+		// Repo.Jobs. An empty job builds the build script of the repository.
+		async BuildCreateJob(password, repoName, job, branch, commit, lowPrio, buildParams) {
+			const fn = "BuildCreateJob";
+			const paramTypes = [["string"], ["string"], ["string"], ["string"], ["string"], ["bool"], ["[]", "Param"]];
 			const returnTypes = [["Build"]];
-			const params = [password, repoName, branch, commit, lowPrio];
+			const params = [password, repoName, job, branch, commit, lowPrio, buildParams];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// CreateBuild exists for compatibility with older "ding kick" behaviour.
@@ -377,6 +465,44 @@ var api;
 			const params = [password, repoName, buildID];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// Queue returns the running builds and the builds waiting in the queue. Builds
+		// are typically started in order of queue position, but limits on concurrent
+		// builds and low-prio builds may cause later builds to start earlier.
+		async Queue(password) {
+			const fn = "Queue";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "QueueJob"]];
+			const params = [password];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QueueMoveFront moves a build waiting in the queue to the front. It will be
+		// started before other waiting builds, as soon as limits on concurrent builds
+		// allow.
+		async QueueMoveFront(password, repoName, buildID) {
+			const fn = "QueueMoveFront";
+			const paramTypes = [["string"], ["string"], ["int32"]];
+			const returnTypes = [];
+			const params = [password, repoName, buildID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QueueCancelRepo cancels all builds for the repository that are waiting in the
+		// queue. Running builds are not affected.
+		async QueueCancelRepo(password, repoName) {
+			const fn = "QueueCancelRepo";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [];
+			const params = [password, repoName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QueuePromoteLowPrio turns a low-prio build waiting in the queue into a regular
+		// build, so it is no longer held back by other builds.
+		async QueuePromoteLowPrio(password, repoName, buildID) {
+			const fn = "QueuePromoteLowPrio";
+			const paramTypes = [["string"], ["string"], ["int32"]];
+			const returnTypes = [];
+			const params = [password, repoName, buildID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// ReleaseCreate release a build.
 		async ReleaseCreate(password, repoName, buildID) {
 			const fn = "ReleaseCreate";
@@ -388,7 +514,10 @@ var api;
 		// RepoBuilds returns all repositories and recent build info for "active" branches.
 		// A branch is active if its name is "master" or "main" (for git), "default" (for hg), or
 		// "develop", or if the last build was less than 4 weeks ago. The most recent
-		// build is returned.
+		// build that was not skipped, and not of an earlier commit of a push or for a
+		// bisect, is returned, for each job of the repository.
+		// Builds for pull requests are returned separately, for pull requests with a build
+		// in the past week.
 		async RepoBuilds(password) {
 			const fn = "RepoBuilds";
 			const paramTypes = [["string"]];
@@ -456,6 +585,66 @@ var api;
 			const params = [password, repoName];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// Schedules returns the schedules of a repository.
+		async Schedules(password, repoName) {
+			const fn = "Schedules";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [["[]", "Schedule"]];
+			const params = [password, repoName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ScheduleCreate adds a schedule to a repository, and sets the time of its first
+		// build.
+		async ScheduleCreate(password, schedule) {
+			const fn = "ScheduleCreate";
+			const paramTypes = [["string"], ["Schedule"]];
+			const returnTypes = [["Schedule"]];
+			const params = [password, schedule];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ScheduleSave changes the branch, time specification and priority of a schedule,
+		// and sets the time of its next build.
+		async ScheduleSave(password, schedule) {
+			const fn = "ScheduleSave";
+			const paramTypes = [["string"], ["Schedule"]];
+			const returnTypes = [["Schedule"]];
+			const params = [password, schedule];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ScheduleRemove removes a schedule from a repository. Builds created by the
+		// schedule are not affected.
+		async ScheduleRemove(password, repoName, scheduleID) {
+			const fn = "ScheduleRemove";
+			const paramTypes = [["string"], ["string"], ["int32"]];
+			const returnTypes = [];
+			const params = [password, repoName, scheduleID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// Secrets returns the secrets of a repository, without their values.
+		async Secrets(password, repoName) {
+			const fn = "Secrets";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [["[]", "Secret"]];
+			const params = [password, repoName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SecretSave adds a secret to a repository, or replaces the secret with the same
+		// name. The value is stored encrypted and cannot be retrieved through the API.
+		async SecretSave(password, repoName, name, value, file) {
+			const fn = "SecretSave";
+			const paramTypes = [["string"], ["string"], ["string"], ["string"], ["bool"]];
+			const returnTypes = [["Secret"]];
+			const params = [password, repoName, name, value, file];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SecretRemove removes a secret from a repository.
+		async SecretRemove(password, repoName, name) {
+			const fn = "SecretRemove";
+			const paramTypes = [["string"], ["string"], ["string"]];
+			const returnTypes = [];
+			const params = [password, repoName, name];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// Build returns the build, including steps output.
 		async Build(password, repoName, buildID) {
 			const fn = "Build";
@@ -464,6 +653,17 @@ var api;
 			const params = [password, repoName, buildID];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// PushBuilds returns the builds for the commits of the push of a build, ordered
+		// from the first to the last commit of the push. Steps are not included. If the
+		// build is not part of a push with builds for earlier commits, no builds are
+		// returned.
+		async PushBuilds(password, repoName, buildID) {
+			const fn = "PushBuilds";
+			const paramTypes = [["string"], ["string"], ["int32"]];
+			const returnTypes = [["[]", "Build"]];
+			const params = [password, repoName, buildID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// BuildRemove removes a build completely. Both from database and all local files.
 		async BuildRemove(password, buildID) {
 			const fn = "BuildRemove";
@@ -585,7 +785,7 @@ var api;
 		async ExampleSSE() {
 			const fn = "ExampleSSE";
 			const paramTypes = [];
-			const returnTypes = [["EventRepo"], ["EventRemoveRepo"], ["EventBuild"], ["EventRemoveBuild"], ["EventOutput"]];
+			const returnTypes = [["EventRepo"], ["EventRemoveRepo"], ["EventBuild"], ["EventRemoveBuild"], ["EventOutput"], ["EventQueue"], ["EventSchedule"], ["EventRemoveSchedule"]];
 			const params = [];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
@@ -1004,6 +1204,9 @@ const streams = {
 	build: new Stream(),
 	removeBuild: new Stream(),
 	output: new Stream(),
+	queue: new Stream(),
+	schedule: new Stream(),
+	removeSchedule: new Stream(),
 };
 let sseElem = dom.span('Disconnected from live updates.'); // Shown in UI next to logout button.
 let eventSource; // We initialize it after first success API call.
@@ -1035,6 +1238,9 @@ const initEventSource = () => {
 	eventSource.addEventListener('build', (e) => streams.build.send(api.parser.EventBuild(JSON.parse(e.data))));
 	eventSource.addEventListener('removeBuild', (e) => streams.removeBuild.send(api.parser.EventRemoveBuild(JSON.parse(e.data))));
 	eventSource.addEventListener('output', (e) => streams.output.send(api.parser.EventOutput(JSON.parse(e.data))));
+	eventSource.addEventListener('queue', (e) => streams.queue.send(api.parser.EventQueue(JSON.parse(e.data))));
+	eventSource.addEventListener('schedule', (e) => streams.schedule.send(api.parser.EventSchedule(JSON.parse(e.data))));
+	eventSource.addEventListener('removeSchedule', (e) => streams.removeSchedule.send(api.parser.EventRemoveSchedule(JSON.parse(e.data))));
 };
 // Atexit helps run cleanup code when a page is unloaded. A page has an atexit to
 // which functions can be added. Pages that can rerender parts of their contents
@@ -1147,6 +1353,12 @@ const formatCoverage = (repo, b) => {
 	}
 	return anchor === 'report' ? '' : anchor;
 };
+const formatTests = (b) => {
+	if (!b.TestsPassed && !b.TestsFailed && !b.TestsSkipped) {
+		return '';
+	}
+	return dom.span(attr.title(b.TestsPassed + ' passed, ' + b.TestsFailed + ' failed, ' + b.TestsSkipped + ' skipped'), '' + b.TestsPassed, b.TestsFailed ? [' / ', dom.span(style({ color: colors.red }), '' + b.TestsFailed)] : []);
+};
 const age0 = (mins, start, end) => {
 	const second = 1;
 	const minute = 60 * second;
@@ -1206,7 +1418,10 @@ const age0 = (mins, start, end) => {
 const formatSize = (size) => (size / (1024 * 1024)).toFixed(1) + 'm';
 const formatBuildSize = (b) => dom.span(attr.title('Disk usage of build directory (including checkout directory), and optional difference in size of (reused) home directory'), formatSize(b.DiskUsage) + (b.HomeDiskUsageDelta ? (b.HomeDiskUsageDelta > 0 ? '+' : '') + formatSize(b.HomeDiskUsageDelta) : ''));
 const statusColor = (b) => {
-	if (b.ErrorMessage || b.Finish && b.Status !== api.BuildStatus.StatusSuccess) {
+	if (b.Status === api.BuildStatus.StatusSuperseded || b.Status === api.BuildStatus.StatusSkipped) {
+		return colors.gray;
+	}
+	else if (b.ErrorMessage || b.Finish && b.Status !== api.BuildStatus.StatusSuccess) {
 		return colors.red;
 	}
 	else if (b.Released) {
@@ -1226,6 +1441,11 @@ const buildStatus = (b) => {
 	}
 	return dom.span(s, style({ fontSize: '.9em', color: 'white', backgroundColor: statusColor(b), padding: '0 .2em', borderRadius: '.15em' }));
 };
+// Ordinal returns e.g. "1st", "2nd", "3rd", "4th".
+const ordinal = (n) => {
+	const suffix = n % 100 >= 11 && n % 100 <= 13 ? 'th' : ['th', 'st', 'nd', 'rd'][n % 10] || 'th';
+	return '' + n + suffix;
+};
 const buildErrmsg = (b) => {
 	let msg = b.ErrorMessage;
 	if (b.ErrorMessage && b.LastLine) {
@@ -1233,6 +1453,23 @@ const buildErrmsg = (b) => {
 	}
 	return msg ? dom.span(style({ maxWidth: '40em', display: 'inline-block' }), msg) : [];
 };
+const buildBranch = (b) => {
+	const job = b.Job ? [' ', dom.span(b.Job, style({ color: colors.gray }), attr.title('Job of the repository.'))] : [];
+	if (!b.PullRequest) {
+		return [b.Branch, job];
+	}
+	return [dom.span('PR #' + b.PullRequest, attr.title('Pull request from ' + b.PullRequestSource + ' into ' + b.PullRequestTarget + '.')), job];
+};
+const pollError = (repo) => {
+	if (!repo.PollInterval || !repo.PollError) {
+		return [];
+	}
+	return [' ', dom.span('!', style({ color: colors.red, fontWeight: 'bold' }), attr.title('Last poll for new commits failed: ' + repo.PollError))];
+};
+// extraBuild returns whether the build is for an older commit of its branch, for
+// an earlier commit of a push or for a bisect, built in addition to the latest
+// commit.
+const extraBuild = (b) => !!b.PushBuildID && b.PushBuildID !== b.ID || !!b.BisectBuildID;
 const popupOpts = (opaque, ...kids) => {
 	const origFocus = document.activeElement;
 	const close = () => {
@@ -1280,6 +1517,7 @@ const popupRepoAdd = async (haveBubblewrap, haveGoToolchainDir) => {
 	let gocur;
 	let goprev;
 	let gonext;
+	let goparallel;
 	let fieldset;
 	let branchChanged = false;
 	let nameChanged = false;
@@ -1324,11 +1562,46 @@ const popupRepoAdd = async (haveBubblewrap, haveGoToolchainDir) => {
 			WebhookSecret: '',
 			AllowGlobalWebhookSecrets: false,
 			BuildScript: '',
+			BuildScriptPath: '',
 			HomeDiskUsage: 0,
 			GoAuto: goauto.checked,
 			GoCur: gocur.checked,
 			GoPrev: goprev.checked,
 			GoNext: gonext.checked,
+			GoParallel: goparallel.checked,
+			MaxBuilds: 0,
+			SupersedeBuilds: false,
+			SupersedeRunning: false,
+			MaxDuration: 0,
+			InactivityTimeout: 0,
+			MaxMemoryMB: 0,
+			MaxProcesses: 0,
+			MaxCPUSeconds: 0,
+			MaxOpenFiles: 0,
+			MaxFileSizeMB: 0,
+			Params: [],
+			Matrix: [],
+			Environment: [],
+			RunPrefix: [],
+			ReplaceRunPrefix: false,
+			BranchEnvs: [],
+			IncludeBranches: [],
+			ExcludeBranches: [],
+			IncludeTags: [],
+			ExcludeTags: [],
+			IncludePaths: [],
+			ExcludePaths: [],
+			ReleaseTags: false,
+			PushCommitBuilds: 0,
+			Bisect: false,
+			Downstreams: [],
+			Jobs: [],
+			PollInterval: 0,
+			PollBranches: [],
+			PollCommand: '',
+			PollLast: null,
+			PollError: '',
+			CommitStatus: { Forge: api.Forge.ForgeNone, URL: '', Repository: '', TokenSecret: '' },
 		};
 		const r = await authed(() => client.RepoCreate(password, repo), fieldset);
 		location.hash = '#repo/' + encodeURIComponent(r.Name);
@@ -1341,13 +1614,13 @@ const popupRepoAdd = async (haveBubblewrap, haveGoToolchainDir) => {
 		let s = t[t.length - 1] || t[t.length - 2] || '';
 		s = s.replace(/\.git$/, '');
 		name.value = s;
-	})), 'Name', name = dom.input(attr.required(''), function change() { nameChanged = true; }), dom.div('Default branch', style({ whiteSpace: 'nowrap' })), defaultBranch = dom.input(attr.value('main'), attr.placeholder('main, master, default'), function change() { branchChanged = true; }), dom.div(), dom.label(reuseUID = dom.input(attr.type('checkbox'), attr.checked('')), ' Reuse $HOME and UID for builds for this repo', attr.title('By reusing $HOME and running builds for this repository under the same UID, build caches can be used. This typically leads to faster builds but reduces isolation of builds.')), dom.div(), dom.label(bubblewrap = dom.input(attr.type('checkbox'), haveBubblewrap ? attr.checked('') : []), ' Run build script in bubblewrap, with limited system access', attr.title('Only available on Linux, with bubblewrap (bwrap) installed. Commands are run in a new mount namespace with access to system directories like /bin /lib /usr, and to the ding build, home and toolchain directories.')), dom.div(), dom.label(bubblewrapNoNet = dom.input(attr.type('checkbox'), haveBubblewrap ? attr.checked('') : []), ' Prevent network access from build script. Only active if bubblewrap is active.', attr.title('Hide network interfaces from the build script. Only a loopback device is available.')), dom.div('Build for Go toolchains', style({ whiteSpace: 'nowrap' }), attr.title('The build script will be run for each of the selected Go toolchains. The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.')), dom.div(dom.label(goauto = dom.input(attr.type('checkbox'), haveGoToolchainDir ? attr.checked('') : '', function change() {
+	})), 'Name', name = dom.input(attr.required(''), function change() { nameChanged = true; }), dom.div('Default branch', style({ whiteSpace: 'nowrap' })), defaultBranch = dom.input(attr.value('main'), attr.placeholder('main, master, default'), function change() { branchChanged = true; }), dom.div(), dom.label(reuseUID = dom.input(attr.type('checkbox'), attr.checked('')), ' Reuse $HOME and UID for builds for this repo', attr.title('By reusing $HOME and running builds for this repository under the same UID, build caches can be used. This typically leads to faster builds but reduces isolation of builds.')), dom.div(), dom.label(bubblewrap = dom.input(attr.type('checkbox'), haveBubblewrap ? attr.checked('') : []), ' Run build script in bubblewrap, with limited system access', attr.title('Only available on Linux, with bubblewrap (bwrap) installed. Commands are run in a new mount namespace with access to system directories like /bin /lib /usr, and to the ding build, home and toolchain directories.')), dom.div(), dom.label(bubblewrapNoNet = dom.input(attr.type('checkbox'), haveBubblewrap ? attr.checked('') : []), ' Prevent network access from build script. Only active if bubblewrap is active.', attr.title('Hide network interfaces from the build script. Only a loopback device is available.')), dom.div('Build for Go toolchains', style({ whiteSpace: 'nowrap' }), attr.title('The build script will be run for each of the selected Go toolchains, each in its own build step, e.g. "build:goprev". The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.')), dom.div(dom.label(goauto = dom.input(attr.type('checkbox'), haveGoToolchainDir ? attr.checked('') : '', function change() {
 		if (goauto.checked) {
 			gocur.checked = false;
 			goprev.checked = false;
 			gonext.checked = false;
 		}
-	}), ' Automatic', attr.title('Build for each of the available Go toolchains, go/goprev/gonext. At least one must be found or the build will fail.')), ' ', dom.label(gocur = dom.input(attr.type('checkbox'), function change() { goauto.checked = false; }), ' Go latest', attr.title('Latest patch version of latest stable Go toolchain version.')), ' ', dom.label(goprev = dom.input(attr.type('checkbox'), function change() { goauto.checked = false; }), ' Go previous', attr.title('Latest patch version of Go toolchain minor version before the latest stable.')), ' ', dom.label(gonext = dom.input(attr.type('checkbox'), function change() { goauto.checked = false; }), ' Go next', attr.title('Release candidate of Go toolchain, if available.')), ' '), dom.div(), dom.label(buildOnUpdatedToolchain = dom.input(attr.type('checkbox'), attr.checked('')), ' Schedule a low-priority build when new toolchains are automatically installed.')), dom.br(), dom.p('The build script can be configured after creating.'), dom.div(style({ textAlign: 'right' }), dom.submitbutton('Add')))));
+	}), ' Automatic', attr.title('Build for each of the available Go toolchains, go/goprev/gonext. At least one must be found or the build will fail.')), ' ', dom.label(gocur = dom.input(attr.type('checkbox'), function change() { goauto.checked = false; }), ' Go latest', attr.title('Latest patch version of latest stable Go toolchain version.')), ' ', dom.label(goprev = dom.input(attr.type('checkbox'), function change() { goauto.checked = false; }), ' Go previous', attr.title('Latest patch version of Go toolchain minor version before the latest stable.')), ' ', dom.label(gonext = dom.input(attr.type('checkbox'), function change() { goauto.checked = false; }), ' Go next', attr.title('Release candidate of Go toolchain, if available.')), ' ', dom.label(goparallel = dom.input(attr.type('checkbox')), ' Concurrently', attr.title('Run the build steps for the selected Go toolchains and build matrix concurrently instead of sequentially. All steps run to completion, instead of stopping at the first failure. Steps other than the first run in a copy of the checkout, at e.g. $DING_BUILDDIR/checkout-goprev-linux/$DING_CHECKOUTPATH.')), ' '), dom.div(), dom.label(buildOnUpdatedToolchain = dom.input(attr.type('checkbox'), attr.checked('')), ' Schedule a low-priority build when new toolchains are automatically installed.')), dom.br(), dom.p('The build script can be configured after creating.'), dom.div(style({ textAlign: 'right' }), dom.submitbutton('Add')))));
 	originInput.focus();
 };
 const pageHome = async () => {
@@ -1360,7 +1633,7 @@ const pageHome = async () => {
 	const rblFavicon = () => {
 		let busy = false;
 		for (const rb of rbl) {
-			for (const b of (rb.Builds || [])) {
+			for (const b of [...(rb.Builds || []), ...(rb.PullRequestBuilds || [])]) {
 				if (!b.Finish) {
 					busy = true;
 					break;
@@ -1386,20 +1659,25 @@ const pageHome = async () => {
 		}), ' ', dom.clickbutton('Build all lowprio', attr.title('Schedule builds for all repositories, but at low priority.'), async function click(e) {
 			await authed(() => client.BuildsCreateLowPrio(password), e.target);
 		})), dom.table(dom._class('striped', 'wide'), dom.thead(dom.tr(['Repo', 'Build ID', 'Status', 'Duration', 'Branch', 'Version', 'Coverage', 'Disk usage', 'Home disk usage', 'Age'].map(s => dom.th(s)), dom.th(style({ textAlign: 'left' }), 'Error'))), dom.tbody(rbl.length === 0 ? dom.tr(dom.td(attr.colspan('10'), 'No repositories', style({ textAlign: 'left' }))) : [], rbl.map(rb => {
-			if ((rb.Builds || []).length === 0) {
-				return dom.tr(dom.td(link('#repo/' + encodeURIComponent(rb.Repo.Name), rb.Repo.Name)));
+			const builds = [...(rb.Builds || []), ...(rb.PullRequestBuilds || [])];
+			if (builds.length === 0) {
+				return dom.tr(dom.td(link('#repo/' + encodeURIComponent(rb.Repo.Name), rb.Repo.Name), pollError(rb.Repo)));
 			}
-			return (rb.Builds || []).map((b, i) => dom.tr(i === 0 ? dom.td(link('#repo/' + encodeURIComponent(rb.Repo.Name), rb.Repo.Name), attr.rowspan('' + (rb.Builds || []).length)) : [], dom.td(link('#repo/' + encodeURIComponent(rb.Repo.Name) + '/build/' + b.ID, '' + b.ID)), dom.td(buildStatus(b)), dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''), dom.td(b.Branch), dom.td(b.Version, b.CommitHash ? attr.title('Commit ' + b.CommitHash) : []), dom.td(formatCoverage(rb.Repo, b)), dom.td(formatBuildSize(b)), i === 0 ? dom.td(attr.rowspan('' + (rb.Builds || []).length), rb.Repo.UID ? dom.span(formatSize(rb.Repo.HomeDiskUsage), attr.title('Of reused home directory')) : []) : [], dom.td(atexit.ageMins(b.Created, undefined)), dom.td(style({ textAlign: 'left' }), buildErrmsg(b))));
+			return builds.map((b, i) => dom.tr(i === 0 ? dom.td(link('#repo/' + encodeURIComponent(rb.Repo.Name), rb.Repo.Name), pollError(rb.Repo), attr.rowspan('' + builds.length)) : [], dom.td(link('#repo/' + encodeURIComponent(rb.Repo.Name) + '/build/' + b.ID, '' + b.ID)), dom.td(buildStatus(b)), dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''), dom.td(buildBranch(b)), dom.td(b.Version, b.CommitHash ? attr.title('Commit ' + b.CommitHash) : []), dom.td(formatCoverage(rb.Repo, b)), dom.td(formatBuildSize(b)), i === 0 ? dom.td(attr.rowspan('' + builds.length), rb.Repo.UID ? dom.span(formatSize(rb.Repo.HomeDiskUsage), attr.title('Of reused home directory')) : []) : [], dom.td(atexit.ageMins(b.Created, undefined)), dom.td(style({ textAlign: 'left' }), buildErrmsg(b))));
 		}))));
 	};
 	render();
 	page.subscribe(streams.build, (e) => {
+		// Only the latest commit of a branch is shown.
+		if (extraBuild(e.Build)) {
+			return;
+		}
 		const rbi = rbl.findIndex(rb => rb.Repo.Name === e.Build.RepoName);
 		if (rbi < 0) {
 			return;
 		}
 		const rb = rbl[rbi];
-		const builds = rb.Builds || [];
+		const builds = (e.Build.PullRequest ? rb.PullRequestBuilds : rb.Builds) || [];
 		const i = builds.findIndex(b => b.ID === e.Build.ID);
 		if (i < 0) {
 			builds.unshift(e.Build);
@@ -1407,7 +1685,12 @@ const pageHome = async () => {
 		else {
 			builds[i] = e.Build;
 		}
-		rb.Builds = builds;
+		if (e.Build.PullRequest) {
+			rb.PullRequestBuilds = builds;
+		}
+		else {
+			rb.Builds = builds;
+		}
 		rbl.splice(rbi, 1);
 		rbl.unshift(rb);
 		rblFavicon();
@@ -1419,6 +1702,7 @@ const pageHome = async () => {
 			return;
 		}
 		rb.Builds = (rb.Builds || []).filter(b => b.ID !== e.BuildID);
+		rb.PullRequestBuilds = (rb.PullRequestBuilds || []).filter(b => b.ID !== e.BuildID);
 		rblFavicon();
 		render();
 	});
@@ -1430,7 +1714,7 @@ const pageHome = async () => {
 				return;
 			}
 		}
-		rbl.unshift({ Repo: ev.Repo, Builds: [] });
+		rbl.unshift({ Repo: ev.Repo, Builds: [], PullRequestBuilds: [] });
 		render();
 	});
 	page.subscribe(streams.removeRepo, (ev) => {
@@ -1527,6 +1811,7 @@ const pageSettings = async () => {
 	let notifyEmailAddrs;
 	let runPrefix;
 	let environment;
+	let maxBuilds;
 	let automaticGoToolchains;
 	let goToolchainWebhookSecret;
 	let githubSecret;
@@ -1546,6 +1831,7 @@ const pageSettings = async () => {
 		settings.NotifyEmailAddrs = notifyEmailAddrs.value.split(',').map(s => s.trim()).filter(s => !!s);
 		settings.RunPrefix = runPrefix.value.split(' ').map(s => s.trim()).filter(s => !!s);
 		settings.Environment = environment.value.split('\n').map(s => s.trim()).filter(s => !!s);
+		settings.MaxBuilds = parseInt(maxBuilds.value) || 0;
 		settings.AutomaticGoToolchains = automaticGoToolchains.checked;
 		settings.GoToolchainWebhookSecret = goToolchainWebhookSecret.value;
 		settings.GithubWebhookSecret = githubSecret.value;
@@ -1556,7 +1842,7 @@ const pageSettings = async () => {
 	// autocomplete=off seems to be ignored by firefox, which also isn't smart enough
 	// to realize it doesn't make sense to store a password when there are 3 present in
 	// a form...
-	attr.autocomplete('off'), fieldset = dom.fieldset(dom.div(style({ display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top', maxWidth: '50em' }), dom.div('Notify email addresses', style({ whiteSpace: 'nowrap' }), attr.title('Comma-separated list of email address that will receive notifications when a build breaks or is fixed and a repository does not have its own addresses to notify configured.')), notifyEmailAddrs = dom.input(attr.value((settings.NotifyEmailAddrs || []).join(', ')), attr.placeholder('user@example.org, other@example.org')), dom.div('Clone and build command prefix', style({ whiteSpace: 'nowrap' }), attr.title('Can be used to run at lower priority and with timeout, e.g. "nice ionice -c 3 timeout 300s"')), runPrefix = dom.input(attr.value((settings.RunPrefix || []).join(' '))), dom.div('Additional environment variables', style({ whiteSpace: 'nowrap' }), attr.title('Of the form key=value, one per line.')), environment = dom.textarea((settings.Environment || []).map(s => s + '\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows('' + Math.max(8, (settings.Environment || []).length + 1))), dom.div(), dom.label(automaticGoToolchains = dom.input(attr.type('checkbox'), settings.AutomaticGoToolchains ? attr.checked('') : []), ' Automatic Go toolchain management', attr.title('Check once per day if new Go toolchains have been released, and automatically install them and update the go/goprev/gonext symlinks, and schedule low priority builds for repositories that have opted in.' + !haveGoToolchainDir ? ' Warning: No Go toolchain directory is configured in the configuration file.' : '')), dom.div('Secret for webhook for Go toolchains update', style({ whiteSpace: 'nowrap' }), attr.title('If configured, an HTTP POST request to the webhooks endpoint at /gotoolchain with a Authorization header with this value (e.g. "Bearer <random>") will attempt to automatically update Go toolchains, with a second attempt after 15 minutes if the first attempt failed.')), goToolchainWebhookSecret = dom.input(attr.value(settings.GoToolchainWebhookSecret), attr.placeholder('Bearer ...')), dom.div(style({ gridColumn: '1 / 3' }), 'Global webhook secrets (deprecated)', dom.p('For new repositories, unique webhooks are assigned to each repository. While global secrets are still configured, they will be accepted to start builds on all older repositories.')), dom.div('Github webhook secret', style({ whiteSpace: 'nowrap' })), githubSecret = dom.input(attr.value(settings.GithubWebhookSecret), attr.type('password'), attr.autocomplete('off')), dom.div('Gitea webhook secret', style({ whiteSpace: 'nowrap' })), giteaSecret = dom.input(attr.value(settings.GiteaWebhookSecret), attr.type('password'), attr.autocomplete('off')), dom.div('Bitbucket webhook secret', style({ whiteSpace: 'nowrap' })), bitbucketSecret = dom.input(attr.value(settings.BitbucketWebhookSecret), attr.type('password'), attr.autocomplete('off'))), dom.br(), dom.submitbutton('Save'))));
+	attr.autocomplete('off'), fieldset = dom.fieldset(dom.div(style({ display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top', maxWidth: '50em' }), dom.div('Notify email addresses', style({ whiteSpace: 'nowrap' }), attr.title('Comma-separated list of email address that will receive notifications when a build breaks or is fixed and a repository does not have its own addresses to notify configured.')), notifyEmailAddrs = dom.input(attr.value((settings.NotifyEmailAddrs || []).join(', ')), attr.placeholder('user@example.org, other@example.org')), dom.div('Clone and build command prefix', style({ whiteSpace: 'nowrap' }), attr.title('Can be used to run at lower priority and with timeout, e.g. "nice ionice -c 3 timeout 300s"')), runPrefix = dom.input(attr.value((settings.RunPrefix || []).join(' '))), dom.div('Additional environment variables', style({ whiteSpace: 'nowrap' }), attr.title('Of the form key=value, one per line.')), environment = dom.textarea((settings.Environment || []).map(s => s + '\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows('' + Math.max(8, (settings.Environment || []).length + 1))), dom.div('Max concurrent builds', style({ whiteSpace: 'nowrap' }), attr.title('Maximum number of builds to run concurrently, including low-priority builds. Zero means no limit. Queued builds are started in order, but builds for repositories with fewer running builds go first.')), maxBuilds = dom.input(attr.type('number'), attr.min('0'), attr.value('' + settings.MaxBuilds)), dom.div(), dom.label(automaticGoToolchains = dom.input(attr.type('checkbox'), settings.AutomaticGoToolchains ? attr.checked('') : []), ' Automatic Go toolchain management', attr.title('Check once per day if new Go toolchains have been released, and automatically install them and update the go/goprev/gonext symlinks, and schedule low priority builds for repositories that have opted in.' + !haveGoToolchainDir ? ' Warning: No Go toolchain directory is configured in the configuration file.' : '')), dom.div('Secret for webhook for Go toolchains update', style({ whiteSpace: 'nowrap' }), attr.title('If configured, an HTTP POST request to the webhooks endpoint at /gotoolchain with a Authorization header with this value (e.g. "Bearer <random>") will attempt to automatically update Go toolchains, with a second attempt after 15 minutes if the first attempt failed.')), goToolchainWebhookSecret = dom.input(attr.value(settings.GoToolchainWebhookSecret), attr.placeholder('Bearer ...')), dom.div(style({ gridColumn: '1 / 3' }), 'Global webhook secrets (deprecated)', dom.p('For new repositories, unique webhooks are assigned to each repository. While global secrets are still configured, they will be accepted to start builds on all older repositories.')), dom.div('Github webhook secret', style({ whiteSpace: 'nowrap' })), githubSecret = dom.input(attr.value(settings.GithubWebhookSecret), attr.type('password'), attr.autocomplete('off')), dom.div('Gitea webhook secret', style({ whiteSpace: 'nowrap' })), giteaSecret = dom.input(attr.value(settings.GiteaWebhookSecret), attr.type('password'), attr.autocomplete('off')), dom.div('Bitbucket webhook secret', style({ whiteSpace: 'nowrap' })), bitbucketSecret = dom.input(attr.value(settings.BitbucketWebhookSecret), attr.type('password'), attr.autocomplete('off'))), dom.br(), dom.submitbutton('Save'))));
 	return page;
 };
 const pageDocs = async () => {
@@ -1565,14 +1851,16 @@ const pageDocs = async () => {
 	dom._kids(crumbElem, link('#', 'Home'), ' / Docs');
 	document.title = 'Ding - Docs';
 	setFavicon(favicons.default);
-	dom._kids(pageElem, dom.h1('Introduction'), dom.p("Ding is a minimalistic build server for internal use. The goal is to make it easy to build software projects in an isolated environment, ensuring it also works on other people's machines. Ding clones a git or mercurial repository, or runs a custom shell script to clone a project, and runs a shell script to build the software. The shell script should output certain lines that ding recognizes, to find build results, test coverage, etc."), dom.h1('Notifications'), dom.p('Ding can be configured to send a notification email if a repo breaks (failed build) or is repaired again (successful build after previous failure)'), dom.h1('Webhooks'), dom.p('For each project to build, first configure a repository and a build script. Optionally configure the code repository to call a ding webhook to start a build. For git, this can be done with post-receive shell script in .git/hooks, or through various settings in web apps like gitea, github and bitbucket. For custom scripts, run ', dom.tt('ding kick baseURL repoName branch commit < password-file'), ' to start a build, where baseURL could be http://localhost:6084 (for default settings), and password is what you use for logging in. For externally-defined webhook formats, ensure the ding webhook listener is publicly accessible (e.g. through a reverse proxy), and configure these paths for the respective services: ', dom.tt('https://.../gitea/<repo>'), ', ', dom.tt('https://.../github/<repo>'), ' or ', dom.tt('https://.../bitbucket/<repo>/<secret>'), '. Gitea includes a "secret" in an Authorization header, github signs its request payload, for bitbucket you must include a secret value in the URL they send the webhook too. These secrets must be configured in the ding configuration file.'), dom.h1('Authentication'), dom.p('Ding only has simple password-based authentication, with a single password for the entire system. Everyone with the password can see all repositories, builds and scripts, and modify all data.'), dom.h1('Go toolchains'), dom.p('Ding has builtin functionality for downloading Go toolchains for use in builds. Triggered either through a daily check, or through a webhook call to /gotoolchain on the webhook endpoint.'), dom.h1('API'), dom.p('Ding has a simple HTTP/JSON-based API, see ', link('ding/', 'Ding API'), '.'), dom.h1('Files and directories'), dom.p('Ding stores all files for repositories, builds, releases and home directories in its "data" directory:'), dom.pre(`
+	dom._kids(pageElem, dom.h1('Introduction'), dom.p("Ding is a minimalistic build server for internal use. The goal is to make it easy to build software projects in an isolated environment, ensuring it also works on other people's machines. Ding clones a git or mercurial repository, or runs a custom shell script to clone a project, and runs a shell script to build the software. The shell script should output certain lines that ding recognizes, to find build results, test coverage, etc."), dom.h1('Notifications'), dom.p('Ding can be configured to send a notification email if a repo breaks (failed build) or is repaired again (successful build after previous failure)'), dom.h1('Webhooks'), dom.p('For each project to build, first configure a repository and a build script. Optionally configure the code repository to call a ding webhook to start a build. For git, this can be done with post-receive shell script in .git/hooks, or through various settings in web apps like gitea, github and bitbucket. For custom scripts, run ', dom.tt('ding kick baseURL repoName branch commit < password-file'), ' to start a build, where baseURL could be http://localhost:6084 (for default settings), and password is what you use for logging in. For externally-defined webhook formats, ensure the ding webhook listener is publicly accessible (e.g. through a reverse proxy), and configure these paths for the respective services: ', dom.tt('https://.../gitea/<repo>'), ', ', dom.tt('https://.../github/<repo>'), ' or ', dom.tt('https://.../bitbucket/<repo>/<secret>'), '. Gitea includes a "secret" in an Authorization header, github signs its request payload, for bitbucket you must include a secret value in the URL they send the webhook too. These secrets must be configured in the ding configuration file.'), dom.p('Pull request events from github and merge request events from gitea also start builds, when a pull request is opened, reopened or receives new commits. The head of the pull request is fetched from ref ', dom.tt('refs/pull/<number>/head'), ', and the build gets branch name ', dom.tt('pull/<number>'), '. Pull requests can come from anyone, so builds of pull requests do not get the secrets of the repository. Only the 3 most recent builds of each pull request are kept, for at most 14 days.'), dom.p('The result of builds can be reported back to github, gitea and bitbucket, as commit status with a link to the build, by configuring "Commit status" for a repository. The access token for the API of the forge is stored as a secret of the repository.'), dom.p('Repositories without webhooks, e.g. on plain SSH git servers or local mercurial repositories, can be polled for new commits. Ding runs ', dom.tt('git ls-remote'), ' or ', dom.tt('hg identify'), ' for the polled branches, or the configured poll command for VCS "command", and creates a build for each branch whose head differs from the commit of its latest build. An error from the last poll is shown with the repository.'), dom.p('For pushes with multiple commits through a github or gitea webhook, the earlier commits can also be built, by setting the number of commits of a push to build for a repository. The last commit is built as usual, the earlier commits get low-priority builds that do not count as the latest build of the branch. The build page shows the builds of all commits of the push, with the first failed commit highlighted.'), dom.p('For git repositories, failures can be bisected automatically. When a build of a branch fails after a successful build, ding builds commits in between with low-priority builds, one at a time, in a binary search for the first failing commit, following first parents of merges. The first failing commit is shown with the failed build and mentioned in the failure notification, which is sent when the bisect is done.'), dom.p('Repositories can have downstream repositories, that are built after a successful build, or after a release, of the upstream repository, e.g. services that depend on a library. Triggered builds get details of the upstream build in environment variables. Cycles of triggers are prevented: a repository is not triggered again by a chain of builds it started.'), dom.p('A repository can have additional named jobs, each with its own build script, branch, tag and path patterns, and Go toolchains, e.g. a quick lint job, a release job for tags, or a job per subproject of a monorepo. A single push builds the build script of the repository and each matching job, from a single repository configuration and webhook. Builds show the job they are for, and each job has its own history per branch, for notifications and commit statuses.'), dom.p('Pushed tags start a build of the tag, with branch name ', dom.tt('tags/<name>'), ' and the tag in ', dom.tt('$DING_TAG'), '. Builds of tags can be released automatically when successful. A tag can also be built with ', dom.tt('ding kick'), ' or through the web interface, with branch ', dom.tt('tags/<name>'), '.'), dom.p('Repositories can have include and exclude patterns for branches and tags, to only start builds for pushes of some branches or tags, e.g. to skip branches like "wip/*". The webhook responds with the reason a push was ignored.'), dom.p('Repositories can also have include and exclude patterns for paths. Builds are skipped when none of the files changed since the previous build of the branch are relevant, e.g. for changes to documentation only. Changed files are taken from the commits in the webhook payload if available, or determined with "git diff" after the clone. Skipped builds get status "skipped" and are removed after 30 days.'), dom.h1('Authentication'), dom.p('Ding only has simple password-based authentication, with a single password for the entire system. Everyone with the password can see all repositories, builds and scripts, and modify all data.'), dom.h1('Go toolchains'), dom.p('Ding has builtin functionality for downloading Go toolchains for use in builds. Triggered either through a daily check, or through a webhook call to /gotoolchain on the webhook endpoint.'), dom.h1('API'), dom.p('Ding has a simple HTTP/JSON-based API, see ', link('ding/', 'Ding API'), '.'), dom.h1('Files and directories'), dom.p('Ding stores all files for repositories, builds, releases and home directories in its "data" directory:'), dom.pre(`
 data/
 	build/<repoName>/<buildID>/		  ($DING_BUILDDIR during builds)
 		checkout/$DING_CHECKOUTPATH/  (working directory for build.sh)
+		checkout-<cell>/			  (copies of checkout, for concurrent build steps for Go toolchains and build matrix)
 		scripts/
 			build.sh				  (copied from database before build)
 		output/
-			{clone,build}.{stdout,stderr,output,nsec}
+			{clone,build,build:<goname>:<matrix values>}.{stdout,stderr,output,nsec}
+			steps					  (names of started steps)
 		home/						  (for builds with unique $HOME/uid)
 		dl/							  (files stored here are available at /dl/file/<repoName>/<buildID>/)
 	release/<repoName>/<buildID>/
@@ -1582,7 +1870,7 @@ data/
 	return page;
 };
 const docsBuildScript = () => {
-	return dom.div(dom.h1('Clone'), dom.p('Clones are run as the configured ding user, not under a unique/reused UID. After cloning, file permissions are fixed up. Configure an .ssh/config and/or ssh keys in the home directory of the ding user.'), dom.h1('Build script environment'), dom.p('The build script is run in a clean environment. It should exit with status 0 only when successful. Patterns in the output indicate where build results can be found, such as files and test coverage, see below.'), dom.p('The working directory is set to $DING_BUILDDIR/checkout/$DING_CHECKOUTPATH.'), dom.p('Only a single build will be run for a repository.'), dom.h2('Example'), dom.h3('Basic'), dom.p('Basic build for building ding from github, using the "Build for Go toolchain" setting.'), dom.pre(`#!/usr/bin/env bash
+	return dom.div(dom.h1('Clone'), dom.p('Clones are run as the configured ding user, not under a unique/reused UID. After cloning, file permissions are fixed up. Configure an .ssh/config and/or ssh keys in the home directory of the ding user.'), dom.h1('Build script environment'), dom.p('The build script is run in a clean environment. It should exit with status 0 only when successful. Patterns in the output indicate where build results can be found, such as files and test coverage, see below.'), dom.p('The working directory is set to $DING_BUILDDIR/checkout/$DING_CHECKOUTPATH.'), dom.p('The build script can be read from a file in the repository, e.g. ', dom.tt('.ding/build.sh'), ', by configuring a build script file. The file is read after the clone, at the commit being built, so changes to the script are versioned with the code, and builds of older commits run the script of that commit. If the file does not exist, the build script configured in ding is used. Each build shows the script it ran, and where it came from.'), dom.p('Build parameters configured for the repository are available as $DING_PARAM_<name>. Values can be set when creating a build, with ', dom.tt('ding kick -param name=value ...'), ', or with query string parameters like ', dom.tt('?param=name=value'), ' in webhook URLs. Parameters without a value get their default.'), dom.p('For repositories with a build matrix, the build script is run for each combination of values, with the value of each axis in the environment variable with the name of the axis. Output files of build steps that ran concurrently should have different names, e.g. with $GOOS in the name.'), dom.p('Secrets configured for the repository are available to the build script, not to clone commands, as environment variables with the name of the secret. For secrets stored as file, the variable holds the path of a file in $DING_BUILDDIR/secrets that is removed after the build. Values of secrets are replaced with "***" in the output of the build script.'), dom.p('Only a single build will be run for a repository.'), dom.h2('Example'), dom.h3('Basic'), dom.p('Basic build for building ding from github, using the "Build for Go toolchain" setting.'), dom.pre(`#!/usr/bin/env bash
 set -eu
 export CGO_ENABLED=0
 export GOFLAGS="-trimpath -mod=vendor"
@@ -1646,16 +1934,20 @@ fi
 # Reformat code, require versioned files did not change.
 go fmt ./...
 git diff --exit-code
-`), dom.br(), dom.p('You can include a script like the above in a repository, and call that.'), dom.p('Run a command like ', dom.tt('ding build -goauto ./build.sh'), ' locally to test build scripts. It sets up similar environment variables as during a normal build, and creates target directories. Then it clones the git or hg repository in the working directory to the temporary destination (first parameter) and builds using build.sh, isolated with bwrap. The resulting output is parsed and a summary printed. If that works, the script is likely to work with a regular build in ding too.'), dom.br(), dom.h2('Environment variables'), dom.ul(dom.li("$HOME, an initially empty directory; for repo's with per-build unique UIDs, equal to $DING_BUILDDIR/home, with reused $HOME/uid set to data/home/$DING_REPONAME."), dom.li('$DING_REPONAME, name of the repository'), dom.li('$DING_BRANCH, the branch of the build'), dom.li('$DING_COMMIT, the commit id/hash, empty if not yet known'), dom.li('$DING_BUILDID, the build number, unique over all builds in ding'), dom.li('$DING_BUILDDIR, where all files related to the build are stored, set to data/build/$DING_REPONAME/$DING_BUILDID/'), dom.li('$DING_DOWNLOADDIR, files stored here are available over HTTP at /dl/file/$DING_REPONAME/$DING_BUILDID/...'), dom.li('$DING_CHECKOUTPATH, where files are checked out as configured for the repository, relative to $DING_BUILDDIR/checkout/'), dom.li('$DING_TOOLCHAINDIR, only if configured, the directory where toolchains are stored, like the Go toolchains'), dom.li('any key/value pair from the "environment" object in the ding config file')), dom.p('If "Build for Go toolchains" is used, the following environment variables will also be set, and PATH is adjusted to include the selected Go toolchain:'), dom.ul(dom.li('$DING_GOTOOLCHAIN, with short name go/goprev/gonext'), dom.li('$DING_NEWGOTOOLCHAIN, set when the reason was a newly installed version of the Go toolchain'), dom.li('$GOTOOLCHAIN, set to version of selected Go toolchain, preventing Go from downloading newer Go toolchains')), dom.br(), dom.h2('Output patterns'), dom.p('The standard output of the release script is parsed for lines that can influence the build results. First word is the literal string, the later words are parameters.'), dom.p('Set the version of this build:'), dom.p(dom._class('indent'), dom.tt('version:', ' ', dom.i(dom._class('mono'), 'string'))), dom.p('Add file to build results:'), dom.p(dom._class('indent'), dom.tt('release:', ' ', dom.i(dom._class('mono'), 'command os arch toolchain path'))), dom.ul(dom.li(dom.i('command'), ' is the name of the command, as you would type it in a terminal'), dom.li(dom.i('os'), ' must be one of: ', dom.i('any, linux, darwin, openbsd, windows'), '; the OS this program can run on, ', dom.i('any'), ' is for platform-independent tools like a jar'), dom.li(dom.i('arch'), ' must be one of: ', dom.i('any, amd64, arm64'), '; similar to OS'), dom.li(dom.i('toolchain'), ' should describe the compiler and possibly other tools that are used to build this release'), dom.li(dom.i('path'), ' is the local path (either absolute or relative to the checkout directory) of the released file')), dom.p('Specify test coverage in percentage from 0 to 100 as floating point (an optional trailing "% ..." is ignored):'), dom.p(dom._class('indent'), dom.tt('coverage:', ' ', dom.i(dom._class('mono'), 'float'))), dom.p('Filename (must be relative to $DING_DOWNLOADDIR) for more details about the code coverage, e.g. an html coverage file:'), dom.p(dom._class('indent'), dom.tt('coverage-report:', ' ', dom.i(dom._class('mono'), 'file'))));
+`), dom.br(), dom.p('You can include a script like the above in a repository, and call that.'), dom.p('Run a command like ', dom.tt('ding build -goauto ./build.sh'), ' locally to test build scripts. It sets up similar environment variables as during a normal build, and creates target directories. Then it clones the git or hg repository in the working directory to the temporary destination (first parameter) and builds using build.sh, isolated with bwrap. The resulting output is parsed and a summary printed. If that works, the script is likely to work with a regular build in ding too.'), dom.br(), dom.h2('Environment variables'), dom.ul(dom.li("$HOME, an initially empty directory; for repo's with per-build unique UIDs, equal to $DING_BUILDDIR/home, with reused $HOME/uid set to data/home/$DING_REPONAME."), dom.li('$DING_REPONAME, name of the repository'), dom.li('$DING_BRANCH, the branch of the build, "pull/<number>" for pull requests, "tags/<name>" for tags'), dom.li('$DING_TAG, only for builds of tags, with the name of the tag'), dom.li('$DING_JOB, only for builds of a job of the repository, with the name of the job'), dom.li('$DING_UPSTREAM_REPONAME, $DING_UPSTREAM_BUILDID and $DING_UPSTREAM_VERSION, only for builds triggered by a build of an upstream repository, with the name of the upstream repository, and the ID and version of its build'), dom.li('$DING_PULLREQUEST, $DING_PULLREQUEST_SOURCE and $DING_PULLREQUEST_TARGET, only for builds of pull requests, with the number and source and target branch of the pull request'), dom.li('$DING_COMMIT, the commit id/hash, empty if not yet known'), dom.li('$DING_BUILDID, the build number, unique over all builds in ding'), dom.li('$DING_BUILDDIR, where all files related to the build are stored, set to data/build/$DING_REPONAME/$DING_BUILDID/'), dom.li('$DING_DOWNLOADDIR, files stored here are available over HTTP at /dl/file/$DING_REPONAME/$DING_BUILDID/...'), dom.li('$DING_CHECKOUTPATH, where files are checked out as configured for the repository, relative to $DING_BUILDDIR/checkout/'), dom.li('$DING_TOOLCHAINDIR, only if configured, the directory where toolchains are stored, like the Go toolchains'), dom.li('any key/value pair from the "environment" object in the ding config file')), dom.p('If "Build for Go toolchains" is used, the following environment variables will also be set, and PATH is adjusted to include the selected Go toolchain:'), dom.ul(dom.li('$DING_GOTOOLCHAIN, with short name go/goprev/gonext'), dom.li('$DING_NEWGOTOOLCHAIN, set when the reason was a newly installed version of the Go toolchain'), dom.li('$GOTOOLCHAIN, set to version of selected Go toolchain, preventing Go from downloading newer Go toolchains')), dom.br(), dom.h2('Output patterns'), dom.p('The standard output of the release script is parsed for lines that can influence the build results. First word is the literal string, the later words are parameters.'), dom.p('Set the version of this build:'), dom.p(dom._class('indent'), dom.tt('version:', ' ', dom.i(dom._class('mono'), 'string'))), dom.p('Add file to build results:'), dom.p(dom._class('indent'), dom.tt('release:', ' ', dom.i(dom._class('mono'), 'command os arch toolchain path'))), dom.ul(dom.li(dom.i('command'), ' is the name of the command, as you would type it in a terminal'), dom.li(dom.i('os'), ' must be one of: ', dom.i('any, linux, darwin, openbsd, windows'), '; the OS this program can run on, ', dom.i('any'), ' is for platform-independent tools like a jar'), dom.li(dom.i('arch'), ' must be one of: ', dom.i('any, amd64, arm64'), '; similar to OS'), dom.li(dom.i('toolchain'), ' should describe the compiler and possibly other tools that are used to build this release'), dom.li(dom.i('path'), ' is the local path (either absolute or relative to the checkout directory) of the released file')), dom.p('Specify test coverage in percentage from 0 to 100 as floating point (an optional trailing "% ..." is ignored):'), dom.p(dom._class('indent'), dom.tt('coverage:', ' ', dom.i(dom._class('mono'), 'float'))), dom.p('Filename (must be relative to $DING_DOWNLOADDIR) for more details about the code coverage, e.g. an html coverage file:'), dom.p(dom._class('indent'), dom.tt('coverage-report:', ' ', dom.i(dom._class('mono'), 'file'))), dom.p('Filename (must be relative to $DING_DOWNLOADDIR) with the output of "go test -json", for storing the results of the individual Go tests. Lines of "go test -json" written directly to standard output are picked up too. Test results are also stored for failed builds, and notifications about failing builds list the failing tests:'), dom.p(dom._class('indent'), dom.tt('go-test-json:', ' ', dom.i(dom._class('mono'), 'file'))), dom.p('Filename (must be relative to $DING_DOWNLOADDIR) of a JUnit XML report, e.g. from Java or JavaScript test runners. Test suites are stored like Go packages:'), dom.p(dom._class('indent'), dom.tt('junit:', ' ', dom.i(dom._class('mono'), 'file'))));
 };
 const pageRepo = async (repoName) => {
 	const page = new Page();
-	let [repo, builds0, [, mailEnabled, haveGoToolchainDir, settings]] = await authed(() => Promise.all([
+	let [repo, builds0, [, mailEnabled, haveGoToolchainDir, settings], schedules0, secrets0] = await authed(() => Promise.all([
 		client.Repo(password, repoName),
 		client.Builds(password, repoName),
 		client.Settings(password),
+		client.Schedules(password, repoName),
+		client.Secrets(password, repoName),
 	]));
 	let builds = builds0 || [];
+	let schedules = schedules0 || [];
+	let secrets = secrets0 || [];
 	if (builds.length === 0) {
 		setFavicon(favicons.gray);
 	}
@@ -1666,8 +1958,8 @@ const pageRepo = async (repoName) => {
 	const atexit = page.newAtexit();
 	const renderBuilds = () => {
 		atexit.run();
-		dom._kids(buildsElem, dom.h1('Builds'), dom.table(dom._class('striped', 'wide'), dom.thead(dom.tr(['ID', 'Branch', 'Status', 'Duration', 'Version', 'Coverage', 'Disk usage', 'Age'].map(s => dom.th(s)), dom.th(style({ textAlign: 'left' }), 'Error'), dom.th('Actions'))), dom.tbody(builds.length === 0 ? dom.tr(dom.td(attr.colspan('10'), 'No builds', style({ textAlign: 'left' }))) : [], builds.map(b => dom.tr(dom.td(link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + b.ID, '' + b.ID)), dom.td(b.Branch), dom.td(buildStatus(b)), dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''), dom.td(b.Version, b.CommitHash ? attr.title('Commit ' + b.CommitHash) : []), dom.td(formatCoverage(repo, b)), dom.td(formatBuildSize(b)), dom.td(atexit.ageMins(b.Created, undefined)), dom.td(style({ textAlign: 'left' }), buildErrmsg(b)), dom.td(dom.clickbutton('Rebuild', attr.title('Start new build.'), async function click(e) {
-			const nb = await authed(() => client.BuildCreate(password, repo.Name, b.Branch, b.CommitHash, false), e.target);
+		dom._kids(buildsElem, dom.h1('Builds'), repo.PollInterval && repo.PollError ? dom.p(style({ color: colors.red }), 'Last poll for new commits failed: ', repo.PollError) : [], dom.table(dom._class('striped', 'wide'), dom.thead(dom.tr(['ID', 'Branch', 'Status', 'Duration', 'Version', 'Coverage', 'Tests', 'Disk usage', 'Age'].map(s => dom.th(s)), dom.th(style({ textAlign: 'left' }), 'Error'), dom.th('Actions'))), dom.tbody(builds.length === 0 ? dom.tr(dom.td(attr.colspan('11'), 'No builds', style({ textAlign: 'left' }))) : [], builds.map(b => dom.tr(dom.td(link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + b.ID, '' + b.ID)), dom.td(buildBranch(b)), dom.td(buildStatus(b)), dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''), dom.td(b.Version, b.CommitHash ? attr.title('Commit ' + b.CommitHash) : []), dom.td(formatCoverage(repo, b)), dom.td(formatTests(b)), dom.td(formatBuildSize(b)), dom.td(atexit.ageMins(b.Created, undefined)), dom.td(style({ textAlign: 'left' }), buildErrmsg(b)), dom.td(dom.clickbutton('Rebuild', b.PullRequest ? [attr.disabled(''), attr.title('Builds for pull requests are only started through webhooks.')] : attr.title('Start new build.'), async function click(e) {
+			const nb = await authed(() => client.BuildCreateJob(password, repo.Name, b.Job, b.Branch, b.CommitHash, false, b.Params || []), e.target);
 			if (!builds.find(b => b.ID === nb.ID)) {
 				builds.unshift(nb);
 				renderBuilds();
@@ -1710,6 +2002,86 @@ const pageRepo = async (repoName) => {
 		}
 		renderBuilds();
 	});
+	page.subscribe(streams.repo, (e) => {
+		if (e.Repo.Name !== repo.Name) {
+			return;
+		}
+		// Only the state of polling, the settings form is not updated.
+		repo.PollLast = e.Repo.PollLast;
+		repo.PollError = e.Repo.PollError;
+		renderBuilds();
+	});
+	const schedulesElem = dom.div();
+	const renderSchedules = () => {
+		let branch;
+		let cron;
+		let lowprio;
+		let fieldset;
+		dom._kids(schedulesElem, dom.h1('Schedules'), dom.p('Builds are created periodically for schedules, e.g. nightly builds. Times are in crontab format, in the time zone of the ding server.'), dom.table(dom._class('striped', 'wide'), dom.thead(dom.tr(['Branch', 'Schedule', 'Low priority', 'Next build', 'Last build', 'Actions'].map(s => dom.th(s)))), dom.tbody(schedules.length === 0 ? dom.tr(dom.td(attr.colspan('6'), 'No schedules', style({ textAlign: 'left' }))) : [], schedules.map(s => dom.tr(dom.td(s.Branch || dom.span(repo.DefaultBranch, attr.title('Default branch.'))), dom.td(dom.tt(s.Cron)), dom.td(s.LowPrio ? 'yes' : 'no'), dom.td(s.Next.toLocaleString(), attr.title(s.Next.toString())), dom.td(s.LastBuildID ? link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + s.LastBuildID, '' + s.LastBuildID) : '-'), dom.td(dom.clickbutton('Remove', attr.title('Remove schedule. Builds created by the schedule are kept.'), async function click(e) {
+			await authed(() => client.ScheduleRemove(password, repo.Name, s.ID), e.target);
+			schedules = schedules.filter(xs => xs.ID !== s.ID);
+			renderSchedules();
+		})))))), dom.br(), dom.form(async function submit(e) {
+			e.stopPropagation();
+			e.preventDefault();
+			const ns = {
+				ID: 0,
+				RepoName: repo.Name,
+				Branch: branch.value,
+				Cron: cron.value,
+				LowPrio: lowprio.checked,
+				Next: new Date(),
+				LastBuildID: 0,
+			};
+			const s = await authed(() => client.ScheduleCreate(password, ns), fieldset);
+			if (!schedules.find(xs => xs.ID === s.ID)) {
+				schedules.push(s);
+			}
+			renderSchedules();
+		}, fieldset = dom.fieldset(branch = dom.input(attr.placeholder('Branch, empty for default'), attr.title('Branch to build. If empty, the default branch of the repository is built.')), ' ', cron = dom.input(attr.required(''), attr.placeholder('0 3 * * *'), attr.title('Minute, hour, day of month, month, day of week. Fields can be "*", a number or name, a range like "1-5", a list like "1,15", and have a step like "*/15". Shorthands @hourly, @daily, @weekly, @monthly and @yearly are also accepted.')), ' ', dom.label(lowprio = dom.input(attr.type('checkbox')), ' Low priority', attr.title('Create low-priority builds, only started when no other builds are in progress.')), ' ', dom.submitbutton('Add schedule'))));
+	};
+	renderSchedules();
+	page.subscribe(streams.schedule, (e) => {
+		if (e.Schedule.RepoName !== repo.Name) {
+			return;
+		}
+		const i = schedules.findIndex(s => s.ID === e.Schedule.ID);
+		if (i < 0) {
+			schedules.push(e.Schedule);
+		}
+		else {
+			schedules[i] = e.Schedule;
+		}
+		renderSchedules();
+	});
+	page.subscribe(streams.removeSchedule, (e) => {
+		if (e.RepoName !== repo.Name) {
+			return;
+		}
+		schedules = schedules.filter(s => s.ID !== e.ScheduleID);
+		renderSchedules();
+	});
+	const secretsElem = dom.div();
+	const renderSecrets = () => {
+		let name;
+		let value;
+		let file;
+		let fieldset;
+		dom._kids(secretsElem, dom.h1('Secrets'), dom.p('Secrets are available to the build script as environment variables, or as files with the environment variable holding the path. Values are stored encrypted, cannot be viewed after saving, and are replaced with "***" in the build output. Builds of pull requests do not get secrets.'), dom.table(dom._class('striped', 'wide'), dom.thead(dom.tr(['Name', 'Type', 'Updated', 'Actions'].map(s => dom.th(s)))), dom.tbody(secrets.length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'No secrets', style({ textAlign: 'left' }))) : [], secrets.map(s => dom.tr(dom.td(dom.tt(s.Name)), dom.td(s.File ? 'file' : 'environment'), dom.td(s.Updated.toLocaleString(), attr.title(s.Updated.toString())), dom.td(dom.clickbutton('Remove', async function click(e) {
+			await authed(() => client.SecretRemove(password, repo.Name, s.Name), e.target);
+			secrets = secrets.filter(xs => xs.ID !== s.ID);
+			renderSecrets();
+		})))))), dom.br(), dom.form(async function submit(e) {
+			e.stopPropagation();
+			e.preventDefault();
+			const s = await authed(() => client.SecretSave(password, repo.Name, name.value, value.value, file.checked), fieldset);
+			secrets = secrets.filter(xs => xs.ID !== s.ID);
+			secrets.push(s);
+			secrets.sort((a, b) => a.Name < b.Name ? -1 : 1);
+			renderSecrets();
+		}, fieldset = dom.fieldset(dom.div(name = dom.input(attr.required(''), attr.placeholder('NAME'), attr.title('Name of the environment variable. Saving a secret with an existing name replaces it.')), ' ', dom.label(file = dom.input(attr.type('checkbox')), ' As file', attr.title('Write the value to a file in the build directory, and set the environment variable to its path. For e.g. SSH keys. The file is removed after the build.'))), dom.div(value = dom.textarea(attr.required(''), attr.placeholder('Value'), attr.rows('3'), style({ width: '100%' }))), dom.div(dom.submitbutton('Save secret')))));
+	};
+	renderSecrets();
 	let name;
 	let vcs;
 	let origin;
@@ -1726,11 +2098,98 @@ const pageRepo = async (repoName) => {
 	let gocur;
 	let goprev;
 	let gonext;
+	let goparallel;
 	let notifyEmailAddrs;
+	let maxBuilds;
+	let supersedeBuilds;
+	let supersedeRunning;
+	let maxDuration;
+	let inactivityTimeout;
+	let maxMemoryMB;
+	let maxProcesses;
+	let maxCPUSeconds;
+	let maxOpenFiles;
+	let maxFileSizeMB;
+	let params;
+	let matrix;
+	let environment;
+	let runPrefix;
+	let replaceRunPrefix;
+	let branchEnvsBox;
+	let downstreamsBox;
 	let webhookSecret;
 	let allowGlobalWebhookSecrets;
+	let includeBranches;
+	let excludeBranches;
+	let includeTags;
+	let excludeTags;
+	let includePaths;
+	let excludePaths;
+	let releaseTags;
+	let pushCommitBuilds;
+	let bisectFailures;
+	let pollInterval;
+	let pollBranches;
+	let pollCommand;
+	let commitStatusForge;
+	let commitStatusURL;
+	let commitStatusRepository;
+	let commitStatusTokenSecret;
 	let buildScript;
+	let buildScriptPath;
+	let jobsBox;
 	let fieldset;
+	let branchEnvViews = [];
+	const newBranchEnvView = (be) => {
+		let pattern;
+		let environment;
+		let runPrefix;
+		let replaceRunPrefix;
+		const root = dom.div(style({ marginBottom: '1ex' }), dom.div(pattern = dom.input(attr.required(''), attr.value(be.Pattern), attr.placeholder('release/*'), attr.title('Pattern for branch names, with * matching any text except slashes, ? matching a single character, and [...] for character classes.')), ' ', runPrefix = dom.input(attr.value((be.RunPrefix || []).join(' ')), attr.placeholder('Command prefix'), attr.title('Commands prefixed to the clone and build commands, appended to the prefix so far.')), ' ', dom.label(replaceRunPrefix = dom.input(attr.type('checkbox'), be.ReplaceRunPrefix ? attr.checked('') : []), ' Replace prefix', attr.title('Use this command prefix instead of the prefix so far.')), ' ', dom.clickbutton('Remove', function click() {
+			branchEnvViews = branchEnvViews.filter(v => v.root !== root);
+			root.remove();
+		})), environment = dom.textarea((be.Environment || []).map(s => s + '\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows('' + Math.max(2, (be.Environment || []).length + 1))));
+		return { root: root, pattern: pattern, environment: environment, runPrefix: runPrefix, replaceRunPrefix: replaceRunPrefix };
+	};
+	let downstreamViews = [];
+	const newDownstreamView = (d) => {
+		let repoName;
+		let upstreamBranch;
+		let branch;
+		let condition;
+		const root = dom.div(style({ marginBottom: '1ex' }), repoName = dom.input(attr.required(''), attr.value(d.Repo), attr.placeholder('Repository'), attr.title('Name of the downstream repository to build.')), ' ', upstreamBranch = dom.input(attr.value(d.UpstreamBranch), attr.placeholder('Upstream branch'), attr.title('Pattern for branches of this repository whose builds trigger a build, with * matching any text except slashes. The default branch if empty.')), ' ', branch = dom.input(attr.value(d.Branch), attr.placeholder('Branch'), attr.title('Branch of the downstream repository to build. Its default branch if empty.')), ' ', condition = dom.select(dom.option('On success', attr.value('success'), d.Condition === api.DownstreamCondition.DownstreamSuccess ? attr.selected('') : []), dom.option('On release', attr.value('release'), d.Condition === api.DownstreamCondition.DownstreamRelease ? attr.selected('') : [])), ' ', dom.clickbutton('Remove', function click() {
+			downstreamViews = downstreamViews.filter(v => v.root !== root);
+			root.remove();
+		}));
+		return { root: root, repoName: repoName, upstreamBranch: upstreamBranch, branch: branch, condition: condition };
+	};
+	let jobViews = [];
+	const newJobView = (j) => {
+		let name;
+		let goauto;
+		let gocur;
+		let goprev;
+		let gonext;
+		let includeBranches;
+		let excludeBranches;
+		let includeTags;
+		let excludeTags;
+		let includePaths;
+		let excludePaths;
+		let buildScript;
+		let buildScriptPath;
+		const root = dom.div(style({ marginBottom: '2ex' }), dom.div(style({ marginBottom: '.5ex' }), name = dom.input(attr.required(''), attr.value(j.Name), attr.placeholder('Name, e.g. lint'), attr.title('Name of the job, with letters, digits and any of ._-, available to builds as $DING_JOB.')), ' ', dom.label(goauto = dom.input(attr.type('checkbox'), j.GoAuto ? attr.checked('') : [], function change() {
+			if (goauto.checked) {
+				gocur.checked = false;
+				goprev.checked = false;
+				gonext.checked = false;
+			}
+		}), ' Go auto'), ' ', dom.label(gocur = dom.input(attr.type('checkbox'), j.GoCur ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go latest'), ' ', dom.label(goprev = dom.input(attr.type('checkbox'), j.GoPrev ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go previous'), ' ', dom.label(gonext = dom.input(attr.type('checkbox'), j.GoNext ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go next'), ' ', dom.clickbutton('Remove', function click() {
+			jobViews = jobViews.filter(v => v.root !== root);
+			root.remove();
+		})), dom.div(style({ display: 'grid', columnGap: '.5em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr 1fr', marginBottom: '.5ex' }), 'Branches', includeBranches = dom.input(attr.value((j.IncludeBranches || []).join(' ')), attr.placeholder('Include')), excludeBranches = dom.input(attr.value((j.ExcludeBranches || []).join(' ')), attr.placeholder('Exclude')), 'Tags', includeTags = dom.input(attr.value((j.IncludeTags || []).join(' ')), attr.placeholder('Include')), excludeTags = dom.input(attr.value((j.ExcludeTags || []).join(' ')), attr.placeholder('Exclude')), 'Paths', includePaths = dom.input(attr.value((j.IncludePaths || []).join(' ')), attr.placeholder('Include, e.g. cmd/tool/')), excludePaths = dom.input(attr.value((j.ExcludePaths || []).join(' ')), attr.placeholder('Exclude')), dom.div('Script file', style({ whiteSpace: 'nowrap' })), buildScriptPath = dom.input(attr.value(j.BuildScriptPath), attr.placeholder('e.g. .ding/lint.sh'), attr.title('Path of a file in the checkout with the build script of the job, read at the built commit. The build script below is used if the file does not exist.'), style({ gridColumn: 'span 2' }))), buildScript = dom.textarea(j.BuildScript, attr.required(''), attr.rows('8'), style({ width: '100%' })));
+		return { root: root, name: name, goauto: goauto, gocur: gocur, goprev: goprev, gonext: gonext, includeBranches: includeBranches, excludeBranches: excludeBranches, includeTags: includeTags, excludeTags: excludeTags, includePaths: includePaths, excludePaths: excludePaths, buildScript: buildScript, buildScriptPath: buildScriptPath };
+	};
 	const originTextareaBox = dom.div(originTextarea = dom.textarea(repo.Origin, attr.required(''), attr.rows('5'), style({ width: '100%' })), dom.div('Script that clones a repository into checkout/$DING_CHECKOUTPATH.'), dom.div('Typically starts with "#!/bin/sh".'), dom.div('It must print a line of the form "commit: ...".'), dom.br());
 	const vcsChanged = function change() {
 		if (vcs.value !== 'command') {
@@ -1757,23 +2216,33 @@ const pageRepo = async (repoName) => {
 		}), ' ', repo.UID ? dom.clickbutton('Clear home directory', attr.title('Remove shared home directory for this build.'), async function click(e) {
 			await authed(() => client.RepoClearHomedir(password, repo.Name), e.target);
 		}) : [], ' ', dom.clickbutton('Build', attr.title('Start a build for the default branch of this repository.'), async function click(e) {
-			const nb = await authed(() => client.BuildCreate(password, repo.Name, repo.DefaultBranch, '', false), e.target);
+			const nb = await authed(() => client.BuildCreate(password, repo.Name, repo.DefaultBranch, '', false, []), e.target);
 			location.hash = '#repo/' + encodeURIComponent(repo.Name) + '/build/' + nb.ID;
 		}), ' ', dom.clickbutton('Build ...', attr.title('Create build for specific branch, possibly low-priority.'), async function click() {
 			let branch;
 			let commit;
 			let lowprio;
+			let job;
+			const paramInputs = (repo.Params || []).map(p => dom.input(attr.value(p.Value)));
 			const close = popup(dom.h1('New build'), dom.form(async function submit(e) {
 				e.stopPropagation();
 				e.preventDefault();
-				const nb = await authed(() => client.BuildCreate(password, repo.Name, branch.value, commit.value, lowprio.checked), fieldset);
+				const nb = await authed(() => client.BuildCreateJob(password, repo.Name, job ? job.value : '', branch.value, commit.value, lowprio.checked, (repo.Params || []).map((p, i) => ({ Name: p.Name, Value: paramInputs[i].value }))), fieldset);
 				if (!builds.find(b => b.ID === nb.ID)) {
 					builds.unshift(nb);
 					renderBuilds();
 				}
 				close();
-			}, dom.fieldset(dom.div(style({ display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top' }), 'Branch', branch = dom.input(attr.required(''), attr.value(repo.DefaultBranch)), dom.div('Commit (optional)', style({ whiteSpace: 'nowrap' })), commit = dom.input(), dom.div(), dom.label(lowprio = dom.input(attr.type('checkbox')), ' Low priority', attr.title('Create build, but only start it when there are no others in progress.'))), dom.br(), dom.submitbutton('Create'))));
+			}, dom.fieldset(dom.div(style({ display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top' }), (repo.Jobs || []).length === 0 ? [] : [
+				'Job',
+				job = dom.select(dom.option('Build script of repository', attr.value('')), (repo.Jobs || []).map(j => dom.option(j.Name))),
+			], 'Branch', branch = dom.input(attr.required(''), attr.value(repo.DefaultBranch)), dom.div('Commit (optional)', style({ whiteSpace: 'nowrap' })), commit = dom.input(), (repo.Params || []).map((p, i) => [
+				dom.div(dom.tt(p.Name), attr.title('Build parameter, available as $DING_PARAM_' + p.Name + '.')),
+				paramInputs[i],
+			]), dom.div(), dom.label(lowprio = dom.input(attr.type('checkbox')), ' Low priority', attr.title('Create build, but only start it when there are no others in progress.'))), dom.br(), dom.submitbutton('Create'))));
 			branch.focus();
+		}), ' ', dom.clickbutton('Cancel queued builds', attr.title('Cancel all builds for this repository that are waiting to start. Running builds are not affected.'), async function click(e) {
+			await authed(() => client.QueueCancelRepo(password, repo.Name), e.target);
 		})),
 		dom.div(style({ display: 'grid', gap: '1em', gridTemplateColumns: '1fr 1fr', justifyItems: 'stretch' }), buildsElem, dom.div(style({ maxWidth: '50em' }), dom.div(dom.h1('Repository settings'), dom.form(async function submit(e) {
 			e.stopPropagation();
@@ -1792,23 +2261,111 @@ const pageRepo = async (repoName) => {
 				WebhookSecret: webhookSecret.value,
 				AllowGlobalWebhookSecrets: allowGlobalWebhookSecrets.checked,
 				BuildScript: buildScript.value,
+				BuildScriptPath: buildScriptPath.value,
 				HomeDiskUsage: 0,
 				GoAuto: goauto.checked,
 				GoCur: gocur.checked,
 				GoPrev: goprev.checked,
 				GoNext: gonext.checked,
+				GoParallel: goparallel.checked,
+				MaxBuilds: parseInt(maxBuilds.value) || 0,
+				SupersedeBuilds: supersedeBuilds.checked,
+				SupersedeRunning: supersedeRunning.checked,
+				MaxDuration: parseInt(maxDuration.value) || 0,
+				InactivityTimeout: parseInt(inactivityTimeout.value) || 0,
+				MaxMemoryMB: parseInt(maxMemoryMB.value) || 0,
+				MaxProcesses: parseInt(maxProcesses.value) || 0,
+				MaxCPUSeconds: parseInt(maxCPUSeconds.value) || 0,
+				MaxOpenFiles: parseInt(maxOpenFiles.value) || 0,
+				MaxFileSizeMB: parseInt(maxFileSizeMB.value) || 0,
+				Params: params.value.split('\n').map(s => s.trim()).filter(s => !!s).map(s => {
+					const t = s.split('=');
+					return { Name: t[0], Value: t.slice(1).join('=') };
+				}),
+				Matrix: matrix.value.split('\n').map(s => s.trim()).filter(s => !!s).map(s => {
+					const t = s.split('=');
+					return { Name: t[0].trim(), Values: t.slice(1).join('=').split(' ').map(s => s.trim()).filter(s => !!s) };
+				}),
+				Environment: environment.value.split('\n').map(s => s.trim()).filter(s => !!s),
+				RunPrefix: runPrefix.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				ReplaceRunPrefix: replaceRunPrefix.checked,
+				BranchEnvs: branchEnvViews.map(v => {
+					return {
+						Pattern: v.pattern.value,
+						Environment: v.environment.value.split('\n').map(s => s.trim()).filter(s => !!s),
+						RunPrefix: v.runPrefix.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						ReplaceRunPrefix: v.replaceRunPrefix.checked,
+					};
+				}),
+				IncludeBranches: includeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				ExcludeBranches: excludeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				IncludeTags: includeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				ExcludeTags: excludeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				IncludePaths: includePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				ExcludePaths: excludePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				ReleaseTags: releaseTags.checked,
+				PushCommitBuilds: parseInt(pushCommitBuilds.value) || 0,
+				Bisect: bisectFailures.checked,
+				Downstreams: downstreamViews.map(v => {
+					return {
+						Repo: v.repoName.value,
+						UpstreamBranch: v.upstreamBranch.value,
+						Branch: v.branch.value,
+						Condition: v.condition.value,
+					};
+				}),
+				Jobs: jobViews.map(v => {
+					return {
+						Name: v.name.value,
+						BuildScript: v.buildScript.value,
+						BuildScriptPath: v.buildScriptPath.value,
+						IncludeBranches: v.includeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						ExcludeBranches: v.excludeBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						IncludeTags: v.includeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						ExcludeTags: v.excludeTags.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						IncludePaths: v.includePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						ExcludePaths: v.excludePaths.value.split(' ').map(s => s.trim()).filter(s => !!s),
+						GoAuto: v.goauto.checked,
+						GoCur: v.gocur.checked,
+						GoPrev: v.goprev.checked,
+						GoNext: v.gonext.checked,
+					};
+				}),
+				PollInterval: parseInt(pollInterval.value) || 0,
+				PollBranches: pollBranches.value.split(' ').map(s => s.trim()).filter(s => !!s),
+				PollCommand: pollCommand.value,
+				PollLast: null,
+				PollError: '',
+				CommitStatus: {
+					Forge: commitStatusForge.value,
+					URL: commitStatusURL.value,
+					Repository: commitStatusRepository.value,
+					TokenSecret: commitStatusTokenSecret.value,
+				},
 			};
 			repo = await authed(() => client.RepoSave(password, nr), fieldset);
 			dom._kids(pageElem, render());
-		}, fieldset = dom.fieldset(dom.div(style({ display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top' }), 'Name', name = dom.input(attr.disabled(''), attr.value(repo.Name)), dom.span('VCS', attr.title('Clones are run as the configured ding user, not under a unique/reused UID. After cloning, file permissions are fixed up. Configure an .ssh/config and/or ssh keys in the home directory of the ding user.')), vcs = dom.select(dom.option('git', repo.VCS == 'git' ? attr.selected('') : []), dom.option('mercurial', repo.VCS == 'mercurial' ? attr.selected('') : []), dom.option('command', repo.VCS == 'command' ? attr.selected('') : []), vcsChanged), 'Origin', originBox = dom.div(originInput = origin = dom.input(attr.value(repo.Origin), attr.required(''), attr.placeholder('https://... or ssh://... or user@host:path.git'), style({ width: '100%' }))), dom.div('Default branch', style({ whiteSpace: 'nowrap' })), defaultBranch = dom.input(attr.value(repo.DefaultBranch), attr.placeholder('main, master, default')), dom.div('Checkout path', style({ whiteSpace: 'nowrap' })), checkoutPath = dom.input(attr.value(repo.CheckoutPath), attr.required(''), attr.title('Name of the directory to checkout the repository. Go builds may use this name for the binary it creates.')), dom.div('Notify email addresses', style({ whiteSpace: 'nowrap' }), mailEnabled ? [] : [' *', attr.title('No SMTP server is configured for outgoing emails.')]), notifyEmailAddrs = dom.input(attr.value((repo.NotifyEmailAddrs || []).join(', ')), attr.title('Comma-separated list of email address that will receive notifications when a build breaks or is fixed. If empty, the email address configured in the configuration file receives a notification, if any.'), attr.placeholder((settings.NotifyEmailAddrs || []).join(', ') || 'user@example.org, other@example.org')), dom.div(), dom.label(reuseUID = dom.input(attr.type('checkbox'), repo.UID !== null ? attr.checked('') : []), ' Reuse $HOME and UID for builds for this repo', attr.title('By reusing $HOME and running builds for this repository under the same UID, build caches can be used. This typically leads to faster builds but reduces isolation of builds.')), dom.div(), dom.label(bubblewrap = dom.input(attr.type('checkbox'), repo.Bubblewrap ? attr.checked('') : []), ' Run build script in bubblewrap, with limited system access', attr.title('Only available on Linux, with bubblewrap (bwrap) installed. Commands are run in a new mount namespace with access to system directories like /bin /lib /usr, and to the ding build, home and toolchain directories.')), dom.div(), dom.label(bubblewrapNoNet = dom.input(attr.type('checkbox'), repo.BubblewrapNoNet ? attr.checked('') : []), ' Prevent network access from build script. Only active if bubblewrap is active.', attr.title('Hide network interfaces from the build script. Only a loopback device is available.')), dom.div('Build for Go toolchains', style({ whiteSpace: 'nowrap' }), attr.title('The build script will be run for each of the selected Go toolchains. The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.' + !haveGoToolchainDir ? ' Warning: No Go toolchain directory is configured in the configuration file.' : '')), dom.div(dom.label(goauto = dom.input(attr.type('checkbox'), repo.GoAuto ? attr.checked('') : [], function change() {
+		}, fieldset = dom.fieldset(dom.div(style({ display: 'grid', columnGap: '1em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr', alignItems: 'top' }), 'Name', name = dom.input(attr.disabled(''), attr.value(repo.Name)), dom.span('VCS', attr.title('Clones are run as the configured ding user, not under a unique/reused UID. After cloning, file permissions are fixed up. Configure an .ssh/config and/or ssh keys in the home directory of the ding user.')), vcs = dom.select(dom.option('git', repo.VCS == 'git' ? attr.selected('') : []), dom.option('mercurial', repo.VCS == 'mercurial' ? attr.selected('') : []), dom.option('command', repo.VCS == 'command' ? attr.selected('') : []), vcsChanged), 'Origin', originBox = dom.div(originInput = origin = dom.input(attr.value(repo.Origin), attr.required(''), attr.placeholder('https://... or ssh://... or user@host:path.git'), style({ width: '100%' }))), dom.div('Default branch', style({ whiteSpace: 'nowrap' })), defaultBranch = dom.input(attr.value(repo.DefaultBranch), attr.placeholder('main, master, default')), dom.div('Checkout path', style({ whiteSpace: 'nowrap' })), checkoutPath = dom.input(attr.value(repo.CheckoutPath), attr.required(''), attr.title('Name of the directory to checkout the repository. Go builds may use this name for the binary it creates.')), dom.div('Notify email addresses', style({ whiteSpace: 'nowrap' }), mailEnabled ? [] : [' *', attr.title('No SMTP server is configured for outgoing emails.')]), notifyEmailAddrs = dom.input(attr.value((repo.NotifyEmailAddrs || []).join(', ')), attr.title('Comma-separated list of email address that will receive notifications when a build breaks or is fixed. If empty, the email address configured in the configuration file receives a notification, if any.'), attr.placeholder((settings.NotifyEmailAddrs || []).join(', ') || 'user@example.org, other@example.org')), dom.div('Max concurrent builds', style({ whiteSpace: 'nowrap' }), attr.title('Builds for different branches of this repository can run concurrently, up to this number. Builds for the same branch never run concurrently. Zero means 1.')), maxBuilds = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxBuilds)), dom.div(), dom.label(supersedeBuilds = dom.input(attr.type('checkbox'), repo.SupersedeBuilds ? attr.checked('') : []), ' Supersede waiting builds for a branch by a new build', attr.title('When a new build for a branch is created, builds for that branch that are waiting to start are cancelled and marked as superseded. Low-priority builds do not supersede other builds.')), dom.div(), dom.label(supersedeRunning = dom.input(attr.type('checkbox'), repo.SupersedeRunning ? attr.checked('') : []), ' Also cancel a running build for the branch', attr.title('Along with superseding waiting builds, also cancel a running build for the branch.')), dom.div('Max duration (seconds)', style({ whiteSpace: 'nowrap' }), attr.title('Maximum duration in seconds for the clone and build steps together. If the build takes longer, it is cancelled with status timeout. Zero means no limit.')), maxDuration = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxDuration)), dom.div('Inactivity timeout (seconds)', style({ whiteSpace: 'nowrap' }), attr.title('If the clone or build commands do not write output for this many seconds, the build is assumed to be stuck and is cancelled with status timeout. Zero means no limit.')), inactivityTimeout = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.InactivityTimeout)), dom.div('Max memory (MB)', style({ whiteSpace: 'nowrap' }), attr.title('Maximum memory for the build script. If ding is configured with a cgroup directory, the limit is for all processes of the build together, otherwise it limits the address space of each process. Zero means no limit.')), maxMemoryMB = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxMemoryMB)), dom.div('Max processes', style({ whiteSpace: 'nowrap' }), attr.title('Maximum number of processes for the build script. If ding is configured with a cgroup directory, the limit is for the processes of the build, otherwise for all processes of the UID of the build. Zero means no limit.')), maxProcesses = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxProcesses)), dom.div('Max CPU time (seconds)', style({ whiteSpace: 'nowrap' }), attr.title('Maximum CPU time for each process of the build script. Zero means no limit.')), maxCPUSeconds = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxCPUSeconds)), dom.div('Max open files', style({ whiteSpace: 'nowrap' }), attr.title('Maximum number of open files for each process of the build script. Zero means no limit.')), maxOpenFiles = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxOpenFiles)), dom.div('Max file size (MB)', style({ whiteSpace: 'nowrap' }), attr.title('Maximum size of files written by the build script. Zero means no limit.')), maxFileSizeMB = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.MaxFileSizeMB)), dom.div(), dom.label(reuseUID = dom.input(attr.type('checkbox'), repo.UID !== null ? attr.checked('') : []), ' Reuse $HOME and UID for builds for this repo', attr.title('By reusing $HOME and running builds for this repository under the same UID, build caches can be used. This typically leads to faster builds but reduces isolation of builds.')), dom.div(), dom.label(bubblewrap = dom.input(attr.type('checkbox'), repo.Bubblewrap ? attr.checked('') : []), ' Run build script in bubblewrap, with limited system access', attr.title('Only available on Linux, with bubblewrap (bwrap) installed. Commands are run in a new mount namespace with access to system directories like /bin /lib /usr, and to the ding build, home and toolchain directories.')), dom.div(), dom.label(bubblewrapNoNet = dom.input(attr.type('checkbox'), repo.BubblewrapNoNet ? attr.checked('') : []), ' Prevent network access from build script. Only active if bubblewrap is active.', attr.title('Hide network interfaces from the build script. Only a loopback device is available.')), dom.div('Build for Go toolchains', style({ whiteSpace: 'nowrap' }), attr.title('The build script will be run for each of the selected Go toolchains, each in its own build step, e.g. "build:goprev". The short name (go, goprev, gonext) is set in $DING_GOTOOLCHAIN. If this build was triggered due to a new Go toolchain being installed, the variable $DING_NEWGOTOOLCHAIN is set.' + !haveGoToolchainDir ? ' Warning: No Go toolchain directory is configured in the configuration file.' : '')), dom.div(dom.label(goauto = dom.input(attr.type('checkbox'), repo.GoAuto ? attr.checked('') : [], function change() {
 			if (goauto.checked) {
 				gocur.checked = false;
 				goprev.checked = false;
 				gonext.checked = false;
 			}
-		}), ' Automatic', attr.title('Build for each of the available Go toolchains, go/goprev/gonext. At least one must be found or the build will fail.')), ' ', dom.label(gocur = dom.input(attr.type('checkbox'), repo.GoCur ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go latest', attr.title('Latest patch version of latest stable Go toolchain version.')), ' ', dom.label(goprev = dom.input(attr.type('checkbox'), repo.GoPrev ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go previous', attr.title('Latest patch version of Go toolchain minor version before the latest stable.')), ' ', dom.label(gonext = dom.input(attr.type('checkbox'), repo.GoNext ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go next', attr.title('Release candidate of Go toolchain, if available.')), ' '), dom.div(), dom.label(buildOnUpdatedToolchain = dom.input(attr.type('checkbox'), repo.BuildOnUpdatedToolchain ? attr.checked('') : []), ' Schedule a low-priority build when new toolchains are automatically installed.'), dom.div('Webhook secrets', style({ whiteSpace: 'nowrap' })), dom.div(webhookSecret = dom.input(attr.value(repo.WebhookSecret)), ' ', dom.clickbutton('Generate random', function click() {
+		}), ' Automatic', attr.title('Build for each of the available Go toolchains, go/goprev/gonext. At least one must be found or the build will fail.')), ' ', dom.label(gocur = dom.input(attr.type('checkbox'), repo.GoCur ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go latest', attr.title('Latest patch version of latest stable Go toolchain version.')), ' ', dom.label(goprev = dom.input(attr.type('checkbox'), repo.GoPrev ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go previous', attr.title('Latest patch version of Go toolchain minor version before the latest stable.')), ' ', dom.label(gonext = dom.input(attr.type('checkbox'), repo.GoNext ? attr.checked('') : [], function change() { goauto.checked = false; }), ' Go next', attr.title('Release candidate of Go toolchain, if available.')), ' ', dom.label(goparallel = dom.input(attr.type('checkbox'), repo.GoParallel ? attr.checked('') : []), ' Concurrently', attr.title('Run the build steps for the selected Go toolchains and build matrix concurrently instead of sequentially. All steps run to completion, instead of stopping at the first failure. Steps other than the first run in a copy of the checkout, at e.g. $DING_BUILDDIR/checkout-goprev-linux/$DING_CHECKOUTPATH.')), ' '), dom.div(), dom.label(buildOnUpdatedToolchain = dom.input(attr.type('checkbox'), repo.BuildOnUpdatedToolchain ? attr.checked('') : []), ' Schedule a low-priority build when new toolchains are automatically installed.'), dom.div('Build matrix', style({ whiteSpace: 'nowrap' }), attr.title('Axes of the build matrix, one per line, of the form NAME=value1 value2 ... The build script is run for each combination of values, and of the selected Go toolchains, each in its own build step, e.g. "build:goprev:linux:amd64". The value of each axis is available in the environment variable with the name of the axis.')), matrix = dom.textarea((repo.Matrix || []).map(a => a.Name + '=' + (a.Values || []).join(' ') + '\n').join(''), attr.placeholder('GOOS=linux openbsd\nCGO_ENABLED=0 1\n...'), attr.rows('' + Math.max(2, (repo.Matrix || []).length + 1))), dom.div('Build parameters', style({ whiteSpace: 'nowrap' }), attr.title('Parameters that can be set when creating a build, of the form name=default, one per line. Names consist of letters, digits and underscore. Values are available during clone and build as $DING_PARAM_<name>.')), params = dom.textarea((repo.Params || []).map(p => p.Name + '=' + p.Value + '\n').join(''), attr.placeholder('name=default\nname=default\n...'), attr.rows('' + Math.max(2, (repo.Params || []).length + 1))), dom.div('Environment variables', style({ whiteSpace: 'nowrap' }), attr.title('Additional environment variables for clone and build, of the form key=value, one per line. They replace global variables with the same name.')), environment = dom.textarea((repo.Environment || []).map(s => s + '\n').join(''), attr.placeholder('key=value\nkey=value\n...'), attr.rows('' + Math.max(2, (repo.Environment || []).length + 1))), dom.div('Command prefix', style({ whiteSpace: 'nowrap' }), attr.title('Commands prefixed to the clone and build commands, appended to the global prefix, e.g. "nice -n 19".')), dom.div(runPrefix = dom.input(attr.value((repo.RunPrefix || []).join(' '))), ' ', dom.label(replaceRunPrefix = dom.input(attr.type('checkbox'), repo.ReplaceRunPrefix ? attr.checked('') : []), ' Replace global prefix', attr.title('Use this command prefix instead of the global prefix. With an empty prefix, commands are run without prefix.'))), dom.div('Branch environments', style({ whiteSpace: 'nowrap' }), attr.title('Environment variables and command prefix for branches matching a pattern. Applied after those of the repository, in order.')), dom.div(branchEnvsBox = dom.div((branchEnvViews = (repo.BranchEnvs || []).map(be => newBranchEnvView(be))).map(v => v.root)), dom.clickbutton('Add branch environment', function click() {
+			const v = newBranchEnvView({ Pattern: '', Environment: [], RunPrefix: [], ReplaceRunPrefix: false });
+			branchEnvViews.push(v);
+			branchEnvsBox.appendChild(v.root);
+		})), dom.div('Webhook secrets', style({ whiteSpace: 'nowrap' })), dom.div(webhookSecret = dom.input(attr.value(repo.WebhookSecret)), ' ', dom.clickbutton('Generate random', function click() {
 			webhookSecret.value = genrandom();
-		}), dom.br(), dom.label(allowGlobalWebhookSecrets = dom.input(attr.type('checkbox'), repo.AllowGlobalWebhookSecrets ? attr.checked('') : []), ' Allow global webhook secrets'))), dom.div(dom.label(dom.div('Build script', style({ marginBottom: '.25ex' })), buildScript = dom.textarea(repo.BuildScript, attr.required(''), attr.rows('24'), style({ width: '100%' })))), dom.br(), dom.div(dom.submitbutton('Save'))))), dom.br(), dom.h1('Webhooks'), dom.p('Configure the following webhook URLs to trigger builds:'), dom.ul(dom.li(dom.tt('http[s]://[webhooklistener]/github/' + repo.Name), ', with secret: ', dom.tt(repo.WebhookSecret)), dom.li(dom.tt('http[s]://[webhooklistener]/gitea/' + repo.Name), ', with secret: ', dom.tt(repo.WebhookSecret)), dom.li(dom.tt('http[s]://[webhooklistener]/bitbucket/' + repo.Name + '/' + repo.WebhookSecret))), repo.AllowGlobalWebhookSecrets && (settings.GithubWebhookSecret || settings.GiteaWebhookSecret || settings.BitbucketWebhookSecret) ? dom.p('Warning: Globally configured webhook secrets are active and also accepted for this repository.') : dom.p('No other (globally configured) secrets are accepted for this repository.'), dom.div(docsBuildScript()), dom.h1('Build settings'), (settings.RunPrefix || []).length > 0 ? dom.p('Build commands are prefixed with: ', dom.tt((settings.RunPrefix || []).join(' '))) : dom.p('Build commands are not run within other commands.'), dom.div('Additional environments available during builds:'), (settings.Environment || []).length === 0 ? dom.p('None') : dom.ul((settings.Environment || []).map(s => dom.li(dom.tt(s)))))),
+		}), dom.br(), dom.label(allowGlobalWebhookSecrets = dom.input(attr.type('checkbox'), repo.AllowGlobalWebhookSecrets ? attr.checked('') : []), ' Allow global webhook secrets')), dom.div('Push filters', style({ whiteSpace: 'nowrap' }), attr.title('Space-separated patterns for names of branches and tags, with * matching any text except slashes, for selecting the pushes that start a build through a webhook or "ding kick". If include patterns are set, only matching names are built. Names matching an exclude pattern are not built. For pull requests, the source branch is matched. Builds started through this web interface are not filtered.')), dom.div(style({ display: 'grid', columnGap: '.5em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr 1fr' }), 'Branches', includeBranches = dom.input(attr.value((repo.IncludeBranches || []).join(' ')), attr.placeholder('Include, e.g. main release/*')), excludeBranches = dom.input(attr.value((repo.ExcludeBranches || []).join(' ')), attr.placeholder('Exclude, e.g. wip/* dependabot/*')), 'Tags', includeTags = dom.input(attr.value((repo.IncludeTags || []).join(' ')), attr.placeholder('Include, e.g. v*')), excludeTags = dom.input(attr.value((repo.ExcludeTags || []).join(' ')), attr.placeholder('Exclude'))), dom.div('Paths', style({ whiteSpace: 'nowrap' }), attr.title('Space-separated patterns for files changed by a push. A pattern without slash matches any file or directory name, e.g. *.md. A pattern with a slash matches a path from the root of the repository, or a directory leading to it, e.g. docs/ or cmd/*. A file is relevant if it matches an include pattern (or no include patterns are set) and does not match an exclude pattern. If none of the changed files are relevant, the build is marked as skipped. Low-priority builds, builds for pull requests and tags, and builds of the same commit as the previous build are never skipped.')), dom.div(style({ display: 'grid', columnGap: '.5em', gridTemplateColumns: '1fr 1fr' }), includePaths = dom.input(attr.value((repo.IncludePaths || []).join(' ')), attr.placeholder('Include, e.g. *.go go.mod')), excludePaths = dom.input(attr.value((repo.ExcludePaths || []).join(' ')), attr.placeholder('Exclude, e.g. docs/ *.md'))), dom.div(), dom.label(releaseTags = dom.input(attr.type('checkbox'), repo.ReleaseTags ? attr.checked('') : []), ' Release successful builds of tags', attr.title('Builds of tags, e.g. from a webhook for a pushed tag, are marked as released when successful, as with the Release button of a build.')), dom.div('Commits of push', style({ whiteSpace: 'nowrap' }), attr.title('Number of earlier commits of a push through a webhook to also build, besides the last commit. The earlier commits get low-priority builds, and the build page of each shows the status of all commits of the push, to find the commit that broke the build. Zero only builds the last commit. At most 20.')), dom.div(pushCommitBuilds = dom.input(attr.type('number'), attr.min('0'), attr.max('20'), attr.value('' + repo.PushCommitBuilds), attr.title('Number of earlier commits of a push through a webhook to also build, besides the last commit. The earlier commits get low-priority builds, and the build page of each shows the status of all commits of the push, to find the commit that broke the build. Zero only builds the last commit. At most 20.'))), dom.div(), dom.label(bisectFailures = dom.input(attr.type('checkbox'), repo.Bisect ? attr.checked('') : []), ' Bisect failures', attr.title('When a build of a branch fails after a successful build of the branch, build the commits in between with low-priority builds, one at a time, in a binary search for the first failing commit. The failure notification is sent once the first failing commit is found. Only for git repositories.')), dom.div('Downstream repositories', style({ whiteSpace: 'nowrap' }), attr.title('Repositories to build after builds of this repository, e.g. services that depend on a library. A build is triggered after a successful build or after a release of a build of matching upstream branches, the default branch if empty. The triggered build gets the upstream repository, build ID and version in $DING_UPSTREAM_REPONAME, $DING_UPSTREAM_BUILDID and $DING_UPSTREAM_VERSION. Repositories already in the chain of triggers are not built again.')), dom.div(downstreamsBox = dom.div((downstreamViews = (repo.Downstreams || []).map(d => newDownstreamView(d))).map(v => v.root)), dom.clickbutton('Add downstream repository', function click() {
+			const v = newDownstreamView({ Repo: '', UpstreamBranch: '', Branch: '', Condition: api.DownstreamCondition.DownstreamSuccess });
+			downstreamViews.push(v);
+			downstreamsBox.appendChild(v.root);
+		})), dom.div('Poll for commits', style({ whiteSpace: 'nowrap' }), attr.title('Check the origin for new commits, for repositories without webhooks. A build is created for each polled branch whose head differs from the commit of its latest build. Git repositories are checked with git ls-remote, mercurial repositories with hg identify.')), dom.div(style({ display: 'grid', columnGap: '.5em', rowGap: '.5ex', gridTemplateColumns: 'min-content 1fr' }), 'Interval', pollInterval = dom.input(attr.type('number'), attr.min('0'), attr.value('' + repo.PollInterval), attr.title('Seconds between polls, at least 60. Zero disables polling.')), 'Branches', pollBranches = dom.input(attr.value((repo.PollBranches || []).join(' ')), attr.placeholder('Space-separated, default branch if empty')), 'Command', pollCommand = dom.input(attr.value(repo.PollCommand), attr.placeholder('For VCS command'), attr.title('For VCS command, required for polling: shell command that prints the head commit of branch $DING_BRANCH, as last line of the form commit:<hash>, like the clone command.'))), dom.div('Commit status', style({ whiteSpace: 'nowrap' }), attr.title('Report the status of builds for their commit to a forge: pending when a build starts, and success, failure or cancelled when it finishes. The status links to the build in ding. Failed requests are retried.')), dom.div(commitStatusForge = dom.select(dom.option('None', attr.value(''), repo.CommitStatus.Forge === '' ? attr.selected('') : []), dom.option('github', repo.CommitStatus.Forge === 'github' ? attr.selected('') : []), dom.option('gitea', repo.CommitStatus.Forge === 'gitea' ? attr.selected('') : []), dom.option('bitbucket', repo.CommitStatus.Forge === 'bitbucket' ? attr.selected('') : [])), ' ', commitStatusRepository = dom.input(attr.value(repo.CommitStatus.Repository), attr.placeholder('owner/name'), attr.title('Repository at the forge, of the form owner/name, or workspace/name for bitbucket.')), ' ', commitStatusTokenSecret = dom.input(attr.value(repo.CommitStatus.TokenSecret), attr.placeholder('Token secret'), attr.title('Name of a secret of this repository holding the access token, sent as bearer token. The secret is also available to builds.')), dom.br(), commitStatusURL = dom.input(attr.value(repo.CommitStatus.URL), attr.placeholder('https://gitea.example.com/api/v1'), attr.title('Base URL of the API. Required for gitea. Defaults to https://api.github.com for github, and https://api.bitbucket.org/2.0 for bitbucket.'), style({ width: '100%' }))), dom.div('Build script file', style({ whiteSpace: 'nowrap' }), attr.title('Path of a file in the checkout with the build script, relative to the checkout path. It is read after the clone, so the build script is versioned with the code, and builds of older commits use their own script. The build script below is used if the file does not exist.')), buildScriptPath = dom.input(attr.value(repo.BuildScriptPath), attr.placeholder('e.g. .ding/build.sh'))), dom.div(dom.label(dom.div('Build script', style({ marginBottom: '.25ex' })), buildScript = dom.textarea(repo.BuildScript, attr.required(''), attr.rows('24'), style({ width: '100%' })))), dom.br(), dom.div(dom.div('Jobs', style({ marginBottom: '.25ex' }), attr.title('Additional named jobs, each with its own build script, e.g. for linting, releases, or subprojects of a monorepo. A push through a webhook, "ding kick" or a poll starts a build of the build script above, and of each job whose patterns match. Branch, tag and path patterns are applied in addition to those of the repository. Go toolchains replace those of the repository. Builds of a job are compared with earlier builds of the same job, for notifications, skipping and superseding. The job name is available as $DING_JOB.')), jobsBox = dom.div((jobViews = (repo.Jobs || []).map(j => newJobView(j))).map(v => v.root)), dom.clickbutton('Add job', function click() {
+			const v = newJobView({ Name: '', BuildScript: '', BuildScriptPath: '', IncludeBranches: [], ExcludeBranches: [], IncludeTags: [], ExcludeTags: [], IncludePaths: [], ExcludePaths: [], GoAuto: false, GoCur: false, GoPrev: false, GoNext: false });
+			jobViews.push(v);
+			jobsBox.appendChild(v.root);
+		})), dom.br(), dom.div(dom.submitbutton('Save'))))), dom.br(), schedulesElem, dom.br(), secretsElem, dom.br(), dom.h1('Webhooks'), dom.p('Configure the following webhook URLs to trigger builds:'), dom.ul(dom.li(dom.tt('http[s]://[webhooklistener]/github/' + repo.Name), ', with secret: ', dom.tt(repo.WebhookSecret)), dom.li(dom.tt('http[s]://[webhooklistener]/gitea/' + repo.Name), ', with secret: ', dom.tt(repo.WebhookSecret)), dom.li(dom.tt('http[s]://[webhooklistener]/bitbucket/' + repo.Name + '/' + repo.WebhookSecret))), repo.AllowGlobalWebhookSecrets && (settings.GithubWebhookSecret || settings.GiteaWebhookSecret || settings.BitbucketWebhookSecret) ? dom.p('Warning: Globally configured webhook secrets are active and also accepted for this repository.') : dom.p('No other (globally configured) secrets are accepted for this repository.'), dom.div(docsBuildScript()), dom.h1('Build settings'), (settings.RunPrefix || []).length > 0 ? dom.p('Build commands are prefixed with: ', dom.tt((settings.RunPrefix || []).join(' '))) : dom.p('Build commands are not run within other commands.'), dom.div('Additional environments available during builds:'), (settings.Environment || []).length === 0 ? dom.p('None') : dom.ul((settings.Environment || []).map(s => dom.li(dom.tt(s)))), dom.p('The environment variables and command prefixes of the repository and matching branches are applied after these. Each build shows the environment and command prefix it was created with.'))),
 	];
 	const elem = render();
 	vcsChanged();
@@ -1821,25 +2378,104 @@ const basename = (s) => {
 };
 const pageBuild = async (repoName, buildID) => {
 	const page = new Page();
-	let [repo, b] = await authed(() => Promise.all([
+	let [repo, b, queue, pushBuilds] = await authed(() => Promise.all([
 		client.Repo(password, repoName),
 		client.Build(password, repoName, buildID),
+		client.Queue(password),
+		client.PushBuilds(password, repoName, buildID),
 	]));
 	let steps = b.Steps || [];
 	let results = b.Results || [];
+	// Position in the queue while the build is waiting to start.
+	const queueElem = dom.span();
+	const renderQueue = () => {
+		const qj = (queue || []).find(qj => qj.BuildID === b.ID);
+		if (!qj || qj.Active) {
+			dom._kids(queueElem);
+			return;
+		}
+		dom._kids(queueElem, ' ', ordinal(qj.Position), ' in line ', qj.Position > 1 ? dom.clickbutton('Move to front', attr.title('Start this build before other waiting builds.'), async function click(e) {
+			await authed(() => client.QueueMoveFront(password, repo.Name, b.ID), e.target);
+		}) : [], qj.LowPrio ? [' ', dom.clickbutton('Promote', attr.title('Turn this low-priority build into a regular build.'), async function click(e) {
+				await authed(() => client.QueuePromoteLowPrio(password, repo.Name, b.ID), e.target);
+			})] : []);
+	};
+	renderQueue();
+	// Builds for the commits of the push this build is part of, oldest first. The first
+	// failed build likely has the commit that broke the build.
+	const pushElem = dom.div();
+	const renderPush = () => {
+		const l = pushBuilds || [];
+		if (l.length === 0) {
+			dom._kids(pushElem);
+			return;
+		}
+		const firstFailed = l.find(pb => pb.Finish && pb.Status === api.BuildStatus.StatusBuild);
+		dom._kids(pushElem, dom.h2('Push'), dom.table(dom.tr(['Position', 'Build', 'Commit', 'Status'].map(s => dom.th(s)), dom.th(style({ textAlign: 'left' }), 'Error')), l.map(pb => dom.tr(dom.td('' + pb.PushPosition), dom.td(pb.ID === b.ID ? '' + pb.ID : link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + pb.ID, '' + pb.ID)), dom.td(pb.CommitHash), dom.td(buildStatus(pb), pb === firstFailed ? [' ', dom.span('first failure', style({ color: colors.red, fontWeight: 'bold' }), attr.title('Earliest commit of the push with a failed build, likely the commit that broke the build.'))] : []), dom.td(style({ textAlign: 'left' }), buildErrmsg(pb))))));
+	};
+	renderPush();
 	// Builds that were started with this view open. We'll show links to these builds in the top bar.
 	let moreBuilds = [];
 	let moreBuildsElem = dom.span();
 	page.updateRoot = moreBuildsElem;
-	const stepColor = () => {
+	const stepColor = (step) => {
 		if (!b.Finish) {
 			return colors.gray;
 		}
-		if (b.Status == api.BuildStatus.StatusSuccess) {
+		if (step.ErrorMessage) {
+			return colors.red;
+		}
+		// If another step has an error message, this step succeeded.
+		if (b.Status == api.BuildStatus.StatusSuccess || steps.find(st => st.ErrorMessage)) {
 			return colors.green;
 		}
 		return colors.red;
 	};
+	// Status of each combination of the build matrix, with the values of the last axis
+	// as columns.
+	const matrixGrid = () => {
+		const cells = steps.filter(st => (st.Matrix || []).length > 0);
+		if (cells.length === 0) {
+			return [];
+		}
+		const axes = (cells[0].Matrix || []).map(p => p.Name);
+		const rowKey = (st) => (st.Matrix || []).slice(0, -1).map(p => p.Value).join(' ');
+		const colKey = (st) => (st.Matrix || [])[axes.length - 1].Value;
+		const rows = [];
+		const columns = [];
+		for (const st of cells) {
+			if (!rows.includes(rowKey(st))) {
+				rows.push(rowKey(st));
+			}
+			if (!columns.includes(colKey(st))) {
+				columns.push(colKey(st));
+			}
+		}
+		return dom.div(dom.h2('Matrix'), dom.table(dom.tr(dom.th(axes.slice(0, -1).join(' ')), columns.map(col => dom.th(axes[axes.length - 1] + '=' + col))), rows.map(row => dom.tr(dom.td(row), columns.map(col => {
+			const st = cells.find(st => rowKey(st) === row && colKey(st) === col);
+			if (!st) {
+				return dom.td('-', attr.title('Not built.'));
+			}
+			return dom.td(dom.span(st.ErrorMessage ? 'failed' : 'ok', attr.title(st.Name + (st.ErrorMessage ? ': ' + st.ErrorMessage : '')), style({ fontSize: '.9em', color: 'white', backgroundColor: stepColor(st), padding: '0 .2em', borderRadius: '.15em' })));
+		})))));
+	};
+	// State of the bisect for this failed build, or the bisect this build is part of.
+	const bisectInfo = () => {
+		const bs = b.Bisect;
+		if (b.BisectBuildID) {
+			return dom.p('Build for the bisect of ', link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + b.BisectBuildID, 'build ' + b.BisectBuildID), '.');
+		}
+		else if ((bs.Commits || []).length === 0) {
+			return [];
+		}
+		else if (bs.FirstBad) {
+			return dom.p('First failing commit, found by bisect: ', dom.tt(bs.FirstBad));
+		}
+		else if (bs.Error) {
+			return dom.p('Bisect for the first failing commit failed: ', bs.Error);
+		}
+		return dom.p('Bisecting ', '' + (bs.Commits || []).length, ' commits since last successful commit ', dom.tt(bs.Good), ', ', '' + (bs.BadIndex - bs.GoodIndex - 1), ' commits left, testing in ', link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + bs.BuildID, 'build ' + bs.BuildID), '.');
+	};
 	dom._kids(crumbElem, dom.span(link('#', 'Home'), ' / ', link('#repo/' + encodeURIComponent(repo.Name), 'Repo ' + repo.Name), ' / ', 'Build ' + b.ID));
 	document.title = 'Ding - Repo ' + repoName + ' - Build ' + b.ID;
 	buildSetFavicon(b);
@@ -1853,11 +2489,24 @@ const pageBuild = async (repoName, buildID) => {
 	};
 	let stepsBox;
 	let stepViews;
+	// Summary of Go test results of a step, with the failed tests and their output.
+	const testsView = (tests) => {
+		const all = tests.map(p => p.Tests || []).flat();
+		const count = (status) => all.filter(t => t.Status === status).length;
+		const failed = (p) => (p.Tests || []).filter(t => t.Status === api.TestStatus.TestFail && !(p.Tests || []).find(t2 => t2.Status === api.TestStatus.TestFail && t2.Name.startsWith(t.Name + '/')));
+		return dom.div(style({ marginBottom: '1ex' }), dom.div('Tests: ', '' + count(api.TestStatus.TestPass), ' passed, ', '' + count(api.TestStatus.TestFail), ' failed, ', '' + count(api.TestStatus.TestSkip), ' skipped, in ', '' + tests.length, ' packages'), tests.filter(p => p.Status === api.TestStatus.TestFail).map(p => {
+			const l = failed(p);
+			if (l.length === 0) {
+				return [dom.div(style({ color: colors.red }), 'Package ', dom.tt(p.Package), ' failed'), p.Output ? dom.pre(p.Output) : []];
+			}
+			return l.map(t => [dom.div(style({ color: colors.red }), 'Test ', dom.tt(t.Name), ' in ', dom.tt(p.Package), ' failed (', t.Elapsed.toFixed(3), 's)'), t.Output ? dom.pre(t.Output) : []]);
+		}));
+	};
 	const newStepView = (step) => {
-		const stepOutput = dom.pre(step.Output, style({ borderLeft: '4px solid ' + stepColor() }));
+		const stepOutput = dom.pre(step.Output, style({ borderLeft: '4px solid ' + stepColor(step) }));
 		const v = {
 			output: stepOutput,
-			root: dom.div(dom.h2(step.Name, step.Nsec ? ' (' + (step.Nsec / (1000 * 1000 * 1000)).toFixed(3) + 's)' : ''), stepOutput, dom.br())
+			root: dom.div(dom.h2(step.Name, step.Nsec ? ' (' + (step.Nsec / (1000 * 1000 * 1000)).toFixed(3) + 's)' : ''), step.Version || step.Coverage || step.CoverageReportFile || (step.Results || []).length > 0 ? dom.div(style({ marginBottom: '1ex' }), step.Version ? ['Version ', step.Version, ' '] : [], step.Coverage || step.CoverageReportFile ? ['Coverage ', formatCoverage(repo, { ...b, Coverage: step.Coverage, CoverageReportFile: step.CoverageReportFile }), ' '] : [], (step.Results || []).length > 0 ? ['Results ', '' + (step.Results || []).length] : []) : [], step.ErrorMessage ? dom.div(style({ marginBottom: '1ex', color: colors.red }), step.ErrorMessage) : [], (step.Tests || []).length > 0 ? testsView(step.Tests || []) : [], stepOutput, dom.br())
 		};
 		return v;
 	};
@@ -1872,22 +2521,30 @@ const pageBuild = async (repoName, buildID) => {
 			render();
 		}), ' ', dom.clickbutton('Cancel build', attr.title('Abort this build, causing it to fail.'), b.Finish ? attr.disabled('') : [], async function click(e) {
 			await authed(() => client.BuildCancel(password, repo.Name, b.ID), e.target);
-		}), ' ', dom.clickbutton('Rebuild', attr.title('Start a new build for this branch and commit.'), async function click(e) {
-			const nb = await authed(() => client.BuildCreate(password, repo.Name, b.Branch, b.CommitHash, false), e.target);
+		}), ' ', dom.clickbutton('Rebuild', b.PullRequest ? [attr.disabled(''), attr.title('Builds for pull requests are only started through webhooks.')] : attr.title('Start a new build for this branch and commit.'), async function click(e) {
+			const nb = await authed(() => client.BuildCreateJob(password, repo.Name, b.Job, b.Branch, b.CommitHash, false, b.Params || []), e.target);
 			location.hash = '#repo/' + encodeURIComponent(repo.Name) + '/build/' + nb.ID;
 		}), ' ', dom.clickbutton('Release', b.Released || b.Status !== api.BuildStatus.StatusSuccess ? attr.disabled('') : [], attr.title("Mark this build as released. Results of releases are not automatically removed. Build directories of releases can otherwise still be automatically removed, but this is done later than for builds that aren't released."), async function click(e) {
 			b = await authed(() => client.ReleaseCreate(password, repo.Name, b.ID), e.target);
 			render();
-		})), dom.div(dom.h1('Summary'), dom.table(dom.tr(['Status', 'Branch', 'Duration', 'Version', 'Commit', 'Coverage', 'Disk usage', 'Age'].map(s => dom.th(s)), dom.th(style({ textAlign: 'left' }), 'Error')), dom.tr(dom.td(buildStatus(b)), dom.td(b.Branch), dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''), dom.td(b.Version), dom.td(b.CommitHash), dom.td(formatCoverage(repo, b)), dom.td(formatBuildSize(b)), dom.td(atexit.ageMins(b.Created, undefined)), dom.td(style({ textAlign: 'left' }), b.ErrorMessage ? dom.div(b.ErrorMessage, style({ maxWidth: '40em' })) : [])))), dom.br(), dom.div(style({ display: 'grid', gap: '1em', gridTemplateColumns: '1fr 1fr', justifyItems: 'stretch' }), dom.div(dom.h1('Steps'), stepsBox = dom.div(stepViews = steps.map((step) => newStepView(step)))), dom.div(dom.div(dom.div(style({ display: 'flex', gap: '1em' }), dom.h1('Results'), b.Status === api.BuildStatus.StatusSuccess && (b.Results || []).length > 0 ? dom.div(dom.a(attr.href('dl/' + (b.Released ? 'release' : 'result') + '/' + encodeURIComponent(repo.Name) + '/' + b.ID + '/' + encodeURIComponent(repo.Name) + '-' + b.Version + '.zip'), attr.download(''), 'zip'), ' ', dom.a(attr.href('dl/' + (b.Released ? 'release' : 'result') + '/' + encodeURIComponent(repo.Name) + '/' + b.ID + '/' + encodeURIComponent(repo.Name) + '-' + b.Version + '.tgz'), attr.download(''), 'tgz')) : []), dom.table(dom.thead(dom.tr(['Name', 'OS', 'Arch', 'Toolchain', 'Link', 'Size'].map(s => dom.th(s)))), dom.tbody(results.length === 0 ? dom.tr(dom.td(attr.colspan('6'), 'No results', style({ textAlign: 'left' }))) : [], results.map(rel => dom.tr(dom.td(rel.Command), dom.td(rel.Os), dom.td(rel.Arch), dom.td(rel.Toolchain), dom.td(dom.a(attr.href((b.Released ? 'release/' : 'result/') + encodeURIComponent(repo.Name) + '/' + b.ID + '/' + (b.Released ? basename(rel.Filename) : rel.Filename)), attr.download(''), rel.Filename)), dom.td(formatSize(rel.Filesize))))))), dom.br(), dom.div(dom.h1('Build script'), dom.pre(b.BuildScript)))));
+		})), dom.div(dom.h1('Summary'), dom.table(dom.tr(['Status', 'Branch', 'Duration', 'Version', 'Commit', 'Coverage', 'Tests', 'Disk usage', 'Peak memory', 'CPU time', 'Age'].map(s => dom.th(s)), dom.th(style({ textAlign: 'left' }), 'Error')), dom.tr(dom.td(buildStatus(b), queueElem), dom.td(buildBranch(b)), dom.td(b.Start ? atexit.age(b.Start, b.Finish || undefined) : ''), dom.td(b.Version), dom.td(b.CommitHash), dom.td(formatCoverage(repo, b)), dom.td(formatTests(b)), dom.td(formatBuildSize(b)), dom.td(b.PeakMemory ? formatSize(b.PeakMemory) : ''), dom.td(b.CPUNsec ? (b.CPUNsec / (1000 * 1000 * 1000)).toFixed(1) + 's' : ''), dom.td(atexit.ageMins(b.Created, undefined)), dom.td(style({ textAlign: 'left' }), b.SupersededBy ? dom.div('Superseded by ', link('#repo/' + encodeURIComponent(repo.Name) + '/build/' + b.SupersededBy, 'build ' + b.SupersededBy)) : (b.ErrorMessage ? dom.div(b.ErrorMessage, style({ maxWidth: '40em' })) : [])))), b.UpstreamBuildID ? dom.p('Triggered by ', link('#repo/' + encodeURIComponent(b.UpstreamRepoName) + '/build/' + b.UpstreamBuildID, 'build ' + b.UpstreamBuildID), ' of upstream repository ', b.UpstreamRepoName, b.UpstreamVersion ? ', version ' + b.UpstreamVersion : '', '.') : [], (b.Params || []).length === 0 ? [] : dom.p('Parameters: ', (b.Params || []).map((p, i) => [i > 0 ? ', ' : '', dom.tt(p.Name + '=' + p.Value)])), (b.Environment || []).length === 0 ? [] : dom.p('Environment: ', (b.Environment || []).map((s, i) => [i > 0 ? ', ' : '', dom.tt(s)])), (b.RunPrefix || []).length === 0 ? [] : dom.p('Command prefix: ', dom.tt((b.RunPrefix || []).join(' '))), matrixGrid(), pushElem, bisectInfo()), dom.br(), dom.div(style({ display: 'grid', gap: '1em', gridTemplateColumns: '1fr 1fr', justifyItems: 'stretch' }), dom.div(dom.h1('Steps'), stepsBox = dom.div(stepViews = steps.map((step) => newStepView(step)))), dom.div(dom.div(dom.div(style({ display: 'flex', gap: '1em' }), dom.h1('Results'), b.Status === api.BuildStatus.StatusSuccess && (b.Results || []).length > 0 ? dom.div(dom.a(attr.href('dl/' + (b.Released ? 'release' : 'result') + '/' + encodeURIComponent(repo.Name) + '/' + b.ID + '/' + encodeURIComponent(repo.Name) + '-' + b.Version + '.zip'), attr.download(''), 'zip'), ' ', dom.a(attr.href('dl/' + (b.Released ? 'release' : 'result') + '/' + encodeURIComponent(repo.Name) + '/' + b.ID + '/' + encodeURIComponent(repo.Name) + '-' + b.Version + '.tgz'), attr.download(''), 'tgz')) : []), dom.table(dom.thead(dom.tr(['Name', 'OS', 'Arch', 'Toolchain', 'Link', 'Size'].map(s => dom.th(s)))), dom.tbody(results.length === 0 ? dom.tr(dom.td(attr.colspan('6'), 'No results', style({ textAlign: 'left' }))) : [], results.map(rel => dom.tr(dom.td(rel.Command), dom.td(rel.Os), dom.td(rel.Arch), dom.td(rel.Toolchain), dom.td(dom.a(attr.href((b.Released ? 'release/' : 'result/') + encodeURIComponent(repo.Name) + '/' + b.ID + '/' + (b.Released ? basename(rel.Filename) : rel.Filename)), attr.download(''), rel.Filename)), dom.td(formatSize(rel.Filesize))))))), dom.br(), dom.div(dom.h1('Build script'), b.BuildScriptFile ? dom.p('Read from ', dom.tt(b.BuildScriptFile), ' in the checkout.') : dom.p('From the settings of the repository.'), dom.pre(b.BuildScript)))));
 	};
 	render();
 	page.subscribe(streams.build, (e) => {
 		if (e.Build.RepoName !== repo.Name) {
 			return;
 		}
+		const pbi = (pushBuilds || []).findIndex(pb => pb.ID === e.Build.ID);
+		if (pbi >= 0 && pushBuilds) {
+			pushBuilds[pbi] = e.Build;
+			renderPush();
+		}
 		if (e.Build.ID === b.ID) {
 			b = e.Build;
 			results = b.Results || [];
+			if (b.Steps) {
+				steps = b.Steps;
+			}
 			render();
 			buildSetFavicon(b);
 		}
@@ -1903,6 +2560,10 @@ const pageBuild = async (repoName, buildID) => {
 		moreBuilds = moreBuilds.filter(bID => bID !== e.BuildID);
 		renderMoreBuilds();
 	});
+	page.subscribe(streams.queue, (e) => {
+		queue = e.Jobs || [];
+		renderQueue();
+	});
 	page.subscribe(streams.output, (e) => {
 		if (e.BuildID !== b.ID) {
 			return;
@@ -1913,9 +2574,12 @@ const pageBuild = async (repoName, buildID) => {
 				Name: e.Step,
 				Output: '',
 				Nsec: 0,
+				ErrorMessage: '',
+				Version: '',
+				CoverageReportFile: '',
 			};
-			for (const sv of stepViews) {
-				sv.output.style.borderLeftColor = stepColor();
+			for (let i = 0; i < stepViews.length; i++) {
+				stepViews[i].output.style.borderLeftColor = stepColor(steps[i]);
 			}
 			steps.push(st);
 			const sv = newStepView(st);
@@ -1925,7 +2589,7 @@ const pageBuild = async (repoName, buildID) => {
 		// Scroll new text into view if bottom is already visible.
 		const scroll = Math.abs(document.body.getBoundingClientRect().bottom - window.innerHeight) < 50;
 		st.Output += e.Text;
-		stepViews[stepViews.length - 1].output.innerText += e.Text;
+		stepViews[steps.indexOf(st)].output.innerText += e.Text;
 		if (scroll) {
 			window.scroll({ top: document.body.scrollHeight });
 		}
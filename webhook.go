@@ -3,13 +3,210 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"path"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 )
 
+// webhookParams returns the build parameters from the "param" query string
+// parameters in the URL of a webhook, each of the form name=value.
+func webhookParams(r *http.Request) ([]Param, error) {
+	var params []Param
+	for _, s := range r.URL.Query()["param"] {
+		p, err := parseParam(s)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// webhookCommit is a commit in a push event of github and gitea.
+type webhookCommit struct {
+	ID       string   `json:"id"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// webhookChangedFiles returns the files changed by the commits of a push, or nil if
+// the list may be incomplete: for new branches, forced pushes, and when the forge
+// may have truncated the list of commits.
+func webhookChangedFiles(before string, forced bool, commits []webhookCommit) []string {
+	if len(commits) == 0 || len(commits) >= 20 || forced || strings.Trim(before, "0") == "" {
+		return nil
+	}
+	var files []string
+	for _, c := range commits {
+		for _, l := range [][]string{c.Added, c.Removed, c.Modified} {
+			for _, f := range l {
+				if !slices.Contains(files, f) {
+					files = append(files, f)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// webhookPushCommits returns the commits of a push before the head commit to
+// create low-priority builds for, oldest first, see Repo.PushCommitBuilds.
+func webhookPushCommits(repo Repo, head string, commits []webhookCommit) []string {
+	if repo.PushCommitBuilds <= 0 {
+		return nil
+	}
+	var ids []string
+	for _, c := range commits {
+		if c.ID != "" && c.ID != head {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) > int(repo.PushCommitBuilds) {
+		ids = ids[len(ids)-int(repo.PushCommitBuilds):]
+	}
+	return ids
+}
+
+// webhookPushBuilds creates and starts low-priority builds for commits of a push
+// before its head commit, linked to the build of the head commit.
+func webhookPushBuilds(ctx context.Context, head Build, commits []string, params []Param) {
+	for i, commit := range commits {
+		repo, build, buildDir, gotoolchains, err := prepareBuild(ctx, head.RepoName, head.Branch, commit, true, params, buildOpts{pushBuildID: head.ID, pushPosition: int32(i + 1)})
+		if err != nil {
+			slog.Error("webhook: error creating build for commit of push", "repo", head.RepoName, "branch", head.Branch, "commit", commit, "err", err)
+			continue
+		}
+		go func() {
+			err := doBuild(context.Background(), repo, build, buildDir, gotoolchains, false)
+			if err != nil {
+				slog.Error("build", "err", err)
+			}
+		}()
+	}
+}
+
+// webhookEvent is a push or pull request event of github or gitea, for
+// webhookBuild.
+type webhookEvent struct {
+	ref     string // E.g. "refs/heads/main" or "refs/tags/v1.0.0".
+	before  string
+	after   string
+	forced  bool
+	commits []webhookCommit
+
+	// For pull request events, instead of ref.
+	pr       *pullRequest
+	prCommit string // Head commit of the pull request.
+}
+
+// webhookBuild starts the builds for a push or pull request event of github or
+// gitea (forge), and writes the response.
+func webhookBuild(w http.ResponseWriter, r *http.Request, forge string, repo Repo, event webhookEvent) {
+	branch := repo.DefaultBranch
+	commit := event.after
+	var tag string
+	changedFiles := webhookChangedFiles(event.before, event.forced, event.commits)
+	if event.pr != nil {
+		branch = event.pr.branch()
+		commit = event.prCommit
+		changedFiles = nil
+	} else if strings.HasPrefix(event.ref, "refs/heads/") {
+		branch = event.ref[len("refs/heads/"):]
+	} else if strings.HasPrefix(event.ref, "refs/tags/") {
+		tag = event.ref[len("refs/tags/"):]
+		if strings.Trim(commit, "0") == "" {
+			// Tag was removed.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// For annotated tags, "after" is the tag object, not the commit. We let the clone
+		// find the commit.
+		branch = tagBranch(tag)
+		commit = ""
+	}
+	kind, name := "branch", branch
+	if event.pr != nil {
+		name = event.pr.source
+	} else if tag != "" {
+		kind, name = "tag", tag
+	}
+	if ignored := refIgnored(repo, kind, name); ignored != "" {
+		webhookIgnored(w, ignored)
+		return
+	}
+	params, err := webhookParams(r)
+	if err != nil {
+		slog.Debug(forge+" webhook: bad parameters", "err", err)
+		http.Error(w, "bad parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := buildOpts{pr: event.pr, changedFiles: changedFiles}
+	var pushCommits []string
+	if event.pr == nil && tag == "" {
+		pushCommits = webhookPushCommits(repo, commit, event.commits)
+	}
+	if len(pushCommits) > 0 {
+		opts.pushPosition = int32(len(pushCommits) + 1)
+	}
+	repo, build, buildDir, gotoolchains, err := prepareBuild(r.Context(), repo.Name, branch, commit, false, params, opts)
+	if err != nil {
+		slog.Error(forge+" webhook: error starting build for push event", "repo", repo.Name, "branch", branch, "commit", commit, "err", err)
+		http.Error(w, "could not create build", http.StatusInternalServerError)
+		return
+	}
+	go func() {
+		err := doBuild(context.Background(), repo, build, buildDir, gotoolchains, false)
+		if err != nil {
+			slog.Error("build", "err", err)
+		}
+	}()
+	// Not set for skipped builds, earlier commits are not built either.
+	if build.PushBuildID != 0 {
+		webhookPushBuilds(r.Context(), build, pushCommits, params)
+	}
+	startJobBuilds(r.Context(), repo, kind, name, branch, commit, params, buildOpts{pr: event.pr, changedFiles: changedFiles})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refIgnored returns why a push of a branch or tag (kind) with name should not start
+// a build, due to the include/exclude patterns of the repository. It returns the
+// empty string if a build should be started.
+func refIgnored(repo Repo, kind, name string) string {
+	include, exclude := repo.IncludeBranches, repo.ExcludeBranches
+	if kind == "tag" {
+		include, exclude = repo.IncludeTags, repo.ExcludeTags
+	}
+	for _, pat := range exclude {
+		if ok, _ := path.Match(pat, name); ok {
+			return fmt.Sprintf("%s %q matches exclude pattern %q", kind, name, pat)
+		}
+	}
+	if len(include) == 0 {
+		return ""
+	}
+	for _, pat := range include {
+		if ok, _ := path.Match(pat, name); ok {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s %q does not match include patterns", kind, name)
+}
+
+// webhookIgnored responds to a webhook request for a push that does not start a
+// build, with the reason.
+func webhookIgnored(w http.ResponseWriter, reasons ...string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "push ignored: %s\n", reason)
+	}
+}
+
 func webhookGoToolchainHandler(w http.ResponseWriter, r *http.Request) {
 	settings := Settings{ID: 1}
 	err := database.Get(r.Context(), &settings)
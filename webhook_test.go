@@ -106,6 +106,7 @@ func TestWebhook(t *testing.T) {
 		DefaultBranch: "main",
 		CheckoutPath:  "hooktest",
 		BuildScript:   "#!/usr/bin/env bash\necho build...\n",
+		Params:        []Param{{"FLAVOR", "plain"}},
 	}
 	repo = api.RepoCreate(ctxbg, config.Password, repo)
 
@@ -118,6 +119,15 @@ func TestWebhook(t *testing.T) {
 	testHook(githubHookHandler, "/github/hooktest", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, nil))}, githubBody, http.StatusBadRequest)
 	testHook(githubHookHandler, "/github/hooktest", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, nil))}, nil, http.StatusBadRequest)
 
+	// Build parameters in query string.
+	testHook(githubHookHandler, "/github/hooktest?param=FLAVOR=spicy", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, githubBody))}, githubBody, http.StatusNoContent)
+	testHook(githubHookHandler, "/github/hooktest?param=bogus", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, githubBody))}, githubBody, http.StatusBadRequest)
+	testHook(githubHookHandler, "/github/hooktest?param=OTHER=x", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, githubBody))}, githubBody, http.StatusInternalServerError)
+	builds := api.Builds(ctxbg, config.Password, repo.Name)
+	tcompare(t, len(builds), 2)
+	tcompare(t, builds[0].Params, []Param{{"FLAVOR", "spicy"}})
+	tcompare(t, builds[1].Params, []Param{{"FLAVOR", "plain"}})
+
 	gtevent := githubEvent{Ref: "refs/heads/main", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}
 	gtevent.Repository.Name = "hooktest"
 	giteaBody := toJSON(gtevent)
@@ -154,3 +164,398 @@ func TestWebhook(t *testing.T) {
 
 	time.Sleep(200 * time.Millisecond) // todo: properly wait for builds to fail.
 }
+
+func TestWebhookPullRequest(t *testing.T) {
+	testHook := func(h http.HandlerFunc, path string, headers map[string]string, body []byte, expCode int) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		w.Body = &bytes.Buffer{}
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		h(w, r)
+		if w.Code != expCode {
+			t.Fatalf("got code %d, expected %d, body %q", w.Code, expCode, w.Body.String())
+		}
+	}
+
+	testEnv(t)
+	api := Ding{}
+
+	repo := Repo{
+		Name:          "prtest",
+		VCS:           VCSCommand,
+		Origin:        "sh -c 'echo clone $DING_BRANCH $DING_PULLREQUEST_SOURCE; mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'",
+		DefaultBranch: "main",
+		CheckoutPath:  "prtest",
+		// Secrets are not available to pull request builds.
+		BuildScript: "#!/usr/bin/env bash\nset -e\ntest \"$DING_PULLREQUEST\" = 3 -o -z \"$DING_PULLREQUEST\"\ntest -z \"$DING_PULLREQUEST\" -o -z \"$TOKEN\"\n",
+	}
+	repo = api.RepoCreate(ctxbg, config.Password, repo)
+	api.SecretSave(ctxbg, config.Password, repo.Name, "TOKEN", "secret1234", false)
+
+	// Wait for the most recent build. Older builds may be removed by the cleanup.
+	waitLast := func() {
+		t.Helper()
+		twaitBuild(t, api.Builds(ctxbg, config.Password, repo.Name)[0], StatusSuccess)
+	}
+
+	githubPR := func(action string, number int32, sha string) []byte {
+		var ev githubPullRequestEvent
+		ev.Action = action
+		ev.Number = number
+		ev.PullRequest.Head.Ref = "feature"
+		ev.PullRequest.Head.SHA = sha
+		ev.PullRequest.Base.Ref = "main"
+		return toJSON(ev)
+	}
+	githubHeaders := func(event string, body []byte) map[string]string {
+		return map[string]string{
+			"X-GitHub-Event":  event,
+			"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, body)),
+		}
+	}
+
+	// Regular branch build.
+	ghpush := githubEvent{Ref: "refs/heads/main", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}
+	pushBody := toJSON(ghpush)
+	testHook(githubHookHandler, "/github/prtest", githubHeaders("push", pushBody), pushBody, http.StatusNoContent)
+	waitLast()
+
+	body := githubPR("opened", 3, "1111111111111111111111111111111111111111")
+	testHook(githubHookHandler, "/github/prtest", githubHeaders("pull_request", body), body, http.StatusNoContent)
+	waitLast()
+
+	builds := api.Builds(ctxbg, config.Password, repo.Name)
+	tcompare(t, len(builds), 2)
+	b := builds[0]
+	tcompare(t, b.Branch, "pull/3")
+	tcompare(t, b.CommitHash, "1111111111111111111111111111111111111111")
+	tcompare(t, b.PullRequest, int32(3))
+	tcompare(t, b.PullRequestSource, "feature")
+	tcompare(t, b.PullRequestTarget, "main")
+	tcompare(t, builds[1].PullRequest, int32(0))
+
+	// No build when pull request is closed.
+	body = githubPR("closed", 3, "1111111111111111111111111111111111111111")
+	testHook(githubHookHandler, "/github/prtest", githubHeaders("pull_request", body), body, http.StatusNoContent)
+	// Bad pull request number.
+	body = githubPR("opened", 0, "1111111111111111111111111111111111111111")
+	testHook(githubHookHandler, "/github/prtest", githubHeaders("pull_request", body), body, http.StatusBadRequest)
+	tcompare(t, len(api.Builds(ctxbg, config.Password, repo.Name)), 2)
+
+	// Gitea merge request with new commits.
+	var gtev giteaPullRequestEvent
+	gtev.Action = "synchronized"
+	gtev.Number = 3
+	gtev.PullRequest.Head.Ref = "other"
+	gtev.PullRequest.Head.SHA = "2222222222222222222222222222222222222222"
+	gtev.PullRequest.Base.Ref = "main"
+	body = toJSON(gtev)
+	testHook(giteaHookHandler, "/gitea/prtest", map[string]string{"X-Gitea-Event": "pull_request", "Authorization": "Bearer " + repo.WebhookSecret}, body, http.StatusNoContent)
+	waitLast()
+	b = api.Builds(ctxbg, config.Password, repo.Name)[0]
+	tcompare(t, b.Branch, "pull/3")
+	tcompare(t, b.PullRequestSource, "other")
+
+	// Pull request builds are separate from branch builds.
+	rbl := api.RepoBuilds(ctxbg, config.Password)
+	tcompare(t, len(rbl), 1)
+	tcompare(t, len(rbl[0].Builds), 1)
+	tcompare(t, rbl[0].Builds[0].Branch, "main")
+	tcompare(t, len(rbl[0].PullRequestBuilds), 1)
+	tcompare(t, rbl[0].PullRequestBuilds[0].ID, b.ID)
+
+	// Only the 3 most recent builds of a pull request are kept.
+	for _, sha := range []string{"3333333333333333333333333333333333333333", "4444444444444444444444444444444444444444"} {
+		body = githubPR("synchronize", 3, sha)
+		testHook(githubHookHandler, "/github/prtest", githubHeaders("pull_request", body), body, http.StatusNoContent)
+		waitLast()
+	}
+	var prBuilds int
+	for _, b := range api.Builds(ctxbg, config.Password, repo.Name) {
+		if b.PullRequest != 0 {
+			prBuilds++
+		}
+	}
+	tcompare(t, prBuilds, 3)
+}
+
+func TestWebhookFilters(t *testing.T) {
+	testHook := func(h http.HandlerFunc, path string, headers map[string]string, body []byte, expCode int, expBody string) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		w.Body = &bytes.Buffer{}
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		h(w, r)
+		if w.Code != expCode {
+			t.Fatalf("got code %d, expected %d, body %q", w.Code, expCode, w.Body.String())
+		}
+		tcompare(t, w.Body.String(), expBody)
+	}
+
+	testEnv(t)
+	api := Ding{}
+
+	repo := Repo{
+		Name:          "filtertest",
+		VCS:           VCSCommand,
+		Origin:        "sh -c 'mkdir -p checkout/$DING_CHECKOUTPATH; echo commit: ...'",
+		DefaultBranch: "main",
+		CheckoutPath:  "filtertest",
+		BuildScript:   "#!/usr/bin/env bash\necho build...\n",
+	}
+	repo = api.RepoCreate(ctxbg, config.Password, repo)
+
+	repo.ExcludeBranches = []string{"["}
+	tneederr(t, "user:error", func() { api.RepoSave(ctxbg, config.Password, repo) })
+	repo.ExcludeBranches = []string{"wip/*", "dependabot/*"}
+	repo.IncludeTags = []string{"v*"}
+	repo = api.RepoSave(ctxbg, config.Password, repo)
+
+	github := func(event string, v any, expCode int, expBody string) {
+		t.Helper()
+		body := toJSON(v)
+		headers := map[string]string{
+			"X-GitHub-Event":  event,
+			"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, body)),
+		}
+		testHook(githubHookHandler, "/github/filtertest", headers, body, expCode, expBody)
+	}
+	github("push", githubEvent{Ref: "refs/heads/wip/x", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}, http.StatusOK, "push ignored: branch \"wip/x\" matches exclude pattern \"wip/*\"\n")
+	github("push", githubEvent{Ref: "refs/tags/other", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}, http.StatusOK, "push ignored: tag \"other\" does not match include patterns\n")
+	github("push", githubEvent{Ref: "refs/tags/v1.0.0", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}, http.StatusNoContent, "")
+	github("push", githubEvent{Ref: "refs/heads/main", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}, http.StatusNoContent, "")
+
+	var prev githubPullRequestEvent
+	prev.Action = "opened"
+	prev.Number = 1
+	prev.PullRequest.Head.Ref = "dependabot/go_modules"
+	prev.PullRequest.Head.SHA = "1111111111111111111111111111111111111111"
+	prev.PullRequest.Base.Ref = "main"
+	github("pull_request", prev, http.StatusOK, "push ignored: branch \"dependabot/go_modules\" matches exclude pattern \"dependabot/*\"\n")
+
+	gtevent := giteaEvent{Ref: "refs/heads/wip/y", After: "e8dab6168e75a88346bc0d2b95ea8227552debf2"}
+	testHook(giteaHookHandler, "/gitea/filtertest", map[string]string{"Authorization": "Bearer " + repo.WebhookSecret}, toJSON(gtevent), http.StatusOK, "push ignored: branch \"wip/y\" matches exclude pattern \"wip/*\"\n")
+
+	// Bitbucket can have multiple changes in a push, the ignored ones are reported.
+	bitbucketBody := []byte(`
+{
+	"repository": {
+		"name": "filtertest",
+		"scm": "git"
+	},
+	"push": {
+		"changes": [
+			{"new": {"target": {"type": "commit", "hash": "e8dab6168e75a88346bc0d2b95ea8227552debf2"}, "name": "wip/z", "type": "branch"}},
+			{"new": {"target": {"type": "commit", "hash": "e8dab6168e75a88346bc0d2b95ea8227552debf2"}, "name": "dev", "type": "branch"}}
+		]
+	}
+}`)
+	testHook(bitbucketHookHandler, "/bitbucket/filtertest/"+repo.WebhookSecret, nil, bitbucketBody, http.StatusOK, "push ignored: branch \"wip/z\" matches exclude pattern \"wip/*\"\n")
+
+	builds := api.Builds(ctxbg, config.Password, repo.Name)
+	tcompare(t, len(builds), 3)
+	for _, b := range builds {
+		twaitBuild(t, b, StatusSuccess)
+	}
+}
+
+func TestWebhookTag(t *testing.T) {
+	testHook := func(h http.HandlerFunc, path string, headers map[string]string, body []byte, expCode int) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		w.Body = &bytes.Buffer{}
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		h(w, r)
+		if w.Code != expCode {
+			t.Fatalf("got code %d, expected %d, body %q", w.Code, expCode, w.Body.String())
+		}
+	}
+
+	testEnv(t)
+	api := Ding{}
+
+	gitRepoDir := testGitRepo(t, "tag")
+	testGitCommit(t, gitRepoDir, "touch", "file.txt")
+	testRun(t, gitRepoDir, "git", "tag", "-a", "-m", "release", "v1.0.0")
+	// Work on main continues after the tag.
+	testGitCommit(t, gitRepoDir)
+	tagObject := testRun(t, gitRepoDir, "git", "rev-parse", "v1.0.0")
+	tagCommit := testRun(t, gitRepoDir, "git", "rev-parse", "v1.0.0^{commit}")
+
+	repo := Repo{
+		Name:          "tagtest",
+		VCS:           VCSGit,
+		Origin:        gitRepoDir,
+		DefaultBranch: "main",
+		CheckoutPath:  "tagtest",
+		BuildScript:   "#!/usr/bin/env bash\nset -e\ntest \"$DING_BRANCH\" = \"tags/$DING_TAG\"\necho hi >result.txt\necho release: tagtest linux amd64 toolchain1 result.txt\n",
+		ReleaseTags:   true,
+	}
+	repo = api.RepoCreate(ctxbg, config.Password, repo)
+
+	github := func(event githubEvent) {
+		t.Helper()
+		body := toJSON(event)
+		testHook(githubHookHandler, "/github/tagtest", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, body))}, body, http.StatusNoContent)
+	}
+
+	// For an annotated tag, "after" is the tag object. The build is for the commit.
+	github(githubEvent{Ref: "refs/tags/v1.0.0", After: tagObject})
+	b := api.Builds(ctxbg, config.Password, repo.Name)[0]
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, repo.Name, b.ID)
+	tcompare(t, b.Branch, "tags/v1.0.0")
+	tcompare(t, b.RefType, RefTag)
+	tcompare(t, b.Tag, "v1.0.0")
+	tcompare(t, b.CommitHash, tagCommit)
+	if b.Released == nil {
+		t.Fatalf("tag build not released")
+	}
+	_, err := os.Stat(fmt.Sprintf("%s/release/%s/%d/result.txt.gz", dingDataDir, repo.Name, b.ID))
+	tcheck(t, err, "stat released file")
+
+	// Removing a tag does not start a build.
+	github(githubEvent{Ref: "refs/tags/v1.0.0", Before: tagObject, After: "0000000000000000000000000000000000000000"})
+	tcompare(t, len(api.Builds(ctxbg, config.Password, repo.Name)), 1)
+
+	// Bitbucket, without automatic release.
+	repo.ReleaseTags = false
+	repo = api.RepoSave(ctxbg, config.Password, repo)
+	bitbucketBody := []byte(fmt.Sprintf(`
+{
+	"repository": {
+		"name": "tagtest",
+		"scm": "git"
+	},
+	"push": {
+		"changes": [
+			{"new": {"target": {"type": "commit", "hash": "%s"}, "name": "v1.0.0", "type": "tag"}}
+		]
+	}
+}`, tagCommit))
+	testHook(bitbucketHookHandler, "/bitbucket/tagtest/"+repo.WebhookSecret, nil, bitbucketBody, http.StatusNoContent)
+	b = api.Builds(ctxbg, config.Password, repo.Name)[0]
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, repo.Name, b.ID)
+	tcompare(t, b.Branch, "tags/v1.0.0")
+	tcompare(t, b.CommitHash, tagCommit)
+	if b.Released != nil {
+		t.Fatalf("tag build released without ReleaseTags")
+	}
+
+	// Branch builds are not released, and don't get a tag.
+	repo.ReleaseTags = true
+	repo.BuildScript = "#!/usr/bin/env bash\nset -e\ntest -z \"$DING_TAG\"\n"
+	repo = api.RepoSave(ctxbg, config.Password, repo)
+	b = api.BuildCreate(ctxbg, config.Password, repo.Name, "main", "", false, nil)
+	twaitBuild(t, b, StatusSuccess)
+	b = api.Build(ctxbg, config.Password, repo.Name, b.ID)
+	tcompare(t, b.RefType, RefBranch)
+	if b.Released != nil {
+		t.Fatalf("branch build released")
+	}
+
+	tneederr(t, "user:error", func() { api.BuildCreate(ctxbg, config.Password, repo.Name, "tags/", "", false, nil) })
+}
+
+func TestWebhookPushCommits(t *testing.T) {
+	testHook := func(h http.HandlerFunc, path string, headers map[string]string, body []byte, expCode int) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		w.Body = &bytes.Buffer{}
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		h(w, r)
+		if w.Code != expCode {
+			t.Fatalf("got code %d, expected %d, body %q", w.Code, expCode, w.Body.String())
+		}
+	}
+
+	testEnv(t)
+	api := Ding{}
+
+	gitRepoDir := testGitRepo(t, "push")
+	commits := []string{
+		testGitCommit(t, gitRepoDir, "true"),
+		testGitCommit(t, gitRepoDir, "touch", "broken"),
+		testGitCommit(t, gitRepoDir, "rm", "broken"),
+		testGitCommit(t, gitRepoDir, "true"),
+	}
+
+	repo := Repo{
+		Name:          "pushtest",
+		VCS:           VCSGit,
+		Origin:        gitRepoDir,
+		DefaultBranch: "main",
+		CheckoutPath:  "pushtest",
+		BuildScript:   "#!/usr/bin/env bash\nset -e\ntest ! -f broken\n",
+	}
+	repo = api.RepoCreate(ctxbg, config.Password, repo)
+
+	repo.PushCommitBuilds = 21
+	tneederr(t, "user:error", func() { api.RepoSave(ctxbg, config.Password, repo) })
+	repo.PushCommitBuilds = 2
+	repo = api.RepoSave(ctxbg, config.Password, repo)
+
+	github := func(event githubEvent) {
+		t.Helper()
+		body := toJSON(event)
+		testHook(githubHookHandler, "/github/pushtest", map[string]string{"X-Hub-Signature": fmt.Sprintf("sha1=%x", hmacsha1(repo.WebhookSecret, body))}, body, http.StatusNoContent)
+	}
+
+	// Only the last 2 commits before the head are built, in addition to the head.
+	var pushCommits []webhookCommit
+	for _, c := range commits[1:] {
+		pushCommits = append(pushCommits, webhookCommit{ID: c})
+	}
+	github(githubEvent{Ref: "refs/heads/main", Before: commits[0], After: commits[3], Commits: pushCommits})
+	builds := api.Builds(ctxbg, config.Password, repo.Name)
+	tcompare(t, len(builds), 3)
+	head := builds[len(builds)-1]
+	tcompare(t, head.CommitHash, commits[3])
+	tcompare(t, head.LowPrio, false)
+	tcompare(t, head.PushBuildID, head.ID)
+	tcompare(t, head.PushPosition, int32(3))
+
+	pushBuilds := api.PushBuilds(ctxbg, config.Password, repo.Name, builds[0].ID)
+	tcompare(t, len(pushBuilds), 3)
+	for i, b := range pushBuilds {
+		tcompare(t, b.CommitHash, commits[i+1])
+		tcompare(t, b.PushBuildID, head.ID)
+		tcompare(t, b.PushPosition, int32(i+1))
+		tcompare(t, b.LowPrio, i < 2)
+	}
+	twaitBuild(t, pushBuilds[0], StatusBuild)
+	twaitBuild(t, pushBuilds[1], StatusSuccess)
+	twaitBuild(t, pushBuilds[2], StatusSuccess)
+
+	// The builds of the earlier commits are not the latest of the branch.
+	for _, rb := range api.RepoBuilds(ctxbg, config.Password) {
+		if rb.Repo.Name == repo.Name {
+			tcompare(t, len(rb.Builds), 1)
+			tcompare(t, rb.Builds[0].ID, head.ID)
+		}
+	}
+
+	// A push with a single commit is not part of a push with earlier builds.
+	github(githubEvent{Ref: "refs/heads/main", Before: commits[2], After: commits[3], Commits: pushCommits[2:]})
+	b := api.Builds(ctxbg, config.Password, repo.Name)[0]
+	tcompare(t, b.PushBuildID, int32(0))
+	tcompare(t, len(api.PushBuilds(ctxbg, config.Password, repo.Name, b.ID)), 0)
+	twaitBuild(t, b, StatusSuccess)
+}